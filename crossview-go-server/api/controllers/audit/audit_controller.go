@@ -0,0 +1,122 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// AuditController serves the audit log to admins.
+type AuditController struct {
+	logger    lib.Logger
+	auditRepo *models.AuditRepository
+}
+
+func NewAuditController(logger lib.Logger, db lib.Database) AuditController {
+	return AuditController{
+		logger:    logger,
+		auditRepo: models.NewAuditRepository(db.DB),
+	}
+}
+
+// parseFilter reads the audit filter from the query string. since and until
+// are RFC 3339 times.
+func parseFilter(ctx *gin.Context) (models.AuditFilter, bool) {
+	filter := models.AuditFilter{
+		Actor:     ctx.Query("actor"),
+		Action:    ctx.Query("action"),
+		Target:    ctx.Query("target"),
+		Context:   ctx.Query("context"),
+		Outcome:   ctx.Query("outcome"),
+		RequestID: ctx.Query("requestId"),
+	}
+	if value := ctx.Query("actorId"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actorId"})
+			return filter, false
+		}
+		filter.ActorID = uint(id)
+	}
+	for name, field := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := ctx.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": name + " must be an RFC 3339 time"})
+			return filter, false
+		}
+		*field = parsed
+	}
+	return filter, true
+}
+
+// GetEvents returns a page of the audit log, newest first.
+func (c *AuditController) GetEvents(ctx *gin.Context) {
+	filter, ok := parseFilter(ctx)
+	if !ok {
+		return
+	}
+
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+		return
+	}
+	pageSize, err := strconv.Atoi(ctx.DefaultQuery("pageSize", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "pageSize must be between 1 and " + strconv.Itoa(maxPageSize)})
+		return
+	}
+
+	events, total, err := c.auditRepo.Find(filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.logger.Error("Failed to get audit events: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get audit events"})
+		return
+	}
+	if events == nil {
+		events = []models.AuditEvent{}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"events":   events,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// ExportEvents streams every matching event as JSON lines, oldest first.
+func (c *AuditController) ExportEvents(ctx *gin.Context) {
+	filter, ok := parseFilter(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("Content-Disposition", `attachment; filename="audit-`+time.Now().UTC().Format("20060102T150405Z")+`.jsonl"`)
+	ctx.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(ctx.Writer)
+	err := c.auditRepo.Each(filter, func(event *models.AuditEvent) error {
+		return encoder.Encode(event)
+	})
+	if err != nil {
+		// The status has been sent, so all that can be done is to stop.
+		c.logger.Error("Failed to export audit events: " + err.Error())
+	}
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAuditControllerTest(t *testing.T) (*gin.Engine, *models.AuditRepository) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.AuditEvent{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	controller := NewAuditController(lib.GetLogger(), lib.Database{DB: db})
+	router := gin.New()
+	router.GET("/api/audit", controller.GetEvents)
+	router.GET("/api/audit/export", controller.ExportEvents)
+	return router, models.NewAuditRepository(db)
+}
+
+func get(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func createEvents(t *testing.T, repo *models.AuditRepository, count int, actor string) {
+	for i := 0; i < count; i++ {
+		if err := repo.Create(&models.AuditEvent{Actor: actor, Action: "user.update", Outcome: models.AuditSuccess}); err != nil {
+			t.Fatalf("Failed to create event: %v", err)
+		}
+	}
+}
+
+func TestAuditController_GetEvents(t *testing.T) {
+	router, repo := setupAuditControllerTest(t)
+	createEvents(t, repo, 3, "alice")
+	createEvents(t, repo, 2, "bob")
+
+	w := get(router, "/api/audit?actor=alice&page=2&pageSize=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var response struct {
+		Events   []models.AuditEvent `json:"events"`
+		Total    int64               `json:"total"`
+		Page     int                 `json:"page"`
+		PageSize int                 `json:"pageSize"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Total != 3 || len(response.Events) != 1 || response.Page != 2 || response.PageSize != 2 {
+		t.Errorf("Unexpected page: %+v", response)
+	}
+	if response.Events[0].Actor != "alice" {
+		t.Errorf("Expected only alice's events, got %+v", response.Events)
+	}
+
+	since := time.Now().Add(time.Hour).Format(time.RFC3339)
+	w = get(router, "/api/audit?since="+since)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Total != 0 || response.Events == nil {
+		t.Errorf("Expected an empty list, got %s", w.Body.String())
+	}
+}
+
+func TestAuditController_GetEvents_InvalidQuery(t *testing.T) {
+	router, _ := setupAuditControllerTest(t)
+
+	for _, query := range []string{"page=0", "pageSize=501", "since=yesterday", "actorId=x"} {
+		if w := get(router, "/api/audit?"+query); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got status %d", query, w.Code)
+		}
+	}
+}
+
+func TestAuditController_ExportEvents(t *testing.T) {
+	router, repo := setupAuditControllerTest(t)
+	createEvents(t, repo, 3, "alice")
+	createEvents(t, repo, 1, "bob")
+
+	w := get(router, "/api/audit/export?actor=alice")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Unexpected response: status %d, content type %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;") {
+		t.Errorf("Expected a download, got '%s'", w.Header().Get("Content-Disposition"))
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || event.Actor != "alice" {
+			t.Errorf("Unexpected line '%s' (%v)", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Errorf("Expected 3 lines, got %d", lines)
+	}
+}
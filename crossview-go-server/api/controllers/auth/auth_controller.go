@@ -2,27 +2,49 @@ package auth
 
 import (
 	"crypto/rand"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"crossview-go-server/api/middlewares"
 	"crossview-go-server/lib"
 	"crossview-go-server/models"
+	"crossview-go-server/services"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// Session keys holding a login that is waiting for its two-factor code.
+	mfaPendingUserKey = middlewares.MFAPendingUserKey
+	mfaPendingAtKey   = "mfaPendingAt"
+
+	// mfaLoginTimeout is how long the user has to enter the code.
+	mfaLoginTimeout = 5 * time.Minute
+)
+
 type AuthController struct {
-	logger   lib.Logger
-	userRepo *models.UserRepository
-	env      lib.Env
+	logger      lib.Logger
+	userRepo    *models.UserRepository
+	sessionRepo *models.SessionRepository
+	mfaRepo     *models.MFARepository
+	ssoService  services.SSOServiceInterface
+	throttle    *loginThrottle
+	env         lib.Env
 }
 
-func NewAuthController(logger lib.Logger, db lib.Database, env lib.Env) AuthController {
+func NewAuthController(logger lib.Logger, db lib.Database, env lib.Env, ssoService services.SSOServiceInterface) AuthController {
 	userRepo := models.NewUserRepository(db.DB)
 	return AuthController{
-		logger:   logger,
-		userRepo: userRepo,
-		env:      env,
+		logger:      logger,
+		userRepo:    userRepo,
+		sessionRepo: models.NewSessionRepository(db.DB),
+		mfaRepo:     models.NewMFARepository(db.DB),
+		ssoService:  ssoService,
+		throttle:    newLoginThrottle(env),
+		env:         env,
 	}
 }
 
@@ -105,7 +127,12 @@ func (c *AuthController) Check(ctx *gin.Context) {
 	default:
 		session := sessions.Default(ctx)
 		userID := session.Get("userId")
-		if userID == nil {
+		sessionID, _ := session.Get("sessionId").(string)
+		if userID == nil || sessionID == "" {
+			ctx.JSON(http.StatusOK, unauthenticated)
+			return
+		}
+		if record, err := c.sessionRepo.Validate(sessionID, c.env.SessionIdleTimeout, c.env.SessionAbsoluteTimeout); err != nil || record == nil {
 			ctx.JSON(http.StatusOK, unauthenticated)
 			return
 		}
@@ -139,27 +166,53 @@ func (c *AuthController) Login(ctx *gin.Context) {
 		return
 	}
 
+	now := time.Now()
+	ip := ctx.ClientIP()
+	if wait := c.throttle.ipAttempt(ip, now); wait > 0 {
+		auditLogin(ctx, "auth.login", req.Username, nil, models.AuditDenied, "Too many failed logins from this address")
+		c.tooManyAttempts(ctx, wait)
+		return
+	}
+
 	user, err := c.userRepo.FindByUsername(req.Username)
 	if err != nil || user == nil {
+		if wait := c.throttle.usernameAttempt(req.Username, now); wait > 0 {
+			auditLogin(ctx, "auth.login", req.Username, nil, models.AuditDenied, "Too many failed logins for this username")
+			c.tooManyAttempts(ctx, wait)
+			return
+		}
+		auditLogin(ctx, "auth.login", req.Username, nil, models.AuditFailure, "Unknown user")
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	// While throttled the password is not even checked, so guesses made
+	// during the wait learn nothing.
+	if wait := c.throttle.userRetryAfter(user, now); wait > 0 {
+		auditLogin(ctx, "auth.login", req.Username, user, models.AuditDenied, "Account locked or throttled")
+		c.tooManyAttempts(ctx, wait)
+		return
+	}
+
 	if !user.VerifyPassword(req.Password) {
+		c.recordFailure(user, ip, now)
+		auditLogin(ctx, "auth.login", req.Username, user, models.AuditFailure, "Wrong password")
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	c.throttle.ipSucceeded(ip)
 
-	session := sessions.Default(ctx)
-	session.Set("userId", user.ID)
-	session.Set("userRole", user.Role)
-	if err := session.Save(); err != nil {
-		c.logger.Error("Failed to save session: " + err.Error())
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+	// Failures are only cleared once the whole login succeeds, so that a
+	// known password can't be used to reset the count between code guesses.
+	if user.MFAEnabled || models.MFARequired(c.env.MFARequiredRoles, user.Role) {
+		c.startMFALogin(ctx, user, now)
 		return
 	}
 
-	c.logger.Infof("User logged in successfully: userId=%d, username=%s, role=%s", user.ID, user.Username, user.Role)
+	if !c.completeLogin(ctx, user, now) {
+		return
+	}
+	auditLogin(ctx, "auth.login", user.Username, user, models.AuditSuccess, "")
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
@@ -171,8 +224,210 @@ func (c *AuthController) Login(ctx *gin.Context) {
 	})
 }
 
+// startMFALogin holds back a login whose password was right until the user
+// enters a code with LoginMFA. A user whose role requires MFA but who has
+// not enrolled is given a new secret to enroll with in the same step.
+func (c *AuthController) startMFALogin(ctx *gin.Context, user *models.User, now time.Time) {
+	response := gin.H{"mfaRequired": true}
+	if !user.MFAEnabled {
+		enrollment, err := c.mfaRepo.StartEnrollment(user, c.env.MFAIssuer)
+		if err != nil {
+			c.logger.Error("Failed to start two-factor enrollment: " + err.Error())
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrollment"})
+			return
+		}
+		response["mfaEnrollment"] = enrollment
+	}
+
+	session := sessions.Default(ctx)
+	session.Set(mfaPendingUserKey, user.ID)
+	session.Set(mfaPendingAtKey, now.Unix())
+	if err := session.Save(); err != nil {
+		c.logger.Error("Failed to save session: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	auditLogin(ctx, "auth.login", user.Username, user, models.AuditSuccess, "Waiting for two-factor code")
+	ctx.JSON(http.StatusOK, response)
+}
+
+// LoginMFA is the second step of a login with two-factor authentication.
+// It takes a code from the user's authenticator app or one of their
+// recovery codes. A user enrolling during login gets their recovery codes
+// in the response.
+func (c *AuthController) LoginMFA(ctx *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return
+	}
+
+	now := time.Now()
+	session := sessions.Default(ctx)
+	userID, _ := session.Get(mfaPendingUserKey).(uint)
+	startedAt, _ := session.Get(mfaPendingAtKey).(int64)
+	if userID == 0 || now.Sub(time.Unix(startedAt, 0)) > mfaLoginTimeout {
+		auditLogin(ctx, "auth.login_mfa", "", nil, models.AuditDenied, "No login waiting for a code")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired. Please sign in again."})
+		return
+	}
+
+	ip := ctx.ClientIP()
+	if wait := c.throttle.ipAttempt(ip, now); wait > 0 {
+		auditLogin(ctx, "auth.login_mfa", "", nil, models.AuditDenied, "Too many failed logins from this address")
+		c.tooManyAttempts(ctx, wait)
+		return
+	}
+
+	user, err := c.userRepo.FindByID(userID)
+	if err != nil || user == nil {
+		auditLogin(ctx, "auth.login_mfa", "", nil, models.AuditDenied, "No login waiting for a code")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired. Please sign in again."})
+		return
+	}
+
+	if wait := c.throttle.userRetryAfter(user, now); wait > 0 {
+		auditLogin(ctx, "auth.login_mfa", user.Username, user, models.AuditDenied, "Account locked or throttled")
+		c.tooManyAttempts(ctx, wait)
+		return
+	}
+
+	valid, err := c.mfaRepo.VerifyCode(user, req.Code, now)
+	if err != nil {
+		c.logger.Error("Failed to verify two-factor code: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if !valid {
+		c.recordFailure(user, ip, now)
+		auditLogin(ctx, "auth.login_mfa", user.Username, user, models.AuditFailure, "Wrong code")
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	c.throttle.ipSucceeded(ip)
+
+	response := gin.H{}
+	if !user.MFAEnabled {
+		recoveryCodes, err := c.mfaRepo.Enable(user)
+		if err != nil {
+			c.logger.Error("Failed to enable two-factor authentication: " + err.Error())
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+			return
+		}
+		c.logger.Infof("Two-factor authentication enabled at login: userId=%d, username=%s", user.ID, user.Username)
+		auditLogin(ctx, "mfa.enable", user.Username, user, models.AuditSuccess, "")
+		response["recoveryCodes"] = recoveryCodes
+	}
+
+	if !c.completeLogin(ctx, user, now) {
+		return
+	}
+	auditLogin(ctx, "auth.login_mfa", user.Username, user, models.AuditSuccess, "")
+
+	response["user"] = gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// recordFailure counts a wrong password or code against the user. The
+// client IP's attempt was already counted by ipAttempt.
+func (c *AuthController) recordFailure(user *models.User, ip string, now time.Time) {
+	if err := c.userRepo.RecordLoginFailure(user, now, c.throttle.lockout, c.throttle.maxAttempts); err != nil {
+		c.logger.Error("Failed to record failed login: " + err.Error())
+	}
+	if user.LockedUntil != nil {
+		c.logger.Warnf("User locked out after %d failed logins: userId=%d, username=%s, ip=%s", user.FailedLoginCount, user.ID, user.Username, ip)
+	}
+}
+
+// completeLogin clears the user's failed logins and starts their session.
+// It responds with an error and returns false if the session can't be
+// started.
+func (c *AuthController) completeLogin(ctx *gin.Context, user *models.User, now time.Time) bool {
+	recordUserLogin(user, now)
+	if err := c.userRepo.UpdateLoginState(user); err != nil {
+		c.logger.Error("Failed to record login: " + err.Error())
+	}
+
+	if err := c.startSession(ctx, user); err != nil {
+		c.logger.Error("Failed to save session: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return false
+	}
+
+	c.logger.Infof("User logged in successfully: userId=%d, username=%s, role=%s", user.ID, user.Username, user.Role)
+	return true
+}
+
+// auditLogin records a step of a login by username. user is nil if the
+// username is unknown.
+func auditLogin(ctx *gin.Context, action, username string, user *models.User, outcome, details string) {
+	event := &models.AuditEvent{Action: action, Actor: username, Outcome: outcome, Details: details}
+	if user != nil {
+		event.ActorID = &user.ID
+		event.Target = models.UserTarget(user.ID)
+	}
+	middlewares.Audit(ctx, event)
+}
+
+// tooManyAttempts refuses a throttled login attempt, telling the client
+// when to try again.
+func (c *AuthController) tooManyAttempts(ctx *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	ctx.Header("Retry-After", strconv.Itoa(seconds))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "Too many failed login attempts. Try again later.",
+		"retryAfter": seconds,
+	})
+}
+
+// startSession records a password login in the session registry and puts
+// it in the user's session.
+func (c *AuthController) startSession(ctx *gin.Context, user *models.User) error {
+	record := &models.UserSession{UserID: user.ID, Provider: "local"}
+	if err := c.sessionRepo.Create(record); err != nil {
+		return err
+	}
+	session := sessions.Default(ctx)
+	session.Set("sessionId", record.ID)
+	session.Set("userId", user.ID)
+	session.Set("userRole", user.Role)
+	session.Delete("userGroups")
+	session.Delete(mfaPendingUserKey)
+	session.Delete(mfaPendingAtKey)
+	return session.Save()
+}
+
+// Logout ends the session. For an OIDC login the response also carries
+// logoutUrl, the IdP's end-session URL the browser should be sent to so the
+// user is logged out there as well.
 func (c *AuthController) Logout(ctx *gin.Context) {
 	session := sessions.Default(ctx)
+	userID, _ := session.Get("userId").(uint)
+	var logoutURL string
+	if sessionID, _ := session.Get("sessionId").(string); sessionID != "" {
+		record, _ := c.sessionRepo.FindByID(sessionID)
+		if err := c.sessionRepo.Delete(sessionID); err != nil {
+			c.logger.Error("Failed to end session: " + err.Error())
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+		if record != nil {
+			var err error
+			logoutURL, err = c.ssoService.OIDCLogoutURL(ctx.Request.Context(), record, c.env.CORSOrigin+"/login")
+			if err != nil {
+				c.logger.Warnf("Failed to build OIDC logout URL: %s", err.Error())
+			}
+		}
+	}
+
 	session.Clear()
 	if err := session.Save(); err != nil {
 		c.logger.Error("Failed to clear session: " + err.Error())
@@ -180,7 +435,18 @@ func (c *AuthController) Logout(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"success": true})
+	event := &models.AuditEvent{Action: "auth.logout"}
+	if userID != 0 {
+		event.ActorID = &userID
+		event.Target = models.UserTarget(userID)
+	}
+	middlewares.Audit(ctx, event)
+
+	response := gin.H{"success": true}
+	if logoutURL != "" {
+		response["logoutUrl"] = logoutURL
+	}
+	ctx.JSON(http.StatusOK, response)
 }
 
 func (c *AuthController) Register(ctx *gin.Context) {
@@ -231,14 +497,17 @@ func (c *AuthController) Register(ctx *gin.Context) {
 		return
 	}
 
-	session := sessions.Default(ctx)
-	session.Set("userId", user.ID)
-	session.Set("userRole", user.Role)
-	if err := session.Save(); err != nil {
-		c.logger.Error("Failed to save session: " + err.Error())
+	c.logger.Infof("User registered successfully: userId=%d, username=%s, email=%s, role=%s", user.ID, user.Username, user.Email, user.Role)
+	auditLogin(ctx, "auth.register", user.Username, user, models.AuditSuccess, "")
+
+	if models.MFARequired(c.env.MFARequiredRoles, user.Role) {
+		c.startMFALogin(ctx, user, time.Now())
+		return
 	}
 
-	c.logger.Infof("User registered successfully: userId=%d, username=%s, email=%s, role=%s", user.ID, user.Username, user.Email, user.Role)
+	if err := c.startSession(ctx, user); err != nil {
+		c.logger.Error("Failed to save session: " + err.Error())
+	}
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
@@ -7,7 +7,9 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"crossview-go-server/api/middlewares"
 	"crossview-go-server/lib"
+	"crossview-go-server/models"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -21,7 +23,7 @@ func TestAuthController_Check_NotAuthenticated(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.GET("/api/auth/check", controller.Check)
 
@@ -52,11 +54,13 @@ func TestAuthController_Check_Authenticated(t *testing.T) {
 	logger := setupTestLogger()
 
 	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+	record := createTestSession(t, db, user.ID, "local")
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.GET("/api/auth/check", func(c *gin.Context) {
 		session := sessions.Default(c)
+		session.Set("sessionId", record.ID)
 		session.Set("userId", user.ID)
 		session.Set("userRole", user.Role)
 		session.Save()
@@ -98,7 +102,7 @@ func TestAuthController_Check_InvalidSession(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.GET("/api/auth/check", func(c *gin.Context) {
 		session := sessions.Default(c)
@@ -125,6 +129,44 @@ func TestAuthController_Check_InvalidSession(t *testing.T) {
 	}
 }
 
+func TestAuthController_Check_EndedSession(t *testing.T) {
+	router := setupTestRouter()
+	store := setupTestSessionStore()
+	router.Use(sessions.Sessions("session", store))
+
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+
+	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+	record := createTestSession(t, db, user.ID, "oidc:default")
+	if _, err := models.NewSessionRepository(db).DeleteByUserID(user.ID); err != nil {
+		t.Fatalf("Failed to end session: %v", err)
+	}
+
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
+
+	router.GET("/api/auth/check", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("sessionId", record.ID)
+		session.Set("userId", user.ID)
+		session.Save()
+		controller.Check(c)
+	})
+
+	req, _ := http.NewRequest("GET", "/api/auth/check", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if authenticated, ok := response["authenticated"].(bool); !ok || authenticated {
+		t.Error("Expected authenticated to be false for an ended session")
+	}
+}
+
 func TestAuthController_Login_Success(t *testing.T) {
 	router := setupTestRouter()
 	store := setupTestSessionStore()
@@ -135,7 +177,7 @@ func TestAuthController_Login_Success(t *testing.T) {
 
 	createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/login", controller.Login)
 
@@ -179,7 +221,7 @@ func TestAuthController_Login_InvalidCredentials(t *testing.T) {
 
 	createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/login", controller.Login)
 
@@ -207,7 +249,7 @@ func TestAuthController_Login_MissingFields(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/login", controller.Login)
 
@@ -234,7 +276,7 @@ func TestAuthController_Login_UserNotFound(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/login", controller.Login)
 
@@ -254,6 +296,38 @@ func TestAuthController_Login_UserNotFound(t *testing.T) {
 	}
 }
 
+func TestAuthController_Login_Audited(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	audit := middlewares.NewAuditMiddleware(lib.NewRequestHandler(logger, setupTestEnv()), logger, lib.Database{DB: db})
+
+	router := setupTestRouter()
+	router.Use(audit.Handler())
+	router.Use(sessions.Sessions("session", setupTestSessionStore()))
+	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "admin")
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
+	router.POST("/api/auth/login", controller.Login)
+
+	postWithCookie(router, "/api/auth/login", map[string]string{"username": "nobody", "password": "password123"}, nil)
+	postWithCookie(router, "/api/auth/login", map[string]string{"username": "testuser", "password": "wrongpassword"}, nil)
+	postWithCookie(router, "/api/auth/login", map[string]string{"username": "testuser", "password": "password123"}, nil)
+
+	events, _, _ := models.NewAuditRepository(db).Find(models.AuditFilter{Action: "auth.login"}, 0, 10)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 login events, got %+v", events)
+	}
+	success, wrongPassword, unknown := events[0], events[1], events[2]
+	if unknown.Actor != "nobody" || unknown.ActorID != nil || unknown.Outcome != models.AuditFailure {
+		t.Errorf("Unexpected event for an unknown user: %+v", unknown)
+	}
+	if wrongPassword.ActorID == nil || *wrongPassword.ActorID != user.ID || wrongPassword.Outcome != models.AuditFailure {
+		t.Errorf("Unexpected event for a wrong password: %+v", wrongPassword)
+	}
+	if success.Outcome != models.AuditSuccess || success.Target != models.UserTarget(user.ID) {
+		t.Errorf("Unexpected event for a login: %+v", success)
+	}
+}
+
 func TestAuthController_Logout_Success(t *testing.T) {
 	router := setupTestRouter()
 	store := setupTestSessionStore()
@@ -262,7 +336,7 @@ func TestAuthController_Logout_Success(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/logout", controller.Logout)
 
@@ -284,6 +358,49 @@ func TestAuthController_Logout_Success(t *testing.T) {
 	}
 }
 
+func TestAuthController_Logout_OIDCSession(t *testing.T) {
+	router := setupTestRouter()
+	store := setupTestSessionStore()
+	router.Use(sessions.Sessions("session", store))
+
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+
+	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+	record := createTestSession(t, db, user.ID, "oidc:default")
+
+	ssoService := stubSSOService{logoutURL: "https://idp.example.com/logout?id_token_hint=token"}
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), ssoService)
+
+	router.POST("/api/auth/logout", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("sessionId", record.ID)
+		session.Set("userId", user.ID)
+		session.Save()
+		controller.Logout(c)
+	})
+
+	req, _ := http.NewRequest("POST", "/api/auth/logout", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if response["logoutUrl"] != ssoService.logoutURL {
+		t.Errorf("Expected logoutUrl '%s', got %v", ssoService.logoutURL, response["logoutUrl"])
+	}
+	if found, _ := models.NewSessionRepository(db).FindByID(record.ID); found != nil {
+		t.Error("Expected the session to be removed from the registry")
+	}
+}
+
 func TestAuthController_Register_Success(t *testing.T) {
 	router := setupTestRouter()
 	store := setupTestSessionStore()
@@ -292,7 +409,7 @@ func TestAuthController_Register_Success(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/register", controller.Register)
 
@@ -341,7 +458,7 @@ func TestAuthController_Register_RegistrationDisabled(t *testing.T) {
 
 	createTestUser(t, db, "existinguser", "existing@example.com", "password123", "user")
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/register", controller.Register)
 
@@ -370,7 +487,7 @@ func TestAuthController_Register_DuplicateUsername(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/register", controller.Register)
 
@@ -415,7 +532,7 @@ func TestAuthController_Register_DuplicateEmail(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/register", controller.Register)
 
@@ -460,7 +577,7 @@ func TestAuthController_Register_MissingFields(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 
-	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv())
+	controller := NewAuthController(logger, lib.Database{DB: db}, setupTestEnv(), stubSSOService{})
 
 	router.POST("/api/auth/register", controller.Register)
 
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/gin-contrib/sessions"
@@ -8,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"crossview-go-server/lib"
 	"crossview-go-server/models"
+	"crossview-go-server/services"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -28,7 +31,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.User{})
+	err = db.AutoMigrate(&models.User{}, &models.UserSession{}, &models.RecoveryCode{}, &models.AuditEvent{})
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
@@ -62,3 +65,25 @@ func createTestUser(t *testing.T, db *gorm.DB, username, email, password, role s
 	return user
 }
 
+
+func createTestSession(t *testing.T, db *gorm.DB, userID uint, provider string) *models.UserSession {
+	record := &models.UserSession{UserID: userID, Provider: provider}
+	if err := models.NewSessionRepository(db).Create(record); err != nil {
+		t.Fatalf("Failed to create test session: %v", err)
+	}
+	return record
+}
+
+// stubSSOService returns logoutURL for OIDC sessions. The auth controller
+// uses no other SSO method.
+type stubSSOService struct {
+	services.SSOServiceInterface
+	logoutURL string
+}
+
+func (s stubSSOService) OIDCLogoutURL(ctx context.Context, session *models.UserSession, redirectURL string) (string, error) {
+	if !strings.HasPrefix(session.Provider, "oidc:") {
+		return "", nil
+	}
+	return s.logoutURL, nil
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+func setupLoginMFATest(t *testing.T, env lib.Env) (*gin.Engine, *gorm.DB) {
+	router := setupTestRouter()
+	router.Use(sessions.Sessions("session", setupTestSessionStore()))
+
+	db := setupTestDB(t)
+	controller := NewAuthController(setupTestLogger(), lib.Database{DB: db}, env, stubSSOService{})
+	router.POST("/api/auth/login", controller.Login)
+	router.POST("/api/auth/login/mfa", controller.LoginMFA)
+	router.GET("/api/auth/check", controller.Check)
+	return router, db
+}
+
+// postWithCookie posts body as JSON, sending cookie if it is not nil.
+func postWithCookie(router *gin.Engine, path string, body interface{}, cookie *http.Cookie) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func responseSessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+	t.Fatal("Expected a session cookie")
+	return nil
+}
+
+func createTestMFAUser(t *testing.T, db *gorm.DB) (*models.User, []string) {
+	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "admin")
+	repo := models.NewMFARepository(db)
+	if _, err := repo.StartEnrollment(user, "Crossview"); err != nil {
+		t.Fatalf("Failed to start enrollment: %v", err)
+	}
+	recoveryCodes, err := repo.Enable(user)
+	if err != nil {
+		t.Fatalf("Failed to enable MFA: %v", err)
+	}
+	return user, recoveryCodes
+}
+
+func TestAuthController_Login_MFA(t *testing.T) {
+	router, db := setupLoginMFATest(t, setupTestEnv())
+	user, _ := createTestMFAUser(t, db)
+
+	w := postWithCookie(router, "/api/auth/login", map[string]string{"username": "testuser", "password": "password123"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response["mfaRequired"] != true || response["user"] != nil {
+		t.Fatalf("Expected the login to wait for a code, got %v", response)
+	}
+	pending := responseSessionCookie(t, w)
+
+	if w := postWithCookie(router, "/api/auth/login/mfa", map[string]string{"code": "12345"}, pending); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong code to be refused, got status %d", w.Code)
+	}
+	if failed, _ := models.NewUserRepository(db).FindByID(user.ID); failed.FailedLoginCount != 1 {
+		t.Errorf("Expected the wrong code to count as a failed login, got %d", failed.FailedLoginCount)
+	}
+
+	code, _ := totp.GenerateCode(user.MFASecret, time.Now())
+	w = postWithCookie(router, "/api/auth/login/mfa", map[string]string{"code": code}, pending)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	loggedIn, _ := models.NewUserRepository(db).FindByID(user.ID)
+	if loggedIn.FailedLoginCount != 0 || loggedIn.LastLoginAt == nil {
+		t.Errorf("Expected a clean login state, got %+v", loggedIn)
+	}
+
+	// The session is only logged in after the second step.
+	if checkAuthenticated(router, pending) {
+		t.Error("Expected the session to be logged out until the code was entered")
+	}
+	if !checkAuthenticated(router, responseSessionCookie(t, w)) {
+		t.Error("Expected the session to be logged in after the code was entered")
+	}
+}
+
+func checkAuthenticated(router *gin.Engine, cookie *http.Cookie) bool {
+	req, _ := http.NewRequest("GET", "/api/auth/check", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response["authenticated"] == true
+}
+
+func TestAuthController_Login_MFARecoveryCode(t *testing.T) {
+	router, db := setupLoginMFATest(t, setupTestEnv())
+	_, recoveryCodes := createTestMFAUser(t, db)
+
+	pending := responseSessionCookie(t, postWithCookie(router, "/api/auth/login", map[string]string{"username": "testuser", "password": "password123"}, nil))
+	if w := postWithCookie(router, "/api/auth/login/mfa", map[string]string{"code": recoveryCodes[0]}, pending); w.Code != http.StatusOK {
+		t.Fatalf("Expected the recovery code to be accepted, got status %d", w.Code)
+	}
+	if w := postWithCookie(router, "/api/auth/login/mfa", map[string]string{"code": recoveryCodes[0]}, pending); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be refused, got status %d", w.Code)
+	}
+}
+
+func TestAuthController_LoginMFA_NoPendingLogin(t *testing.T) {
+	router, _ := setupLoginMFATest(t, setupTestEnv())
+
+	if w := postWithCookie(router, "/api/auth/login/mfa", map[string]string{"code": "123456"}, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAuthController_Login_MFAEnrollmentRequired(t *testing.T) {
+	env := setupTestEnv()
+	env.MFAIssuer = "Crossview"
+	env.MFARequiredRoles = []string{"admin"}
+	router, db := setupLoginMFATest(t, env)
+	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "admin")
+
+	w := postWithCookie(router, "/api/auth/login", map[string]string{"username": "testuser", "password": "password123"}, nil)
+	var response struct {
+		MFARequired   bool                  `json:"mfaRequired"`
+		MFAEnrollment *models.MFAEnrollment `json:"mfaEnrollment"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusOK || !response.MFARequired || response.MFAEnrollment == nil {
+		t.Fatalf("Expected the login to require enrollment, got status %d: %s", w.Code, w.Body.String())
+	}
+
+	code, _ := totp.GenerateCode(response.MFAEnrollment.Secret, time.Now())
+	w = postWithCookie(router, "/api/auth/login/mfa", map[string]string{"code": code}, responseSessionCookie(t, w))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var completed struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &completed)
+	if len(completed.RecoveryCodes) == 0 {
+		t.Error("Expected recovery codes after enrolling")
+	}
+	if enrolled, _ := models.NewUserRepository(db).FindByID(user.ID); !enrolled.MFAEnabled {
+		t.Error("Expected MFA to be enabled")
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+)
+
+// maxTrackedFailures bounds the in-memory failure maps; stale entries are
+// pruned once a map grows past it.
+const maxTrackedFailures = 1024
+
+// loginThrottle slows down password guessing. Failures are counted per
+// username, on the user record (or in memory for names that don't exist,
+// so they behave the same), and per client IP in memory. Attempts from an
+// IP are counted before the credentials are checked and taken back if the
+// login succeeds. Every failure
+// doubles the wait before the next attempt, and enough failures in a row
+// lock the username or IP out. Failures are forgotten once the lockout
+// duration has passed since the last one.
+type loginThrottle struct {
+	maxAttempts   int
+	ipMaxAttempts int
+	backoff       time.Duration
+	lockout       time.Duration
+
+	mu        sync.Mutex
+	ips       map[string]*loginFailures
+	usernames map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+}
+
+func newLoginThrottle(env lib.Env) *loginThrottle {
+	return &loginThrottle{
+		maxAttempts:   env.LoginMaxAttempts,
+		ipMaxAttempts: env.LoginIPMaxAttempts,
+		backoff:       env.LoginBackoff,
+		lockout:       env.LoginLockoutDuration,
+		ips:           map[string]*loginFailures{},
+		usernames:     map[string]*loginFailures{},
+	}
+}
+
+// wait returns how long after the last of count failures the next attempt
+// must wait.
+func (t *loginThrottle) wait(count int, last time.Time, maxAttempts int, now time.Time) time.Duration {
+	if count == 0 {
+		return 0
+	}
+	elapsed := now.Sub(last)
+	if elapsed >= t.lockout {
+		return 0
+	}
+	delay := t.lockout
+	if maxAttempts == 0 || count < maxAttempts {
+		if count <= 30 {
+			if backoff := t.backoff << (count - 1); backoff < delay {
+				delay = backoff
+			}
+		}
+	}
+	if delay <= elapsed {
+		return 0
+	}
+	return delay - elapsed
+}
+
+// ipAttempt counts an attempt from ip before its credentials are checked,
+// so that attempts made at the same time can't all slip under the limit. It
+// returns how long the IP must wait instead, without counting the attempt.
+// A successful attempt is handed back with ipSucceeded.
+func (t *loginThrottle) ipAttempt(ip string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if failures, ok := t.ips[ip]; ok {
+		if wait := t.wait(failures.count, failures.last, t.ipMaxAttempts, now); wait > 0 {
+			return wait
+		}
+	}
+	t.record(t.ips, ip, now)
+	return 0
+}
+
+// ipSucceeded takes back the attempt ipAttempt counted for a login that
+// succeeded.
+func (t *loginThrottle) ipSucceeded(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if failures, ok := t.ips[ip]; ok && failures.count > 0 {
+		failures.count--
+	}
+}
+
+// usernameAttempt is ipAttempt for a username with no user record. Such an
+// attempt always fails, so it is never handed back.
+func (t *loginThrottle) usernameAttempt(username string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if failures, ok := t.usernames[username]; ok {
+		if wait := t.wait(failures.count, failures.last, t.maxAttempts, now); wait > 0 {
+			return wait
+		}
+	}
+	t.record(t.usernames, username, now)
+	return 0
+}
+
+// userRetryAfter returns how long the user must wait before their next
+// attempt.
+func (t *loginThrottle) userRetryAfter(user *models.User, now time.Time) time.Duration {
+	if user.LastFailedLoginAt == nil {
+		return 0
+	}
+	return t.wait(user.FailedLoginCount, *user.LastFailedLoginAt, t.maxAttempts, now)
+}
+
+func (t *loginThrottle) record(failures map[string]*loginFailures, key string, now time.Time) {
+	if len(failures) > maxTrackedFailures {
+		for k, f := range failures {
+			if now.Sub(f.last) >= t.lockout {
+				delete(failures, k)
+			}
+		}
+	}
+	entry, ok := failures[key]
+	if !ok || now.Sub(entry.last) >= t.lockout {
+		entry = &loginFailures{}
+		failures[key] = entry
+	}
+	entry.count++
+	entry.last = now
+}
+
+// recordUserLogin clears the user's failures after a successful login. A
+// user who logs in with a password is no longer offered to SSO logins by
+// email. The caller saves the user.
+func recordUserLogin(user *models.User, now time.Time) {
+	user.SSOLinkPending = false
+	user.FailedLoginCount = 0
+	user.LastFailedLoginAt = nil
+	user.LockedUntil = nil
+	user.LastLoginAt = &now
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func setupLoginThrottleTest(t *testing.T, env lib.Env) (*gin.Engine, *gorm.DB) {
+	router := setupTestRouter()
+	router.Use(sessions.Sessions("session", setupTestSessionStore()))
+
+	db := setupTestDB(t)
+	controller := NewAuthController(setupTestLogger(), lib.Database{DB: db}, env, stubSSOService{})
+	router.POST("/api/auth/login", controller.Login)
+	return router, db
+}
+
+func login(router *gin.Engine, remoteAddr, username, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	req, _ := http.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginThrottle_Wait(t *testing.T) {
+	throttle := &loginThrottle{backoff: time.Second, lockout: time.Minute}
+	last := time.Now()
+
+	tests := []struct {
+		name        string
+		count       int
+		maxAttempts int
+		elapsed     time.Duration
+		expected    time.Duration
+	}{
+		{"no failures", 0, 5, 0, 0},
+		{"first failure", 1, 5, 0, time.Second},
+		{"backoff doubles", 3, 5, 0, 4 * time.Second},
+		{"backoff partly served", 3, 5, time.Second, 3 * time.Second},
+		{"backoff served", 3, 5, 5 * time.Second, 0},
+		{"backoff capped at lockout", 10, 0, 0, time.Minute},
+		{"locked out", 5, 5, 10 * time.Second, 50 * time.Second},
+		{"failures forgotten", 5, 5, time.Minute, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := throttle.wait(tt.count, last, tt.maxAttempts, last.Add(tt.elapsed)); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAuthController_Login_Backoff(t *testing.T) {
+	router, db := setupLoginThrottleTest(t, lib.Env{
+		LoginMaxAttempts:     5,
+		LoginBackoff:         time.Minute,
+		LoginLockoutDuration: time.Hour,
+	})
+	createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+
+	if w := login(router, "192.0.2.1:1234", "testuser", "wrongpassword"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w := login(router, "192.0.2.1:1234", "testuser", "password123")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("Expected Retry-After 60, got '%s'", retryAfter)
+	}
+}
+
+func TestAuthController_Login_Lockout(t *testing.T) {
+	router, db := setupLoginThrottleTest(t, lib.Env{
+		LoginMaxAttempts:     3,
+		LoginLockoutDuration: 15 * time.Minute,
+	})
+	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+	repo := models.NewUserRepository(db)
+
+	for i := 0; i < 3; i++ {
+		if w := login(router, "192.0.2.1:1234", "testuser", "wrongpassword"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected status code %d, got %d", i+1, http.StatusUnauthorized, w.Code)
+		}
+	}
+
+	locked, _ := repo.FindByID(user.ID)
+	if locked.FailedLoginCount != 3 || locked.LockedUntil == nil {
+		t.Fatalf("Expected the account to be locked, got %+v", locked)
+	}
+	if w := login(router, "192.0.2.1:1234", "testuser", "password123"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the correct password to be refused during lockout, got status %d", w.Code)
+	}
+
+	if err := repo.Unlock(user.ID); err != nil {
+		t.Fatalf("Failed to unlock user: %v", err)
+	}
+	if w := login(router, "192.0.2.1:1234", "testuser", "password123"); w.Code != http.StatusOK {
+		t.Fatalf("Expected login to succeed after unlock, got status %d", w.Code)
+	}
+
+	loggedIn, _ := repo.FindByID(user.ID)
+	if loggedIn.FailedLoginCount != 0 || loggedIn.LockedUntil != nil || loggedIn.LastLoginAt == nil {
+		t.Errorf("Expected a clean login state, got %+v", loggedIn)
+	}
+}
+
+func TestAuthController_Login_IPLimit(t *testing.T) {
+	router, db := setupLoginThrottleTest(t, lib.Env{
+		LoginIPMaxAttempts:   2,
+		LoginLockoutDuration: 15 * time.Minute,
+	})
+	createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+
+	login(router, "192.0.2.1:1234", "alice", "guess")
+	login(router, "192.0.2.1:1234", "bob", "guess")
+
+	if w := login(router, "192.0.2.1:1234", "testuser", "password123"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the IP to be locked out, got status %d", w.Code)
+	}
+	if w := login(router, "198.51.100.7:1234", "testuser", "password123"); w.Code != http.StatusOK {
+		t.Errorf("Expected another IP to log in, got status %d", w.Code)
+	}
+}
+
+func TestAuthController_Login_UnknownUsernameThrottled(t *testing.T) {
+	router, _ := setupLoginThrottleTest(t, lib.Env{
+		LoginMaxAttempts:     2,
+		LoginLockoutDuration: 15 * time.Minute,
+	})
+
+	login(router, "192.0.2.1:1234", "ghost", "guess")
+	if w := login(router, "198.51.100.7:1234", "ghost", "guess"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// An unknown name locks out like a real one, so lockouts don't reveal
+	// which usernames exist.
+	if w := login(router, "203.0.113.9:1234", "ghost", "guess"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the unknown username to be locked out, got status %d", w.Code)
+	}
+}
+
+// loginConcurrently sends a wrong password for each address at once, so that
+// the attempts all read the same state before any is recorded, and counts
+// the responses by status code.
+func loginConcurrently(router *gin.Engine, username string, remoteAddrs []string) map[int]int {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	codes := map[int]int{}
+	for _, remoteAddr := range remoteAddrs {
+		wg.Add(1)
+		go func(remoteAddr string) {
+			defer wg.Done()
+			w := login(router, remoteAddr, username, "wrongpassword")
+			mu.Lock()
+			codes[w.Code]++
+			mu.Unlock()
+		}(remoteAddr)
+	}
+	wg.Wait()
+	return codes
+}
+
+func setupConcurrentLoginTest(t *testing.T, env lib.Env) (*gin.Engine, *gorm.DB) {
+	router, db := setupLoginThrottleTest(t, env)
+	// Every connection to ":memory:" opens a new, empty database.
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return router, db
+}
+
+func TestAuthController_Login_ConcurrentFailures(t *testing.T) {
+	router, db := setupConcurrentLoginTest(t, lib.Env{
+		LoginMaxAttempts:     3,
+		LoginLockoutDuration: 15 * time.Minute,
+	})
+	user := createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+
+	remoteAddrs := make([]string, 10)
+	for i := range remoteAddrs {
+		remoteAddrs[i] = fmt.Sprintf("192.0.2.%d:1234", i+1)
+	}
+	codes := loginConcurrently(router, "testuser", remoteAddrs)
+
+	locked, _ := models.NewUserRepository(db).FindByID(user.ID)
+	if locked.FailedLoginCount != codes[http.StatusUnauthorized] || locked.LockedUntil == nil {
+		t.Errorf("Expected all %d wrong passwords to count and lock the account, got count %d, locked until %v",
+			codes[http.StatusUnauthorized], locked.FailedLoginCount, locked.LockedUntil)
+	}
+}
+
+func TestAuthController_Login_ConcurrentIPAttempts(t *testing.T) {
+	router, db := setupConcurrentLoginTest(t, lib.Env{
+		LoginIPMaxAttempts:   4,
+		LoginLockoutDuration: 15 * time.Minute,
+	})
+	createTestUser(t, db, "testuser", "test@example.com", "password123", "user")
+
+	remoteAddrs := make([]string, 10)
+	for i := range remoteAddrs {
+		remoteAddrs[i] = "192.0.2.1:1234"
+	}
+	if codes := loginConcurrently(router, "testuser", remoteAddrs); codes[http.StatusUnauthorized] != 4 || codes[http.StatusTooManyRequests] != 6 {
+		t.Errorf("Expected 4 attempts from the IP to be checked and the rest refused, got %v", codes)
+	}
+}
@@ -28,7 +28,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.User{})
+	err = db.AutoMigrate(&models.User{}, &models.UserIdentity{}, &models.UserSession{}, &models.SessionData{}, &models.APIToken{}, &models.RecoveryCode{})
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
@@ -2,6 +2,7 @@ package controllers
 
 
 import (
+	"crossview-go-server/api/controllers/audit"
 	"crossview-go-server/api/controllers/auth"
 	"crossview-go-server/api/controllers/config"
 	"crossview-go-server/api/controllers/kubernetes"
@@ -17,4 +18,7 @@ var Module = fx.Options(
 	fx.Provide(kubernetes.NewWatchController),
 	fx.Provide(config.NewConfigController),
 	fx.Provide(user.NewUserController),
+	fx.Provide(user.NewTokenController),
+	fx.Provide(user.NewMFAController),
+	fx.Provide(audit.NewAuditController),
 )
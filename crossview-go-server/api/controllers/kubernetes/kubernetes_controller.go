@@ -1,16 +1,24 @@
 package kubernetes
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"crossview-go-server/api/middlewares"
 	"crossview-go-server/lib"
 	"crossview-go-server/services"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// sessionContextKey is the session key holding the user's preferred context.
+const sessionContextKey = "kubeContext"
+
 type KubernetesController struct {
 	logger            lib.Logger
 	kubernetesService services.KubernetesServiceInterface
@@ -29,6 +37,9 @@ func (c *KubernetesController) GetStatus(ctx *gin.Context) {
 	})
 }
 
+// SetContext stores the caller's preferred context in their session. The
+// preference is never shared: callers without a session, such as API
+// tokens, name the context on every request instead.
 func (c *KubernetesController) SetContext(ctx *gin.Context) {
 	var request struct {
 		Context string `json:"context"`
@@ -37,27 +48,70 @@ func (c *KubernetesController) SetContext(ctx *gin.Context) {
 	if err := ctx.ShouldBindJSON(&request); err != nil {
 		request.Context = ctx.Query("context")
 	}
+	middlewares.AuditAction(ctx, "context.select", "context:"+request.Context)
+	middlewares.AuditContext(ctx, request.Context)
+
+	session, ok := requestSession(ctx)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A context preference requires a session; pass the context parameter on each request"})
+		return
+	}
 
-	if err := c.kubernetesService.SetContext(request.Context); err != nil {
+	contextName, err := c.kubernetesService.ResolveContext(request.Context)
+	if err != nil {
 		c.logger.Errorf("Failed to set Kubernetes context: %s", err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	currentContext := c.kubernetesService.GetCurrentContext()
+	session.Set(sessionContextKey, contextName)
+	if err := session.Save(); err != nil {
+		c.logger.Errorf("Failed to save session: %s", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save context preference"})
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"context": currentContext,
+		"context": contextName,
 	})
 }
 
 func (c *KubernetesController) GetCurrentContext(ctx *gin.Context) {
-	currentContext := c.kubernetesService.GetCurrentContext()
 	ctx.JSON(http.StatusOK, gin.H{
-		"context": currentContext,
+		"context": c.currentContext(ctx),
 	})
 }
 
+// currentContext returns the context preferred by the caller's session,
+// falling back to "in-cluster" inside the cluster and to none outside it.
+func (c *KubernetesController) currentContext(ctx *gin.Context) string {
+	return preferredContext(ctx, c.kubernetesService)
+}
+
+// requestContext returns the context named in the query string, or the
+// caller's preferred context when none is given.
+func (c *KubernetesController) requestContext(ctx *gin.Context) string {
+	if contextName := ctx.Query("context"); contextName != "" {
+		return contextName
+	}
+	return c.currentContext(ctx)
+}
+
+func requestSession(ctx *gin.Context) (sessions.Session, bool) {
+	if _, exists := ctx.Get(sessions.DefaultKey); !exists {
+		return nil, false
+	}
+	return sessions.Default(ctx), true
+}
+
+func preferredContext(ctx *gin.Context, kubernetesService services.KubernetesServiceInterface) string {
+	if session, ok := requestSession(ctx); ok {
+		if contextName, ok := session.Get(sessionContextKey).(string); ok && contextName != "" {
+			return contextName
+		}
+	}
+	return kubernetesService.GetCurrentContext()
+}
+
 func (c *KubernetesController) GetContexts(ctx *gin.Context) {
 	contexts, err := c.kubernetesService.GetContexts()
 	if err != nil {
@@ -70,13 +124,10 @@ func (c *KubernetesController) GetContexts(ctx *gin.Context) {
 }
 
 func (c *KubernetesController) CheckConnection(ctx *gin.Context) {
-	contextName := ctx.Query("context")
+	contextName := c.requestContext(ctx)
 	if contextName == "" {
-		contextName = c.kubernetesService.GetCurrentContext()
-		if contextName == "" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "context parameter is required"})
-			return
-		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "context parameter is required"})
+		return
 	}
 
 	connected, err := c.kubernetesService.IsConnected(contextName)
@@ -96,7 +147,7 @@ func (c *KubernetesController) GetResources(ctx *gin.Context) {
 	apiVersion := ctx.Query("apiVersion")
 	kind := ctx.Query("kind")
 	namespace := ctx.Query("namespace")
-	contextName := ctx.Query("context")
+	contextName := c.requestContext(ctx)
 	plural := ctx.Query("plural")
 	continueToken := ctx.Query("continue")
 
@@ -117,7 +168,7 @@ func (c *KubernetesController) GetResources(ctx *gin.Context) {
 		return
 	}
 
-	result, err := c.kubernetesService.GetResources(apiVersion, kind, namespace, contextName, plural, limit, continueToken)
+	result, err := c.service(ctx).GetResources(apiVersion, kind, namespace, contextName, plural, limit, continueToken)
 	if err != nil {
 		if strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "NotFound") {
 			ctx.JSON(http.StatusOK, gin.H{
@@ -127,6 +178,10 @@ func (c *KubernetesController) GetResources(ctx *gin.Context) {
 			})
 			return
 		}
+		if apierrors.IsForbidden(err) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.logger.Errorf("Failed to get resources: %s", err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -144,7 +199,7 @@ func (c *KubernetesController) GetResource(ctx *gin.Context) {
 	kind := ctx.Query("kind")
 	name := ctx.Query("name")
 	namespace := ctx.Query("namespace")
-	contextName := ctx.Query("context")
+	contextName := c.requestContext(ctx)
 	plural := ctx.Query("plural")
 
 	if apiVersion == "" {
@@ -165,12 +220,16 @@ func (c *KubernetesController) GetResource(ctx *gin.Context) {
 		cleanNamespace = ""
 	}
 
-	resource, err := c.kubernetesService.GetResource(apiVersion, kind, name, cleanNamespace, contextName, plural)
+	resource, err := c.service(ctx).GetResource(apiVersion, kind, name, cleanNamespace, contextName, plural)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "NotFound") {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
 			return
 		}
+		if apierrors.IsForbidden(err) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.logger.Errorf("Failed to get resource: %s", err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -179,11 +238,236 @@ func (c *KubernetesController) GetResource(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, resource)
 }
 
+func (c *KubernetesController) ApplyResource(ctx *gin.Context) {
+	contextName := c.requestContext(ctx)
+	middlewares.AuditAction(ctx, "resource.apply", "")
+	middlewares.AuditContext(ctx, contextName)
+
+	dryRun, err := parseDryRun(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	force := false
+	if forceParam := ctx.Query("force"); forceParam != "" {
+		force, err = strconv.ParseBool(forceParam)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "force must be true or false"})
+			return
+		}
+	}
+
+	var manifest map[string]interface{}
+	if err := ctx.ShouldBindJSON(&manifest); err != nil || len(manifest) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "resource manifest is required"})
+		return
+	}
+	kind, _ := manifest["kind"].(string)
+	metadata, _ := manifest["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	namespace, _ := metadata["namespace"].(string)
+	auditResource(ctx, "resource.apply", kind, namespace, name, contextName)
+
+	resource, err := c.service(ctx).ApplyResource(contextName, manifest, services.ApplyOptions{
+		FieldManager: ctx.Query("fieldManager"),
+		Force:        force,
+		DryRun:       dryRun,
+	})
+	if err != nil {
+		c.logger.Errorf("Failed to apply resource: %s", err.Error())
+		ctx.JSON(writeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resource)
+}
+
+func (c *KubernetesController) PatchResource(ctx *gin.Context) {
+	apiVersion := ctx.Query("apiVersion")
+	kind := ctx.Query("kind")
+	name := ctx.Query("name")
+	namespace := ctx.Query("namespace")
+	contextName := c.requestContext(ctx)
+	auditResource(ctx, "resource.patch", kind, namespace, name, contextName)
+
+	if apiVersion == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "apiVersion parameter is required"})
+		return
+	}
+	if kind == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "kind parameter is required"})
+		return
+	}
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "name parameter is required"})
+		return
+	}
+
+	dryRun, err := parseDryRun(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patch, err := ctx.GetRawData()
+	if err != nil || len(patch) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "patch body is required"})
+		return
+	}
+
+	resource, err := c.service(ctx).PatchResource(apiVersion, kind, name, namespace, contextName, patch, dryRun)
+	if err != nil {
+		c.logger.Errorf("Failed to patch resource: %s", err.Error())
+		ctx.JSON(writeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resource)
+}
+
+func (c *KubernetesController) DeleteResource(ctx *gin.Context) {
+	apiVersion := ctx.Query("apiVersion")
+	kind := ctx.Query("kind")
+	name := ctx.Query("name")
+	namespace := ctx.Query("namespace")
+	contextName := c.requestContext(ctx)
+	auditResource(ctx, "resource.delete", kind, namespace, name, contextName)
+
+	if apiVersion == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "apiVersion parameter is required"})
+		return
+	}
+	if kind == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "kind parameter is required"})
+		return
+	}
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "name parameter is required"})
+		return
+	}
+
+	dryRun, err := parseDryRun(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = c.service(ctx).DeleteResource(apiVersion, kind, name, namespace, contextName, services.DeleteOptions{
+		PropagationPolicy: ctx.Query("propagationPolicy"),
+		DryRun:            dryRun,
+	})
+	if err != nil {
+		c.logger.Errorf("Failed to delete resource: %s", err.Error())
+		ctx.JSON(writeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"dryRun":  dryRun,
+	})
+}
+
+func (c *KubernetesController) RunResourceAction(ctx *gin.Context) {
+	action := services.ResourceAction(ctx.Param("action"))
+	apiVersion := ctx.Query("apiVersion")
+	kind := ctx.Query("kind")
+	name := ctx.Query("name")
+	namespace := ctx.Query("namespace")
+	contextName := c.requestContext(ctx)
+	auditResource(ctx, "resource."+string(action), kind, namespace, name, contextName)
+
+	switch action {
+	case services.ResourceActionPause, services.ResourceActionResume, services.ResourceActionReconcile:
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "action must be pause, resume or reconcile"})
+		return
+	}
+	if apiVersion == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "apiVersion parameter is required"})
+		return
+	}
+	if kind == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "kind parameter is required"})
+		return
+	}
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "name parameter is required"})
+		return
+	}
+
+	includeComposed := false
+	if composedParam := ctx.Query("composed"); composedParam != "" {
+		var err error
+		includeComposed, err = strconv.ParseBool(composedParam)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "composed must be true or false"})
+			return
+		}
+	}
+
+	if namespace == "undefined" || namespace == "null" {
+		namespace = ""
+	}
+
+	result, err := c.service(ctx).RunResourceAction(apiVersion, kind, name, namespace, contextName, action, includeComposed)
+	if err != nil {
+		c.logger.Errorf("Failed to %s resource: %s", action, err.Error())
+		ctx.JSON(writeErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+func (c *KubernetesController) GetTrace(ctx *gin.Context) {
+	apiVersion := ctx.Query("apiVersion")
+	kind := ctx.Query("kind")
+	name := ctx.Query("name")
+	namespace := ctx.Query("namespace")
+	contextName := c.requestContext(ctx)
+
+	if apiVersion == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "apiVersion parameter is required"})
+		return
+	}
+	if kind == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "kind parameter is required"})
+		return
+	}
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "name parameter is required"})
+		return
+	}
+
+	if namespace == "undefined" || namespace == "null" {
+		namespace = ""
+	}
+
+	trace, err := c.service(ctx).GetResourceTrace(apiVersion, kind, name, namespace, contextName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "NotFound") {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+			return
+		}
+		if apierrors.IsForbidden(err) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorf("Failed to trace resource: %s", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, trace)
+}
+
 func (c *KubernetesController) GetEvents(ctx *gin.Context) {
 	kind := ctx.Query("kind")
 	name := ctx.Query("name")
 	namespace := ctx.Query("namespace")
-	contextName := ctx.Query("context")
+	contextName := c.requestContext(ctx)
 
 	if kind == "" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "kind parameter is required"})
@@ -194,7 +478,7 @@ func (c *KubernetesController) GetEvents(ctx *gin.Context) {
 		return
 	}
 
-	events, err := c.kubernetesService.GetEvents(kind, name, namespace, contextName)
+	events, err := c.service(ctx).GetEvents(kind, name, namespace, contextName)
 	if err != nil {
 		c.logger.Errorf("Failed to get events: %s", err.Error())
 		ctx.JSON(http.StatusOK, []interface{}{})
@@ -205,11 +489,15 @@ func (c *KubernetesController) GetEvents(ctx *gin.Context) {
 }
 
 func (c *KubernetesController) GetManagedResources(ctx *gin.Context) {
-	contextName := ctx.Query("context")
+	contextName := c.requestContext(ctx)
 	forceRefresh := ctx.Query("refresh") == "true"
 
-	result, err := c.kubernetesService.GetManagedResources(contextName, forceRefresh)
+	result, err := c.service(ctx).GetManagedResources(contextName, forceRefresh)
 	if err != nil {
+		if apierrors.IsForbidden(err) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.logger.Errorf("Failed to get managed resources: %s", err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -219,6 +507,7 @@ func (c *KubernetesController) GetManagedResources(ctx *gin.Context) {
 }
 
 func (c *KubernetesController) AddKubeConfig(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "kubeconfig.add", "")
 	var request struct {
 		KubeConfig string `json:"kubeConfig"`
 	}
@@ -239,6 +528,7 @@ func (c *KubernetesController) AddKubeConfig(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	middlewares.AuditAction(ctx, "kubeconfig.add", "contexts:"+strings.Join(addedContexts, ","))
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -261,6 +551,8 @@ func (c *KubernetesController) RemoveContext(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "context cannot be empty"})
 		return
 	}
+	middlewares.AuditAction(ctx, "context.remove", "context:"+request.Context)
+	middlewares.AuditContext(ctx, request.Context)
 
 	if err := c.kubernetesService.RemoveContext(request.Context); err != nil {
 		c.logger.Errorf("Failed to remove context: %s", err.Error())
@@ -272,4 +564,89 @@ func (c *KubernetesController) RemoveContext(ctx *gin.Context) {
 		"success": true,
 		"message": fmt.Sprintf("Successfully removed context: %s", request.Context),
 	})
-}
\ No newline at end of file
+}
+// auditResource names a change to a resource for the audit log. The target
+// is "<kind>:<namespace>/<name>", or "<kind>:<name>" for cluster-scoped
+// resources.
+func auditResource(ctx *gin.Context, action, kind, namespace, name, contextName string) {
+	target := kind + ":" + name
+	if namespace != "" && namespace != "undefined" && namespace != "null" {
+		target = kind + ":" + namespace + "/" + name
+	}
+	middlewares.AuditAction(ctx, action, target)
+	middlewares.AuditContext(ctx, contextName)
+}
+
+// service returns the Kubernetes service acting for the request's user.
+func (c *KubernetesController) service(ctx *gin.Context) services.KubernetesServiceInterface {
+	return c.kubernetesService.WithIdentity(requestIdentity(ctx))
+}
+
+// requestIdentity returns the user the request is made for, as set by the
+// auth and permission middlewares, or nil when there is none.
+func requestIdentity(ctx *gin.Context) *services.Identity {
+	username := ctx.GetString("username")
+	if username == "" {
+		return nil
+	}
+	return &services.Identity{
+		Username: username,
+		Groups:   ctx.GetStringSlice("userGroups"),
+	}
+}
+
+// parseDryRun reads the dryRun query parameter. Like the Kubernetes API,
+// the only accepted value is "All".
+func parseDryRun(ctx *gin.Context) (bool, error) {
+	switch ctx.Query("dryRun") {
+	case "":
+		return false, nil
+	case metav1.DryRunAll:
+		return true, nil
+	default:
+		return false, fmt.Errorf("dryRun must be %s", metav1.DryRunAll)
+	}
+}
+
+// badWriteRequests are the errors for write requests that are wrong as
+// given.
+var badWriteRequests = []error{
+	services.ErrContextRequired,
+	services.ErrAPIVersionRequired,
+	services.ErrInvalidAPIVersion,
+	services.ErrKindRequired,
+	services.ErrNameRequired,
+	services.ErrNamespaceRequired,
+	services.ErrInvalidPatch,
+	services.ErrInvalidPropagationPolicy,
+	services.ErrInvalidAction,
+}
+
+// writeErrorStatus maps errors from write operations to an HTTP status,
+// passing through the status the API server returned where there is one.
+func writeErrorStatus(err error) int {
+	switch {
+	case apierrors.IsNotFound(err), errors.Is(err, services.ErrResourceNotFound),
+		errors.Is(err, services.ErrResourceTypeNotFound), errors.Is(err, services.ErrContextNotFound):
+		return http.StatusNotFound
+	case apierrors.IsConflict(err):
+		return http.StatusConflict
+	case apierrors.IsInvalid(err):
+		return http.StatusUnprocessableEntity
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsBadRequest(err), isBadWriteRequest(err):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func isBadWriteRequest(err error) bool {
+	for _, target := range badWriteRequests {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,7 +5,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"crossview-go-server/services"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestKubernetesController_GetStatus(t *testing.T) {
@@ -125,16 +133,13 @@ func TestKubernetesController_SetContext_Success(t *testing.T) {
 	logger := setupTestLogger()
 	mockService := setupMockKubernetesService()
 
-	mockService.SetContextFunc = func(ctxName string) error {
-		return nil
-	}
-
-	mockService.GetCurrentContextFunc = func() string {
-		return "test-context"
+	mockService.ResolveContextFunc = func(ctxName string) (string, error) {
+		return ctxName, nil
 	}
 
 	controller := NewKubernetesController(logger, mockService)
 
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret-key"))))
 	router.POST("/api/kubernetes/context", controller.SetContext)
 
 	req, _ := http.NewRequest("POST", "/api/kubernetes/context?context=test-context", nil)
@@ -153,6 +158,9 @@ func TestKubernetesController_SetContext_Success(t *testing.T) {
 	if success, ok := response["success"].(bool); !ok || !success {
 		t.Error("Expected success to be true")
 	}
+	if response["context"] != "test-context" {
+		t.Errorf("Expected context 'test-context', got '%v'", response["context"])
+	}
 }
 
 func TestKubernetesController_SetContext_Error(t *testing.T) {
@@ -160,12 +168,13 @@ func TestKubernetesController_SetContext_Error(t *testing.T) {
 	logger := setupTestLogger()
 	mockService := setupMockKubernetesService()
 
-	mockService.SetContextFunc = func(ctxName string) error {
-		return http.ErrMissingFile
+	mockService.ResolveContextFunc = func(ctxName string) (string, error) {
+		return "", http.ErrMissingFile
 	}
 
 	controller := NewKubernetesController(logger, mockService)
 
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret-key"))))
 	router.POST("/api/kubernetes/context", controller.SetContext)
 
 	req, _ := http.NewRequest("POST", "/api/kubernetes/context?context=test-context", nil)
@@ -177,6 +186,29 @@ func TestKubernetesController_SetContext_Error(t *testing.T) {
 	}
 }
 
+func TestKubernetesController_SetContext_NoSession(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	mockService.ResolveContextFunc = func(ctxName string) (string, error) {
+		t.Error("Expected no context to be resolved without a session")
+		return ctxName, nil
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.POST("/api/kubernetes/context", controller.SetContext)
+
+	req, _ := http.NewRequest("POST", "/api/kubernetes/context?context=test-context", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
 func TestKubernetesController_CheckConnection_WithContext(t *testing.T) {
 	router := setupTestRouter()
 	logger := setupTestLogger()
@@ -567,3 +599,380 @@ func TestKubernetesController_GetManagedResources_Error(t *testing.T) {
 	}
 }
 
+
+func TestKubernetesController_SetContext_StoresSessionPreference(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	var requestedContext string
+	mockService.GetResourcesFunc = func(apiVersion, kind, namespace, contextName, plural string, limit *int64, continueToken string) (map[string]interface{}, error) {
+		requestedContext = contextName
+		return map[string]interface{}{"items": []interface{}{}}, nil
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("test-secret-key"))))
+	router.POST("/api/contexts/current", controller.SetContext)
+	router.GET("/api/contexts/current", controller.GetCurrentContext)
+	router.GET("/api/resources", controller.GetResources)
+
+	req, _ := http.NewRequest("POST", "/api/contexts/current?context=session-context", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	cookies := w.Result().Cookies()
+
+	req, _ = http.NewRequest("GET", "/api/contexts/current", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response["context"] != "session-context" {
+		t.Errorf("Expected context 'session-context', got '%v'", response["context"])
+	}
+
+	req, _ = http.NewRequest("GET", "/api/resources?apiVersion=v1&kind=Pod", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if requestedContext != "session-context" {
+		t.Errorf("Expected resources to be listed from 'session-context', got '%s'", requestedContext)
+	}
+}
+
+func TestWatchNamespace(t *testing.T) {
+	namespaced := services.ResourceInfo{Namespaced: true}
+	clusterScoped := services.ResourceInfo{Namespaced: false}
+
+	if ns := watchNamespace(WatchRequest{Namespace: "default"}, namespaced); ns != "default" {
+		t.Errorf("Expected 'default', got '%s'", ns)
+	}
+	if ns := watchNamespace(WatchRequest{Namespace: "default"}, clusterScoped); ns != "" {
+		t.Errorf("Expected cluster-scoped kinds to ignore the namespace, got '%s'", ns)
+	}
+	if ns := watchNamespace(WatchRequest{Namespace: "undefined"}, namespaced); ns != "" {
+		t.Errorf("Expected 'undefined' to be treated as no namespace, got '%s'", ns)
+	}
+}
+
+func TestKubernetesController_GetTrace_MissingName(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.GET("/api/trace", controller.GetTrace)
+
+	req, _ := http.NewRequest("GET", "/api/trace?apiVersion=example.crossplane.io/v1alpha1&kind=Database", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestKubernetesController_GetTrace_Success(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	mockService.GetResourceTraceFunc = func(apiVersion, kind, name, namespace, contextName string) (*services.TraceNode, error) {
+		if namespace != "" {
+			t.Errorf("Expected empty namespace, got %q", namespace)
+		}
+		return &services.TraceNode{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Name:       name,
+			Target:     true,
+			Ready:      &services.TraceCondition{Status: "True"},
+			Children:   []*services.TraceNode{},
+		}, nil
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.GET("/api/trace", controller.GetTrace)
+
+	req, _ := http.NewRequest("GET", "/api/trace?apiVersion=example.crossplane.io/v1alpha1&kind=XDatabase&name=orders&namespace=undefined", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response["name"] != "orders" || response["target"] != true {
+		t.Errorf("Unexpected response: %v", response)
+	}
+}
+
+func TestKubernetesController_GetTrace_NotFound(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	mockService.GetResourceTraceFunc = func(apiVersion, kind, name, namespace, contextName string) (*services.TraceNode, error) {
+		return nil, fmt.Errorf("resource not found: team-a/orders")
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.GET("/api/trace", controller.GetTrace)
+
+	req, _ := http.NewRequest("GET", "/api/trace?apiVersion=example.crossplane.io/v1alpha1&kind=Database&name=orders&namespace=team-a", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestKubernetesController_ApplyResource_DryRun(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	var received services.ApplyOptions
+	mockService.ApplyResourceFunc = func(contextName string, manifest map[string]interface{}, opts services.ApplyOptions) (map[string]interface{}, error) {
+		received = opts
+		return manifest, nil
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.POST("/api/resource", controller.ApplyResource)
+
+	body := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"default"}}`
+	req, _ := http.NewRequest("POST", "/api/resource?dryRun=All&fieldManager=editor&force=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if !received.DryRun || !received.Force || received.FieldManager != "editor" {
+		t.Errorf("Unexpected apply options: %+v", received)
+	}
+}
+
+func TestKubernetesController_ApplyResource_InvalidDryRun(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.POST("/api/resource", controller.ApplyResource)
+
+	req, _ := http.NewRequest("POST", "/api/resource?dryRun=true", strings.NewReader(`{"kind":"ConfigMap"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestKubernetesController_ApplyResource_Conflict(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	mockService.ApplyResourceFunc = func(contextName string, manifest map[string]interface{}, opts services.ApplyOptions) (map[string]interface{}, error) {
+		err := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "settings", fmt.Errorf("field managed by kubectl"))
+		return nil, fmt.Errorf("failed to apply resource: %w", err)
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.POST("/api/resource", controller.ApplyResource)
+
+	body := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"default"}}`
+	req, _ := http.NewRequest("POST", "/api/resource", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestKubernetesController_PatchResource(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	var receivedPatch string
+	mockService.PatchResourceFunc = func(apiVersion, kind, name, namespace, contextName string, patch []byte, dryRun bool) (map[string]interface{}, error) {
+		receivedPatch = string(patch)
+		return map[string]interface{}{"kind": kind}, nil
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.PATCH("/api/resource", controller.PatchResource)
+
+	req, _ := http.NewRequest("PATCH", "/api/resource?apiVersion=v1&kind=ConfigMap&name=settings&namespace=default",
+		strings.NewReader(`{"data":{"mode":"slow"}}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if receivedPatch != `{"data":{"mode":"slow"}}` {
+		t.Errorf("Unexpected patch body: %s", receivedPatch)
+	}
+}
+
+func TestKubernetesController_DeleteResource(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	var received services.DeleteOptions
+	mockService.DeleteResourceFunc = func(apiVersion, kind, name, namespace, contextName string, opts services.DeleteOptions) error {
+		received = opts
+		return nil
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.DELETE("/api/resource", controller.DeleteResource)
+
+	req, _ := http.NewRequest("DELETE", "/api/resource?apiVersion=v1&kind=ConfigMap&name=settings&namespace=default&propagationPolicy=Foreground", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if received.PropagationPolicy != "Foreground" || received.DryRun {
+		t.Errorf("Unexpected delete options: %+v", received)
+	}
+}
+
+func TestKubernetesController_RunResourceAction(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	var receivedAction services.ResourceAction
+	var receivedComposed bool
+	mockService.RunResourceActionFunc = func(apiVersion, kind, name, namespace, contextName string, action services.ResourceAction, includeComposed bool) (*services.ResourceActionResult, error) {
+		receivedAction = action
+		receivedComposed = includeComposed
+		return &services.ResourceActionResult{Resource: map[string]interface{}{"kind": kind}}, nil
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.POST("/api/resource/actions/:action", controller.RunResourceAction)
+
+	req, _ := http.NewRequest("POST", "/api/resource/actions/pause?apiVersion=example.crossplane.io/v1alpha1&kind=XDatabase&name=orders&composed=true", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if receivedAction != services.ResourceActionPause || !receivedComposed {
+		t.Errorf("Unexpected action %q, composed %v", receivedAction, receivedComposed)
+	}
+}
+
+func TestKubernetesController_RunResourceAction_UnknownAction(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.POST("/api/resource/actions/:action", controller.RunResourceAction)
+
+	req, _ := http.NewRequest("POST", "/api/resource/actions/restart?apiVersion=v1&kind=Pod&name=web", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestKubernetesController_GetResources_UsesRequestIdentity(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	mockService := setupMockKubernetesService()
+
+	var identity *services.Identity
+	scoped := setupMockKubernetesService()
+	scoped.GetResourcesFunc = func(apiVersion, kind, namespace, contextName, plural string, limit *int64, continueToken string) (map[string]interface{}, error) {
+		return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "", fmt.Errorf("denied"))
+	}
+	mockService.WithIdentityFunc = func(i *services.Identity) services.KubernetesServiceInterface {
+		identity = i
+		return scoped
+	}
+
+	controller := NewKubernetesController(logger, mockService)
+
+	router.GET("/api/resources", func(ctx *gin.Context) {
+		ctx.Set("username", "alice")
+		ctx.Set("userGroups", []string{"platform"})
+		ctx.Next()
+	}, controller.GetResources)
+
+	req, _ := http.NewRequest("GET", "/api/resources?apiVersion=v1&kind=ConfigMap", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if identity == nil || identity.Username != "alice" || len(identity.Groups) != 1 || identity.Groups[0] != "platform" {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+}
+
+func TestWriteErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w for Database", services.ErrNamespaceRequired), http.StatusBadRequest},
+		{fmt.Errorf("failed to resolve context: %w", services.ErrContextRequired), http.StatusBadRequest},
+		{fmt.Errorf("%w: example.org/v1/Widget", services.ErrResourceTypeNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: Database/orders", services.ErrResourceNotFound), http.StatusNotFound},
+		{fmt.Errorf("failed to patch resource: %w", apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "settings", fmt.Errorf("conflict"))), http.StatusConflict},
+		// Only the sentinels count, not words in a message.
+		{fmt.Errorf("webhook returned an invalid response: field not found"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := writeErrorStatus(tt.err); got != tt.want {
+			t.Errorf("writeErrorStatus(%q) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package kubernetes
 import (
 	"github.com/gin-gonic/gin"
 	"crossview-go-server/lib"
+	"crossview-go-server/services"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -21,11 +22,13 @@ func setupMockKubernetesService() MockKubernetesService {
 }
 
 type MockKubernetesService struct {
-	SetContextFunc           func(ctxName string) error
 	GetCurrentContextFunc    func() string
+	ResolveContextFunc       func(ctxName string) (string, error)
 	GetContextsFunc          func() ([]string, error)
 	GetClientsetFunc         func() (kubernetes.Interface, error)
 	GetConfigFunc            func() (*rest.Config, error)
+	GetClientsFunc           func(ctxName string) (*services.ClusterClients, error)
+	ResolveResourceFunc      func(contextName, apiVersion, kind, plural string) (services.ResourceInfo, error)
 	IsConnectedFunc          func(ctxName string) (bool, error)
 	AddKubeConfigFunc        func(kubeConfigYAML string) ([]string, error)
 	RemoveContextFunc        func(ctxName string) error
@@ -33,17 +36,17 @@ type MockKubernetesService struct {
 	ClearManagedResourcesCacheFunc func(contextName string)
 	GetResourcesFunc         func(apiVersion, kind, namespace, contextName, plural string, limit *int64, continueToken string) (map[string]interface{}, error)
 	GetResourceFunc          func(apiVersion, kind, name, namespace, contextName, plural string) (map[string]interface{}, error)
+	ApplyResourceFunc        func(contextName string, manifest map[string]interface{}, opts services.ApplyOptions) (map[string]interface{}, error)
+	PatchResourceFunc        func(apiVersion, kind, name, namespace, contextName string, patch []byte, dryRun bool) (map[string]interface{}, error)
+	DeleteResourceFunc       func(apiVersion, kind, name, namespace, contextName string, opts services.DeleteOptions) error
+	RunResourceActionFunc    func(apiVersion, kind, name, namespace, contextName string, action services.ResourceAction, includeComposed bool) (*services.ResourceActionResult, error)
+	WithIdentityFunc         func(identity *services.Identity) services.KubernetesServiceInterface
+	AuthorizeFunc            func(contextName, verb string, info services.ResourceInfo, namespace, name string) error
+	GetResourceTraceFunc     func(apiVersion, kind, name, namespace, contextName string) (*services.TraceNode, error)
 	GetEventsFunc            func(kind, name, namespace, contextName string) ([]map[string]interface{}, error)
 	GetManagedResourcesFunc  func(contextName string, forceRefresh bool) (map[string]interface{}, error)
 }
 
-func (m MockKubernetesService) SetContext(ctxName string) error {
-	if m.SetContextFunc != nil {
-		return m.SetContextFunc(ctxName)
-	}
-	return nil
-}
-
 func (m MockKubernetesService) GetCurrentContext() string {
 	if m.GetCurrentContextFunc != nil {
 		return m.GetCurrentContextFunc()
@@ -51,6 +54,13 @@ func (m MockKubernetesService) GetCurrentContext() string {
 	return ""
 }
 
+func (m MockKubernetesService) ResolveContext(ctxName string) (string, error) {
+	if m.ResolveContextFunc != nil {
+		return m.ResolveContextFunc(ctxName)
+	}
+	return ctxName, nil
+}
+
 func (m MockKubernetesService) GetContexts() ([]string, error) {
 	if m.GetContextsFunc != nil {
 		return m.GetContextsFunc()
@@ -72,6 +82,20 @@ func (m MockKubernetesService) GetConfig() (*rest.Config, error) {
 	return nil, nil
 }
 
+func (m MockKubernetesService) GetClients(ctxName string) (*services.ClusterClients, error) {
+	if m.GetClientsFunc != nil {
+		return m.GetClientsFunc(ctxName)
+	}
+	return nil, nil
+}
+
+func (m MockKubernetesService) ResolveResource(contextName, apiVersion, kind, plural string) (services.ResourceInfo, error) {
+	if m.ResolveResourceFunc != nil {
+		return m.ResolveResourceFunc(contextName, apiVersion, kind, plural)
+	}
+	return services.ResourceInfo{}, nil
+}
+
 func (m MockKubernetesService) IsConnected(ctxName string) (bool, error) {
 	if m.IsConnectedFunc != nil {
 		return m.IsConnectedFunc(ctxName)
@@ -93,6 +117,55 @@ func (m MockKubernetesService) GetResource(apiVersion, kind, name, namespace, co
 	return map[string]interface{}{}, nil
 }
 
+func (m MockKubernetesService) ApplyResource(contextName string, manifest map[string]interface{}, opts services.ApplyOptions) (map[string]interface{}, error) {
+	if m.ApplyResourceFunc != nil {
+		return m.ApplyResourceFunc(contextName, manifest, opts)
+	}
+	return manifest, nil
+}
+
+func (m MockKubernetesService) PatchResource(apiVersion, kind, name, namespace, contextName string, patch []byte, dryRun bool) (map[string]interface{}, error) {
+	if m.PatchResourceFunc != nil {
+		return m.PatchResourceFunc(apiVersion, kind, name, namespace, contextName, patch, dryRun)
+	}
+	return map[string]interface{}{}, nil
+}
+
+func (m MockKubernetesService) DeleteResource(apiVersion, kind, name, namespace, contextName string, opts services.DeleteOptions) error {
+	if m.DeleteResourceFunc != nil {
+		return m.DeleteResourceFunc(apiVersion, kind, name, namespace, contextName, opts)
+	}
+	return nil
+}
+
+func (m MockKubernetesService) RunResourceAction(apiVersion, kind, name, namespace, contextName string, action services.ResourceAction, includeComposed bool) (*services.ResourceActionResult, error) {
+	if m.RunResourceActionFunc != nil {
+		return m.RunResourceActionFunc(apiVersion, kind, name, namespace, contextName, action, includeComposed)
+	}
+	return &services.ResourceActionResult{Resource: map[string]interface{}{}}, nil
+}
+
+func (m MockKubernetesService) WithIdentity(identity *services.Identity) services.KubernetesServiceInterface {
+	if m.WithIdentityFunc != nil {
+		return m.WithIdentityFunc(identity)
+	}
+	return m
+}
+
+func (m MockKubernetesService) Authorize(contextName, verb string, info services.ResourceInfo, namespace, name string) error {
+	if m.AuthorizeFunc != nil {
+		return m.AuthorizeFunc(contextName, verb, info, namespace, name)
+	}
+	return nil
+}
+
+func (m MockKubernetesService) GetResourceTrace(apiVersion, kind, name, namespace, contextName string) (*services.TraceNode, error) {
+	if m.GetResourceTraceFunc != nil {
+		return m.GetResourceTraceFunc(apiVersion, kind, name, namespace, contextName)
+	}
+	return &services.TraceNode{Children: []*services.TraceNode{}}, nil
+}
+
 func (m MockKubernetesService) GetEvents(kind, name, namespace, contextName string) ([]map[string]interface{}, error) {
 	if m.GetEventsFunc != nil {
 		return m.GetEventsFunc(kind, name, namespace, contextName)
@@ -14,9 +14,7 @@ import (
 	"crossview-go-server/lib"
 	"crossview-go-server/services"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
 )
@@ -31,6 +29,7 @@ type WatchController struct {
 
 type ResourceWatcher struct {
 	conn      *websocket.Conn
+	service   services.KubernetesServiceInterface
 	context   string
 	resources []WatchRequest
 	stop      chan struct{}
@@ -76,8 +75,12 @@ func (c *WatchController) WatchResources(ctx *gin.Context) {
 
 	watcherID := fmt.Sprintf("%p", conn)
 	contextName := ctx.Query("context")
+	if contextName == "" {
+		contextName = preferredContext(ctx, c.kubernetesService)
+	}
 	watcher := &ResourceWatcher{
 		conn:    conn,
+		service: c.kubernetesService.WithIdentity(requestIdentity(ctx)),
 		context: contextName,
 		resources: []WatchRequest{},
 		stop:    make(chan struct{}),
@@ -247,45 +250,28 @@ func (c *WatchController) watchSingleResource(watcher *ResourceWatcher, req Watc
 	resourceKey := fmt.Sprintf("%s:%s:%s:%s", req.APIVersion, req.Kind, req.Namespace, req.Name)
 	c.logger.Infof("watchSingleResource called for: %s", resourceKey)
 	
-	if watcher.context == "" {
-		watcher.context = c.kubernetesService.GetCurrentContext()
-		c.logger.Infof("Using default context: %s", watcher.context)
-	}
-
-	if err := c.kubernetesService.SetContext(watcher.context); err != nil {
-		c.logger.Errorf("Failed to set context %s: %s", watcher.context, err.Error())
+	clients, err := watcher.service.GetClients(watcher.context)
+	if err != nil {
+		c.logger.Errorf("Failed to get clients for context %s: %s", watcher.context, err.Error())
 		c.sendError(watcher, fmt.Sprintf("Failed to set context: %s", err.Error()))
 		return
 	}
 
-	config, err := c.kubernetesService.GetConfig()
+	info, err := watcher.service.ResolveResource(clients.Context, req.APIVersion, req.Kind, req.Plural)
 	if err != nil {
-		c.sendError(watcher, fmt.Sprintf("Failed to get config: %s", err.Error()))
+		c.sendError(watcher, fmt.Sprintf("Failed to resolve resource %s %s: %s", req.APIVersion, req.Kind, err.Error()))
 		return
 	}
-
-	apiVersionParts := strings.Split(req.APIVersion, "/")
-	if len(apiVersionParts) != 2 {
-		c.sendError(watcher, fmt.Sprintf("Invalid apiVersion: %s", req.APIVersion))
-		return
-	}
-
-	plural := req.Plural
-	if plural == "" {
-		plural = strings.ToLower(req.Kind) + "s"
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		c.sendError(watcher, fmt.Sprintf("Failed to create dynamic client: %s", err.Error()))
-		return
+	namespace := watchNamespace(req, info)
+	for _, verb := range []string{"list", "watch"} {
+		if err := watcher.service.Authorize(clients.Context, verb, info, namespace, req.Name); err != nil {
+			c.sendError(watcher, fmt.Sprintf("Failed to watch resource %s %s: %s", req.Kind, req.Name, err.Error()))
+			return
+		}
 	}
 
-	gvr := schema.GroupVersionResource{
-		Group:    apiVersionParts[0],
-		Version:  apiVersionParts[1],
-		Resource: plural,
-	}
+	dynamicClient := clients.Dynamic
+	gvr := info.GVR
 
 	// Check if informer already exists for this resource
 	watcher.informersMu.Lock()
@@ -299,7 +285,7 @@ func (c *WatchController) watchSingleResource(watcher *ResourceWatcher, req Watc
 	watcher.informersMu.Unlock()
 
 	// Create dynamic informer factory
-	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, time.Second*30, req.Namespace, func(options *metav1.ListOptions) {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, time.Second*30, namespace, func(options *metav1.ListOptions) {
 		options.FieldSelector = fmt.Sprintf("metadata.name=%s", req.Name)
 	})
 
@@ -378,47 +364,29 @@ func (c *WatchController) watchSingleResource(watcher *ResourceWatcher, req Watc
 }
 
 func (c *WatchController) updateResource(watcher *ResourceWatcher, req WatchRequest) {
-	if watcher.context == "" {
-		watcher.context = c.kubernetesService.GetCurrentContext()
-	}
-
-	if err := c.kubernetesService.SetContext(watcher.context); err != nil {
+	clients, err := watcher.service.GetClients(watcher.context)
+	if err != nil {
 		c.sendError(watcher, fmt.Sprintf("Failed to set context: %s", err.Error()))
 		return
 	}
 
-	config, err := c.kubernetesService.GetConfig()
+	info, err := watcher.service.ResolveResource(clients.Context, req.APIVersion, req.Kind, req.Plural)
 	if err != nil {
-		c.sendError(watcher, fmt.Sprintf("Failed to get config: %s", err.Error()))
+		c.sendError(watcher, fmt.Sprintf("Failed to resolve resource %s %s: %s", req.APIVersion, req.Kind, err.Error()))
 		return
 	}
-
-	apiVersionParts := strings.Split(req.APIVersion, "/")
-	if len(apiVersionParts) != 2 {
-		c.sendError(watcher, fmt.Sprintf("Invalid apiVersion: %s", req.APIVersion))
-		return
-	}
-
-	plural := req.Plural
-	if plural == "" {
-		plural = strings.ToLower(req.Kind) + "s"
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		c.sendError(watcher, fmt.Sprintf("Failed to create dynamic client: %s", err.Error()))
+	namespace := watchNamespace(req, info)
+	if err := watcher.service.Authorize(clients.Context, "get", info, namespace, req.Name); err != nil {
+		c.sendError(watcher, fmt.Sprintf("Failed to get resource: %s", err.Error()))
 		return
 	}
 
-	gvr := schema.GroupVersionResource{
-		Group:    apiVersionParts[0],
-		Version:  apiVersionParts[1],
-		Resource: plural,
-	}
+	dynamicClient := clients.Dynamic
+	gvr := info.GVR
 
 	var resource *unstructured.Unstructured
-	if req.Namespace != "" && req.Namespace != "undefined" && req.Namespace != "null" {
-		resource, err = dynamicClient.Resource(gvr).Namespace(req.Namespace).Get(context.Background(), req.Name, metav1.GetOptions{})
+	if namespace != "" {
+		resource, err = dynamicClient.Resource(gvr).Namespace(namespace).Get(context.Background(), req.Name, metav1.GetOptions{})
 	} else {
 		resource, err = dynamicClient.Resource(gvr).Get(context.Background(), req.Name, metav1.GetOptions{})
 	}
@@ -448,6 +416,15 @@ func (c *WatchController) updateResource(watcher *ResourceWatcher, req WatchRequ
 	})
 }
 
+// watchNamespace returns the namespace to watch req in, ignoring any
+// namespace sent for a cluster-scoped kind.
+func watchNamespace(req WatchRequest, info services.ResourceInfo) string {
+	if !info.Namespaced || req.Namespace == "undefined" || req.Namespace == "null" {
+		return ""
+	}
+	return req.Namespace
+}
+
 func (c *WatchController) sendMessage(watcher *ResourceWatcher, msg WatchMessage) {
 	watcher.mu.Lock()
 	defer watcher.mu.Unlock()
@@ -1,15 +1,24 @@
 package sso
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"crossview-go-server/api/middlewares"
 	"crossview-go-server/lib"
+	"crossview-go-server/models"
 	"crossview-go-server/services"
 )
 
+const (
+	samlRequestCookie = "crossview_saml_request"
+	samlRequestMaxAge = 300
+)
+
 type SSOController struct {
 	logger    lib.Logger
 	env       lib.Env
@@ -26,38 +35,110 @@ func NewSSOController(logger lib.Logger, env lib.Env, ssoService services.SSOSer
 
 func (c *SSOController) GetStatus(ctx *gin.Context) {
 	ssoConfig := c.ssoService.GetSSOStatus()
+	providers := []gin.H{}
+	if ssoConfig.Enabled {
+		for _, provider := range ssoConfig.EnabledOIDCProviders() {
+			providers = append(providers, gin.H{
+				"name":        provider.Name,
+				"displayName": provider.DisplayName,
+				"loginPath":   "/api/auth/oidc/" + provider.Name,
+				"discovery":   discoveryStatusJSON(c.ssoService.GetOIDCDiscoveryStatus(provider.Name)),
+			})
+		}
+	}
+	oidc := gin.H{
+		"enabled":   ssoConfig.OIDC.Enabled,
+		"providers": providers,
+	}
 	ctx.JSON(http.StatusOK, gin.H{
 		"enabled": ssoConfig.Enabled,
-		"oidc": gin.H{
-			"enabled": ssoConfig.OIDC.Enabled,
-		},
+		"oidc":    oidc,
 		"saml": gin.H{
 			"enabled": ssoConfig.SAML.Enabled,
 		},
 	})
 }
 
+// discoveryStatusJSON reports the last discovery check as "pending", "ok" or
+// "error". The status is public, so the error itself is only logged.
+func discoveryStatusJSON(status services.OIDCDiscoveryStatus) gin.H {
+	if !status.Checked {
+		return gin.H{"status": "pending"}
+	}
+	result := gin.H{
+		"status":    "ok",
+		"issuer":    status.Issuer,
+		"checkedAt": status.CheckedAt,
+	}
+	if status.Error != "" {
+		result["status"] = "error"
+	}
+	return result
+}
+
+// oidcCallbackPath is where provider's callback is routed; the unnamed
+// provider keeps the original path.
+func oidcCallbackPath(provider string) string {
+	if provider == "" {
+		return "/api/auth/oidc/callback"
+	}
+	return "/api/auth/oidc/" + url.PathEscape(provider) + "/callback"
+}
+
 func (c *SSOController) InitiateOIDC(ctx *gin.Context) {
+	provider := ctx.Param("provider")
 	// Build callback URL dynamically from request origin
-	callbackURL := c.buildCallbackURL(ctx, "/api/auth/oidc/callback")
+	callbackURL := c.buildCallbackURL(ctx, oidcCallbackPath(provider))
 	
-	authURL, err := c.ssoService.InitiateOIDC(ctx.Request.Context(), callbackURL)
+	authURL, login, err := c.ssoService.InitiateOIDC(ctx.Request.Context(), provider, callbackURL)
 	if err != nil {
 		c.logger.Errorf("OIDC initiation failed: %s", err.Error())
 		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 	
+	session := sessions.Default(ctx)
+	session.Set("oidcProvider", login.Provider)
+	session.Set("oidcState", login.State)
+	session.Set("oidcNonce", login.Nonce)
+	session.Set("oidcCodeVerifier", login.CodeVerifier)
+	if err := session.Save(); err != nil {
+		c.logger.Errorf("Failed to save session: %s", err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	
 	ctx.Redirect(http.StatusFound, authURL)
 }
 
+// takeOIDCLogin returns the login InitiateOIDC stored in the session and
+// removes it, so each state is accepted at most once.
+func (c *SSOController) takeOIDCLogin(session sessions.Session) *services.OIDCLogin {
+	login := &services.OIDCLogin{}
+	login.Provider, _ = session.Get("oidcProvider").(string)
+	login.State, _ = session.Get("oidcState").(string)
+	login.Nonce, _ = session.Get("oidcNonce").(string)
+	login.CodeVerifier, _ = session.Get("oidcCodeVerifier").(string)
+	
+	session.Delete("oidcProvider")
+	session.Delete("oidcState")
+	session.Delete("oidcNonce")
+	session.Delete("oidcCodeVerifier")
+	if err := session.Save(); err != nil {
+		c.logger.Errorf("Failed to save session: %s", err.Error())
+	}
+	return login
+}
+
 func (c *SSOController) HandleOIDCCallback(ctx *gin.Context) {
+	provider := ctx.Param("provider")
 	code := ctx.Query("code")
 	state := ctx.Query("state")
 	errorParam := ctx.Query("error")
 	
 	if errorParam != "" {
 		c.logger.Warnf("OIDC callback error: %s", errorParam)
+		auditSSOLogin(ctx, nil, models.AuditFailure, oidcAuditDetails(provider, errors.New("provider returned "+errorParam)))
 		frontendURL := c.env.CORSOrigin
 		ctx.Redirect(http.StatusFound, frontendURL+"/login?error=sso_failed")
 		return
@@ -71,19 +152,30 @@ func (c *SSOController) HandleOIDCCallback(ctx *gin.Context) {
 	}
 	
 	// Build callback URL dynamically from request origin
-	callbackURL := c.buildCallbackURL(ctx, "/api/auth/oidc/callback")
+	callbackURL := c.buildCallbackURL(ctx, oidcCallbackPath(provider))
+	
+	session := sessions.Default(ctx)
+	login := c.takeOIDCLogin(session)
 	
-	user, err := c.ssoService.HandleOIDCCallback(ctx.Request.Context(), code, state, callbackURL)
+	user, record, err := c.ssoService.HandleOIDCCallback(ctx.Request.Context(), provider, code, state, callbackURL, login)
+	if errors.Is(err, services.ErrSSOLoginDenied) {
+		auditSSOLogin(ctx, nil, models.AuditDenied, oidcAuditDetails(provider, err))
+		frontendURL := c.env.CORSOrigin
+		ctx.Redirect(http.StatusFound, frontendURL+"/login?error=sso_denied")
+		return
+	}
 	if err != nil {
 		c.logger.Errorf("OIDC callback failed: %s", err.Error())
+		auditSSOLogin(ctx, nil, models.AuditFailure, oidcAuditDetails(provider, err))
 		frontendURL := c.env.CORSOrigin
 		ctx.Redirect(http.StatusFound, frontendURL+"/login?error=sso_failed")
 		return
 	}
 	
-	session := sessions.Default(ctx)
+	session.Set("sessionId", record.ID)
 	session.Set("userId", user.ID)
 	session.Set("userRole", user.Role)
+	session.Set("userGroups", user.Groups)
 	if err := session.Save(); err != nil {
 		c.logger.Errorf("Failed to save session: %s", err.Error())
 		frontendURL := c.env.CORSOrigin
@@ -92,24 +184,53 @@ func (c *SSOController) HandleOIDCCallback(ctx *gin.Context) {
 	}
 	
 	c.logger.Infof("OIDC login successful: userId=%d, username=%s", user.ID, user.Username)
+	auditSSOLogin(ctx, user, models.AuditSuccess, oidcAuditDetails(provider, nil))
 	frontendURL := c.env.CORSOrigin
 	ctx.Redirect(http.StatusFound, frontendURL)
 }
 
-func (c *SSOController) InitiateSAML(ctx *gin.Context) {
-	// Build callback URL dynamically from request origin
-	callbackURL := c.buildCallbackURL(ctx, "/api/auth/saml/callback")
+// HandleBackChannelLogout receives the logout token a provider posts when a
+// user's IdP session ends, and ends the matching Crossview sessions.
+func (c *SSOController) HandleBackChannelLogout(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	logoutToken := ctx.PostForm("logout_token")
+	if logoutToken == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "logout_token is required"})
+		return
+	}
+	
+	if _, err := c.ssoService.HandleBackChannelLogout(ctx.Request.Context(), ctx.Param("provider"), logoutToken); err != nil {
+		c.logger.Warnf("OIDC back-channel logout rejected: %s", err.Error())
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
 	
-	authURL, err := c.ssoService.InitiateSAML(ctx.Request.Context(), callbackURL)
+	ctx.Status(http.StatusOK)
+}
+
+func (c *SSOController) InitiateSAML(ctx *gin.Context) {
+	authURL, requestID, err := c.ssoService.InitiateSAML(ctx.Request.Context())
 	if err != nil {
 		c.logger.Errorf("SAML initiation failed: %s", err.Error())
 		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 	
+	c.setSAMLRequestCookie(ctx, requestID, samlRequestMaxAge)
 	ctx.Redirect(http.StatusFound, authURL)
 }
 
+func (c *SSOController) GetSAMLMetadata(ctx *gin.Context) {
+	metadata, err := c.ssoService.GetSAMLMetadata(ctx.Request.Context())
+	if err != nil {
+		c.logger.Errorf("SAML metadata failed: %s", err.Error())
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	
+	ctx.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
 func (c *SSOController) HandleSAMLCallback(ctx *gin.Context) {
 	samlResponse := ctx.PostForm("SAMLResponse")
 	if samlResponse == "" {
@@ -119,20 +240,23 @@ func (c *SSOController) HandleSAMLCallback(ctx *gin.Context) {
 		return
 	}
 	
-	// Build callback URL dynamically from request origin
-	callbackURL := c.buildCallbackURL(ctx, "/api/auth/saml/callback")
+	requestID, _ := ctx.Cookie(samlRequestCookie)
+	c.setSAMLRequestCookie(ctx, "", -1)
 	
-	user, err := c.ssoService.HandleSAMLCallback(ctx.Request.Context(), samlResponse, callbackURL)
+	user, record, err := c.ssoService.HandleSAMLCallback(ctx.Request.Context(), samlResponse, requestID)
 	if err != nil {
 		c.logger.Errorf("SAML callback failed: %s", err.Error())
+		auditSSOLogin(ctx, nil, models.AuditFailure, "SAML: "+err.Error())
 		frontendURL := c.env.CORSOrigin
 		ctx.Redirect(http.StatusFound, frontendURL+"/login?error=sso_failed")
 		return
 	}
 	
 	session := sessions.Default(ctx)
+	session.Set("sessionId", record.ID)
 	session.Set("userId", user.ID)
 	session.Set("userRole", user.Role)
+	session.Set("userGroups", user.Groups)
 	if err := session.Save(); err != nil {
 		c.logger.Errorf("Failed to save session: %s", err.Error())
 		frontendURL := c.env.CORSOrigin
@@ -141,10 +265,50 @@ func (c *SSOController) HandleSAMLCallback(ctx *gin.Context) {
 	}
 	
 	c.logger.Infof("SAML login successful: userId=%d, username=%s", user.ID, user.Username)
+	auditSSOLogin(ctx, user, models.AuditSuccess, "SAML")
 	frontendURL := c.env.CORSOrigin
 	ctx.Redirect(http.StatusFound, frontendURL)
 }
 
+// auditSSOLogin records the outcome of an SSO callback. user is nil unless
+// the login succeeded.
+func auditSSOLogin(ctx *gin.Context, user *models.User, outcome, details string) {
+	event := &models.AuditEvent{Action: "auth.sso_login", Outcome: outcome, Details: details}
+	if user != nil {
+		event.ActorID = &user.ID
+		event.Actor = user.Username
+		event.Target = models.UserTarget(user.ID)
+	}
+	middlewares.Audit(ctx, event)
+}
+
+// oidcAuditDetails names the OIDC provider of a login and, if it failed,
+// why.
+func oidcAuditDetails(provider string, err error) string {
+	details := "OIDC"
+	if provider != "" {
+		details += " provider " + provider
+	}
+	if err != nil {
+		details += ": " + err.Error()
+	}
+	return details
+}
+
+// setSAMLRequestCookie remembers the ID of the AuthnRequest in flight. The
+// IdP posts its response cross-site, which drops the Lax session cookie, so
+// the ID travels in a cookie of its own that allows it over HTTPS, i.e.
+// when the configured callback URL is an https one.
+func (c *SSOController) setSAMLRequestCookie(ctx *gin.Context, requestID string, maxAge int) {
+	secure := strings.HasPrefix(c.ssoService.GetSSOStatus().SAML.CallbackURL, "https://")
+	if secure {
+		ctx.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		ctx.SetSameSite(http.SameSiteLaxMode)
+	}
+	ctx.SetCookie(samlRequestCookie, requestID, maxAge, "/api/auth/saml", "", secure, true)
+}
+
 // buildCallbackURL constructs the callback URL dynamically from the request
 // Falls back to config value if request origin cannot be determined
 func (c *SSOController) buildCallbackURL(ctx *gin.Context, callbackPath string) string {
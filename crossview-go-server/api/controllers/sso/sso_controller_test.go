@@ -6,11 +6,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"crossview-go-server/lib"
 	"crossview-go-server/models"
+	"crossview-go-server/services"
 )
 
 func setupMockSSOService() MockSSOService {
@@ -18,11 +21,15 @@ func setupMockSSOService() MockSSOService {
 }
 
 type MockSSOService struct {
-	GetSSOStatusFunc        func() lib.SSOConfig
-	InitiateOIDCFunc        func(ctx context.Context, callbackURL string) (string, error)
-	HandleOIDCCallbackFunc  func(ctx context.Context, code, state string, callbackURL string) (*models.User, error)
-	InitiateSAMLFunc        func(ctx context.Context, callbackURL string) (string, error)
-	HandleSAMLCallbackFunc  func(ctx context.Context, samlResponse string, callbackURL string) (*models.User, error)
+	GetSSOStatusFunc            func() lib.SSOConfig
+	InitiateOIDCFunc            func(ctx context.Context, provider string, callbackURL string) (string, *services.OIDCLogin, error)
+	HandleOIDCCallbackFunc      func(ctx context.Context, provider string, code, state string, callbackURL string, login *services.OIDCLogin) (*models.User, *models.UserSession, error)
+	OIDCLogoutURLFunc           func(ctx context.Context, session *models.UserSession, redirectURL string) (string, error)
+	HandleBackChannelLogoutFunc func(ctx context.Context, provider string, logoutToken string) (int64, error)
+	InitiateSAMLFunc            func(ctx context.Context) (string, string, error)
+	HandleSAMLCallbackFunc      func(ctx context.Context, samlResponse string, requestID string) (*models.User, *models.UserSession, error)
+	GetSAMLMetadataFunc         func(ctx context.Context) ([]byte, error)
+	GetOIDCDiscoveryStatusFunc  func(provider string) services.OIDCDiscoveryStatus
 }
 
 func (m MockSSOService) GetSSOStatus() lib.SSOConfig {
@@ -32,34 +39,66 @@ func (m MockSSOService) GetSSOStatus() lib.SSOConfig {
 	return lib.SSOConfig{Enabled: false}
 }
 
-func (m MockSSOService) InitiateOIDC(ctx context.Context, callbackURL string) (string, error) {
+func (m MockSSOService) InitiateOIDC(ctx context.Context, provider string, callbackURL string) (string, *services.OIDCLogin, error) {
 	if m.InitiateOIDCFunc != nil {
-		return m.InitiateOIDCFunc(ctx, callbackURL)
+		return m.InitiateOIDCFunc(ctx, provider, callbackURL)
 	}
-	return "", nil
+	return "", &services.OIDCLogin{}, nil
 }
 
-func (m MockSSOService) HandleOIDCCallback(ctx context.Context, code, state string, callbackURL string) (*models.User, error) {
+func (m MockSSOService) HandleOIDCCallback(ctx context.Context, provider string, code, state string, callbackURL string, login *services.OIDCLogin) (*models.User, *models.UserSession, error) {
 	if m.HandleOIDCCallbackFunc != nil {
-		return m.HandleOIDCCallbackFunc(ctx, code, state, callbackURL)
+		return m.HandleOIDCCallbackFunc(ctx, provider, code, state, callbackURL, login)
 	}
-	return nil, nil
+	return nil, nil, nil
 }
 
-func (m MockSSOService) InitiateSAML(ctx context.Context, callbackURL string) (string, error) {
-	if m.InitiateSAMLFunc != nil {
-		return m.InitiateSAMLFunc(ctx, callbackURL)
+func (m MockSSOService) OIDCLogoutURL(ctx context.Context, session *models.UserSession, redirectURL string) (string, error) {
+	if m.OIDCLogoutURLFunc != nil {
+		return m.OIDCLogoutURLFunc(ctx, session, redirectURL)
 	}
 	return "", nil
 }
 
-func (m MockSSOService) HandleSAMLCallback(ctx context.Context, samlResponse string, callbackURL string) (*models.User, error) {
+func (m MockSSOService) HandleBackChannelLogout(ctx context.Context, provider string, logoutToken string) (int64, error) {
+	if m.HandleBackChannelLogoutFunc != nil {
+		return m.HandleBackChannelLogoutFunc(ctx, provider, logoutToken)
+	}
+	return 0, nil
+}
+
+func (m MockSSOService) InitiateSAML(ctx context.Context) (string, string, error) {
+	if m.InitiateSAMLFunc != nil {
+		return m.InitiateSAMLFunc(ctx)
+	}
+	return "", "", nil
+}
+
+func (m MockSSOService) HandleSAMLCallback(ctx context.Context, samlResponse string, requestID string) (*models.User, *models.UserSession, error) {
 	if m.HandleSAMLCallbackFunc != nil {
-		return m.HandleSAMLCallbackFunc(ctx, samlResponse, callbackURL)
+		return m.HandleSAMLCallbackFunc(ctx, samlResponse, requestID)
+	}
+	return nil, nil, nil
+}
+
+func (m MockSSOService) GetSAMLMetadata(ctx context.Context) ([]byte, error) {
+	if m.GetSAMLMetadataFunc != nil {
+		return m.GetSAMLMetadataFunc(ctx)
 	}
 	return nil, nil
 }
 
+func (m MockSSOService) ValidateOIDCDiscovery(ctx context.Context) error {
+	return nil
+}
+
+func (m MockSSOService) GetOIDCDiscoveryStatus(provider string) services.OIDCDiscoveryStatus {
+	if m.GetOIDCDiscoveryStatusFunc != nil {
+		return m.GetOIDCDiscoveryStatusFunc(provider)
+	}
+	return services.OIDCDiscoveryStatus{}
+}
+
 func TestSSOController_GetStatus(t *testing.T) {
 	router := setupTestRouter()
 	logger := setupTestLogger()
@@ -96,14 +135,138 @@ func TestSSOController_GetStatus(t *testing.T) {
 	}
 }
 
+func TestSSOController_GetStatus_Providers(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	mockService := setupMockSSOService()
+
+	mockService.GetSSOStatusFunc = func() lib.SSOConfig {
+		return lib.SSOConfig{
+			Enabled: true,
+			OIDC:    lib.OIDCConfig{Enabled: true},
+			OIDCProviders: []lib.OIDCConfig{
+				{Name: "employees", DisplayName: "Employees", Enabled: true},
+				{Name: "retired", DisplayName: "Retired", Enabled: false},
+				{Name: "contractors", DisplayName: "Contractors", Enabled: true},
+			},
+		}
+	}
+	mockService.GetOIDCDiscoveryStatusFunc = func(provider string) services.OIDCDiscoveryStatus {
+		if provider != "contractors" {
+			return services.OIDCDiscoveryStatus{}
+		}
+		return services.OIDCDiscoveryStatus{
+			Checked:   true,
+			Issuer:    "https://contractors.okta.com",
+			CheckedAt: time.Now(),
+			Error:     "failed to fetch discovery document",
+		}
+	}
+
+	controller := NewSSOController(logger, env, mockService)
+	router.GET("/api/auth/sso/status", controller.GetStatus)
+
+	req, _ := http.NewRequest("GET", "/api/auth/sso/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response struct {
+		OIDC struct {
+			Providers []struct {
+				Name        string                 `json:"name"`
+				DisplayName string                 `json:"displayName"`
+				LoginPath   string                 `json:"loginPath"`
+				Discovery   map[string]interface{} `json:"discovery"`
+			} `json:"providers"`
+		} `json:"oidc"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	providers := response.OIDC.Providers
+	if len(providers) != 2 || providers[0].Name != "employees" || providers[1].Name != "contractors" {
+		t.Fatalf("Expected the enabled providers in order, got %+v", providers)
+	}
+	if providers[0].DisplayName != "Employees" || providers[0].LoginPath != "/api/auth/oidc/employees" {
+		t.Errorf("Unexpected provider: %+v", providers[0])
+	}
+	if providers[0].Discovery["status"] != "pending" {
+		t.Errorf("Expected discovery status 'pending', got %v", providers[0].Discovery["status"])
+	}
+	if providers[1].Discovery["status"] != "error" || providers[1].Discovery["issuer"] != "https://contractors.okta.com" {
+		t.Errorf("Expected the discovery error to be reported, got %v", providers[1].Discovery)
+	}
+	if _, exposed := providers[1].Discovery["error"]; exposed {
+		t.Errorf("Expected the error detail not to be exposed, got %v", providers[1].Discovery)
+	}
+}
+
+func TestSSOController_NamedProviderRoutes(t *testing.T) {
+	router := setupTestRouter()
+	store := setupTestSessionStore()
+	router.Use(sessions.Sessions("session", store))
+
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	mockService := setupMockSSOService()
+
+	var initiated, handled, callbackURL string
+	mockService.InitiateOIDCFunc = func(ctx context.Context, provider string, url string) (string, *services.OIDCLogin, error) {
+		initiated, callbackURL = provider, url
+		return "http://example.com/auth", &services.OIDCLogin{Provider: provider, State: "test-state"}, nil
+	}
+	mockService.HandleOIDCCallbackFunc = func(ctx context.Context, provider string, code, state string, url string, login *services.OIDCLogin) (*models.User, *models.UserSession, error) {
+		handled = provider
+		if login.Provider != provider {
+			t.Errorf("Expected the session login for '%s', got '%s'", provider, login.Provider)
+		}
+		return &models.User{ID: 1, Username: "testuser", Role: models.RoleViewer}, &models.UserSession{ID: "test-session"}, nil
+	}
+
+	controller := NewSSOController(logger, env, mockService)
+	router.GET("/api/auth/oidc/callback", controller.HandleOIDCCallback)
+	router.GET("/api/auth/oidc/:provider", controller.InitiateOIDC)
+	router.GET("/api/auth/oidc/:provider/callback", controller.HandleOIDCCallback)
+
+	req, _ := http.NewRequest("GET", "/api/auth/oidc/contractors", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if initiated != "contractors" {
+		t.Errorf("Expected provider 'contractors', got '%s'", initiated)
+	}
+	if !strings.HasSuffix(callbackURL, "/api/auth/oidc/contractors/callback") {
+		t.Errorf("Expected the provider's callback URL, got '%s'", callbackURL)
+	}
+
+	req, _ = http.NewRequest("GET", "/api/auth/oidc/contractors/callback?code=test-code&state=test-state", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if handled != "contractors" {
+		t.Errorf("Expected callback for 'contractors', got '%s'", handled)
+	}
+	if w.Header().Get("Location") != env.CORSOrigin {
+		t.Errorf("Expected redirect to '%s', got '%s'", env.CORSOrigin, w.Header().Get("Location"))
+	}
+}
+
 func TestSSOController_InitiateOIDC_Success(t *testing.T) {
 	router := setupTestRouter()
+	store := setupTestSessionStore()
+	router.Use(sessions.Sessions("session", store))
+
 	logger := setupTestLogger()
 	env := setupTestEnv()
 	mockService := setupMockSSOService()
 
-	mockService.InitiateOIDCFunc = func(ctx context.Context, callbackURL string) (string, error) {
-		return "http://example.com/auth?client_id=test", nil
+	mockService.InitiateOIDCFunc = func(ctx context.Context, provider string, callbackURL string) (string, *services.OIDCLogin, error) {
+		return "http://example.com/auth?client_id=test", &services.OIDCLogin{State: "test-state"}, nil
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -130,8 +293,8 @@ func TestSSOController_InitiateOIDC_Error(t *testing.T) {
 	env := setupTestEnv()
 	mockService := setupMockSSOService()
 
-	mockService.InitiateOIDCFunc = func(ctx context.Context, callbackURL string) (string, error) {
-		return "", http.ErrMissingFile
+	mockService.InitiateOIDCFunc = func(ctx context.Context, provider string, callbackURL string) (string, *services.OIDCLogin, error) {
+		return "", nil, http.ErrMissingFile
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -163,8 +326,8 @@ func TestSSOController_HandleOIDCCallback_Success(t *testing.T) {
 		Role:     "user",
 	}
 
-	mockService.HandleOIDCCallbackFunc = func(ctx context.Context, code, state string, callbackURL string) (*models.User, error) {
-		return testUser, nil
+	mockService.HandleOIDCCallbackFunc = func(ctx context.Context, provider string, code, state string, callbackURL string, login *services.OIDCLogin) (*models.User, *models.UserSession, error) {
+		return testUser, &models.UserSession{ID: "test-session"}, nil
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -185,6 +348,50 @@ func TestSSOController_HandleOIDCCallback_Success(t *testing.T) {
 	}
 }
 
+func TestSSOController_HandleOIDCCallback_UsesSessionLogin(t *testing.T) {
+	router := setupTestRouter()
+	store := setupTestSessionStore()
+	router.Use(sessions.Sessions("session", store))
+
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	mockService := setupMockSSOService()
+
+	issued := &services.OIDCLogin{State: "test-state", Nonce: "test-nonce", CodeVerifier: "test-verifier"}
+	mockService.InitiateOIDCFunc = func(ctx context.Context, provider string, callbackURL string) (string, *services.OIDCLogin, error) {
+		return "http://example.com/auth", issued, nil
+	}
+	var received []services.OIDCLogin
+	mockService.HandleOIDCCallbackFunc = func(ctx context.Context, provider string, code, state string, callbackURL string, login *services.OIDCLogin) (*models.User, *models.UserSession, error) {
+		received = append(received, *login)
+		return &models.User{ID: 1, Username: "testuser"}, &models.UserSession{ID: "test-session"}, nil
+	}
+
+	controller := NewSSOController(logger, env, mockService)
+
+	router.GET("/api/auth/oidc", controller.InitiateOIDC)
+	router.GET("/api/auth/oidc/callback", controller.HandleOIDCCallback)
+
+	req, _ := http.NewRequest("GET", "/api/auth/oidc", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	cookies := w.Result().Cookies()
+
+	req, _ = http.NewRequest("GET", "/api/auth/oidc/callback?code=test-code&state=test-state", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 callback, got %d", len(received))
+	}
+	if received[0] != *issued {
+		t.Errorf("Expected the issued login, got %+v", received[0])
+	}
+}
+
 func TestSSOController_HandleOIDCCallback_ErrorParam(t *testing.T) {
 	router := setupTestRouter()
 	store := setupTestSessionStore()
@@ -250,8 +457,8 @@ func TestSSOController_HandleOIDCCallback_ServiceError(t *testing.T) {
 	env := setupTestEnv()
 	mockService := setupMockSSOService()
 
-	mockService.HandleOIDCCallbackFunc = func(ctx context.Context, code, state string, callbackURL string) (*models.User, error) {
-		return nil, http.ErrMissingFile
+	mockService.HandleOIDCCallbackFunc = func(ctx context.Context, provider string, code, state string, callbackURL string, login *services.OIDCLogin) (*models.User, *models.UserSession, error) {
+		return nil, nil, http.ErrMissingFile
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -273,14 +480,46 @@ func TestSSOController_HandleOIDCCallback_ServiceError(t *testing.T) {
 	}
 }
 
+func TestSSOController_HandleOIDCCallback_Denied(t *testing.T) {
+	router := setupTestRouter()
+	store := setupTestSessionStore()
+	router.Use(sessions.Sessions("session", store))
+
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	mockService := setupMockSSOService()
+
+	mockService.HandleOIDCCallbackFunc = func(ctx context.Context, provider string, code, state string, callbackURL string, login *services.OIDCLogin) (*models.User, *models.UserSession, error) {
+		return nil, nil, services.ErrSSOLoginDenied
+	}
+
+	controller := NewSSOController(logger, env, mockService)
+
+	router.GET("/api/auth/oidc/callback", controller.HandleOIDCCallback)
+
+	req, _ := http.NewRequest("GET", "/api/auth/oidc/callback?code=test-code", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusFound, w.Code)
+	}
+
+	location := w.Header().Get("Location")
+	expectedLocation := env.CORSOrigin + "/login?error=sso_denied"
+	if location != expectedLocation {
+		t.Errorf("Expected redirect to '%s', got '%s'", expectedLocation, location)
+	}
+}
+
 func TestSSOController_InitiateSAML_Success(t *testing.T) {
 	router := setupTestRouter()
 	logger := setupTestLogger()
 	env := setupTestEnv()
 	mockService := setupMockSSOService()
 
-	mockService.InitiateSAMLFunc = func(ctx context.Context, callbackURL string) (string, error) {
-		return "http://example.com/saml/login", nil
+	mockService.InitiateSAMLFunc = func(ctx context.Context) (string, string, error) {
+		return "http://example.com/saml/login", "id-123", nil
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -299,6 +538,11 @@ func TestSSOController_InitiateSAML_Success(t *testing.T) {
 	if location != "http://example.com/saml/login" {
 		t.Errorf("Expected redirect to 'http://example.com/saml/login', got '%s'", location)
 	}
+
+	cookie := w.Header().Get("Set-Cookie")
+	if !strings.Contains(cookie, samlRequestCookie+"=id-123") || !strings.Contains(cookie, "HttpOnly") {
+		t.Errorf("Expected request ID cookie, got '%s'", cookie)
+	}
 }
 
 func TestSSOController_InitiateSAML_Error(t *testing.T) {
@@ -307,8 +551,8 @@ func TestSSOController_InitiateSAML_Error(t *testing.T) {
 	env := setupTestEnv()
 	mockService := setupMockSSOService()
 
-	mockService.InitiateSAMLFunc = func(ctx context.Context, callbackURL string) (string, error) {
-		return "", http.ErrMissingFile
+	mockService.InitiateSAMLFunc = func(ctx context.Context) (string, string, error) {
+		return "", "", http.ErrMissingFile
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -340,8 +584,10 @@ func TestSSOController_HandleSAMLCallback_Success(t *testing.T) {
 		Role:     "user",
 	}
 
-	mockService.HandleSAMLCallbackFunc = func(ctx context.Context, samlResponse string, callbackURL string) (*models.User, error) {
-		return testUser, nil
+	var gotRequestID string
+	mockService.HandleSAMLCallbackFunc = func(ctx context.Context, samlResponse string, requestID string) (*models.User, *models.UserSession, error) {
+		gotRequestID = requestID
+		return testUser, &models.UserSession{ID: "test-session"}, nil
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -351,6 +597,7 @@ func TestSSOController_HandleSAMLCallback_Success(t *testing.T) {
 	formData := bytes.NewBufferString("SAMLResponse=test-saml-response")
 	req, _ := http.NewRequest("POST", "/api/auth/saml/callback", formData)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: samlRequestCookie, Value: "id-123"})
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -362,6 +609,10 @@ func TestSSOController_HandleSAMLCallback_Success(t *testing.T) {
 	if location != env.CORSOrigin {
 		t.Errorf("Expected redirect to '%s', got '%s'", env.CORSOrigin, location)
 	}
+
+	if gotRequestID != "id-123" {
+		t.Errorf("Expected request ID 'id-123', got '%s'", gotRequestID)
+	}
 }
 
 func TestSSOController_HandleSAMLCallback_MissingResponse(t *testing.T) {
@@ -401,8 +652,8 @@ func TestSSOController_HandleSAMLCallback_ServiceError(t *testing.T) {
 	env := setupTestEnv()
 	mockService := setupMockSSOService()
 
-	mockService.HandleSAMLCallbackFunc = func(ctx context.Context, samlResponse string, callbackURL string) (*models.User, error) {
-		return nil, http.ErrMissingFile
+	mockService.HandleSAMLCallbackFunc = func(ctx context.Context, samlResponse string, requestID string) (*models.User, *models.UserSession, error) {
+		return nil, nil, http.ErrMissingFile
 	}
 
 	controller := NewSSOController(logger, env, mockService)
@@ -426,3 +677,101 @@ func TestSSOController_HandleSAMLCallback_ServiceError(t *testing.T) {
 	}
 }
 
+
+func TestSSOController_GetSAMLMetadata(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	mockService := setupMockSSOService()
+
+	mockService.GetSAMLMetadataFunc = func(ctx context.Context) ([]byte, error) {
+		return []byte("<EntityDescriptor/>"), nil
+	}
+
+	controller := NewSSOController(logger, env, mockService)
+
+	router.GET("/api/auth/saml/metadata", controller.GetSAMLMetadata)
+
+	req, _ := http.NewRequest("GET", "/api/auth/saml/metadata", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Content-Type") != "application/samlmetadata+xml" {
+		t.Errorf("Unexpected content type '%s'", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestSSOController_InitiateSAML_SecureCookieFromConfig(t *testing.T) {
+	router := setupTestRouter()
+	mockService := setupMockSSOService()
+	mockService.GetSSOStatusFunc = func() lib.SSOConfig {
+		return lib.SSOConfig{Enabled: true, SAML: lib.SAMLConfig{Enabled: true, CallbackURL: "https://crossview.example.com/api/auth/saml/callback"}}
+	}
+	mockService.InitiateSAMLFunc = func(ctx context.Context) (string, string, error) {
+		return "https://idp.example.com/sso", "id-123", nil
+	}
+	controller := NewSSOController(setupTestLogger(), setupTestEnv(), mockService)
+	router.GET("/api/auth/saml", controller.InitiateSAML)
+
+	// The request's own host and scheme don't matter.
+	req, _ := http.NewRequest("GET", "/api/auth/saml", nil)
+	req.Header.Set("X-Forwarded-Host", "attacker.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	cookie := w.Header().Get("Set-Cookie")
+	if !strings.Contains(cookie, "Secure") || !strings.Contains(cookie, "SameSite=None") {
+		t.Errorf("Expected a secure cross-site cookie for an https callback URL, got '%s'", cookie)
+	}
+}
+
+func TestSSOController_HandleBackChannelLogout(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	mockService := setupMockSSOService()
+
+	var gotProvider, gotToken string
+	mockService.HandleBackChannelLogoutFunc = func(ctx context.Context, provider string, logoutToken string) (int64, error) {
+		gotProvider, gotToken = provider, logoutToken
+		if logoutToken != "valid-token" {
+			return 0, http.ErrMissingFile
+		}
+		return 1, nil
+	}
+
+	controller := NewSSOController(logger, env, mockService)
+	router.POST("/api/auth/oidc/:provider/backchannel-logout", controller.HandleBackChannelLogout)
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{"valid token", "logout_token=valid-token", http.StatusOK},
+		{"rejected token", "logout_token=forged-token", http.StatusBadRequest},
+		{"missing token", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/api/auth/oidc/employees/backchannel-logout", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Expected status code %d, got %d", tt.expectedCode, w.Code)
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Expected Cache-Control no-store, got '%s'", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	if gotProvider != "employees" || gotToken != "forged-token" {
+		t.Errorf("Unexpected provider '%s' or token '%s'", gotProvider, gotToken)
+	}
+}
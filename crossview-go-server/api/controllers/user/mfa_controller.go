@@ -0,0 +1,203 @@
+package user
+
+import (
+	"net/http"
+	"time"
+
+	"crossview-go-server/api/middlewares"
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAController manages two-factor authentication for the signed-in user's
+// local account.
+type MFAController struct {
+	logger   lib.Logger
+	env      lib.Env
+	userRepo *models.UserRepository
+	mfaRepo  *models.MFARepository
+}
+
+func NewMFAController(logger lib.Logger, db lib.Database, env lib.Env) MFAController {
+	return MFAController{
+		logger:   logger,
+		env:      env,
+		userRepo: models.NewUserRepository(db.DB),
+		mfaRepo:  models.NewMFARepository(db.DB),
+	}
+}
+
+// mfaOwner returns the signed-in user. Requests authenticated with an API
+// token are refused.
+func (c *MFAController) mfaOwner(ctx *gin.Context) (*models.User, bool) {
+	if _, ok := ctx.Get(middlewares.APITokenKey); ok {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "API tokens cannot be used to manage two-factor authentication"})
+		return nil, false
+	}
+	user, err := c.userRepo.FindByID(currentUserID(ctx))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	return user, true
+}
+
+// verifyCode checks the code in the request body against the user's
+// authenticator app or recovery codes, responding with an error if it is
+// missing or wrong.
+func (c *MFAController) verifyCode(ctx *gin.Context, user *models.User) bool {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+		return false
+	}
+	valid, err := c.mfaRepo.VerifyCode(user, req.Code, time.Now())
+	if err != nil {
+		c.logger.Error("Failed to verify two-factor code: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return false
+	}
+	if !valid {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return false
+	}
+	return true
+}
+
+func (c *MFAController) GetMFA(ctx *gin.Context) {
+	user, ok := c.mfaOwner(ctx)
+	if !ok {
+		return
+	}
+
+	remaining, err := c.mfaRepo.CountRecoveryCodes(user.ID)
+	if err != nil {
+		c.logger.Error("Failed to count recovery codes: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"enabled":                user.MFAEnabled,
+		"required":               models.MFARequired(c.env.MFARequiredRoles, user.Role),
+		"recoveryCodesRemaining": remaining,
+	})
+}
+
+// EnrollMFA starts enrollment with a new secret for the user's
+// authenticator app. MFA is turned on by VerifyMFA.
+func (c *MFAController) EnrollMFA(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "mfa.enroll", models.UserTarget(currentUserID(ctx)))
+	user, ok := c.mfaOwner(ctx)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	enrollment, err := c.mfaRepo.StartEnrollment(user, c.env.MFAIssuer)
+	if err != nil {
+		c.logger.Error("Failed to start two-factor enrollment: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrollment"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollment)
+}
+
+// VerifyMFA confirms enrollment with a code from the authenticator app,
+// turns MFA on and returns the user's recovery codes.
+func (c *MFAController) VerifyMFA(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "mfa.enable", models.UserTarget(currentUserID(ctx)))
+	user, ok := c.mfaOwner(ctx)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.MFASecret == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+	if !c.verifyCode(ctx, user) {
+		return
+	}
+
+	recoveryCodes, err := c.mfaRepo.Enable(user)
+	if err != nil {
+		c.logger.Error("Failed to enable two-factor authentication: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.logger.Infof("Two-factor authentication enabled: userId=%d, username=%s", user.ID, user.Username)
+
+	ctx.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, for example
+// when they are running out.
+func (c *MFAController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "mfa.recovery_codes_regenerate", models.UserTarget(currentUserID(ctx)))
+	user, ok := c.mfaOwner(ctx)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !c.verifyCode(ctx, user) {
+		return
+	}
+
+	recoveryCodes, err := c.mfaRepo.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.logger.Error("Failed to regenerate recovery codes: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+
+	c.logger.Infof("Recovery codes regenerated: userId=%d, username=%s", user.ID, user.Username)
+
+	ctx.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
+
+// DisableMFA turns MFA off after checking a code. Users whose role
+// requires MFA can't turn it off.
+func (c *MFAController) DisableMFA(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "mfa.disable", models.UserTarget(currentUserID(ctx)))
+	user, ok := c.mfaOwner(ctx)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if models.MFARequired(c.env.MFARequiredRoles, user.Role) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	if !c.verifyCode(ctx, user) {
+		return
+	}
+
+	if err := c.mfaRepo.Disable(user.ID); err != nil {
+		c.logger.Error("Failed to disable two-factor authentication: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.logger.Infof("Two-factor authentication disabled: userId=%d, username=%s", user.ID, user.Username)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+func setupMFAControllerTest(t *testing.T, env lib.Env) (*gin.Engine, *gorm.DB, *models.User) {
+	_, db := setupUserControllerTest(t)
+	user, _ := createTestUserWithSessions(t, db, "alice", 0)
+
+	controller := NewMFAController(lib.GetLogger(), lib.Database{DB: db}, env)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", user.ID)
+		c.Next()
+	})
+	router.GET("/api/users/me/mfa", controller.GetMFA)
+	router.DELETE("/api/users/me/mfa", controller.DisableMFA)
+	router.POST("/api/users/me/mfa/enroll", controller.EnrollMFA)
+	router.POST("/api/users/me/mfa/verify", controller.VerifyMFA)
+	router.POST("/api/users/me/mfa/recovery-codes", controller.RegenerateRecoveryCodes)
+	return router, db, user
+}
+
+func TestMFAController_EnrollAndDisable(t *testing.T) {
+	router, db, user := setupMFAControllerTest(t, lib.Env{MFAIssuer: "Crossview"})
+
+	if w := serve(router, "POST", "/api/users/me/mfa/verify", map[string]string{"code": "123456"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected verify before enroll to fail, got status %d", w.Code)
+	}
+
+	w := serve(router, "POST", "/api/users/me/mfa/enroll", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var enrollment models.MFAEnrollment
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	if enrollment.Secret == "" || enrollment.URL == "" || enrollment.QRCode == "" {
+		t.Fatalf("Unexpected enrollment: %+v", enrollment)
+	}
+
+	if w := serve(router, "POST", "/api/users/me/mfa/verify", map[string]string{"code": "12345"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a wrong code to be refused, got status %d", w.Code)
+	}
+	code, _ := totp.GenerateCode(enrollment.Secret, time.Now())
+	w = serve(router, "POST", "/api/users/me/mfa/verify", map[string]string{"code": code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var verified struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &verified)
+	if len(verified.RecoveryCodes) == 0 {
+		t.Fatal("Expected recovery codes")
+	}
+
+	w = serve(router, "GET", "/api/users/me/mfa", nil)
+	var status map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &status)
+	if status["enabled"] != true || status["recoveryCodesRemaining"] != float64(len(verified.RecoveryCodes)) {
+		t.Errorf("Unexpected status: %v", status)
+	}
+	if w := serve(router, "POST", "/api/users/me/mfa/enroll", nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected enrolling again to conflict, got status %d", w.Code)
+	}
+
+	if w := serve(router, "DELETE", "/api/users/me/mfa", map[string]string{"code": verified.RecoveryCodes[0]}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if disabled, _ := models.NewUserRepository(db).FindByID(user.ID); disabled.MFAEnabled {
+		t.Error("Expected MFA to be disabled")
+	}
+}
+
+func TestMFAController_RequiredRoleCannotDisable(t *testing.T) {
+	router, db, user := setupMFAControllerTest(t, lib.Env{MFAIssuer: "Crossview", MFARequiredRoles: []string{"editor"}})
+	repo := models.NewMFARepository(db)
+	repo.StartEnrollment(user, "Crossview")
+	recoveryCodes, _ := repo.Enable(user)
+
+	if w := serve(router, "DELETE", "/api/users/me/mfa", map[string]string{"code": recoveryCodes[0]}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestUserController_ResetUserMFA(t *testing.T) {
+	_, db := setupUserControllerTest(t)
+	user, _ := createTestUserWithSessions(t, db, "alice", 0)
+	repo := models.NewMFARepository(db)
+	repo.StartEnrollment(user, "Crossview")
+	repo.Enable(user)
+
+	controller := NewUserController(lib.GetLogger(), lib.Database{DB: db})
+	router := gin.New()
+	router.DELETE("/api/users/:id/mfa", controller.ResetUserMFA)
+
+	if w := serve(router, "DELETE", "/api/users/"+uintToString(user.ID)+"/mfa", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	reset, _ := models.NewUserRepository(db).FindByID(user.ID)
+	if reset.MFAEnabled || reset.MFASecret != "" {
+		t.Errorf("Expected MFA to be reset, got %+v", reset)
+	}
+}
@@ -0,0 +1,167 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"crossview-go-server/api/middlewares"
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTokenLifetimeDays = 90
+	maxTokenLifetimeDays     = 365
+)
+
+// TokenController manages the signed-in user's personal API tokens.
+type TokenController struct {
+	logger    lib.Logger
+	tokenRepo *models.APITokenRepository
+}
+
+func NewTokenController(logger lib.Logger, db lib.Database) TokenController {
+	return TokenController{
+		logger:    logger,
+		tokenRepo: models.NewAPITokenRepository(db.DB),
+	}
+}
+
+// tokenOwner returns the signed-in user's ID. Requests authenticated with
+// an API token are refused, so that a token can't mint broader tokens.
+func tokenOwner(ctx *gin.Context) (uint, bool) {
+	if _, ok := ctx.Get(middlewares.APITokenKey); ok {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "API tokens cannot be used to manage API tokens"})
+		return 0, false
+	}
+	userID := currentUserID(ctx)
+	if userID == 0 {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func (c *TokenController) GetTokens(ctx *gin.Context) {
+	userID, ok := tokenOwner(ctx)
+	if !ok {
+		return
+	}
+
+	tokens, err := c.tokenRepo.FindByUserID(userID)
+	if err != nil {
+		c.logger.Error("Failed to get API tokens: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API tokens"})
+		return
+	}
+	if tokens == nil {
+		tokens = []models.APIToken{}
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (c *TokenController) CreateToken(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "token.create", "")
+	userID, ok := tokenOwner(ctx)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name" binding:"required"`
+		ExpiresInDays int      `json:"expiresInDays"`
+		ReadOnly      bool     `json:"readOnly"`
+		Contexts      []string `json:"contexts"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Token name is required"})
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultTokenLifetimeDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > maxTokenLifetimeDays {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "expiresInDays must be between 1 and " + strconv.Itoa(maxTokenLifetimeDays)})
+		return
+	}
+
+	var contexts []string
+	for _, name := range req.Contexts {
+		if name = strings.TrimSpace(name); name != "" {
+			contexts = append(contexts, name)
+		}
+	}
+
+	token := &models.APIToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		ReadOnly:  req.ReadOnly,
+		Contexts:  contexts,
+		ExpiresAt: time.Now().AddDate(0, 0, req.ExpiresInDays),
+	}
+	raw, err := c.tokenRepo.Create(token)
+	if err != nil {
+		c.logger.Error("Failed to create API token: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token"})
+		return
+	}
+
+	c.logger.Infof("API token created: userId=%d, tokenId=%d, name=%s, readOnly=%t", userID, token.ID, token.Name, token.ReadOnly)
+	middlewares.AuditAction(ctx, "token.create", "token:"+strconv.FormatUint(uint64(token.ID), 10))
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":         token.ID,
+		"name":       token.Name,
+		"prefix":     token.Prefix,
+		"read_only":  token.ReadOnly,
+		"contexts":   token.Contexts,
+		"expires_at": token.ExpiresAt,
+		"created_at": token.CreatedAt,
+		"token":      raw,
+	})
+}
+
+func (c *TokenController) RevokeToken(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "token.revoke", "token:"+ctx.Param("tokenId"))
+	userID, ok := tokenOwner(ctx)
+	if !ok {
+		return
+	}
+	tokenID, err := strconv.ParseUint(ctx.Param("tokenId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	if err := c.tokenRepo.DeleteForUser(userID, uint(tokenID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		c.logger.Error("Failed to revoke API token: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API token"})
+		return
+	}
+
+	c.logger.Infof("API token revoked: userId=%d, tokenId=%d", userID, tokenID)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// currentUserID returns the ID the auth middleware identified the caller
+// by, or 0.
+func currentUserID(ctx *gin.Context) uint {
+	if id, ok := ctx.Get("userId"); ok {
+		if userID, ok := id.(uint); ok {
+			return userID
+		}
+	}
+	return 0
+}
@@ -0,0 +1,90 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"crossview-go-server/api/middlewares"
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTokenControllerTest(t *testing.T, viaToken bool) *gin.Engine {
+	_, db := setupUserControllerTest(t)
+	controller := NewTokenController(lib.GetLogger(), lib.Database{DB: db})
+	authenticate := func(c *gin.Context) {
+		c.Set("userId", uint(1))
+		if viaToken {
+			c.Set(middlewares.APITokenKey, &models.APIToken{UserID: 1})
+		}
+		c.Next()
+	}
+	router := gin.New()
+	router.GET("/api/users/me/tokens", authenticate, controller.GetTokens)
+	router.POST("/api/users/me/tokens", authenticate, controller.CreateToken)
+	router.DELETE("/api/users/me/tokens/:tokenId", authenticate, controller.RevokeToken)
+	return router
+}
+
+func TestTokenController_Lifecycle(t *testing.T) {
+	router := setupTokenControllerTest(t, false)
+
+	w := serve(router, "POST", "/api/users/me/tokens", map[string]interface{}{"name": "ci", "readOnly": true, "contexts": []string{"prod"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if raw, _ := created["token"].(string); !strings.HasPrefix(raw, models.APITokenPrefix) {
+		t.Errorf("Expected the new token in the response, got %v", created["token"])
+	}
+
+	w = serve(router, "GET", "/api/users/me/tokens", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if strings.Contains(w.Body.String(), created["token"].(string)) || strings.Contains(w.Body.String(), "token_hash") {
+		t.Error("Expected listed tokens not to expose the token or its hash")
+	}
+	var listed []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0]["read_only"] != true {
+		t.Fatalf("Unexpected tokens: %v", listed)
+	}
+
+	id := strconv.Itoa(int(listed[0]["id"].(float64)))
+	if w := serve(router, "DELETE", "/api/users/me/tokens/"+id, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := serve(router, "DELETE", "/api/users/me/tokens/"+id, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a revoked token, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestTokenController_CreateToken_Validation(t *testing.T) {
+	router := setupTokenControllerTest(t, false)
+
+	for _, body := range []map[string]interface{}{
+		{},
+		{"name": "  "},
+		{"name": "ci", "expiresInDays": 1000},
+		{"name": "ci", "expiresInDays": -1},
+	} {
+		if w := serve(router, "POST", "/api/users/me/tokens", body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %v, got %d", http.StatusBadRequest, body, w.Code)
+		}
+	}
+}
+
+func TestTokenController_RefusesTokenAuth(t *testing.T) {
+	router := setupTokenControllerTest(t, true)
+
+	if w := serve(router, "POST", "/api/users/me/tokens", map[string]interface{}{"name": "escalate"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
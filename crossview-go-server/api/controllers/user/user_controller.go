@@ -1,24 +1,31 @@
 package user
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"crossview-go-server/api/middlewares"
 	"crossview-go-server/lib"
 	"crossview-go-server/models"
+	"gorm.io/gorm"
 )
 
 type UserController struct {
-	logger   lib.Logger
-	userRepo *models.UserRepository
+	logger      lib.Logger
+	userRepo    *models.UserRepository
+	sessionRepo *models.SessionRepository
+	mfaRepo     *models.MFARepository
 }
 
 func NewUserController(logger lib.Logger, db lib.Database) UserController {
 	userRepo := models.NewUserRepository(db.DB)
 	return UserController{
-		logger:   logger,
-		userRepo: userRepo,
+		logger:      logger,
+		userRepo:    userRepo,
+		sessionRepo: models.NewSessionRepository(db.DB),
+		mfaRepo:     models.NewMFARepository(db.DB),
 	}
 }
 
@@ -34,6 +41,7 @@ func (c *UserController) GetUsers(ctx *gin.Context) {
 }
 
 func (c *UserController) CreateUser(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.create", "")
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Email    string `json:"email" binding:"required"`
@@ -47,13 +55,14 @@ func (c *UserController) CreateUser(ctx *gin.Context) {
 	}
 
 	if req.Role == "" {
-		req.Role = "user"
+		req.Role = models.RoleEditor
 	}
 
-	if req.Role != "admin" && req.Role != "user" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Role must be 'admin' or 'user'"})
+	if !models.IsValidRole(req.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Role must be 'viewer', 'editor' or 'admin'"})
 		return
 	}
+	req.Role = models.NormalizeRole(req.Role)
 
 	existingUser, _ := c.userRepo.FindByUsername(req.Username)
 	if existingUser != nil {
@@ -86,6 +95,7 @@ func (c *UserController) CreateUser(ctx *gin.Context) {
 	}
 
 	c.logger.Infof("User created successfully: userId=%d, username=%s, email=%s, role=%s", user.ID, user.Username, user.Email, user.Role)
+	middlewares.AuditAction(ctx, "user.create", models.UserTarget(user.ID))
 
 	ctx.JSON(http.StatusOK, gin.H{
 		"id":       user.ID,
@@ -97,6 +107,7 @@ func (c *UserController) CreateUser(ctx *gin.Context) {
 }
 
 func (c *UserController) UpdateUser(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.update", "user:"+ctx.Param("id"))
 	idParam := ctx.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
 	if err != nil {
@@ -144,12 +155,15 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		user.Email = req.Email
 	}
 
+	roleChanged := false
 	if req.Role != "" {
-		if req.Role != "admin" && req.Role != "user" {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Role must be 'admin' or 'user'"})
+		if !models.IsValidRole(req.Role) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Role must be 'viewer', 'editor' or 'admin'"})
 			return
 		}
-		user.Role = req.Role
+		role := models.NormalizeRole(req.Role)
+		roleChanged = role != models.NormalizeRole(user.Role)
+		user.Role = role
 	}
 
 	if req.Password != "" {
@@ -160,6 +174,19 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 		}
 	}
 
+	// The role is saved on its own first, so that the last-admin check and
+	// the change happen in one transaction.
+	if roleChanged {
+		if err := c.userRepo.UpdateRole(user.ID, user.Role); errors.Is(err, models.ErrLastAdmin) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Cannot change the role of the last admin"})
+			return
+		} else if err != nil {
+			c.logger.Error("Failed to update user role: " + err.Error())
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+			return
+		}
+	}
+
 	if err := c.userRepo.Update(user); err != nil {
 		c.logger.Error("Failed to update user: " + err.Error())
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
@@ -168,6 +195,16 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 
 	c.logger.Infof("User updated successfully: userId=%d, username=%s, email=%s, role=%s", user.ID, user.Username, user.Email, user.Role)
 
+	// A new role or password only takes hold once the user logs in again.
+	if roleChanged || req.Password != "" {
+		ended, err := c.sessionRepo.DeleteByUserID(user.ID)
+		if err != nil {
+			c.logger.Error("Failed to end sessions after role or password change: " + err.Error())
+		} else {
+			c.logger.Infof("Ended sessions after role or password change: userId=%d, sessions=%d", user.ID, ended)
+		}
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"id":       user.ID,
 		"username": user.Username,
@@ -178,3 +215,327 @@ func (c *UserController) UpdateUser(ctx *gin.Context) {
 	})
 }
 
+// DeleteUser removes a user and ends their sessions. The last admin can't
+// be deleted.
+func (c *UserController) DeleteUser(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.delete", "user:"+ctx.Param("id"))
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := c.userRepo.FindByID(uint(id))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := c.userRepo.Delete(user.ID); err != nil {
+		if errors.Is(err, models.ErrLastAdmin) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the last admin"})
+			return
+		}
+		c.logger.Error("Failed to delete user: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	c.logger.Infof("User deleted: userId=%d, username=%s, deletedBy=%d", user.ID, user.Username, currentUserID(ctx))
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// GetMe returns the signed-in user's own account.
+func (c *UserController) GetMe(ctx *gin.Context) {
+	user, err := c.userRepo.FindByID(currentUserID(ctx))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// accountOwner returns the signed-in user for a change to their own
+// account. Requests authenticated with an API token are refused, so that a
+// leaked token can't be used to take over the account.
+func (c *UserController) accountOwner(ctx *gin.Context) (*models.User, bool) {
+	if _, ok := ctx.Get(middlewares.APITokenKey); ok {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "API tokens cannot be used to change account settings"})
+		return nil, false
+	}
+	user, err := c.userRepo.FindByID(currentUserID(ctx))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+	return user, true
+}
+
+// UpdateMe changes the signed-in user's email and name. Username and role
+// can only be changed by an admin.
+func (c *UserController) UpdateMe(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "account.update", models.UserTarget(currentUserID(ctx)))
+	user, ok := c.accountOwner(ctx)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email     string  `json:"email"`
+		FirstName *string `json:"firstName"`
+		LastName  *string `json:"lastName"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if req.Email != "" && req.Email != user.Email {
+		existingEmail, _ := c.userRepo.FindByEmail(req.Email)
+		if existingEmail != nil && existingEmail.ID != user.ID {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Email already exists"})
+			return
+		}
+		user.Email = req.Email
+	}
+	if req.FirstName != nil {
+		user.FirstName = req.FirstName
+	}
+	if req.LastName != nil {
+		user.LastName = req.LastName
+	}
+
+	if err := c.userRepo.Update(user); err != nil {
+		c.logger.Error("Failed to update profile: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.logger.Infof("Profile updated: userId=%d, username=%s, email=%s", user.ID, user.Username, user.Email)
+
+	ctx.JSON(http.StatusOK, user)
+}
+
+// ChangePassword sets a new password for the signed-in user after checking
+// their current one, and ends their other sessions.
+func (c *UserController) ChangePassword(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "account.change_password", models.UserTarget(currentUserID(ctx)))
+	user, ok := c.accountOwner(ctx)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"currentPassword" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Current and new password are required"})
+		return
+	}
+
+	if !user.VerifyPassword(req.CurrentPassword) {
+		c.logger.Warnf("Password change with wrong current password: userId=%d, username=%s", user.ID, user.Username)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		c.logger.Error("Failed to hash password: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	if err := c.userRepo.Update(user); err != nil {
+		c.logger.Error("Failed to change password: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	ended, err := c.sessionRepo.DeleteOthers(user.ID, ctx.GetString(middlewares.SessionIDKey))
+	if err != nil {
+		c.logger.Error("Failed to end sessions after password change: " + err.Error())
+	}
+
+	c.logger.Infof("Password changed: userId=%d, username=%s, endedSessions=%d", user.ID, user.Username, ended)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// UnlockUser clears a user's failed logins, lifting a lockout early.
+func (c *UserController) UnlockUser(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.unlock", "user:"+ctx.Param("id"))
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := c.userRepo.FindByID(uint(id))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := c.userRepo.Unlock(user.ID); err != nil {
+		c.logger.Error("Failed to unlock user: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	c.logger.Infof("User unlocked: userId=%d, username=%s", user.ID, user.Username)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// ResetUserMFA turns off a user's two-factor authentication, for a user
+// who has lost both their authenticator and their recovery codes. If their
+// role requires MFA they enroll again at their next login.
+func (c *UserController) ResetUserMFA(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.mfa_reset", "user:"+ctx.Param("id"))
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := c.userRepo.FindByID(uint(id))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := c.mfaRepo.Disable(user.ID); err != nil {
+		c.logger.Error("Failed to reset two-factor authentication: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	c.logger.Infof("Two-factor authentication reset: userId=%d, username=%s", user.ID, user.Username)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+func (c *UserController) GetUserIdentities(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := c.userRepo.FindByID(uint(id))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	identities, err := c.userRepo.FindIdentitiesByUserID(user.ID)
+	if err != nil {
+		c.logger.Error("Failed to get user identities: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user identities"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, identities)
+}
+
+func (c *UserController) UnlinkUserIdentity(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.identity_unlink", "user:"+ctx.Param("id"))
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	identityID, err := strconv.ParseUint(ctx.Param("identityId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid identity ID"})
+		return
+	}
+
+	if err := c.userRepo.DeleteIdentity(uint(id), uint(identityID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Identity not found"})
+			return
+		}
+		c.logger.Error("Failed to unlink identity: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink identity"})
+		return
+	}
+
+	c.logger.Infof("Identity unlinked: userId=%d, identityId=%d", id, identityID)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
+
+func (c *UserController) GetUserSessions(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := c.userRepo.FindByID(uint(id))
+	if err != nil || user == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	userSessions, err := c.sessionRepo.FindByUserID(user.ID)
+	if err != nil {
+		c.logger.Error("Failed to get user sessions: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user sessions"})
+		return
+	}
+	if userSessions == nil {
+		userSessions = []models.UserSession{}
+	}
+
+	ctx.JSON(http.StatusOK, userSessions)
+}
+
+func (c *UserController) RevokeUserSession(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.session_revoke", "user:"+ctx.Param("id"))
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := c.sessionRepo.DeleteForUser(uint(id), ctx.Param("sessionId")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.logger.Error("Failed to revoke session: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.logger.Infof("Session revoked: userId=%d", id)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+func (c *UserController) RevokeUserSessions(ctx *gin.Context) {
+	middlewares.AuditAction(ctx, "user.sessions_revoke", "user:"+ctx.Param("id"))
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	ended, err := c.sessionRepo.DeleteByUserID(uint(id))
+	if err != nil {
+		c.logger.Error("Failed to revoke sessions: " + err.Error())
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.logger.Infof("Sessions revoked: userId=%d, sessions=%d", id, ended)
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": ended})
+}
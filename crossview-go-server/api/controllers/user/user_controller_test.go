@@ -0,0 +1,294 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"crossview-go-server/api/middlewares"
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupUserControllerTest(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.UserIdentity{}, &models.UserSession{}, &models.APIToken{}, &models.RecoveryCode{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	controller := NewUserController(lib.GetLogger(), lib.Database{DB: db})
+	router := gin.New()
+	router.PUT("/api/users/:id", controller.UpdateUser)
+	router.DELETE("/api/users/:id", controller.DeleteUser)
+	router.GET("/api/users/:id/sessions", controller.GetUserSessions)
+	router.DELETE("/api/users/:id/sessions", controller.RevokeUserSessions)
+	router.DELETE("/api/users/:id/sessions/:sessionId", controller.RevokeUserSession)
+	router.POST("/api/users/:id/unlock", controller.UnlockUser)
+	return router, db
+}
+
+func createTestUserWithSessions(t *testing.T, db *gorm.DB, username string, count int) (*models.User, []*models.UserSession) {
+	user := &models.User{Username: username, Email: username + "@example.com", Role: models.RoleEditor}
+	if err := user.SetPassword("secret"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	repo := models.NewSessionRepository(db)
+	var userSessions []*models.UserSession
+	for i := 0; i < count; i++ {
+		session := &models.UserSession{UserID: user.ID, Provider: "local"}
+		if err := repo.Create(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		userSessions = append(userSessions, session)
+	}
+	return user, userSessions
+}
+
+func serve(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUserController_Sessions(t *testing.T) {
+	router, db := setupUserControllerTest(t)
+	user, userSessions := createTestUserWithSessions(t, db, "alice", 2)
+	other, otherSessions := createTestUserWithSessions(t, db, "bob", 1)
+	base := "/api/users/" + uintToString(user.ID) + "/sessions"
+
+	w := serve(router, "GET", base, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var listed []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	if len(listed) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(listed))
+	}
+	if _, ok := listed[0]["id_token"]; ok {
+		t.Error("Expected the ID token not to be exposed")
+	}
+
+	if w := serve(router, "DELETE", base+"/"+otherSessions[0].ID, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected another user's session to be out of reach, got %d", w.Code)
+	}
+	if w := serve(router, "DELETE", base+"/"+userSessions[0].ID, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = serve(router, "DELETE", base, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response["revoked"] != float64(1) {
+		t.Errorf("Expected 1 remaining session to be revoked, got %v", response["revoked"])
+	}
+
+	remaining, _ := models.NewSessionRepository(db).FindByUserID(other.ID)
+	if len(remaining) != 1 {
+		t.Errorf("Expected the other user's session to remain, got %d", len(remaining))
+	}
+}
+
+func TestUserController_UpdateUser_RoleChangeEndsSessions(t *testing.T) {
+	router, db := setupUserControllerTest(t)
+	user, _ := createTestUserWithSessions(t, db, "alice", 2)
+	path := "/api/users/" + uintToString(user.ID)
+	repo := models.NewSessionRepository(db)
+
+	if w := serve(router, "PUT", path, map[string]string{"email": "alice@corp.example.com"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if remaining, _ := repo.FindByUserID(user.ID); len(remaining) != 2 {
+		t.Errorf("Expected an email change to keep sessions, got %d", len(remaining))
+	}
+
+	if w := serve(router, "PUT", path, map[string]string{"role": "viewer"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if remaining, _ := repo.FindByUserID(user.ID); len(remaining) != 0 {
+		t.Errorf("Expected a role change to end all sessions, got %d", len(remaining))
+	}
+}
+
+func TestUserController_UpdateUser_PasswordResetEndsSessions(t *testing.T) {
+	router, db := setupUserControllerTest(t)
+	user, _ := createTestUserWithSessions(t, db, "alice", 2)
+	path := "/api/users/" + uintToString(user.ID)
+
+	if w := serve(router, "PUT", path, map[string]string{"password": "new-password-123"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if remaining, _ := models.NewSessionRepository(db).FindByUserID(user.ID); len(remaining) != 0 {
+		t.Errorf("Expected a password reset to end all sessions, got %d", len(remaining))
+	}
+}
+
+func TestUserController_UnlockUser(t *testing.T) {
+	router, db := setupUserControllerTest(t)
+	user, _ := createTestUserWithSessions(t, db, "alice", 0)
+	repo := models.NewUserRepository(db)
+
+	now := time.Now()
+	lockedUntil := now.Add(time.Hour)
+	user.FailedLoginCount = 5
+	user.LastFailedLoginAt = &now
+	user.LockedUntil = &lockedUntil
+	if err := repo.UpdateLoginState(user); err != nil {
+		t.Fatalf("Failed to lock user: %v", err)
+	}
+
+	if w := serve(router, "POST", "/api/users/"+uintToString(user.ID)+"/unlock", nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	unlocked, _ := repo.FindByID(user.ID)
+	if unlocked.FailedLoginCount != 0 || unlocked.LastFailedLoginAt != nil || unlocked.LockedUntil != nil {
+		t.Errorf("Expected the lockout to be cleared, got %+v", unlocked)
+	}
+
+	if w := serve(router, "POST", "/api/users/999/unlock", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+// setupAccountTest serves the self-service routes as user, signed in with
+// session.
+func setupAccountTest(t *testing.T, db *gorm.DB, user *models.User, session *models.UserSession) *gin.Engine {
+	controller := NewUserController(lib.GetLogger(), lib.Database{DB: db})
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", user.ID)
+		c.Set(middlewares.SessionIDKey, session.ID)
+		c.Next()
+	})
+	router.GET("/api/users/me", controller.GetMe)
+	router.PUT("/api/users/me", controller.UpdateMe)
+	router.POST("/api/users/me/change-password", controller.ChangePassword)
+	return router
+}
+
+func TestUserController_DeleteUser(t *testing.T) {
+	router, db := setupUserControllerTest(t)
+	admin, _ := createTestUserWithSessions(t, db, "admin", 0)
+	db.Model(admin).Update("role", models.RoleAdmin)
+	user, _ := createTestUserWithSessions(t, db, "alice", 2)
+
+	if w := serve(router, "DELETE", "/api/users/"+uintToString(user.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if found, _ := models.NewUserRepository(db).FindByID(user.ID); found != nil {
+		t.Error("Expected the user to be deleted")
+	}
+	if remaining, _ := models.NewSessionRepository(db).FindByUserID(user.ID); len(remaining) != 0 {
+		t.Errorf("Expected the user's sessions to end, got %d", len(remaining))
+	}
+
+	if w := serve(router, "DELETE", "/api/users/"+uintToString(admin.ID), nil); w.Code != http.StatusConflict {
+		t.Errorf("Expected the last admin to be kept, got status %d", w.Code)
+	}
+	if w := serve(router, "PUT", "/api/users/"+uintToString(admin.ID), map[string]string{"role": "editor"}); w.Code != http.StatusConflict {
+		t.Errorf("Expected the last admin to keep their role, got status %d", w.Code)
+	}
+	if w := serve(router, "DELETE", "/api/users/999", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestUserController_Profile(t *testing.T) {
+	_, db := setupUserControllerTest(t)
+	createTestUserWithSessions(t, db, "bob", 0)
+	user, userSessions := createTestUserWithSessions(t, db, "alice", 1)
+	router := setupAccountTest(t, db, user, userSessions[0])
+
+	w := serve(router, "GET", "/api/users/me", nil)
+	var profile map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &profile)
+	if w.Code != http.StatusOK || profile["username"] != "alice" {
+		t.Fatalf("Unexpected profile (status %d): %v", w.Code, profile)
+	}
+	if _, ok := profile["password_hash"]; ok {
+		t.Error("Expected the password hash to stay private")
+	}
+
+	if w := serve(router, "PUT", "/api/users/me", map[string]string{"email": "bob@example.com"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected another user's email to be refused, got status %d", w.Code)
+	}
+	w = serve(router, "PUT", "/api/users/me", map[string]string{"email": "alice@corp.example.com", "firstName": "Alice", "role": "admin"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	updated, _ := models.NewUserRepository(db).FindByID(user.ID)
+	if updated.Email != "alice@corp.example.com" || updated.FirstName == nil || *updated.FirstName != "Alice" {
+		t.Errorf("Expected the profile to be updated, got %+v", updated)
+	}
+	if updated.Role != models.RoleEditor {
+		t.Errorf("Expected users not to change their own role, got '%s'", updated.Role)
+	}
+}
+
+func TestUserController_ChangePassword(t *testing.T) {
+	_, db := setupUserControllerTest(t)
+	user, userSessions := createTestUserWithSessions(t, db, "alice", 3)
+	router := setupAccountTest(t, db, user, userSessions[0])
+	path := "/api/users/me/change-password"
+
+	if w := serve(router, "POST", path, map[string]string{"currentPassword": "wrong", "newPassword": "new-secret"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a wrong current password to be refused, got status %d", w.Code)
+	}
+	if w := serve(router, "POST", path, map[string]string{"currentPassword": "secret", "newPassword": "new-secret"}); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	changed, _ := models.NewUserRepository(db).FindByID(user.ID)
+	if !changed.VerifyPassword("new-secret") || changed.VerifyPassword("secret") {
+		t.Error("Expected the new password to replace the old one")
+	}
+	remaining, _ := models.NewSessionRepository(db).FindByUserID(user.ID)
+	if len(remaining) != 1 || remaining[0].ID != userSessions[0].ID {
+		t.Errorf("Expected only the current session to remain, got %d", len(remaining))
+	}
+}
+
+func TestUserController_ChangePassword_APIToken(t *testing.T) {
+	_, db := setupUserControllerTest(t)
+	user, _ := createTestUserWithSessions(t, db, "alice", 0)
+	controller := NewUserController(lib.GetLogger(), lib.Database{DB: db})
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", user.ID)
+		c.Set(middlewares.APITokenKey, &models.APIToken{UserID: user.ID})
+		c.Next()
+	})
+	router.POST("/api/users/me/change-password", controller.ChangePassword)
+
+	if w := serve(router, "POST", "/api/users/me/change-password", map[string]string{"currentPassword": "secret", "newPassword": "x"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected API tokens to be refused, got status %d", w.Code)
+	}
+}
+
+func uintToString(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
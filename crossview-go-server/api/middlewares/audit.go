@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDKey is the context key holding the ID of the request, taken from
+// the X-Request-ID header when the client sent a usable one.
+const RequestIDKey = "requestId"
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// auditKey holds the request's AuditMiddleware, and auditRecordedKey
+	// is set once a handler has recorded an event for the request.
+	auditKey         = "audit"
+	auditRecordedKey = "auditRecorded"
+	// auditActionKey and auditTargetKey hold what AuditAction was given,
+	// and auditContextKey what AuditContext was.
+	auditActionKey  = "auditAction"
+	auditTargetKey  = "auditTarget"
+	auditContextKey = "auditContext"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// AuditMiddleware assigns every request an ID and writes the audit log.
+// Handlers record what they did with Audit, or name it with AuditAction and
+// leave the middleware to record it once they are done. Other mutating API
+// requests are recorded by route.
+type AuditMiddleware struct {
+	handler   lib.RequestHandler
+	logger    lib.Logger
+	auditRepo *models.AuditRepository
+	userRepo  *models.UserRepository
+}
+
+func NewAuditMiddleware(handler lib.RequestHandler, logger lib.Logger, db lib.Database) AuditMiddleware {
+	return AuditMiddleware{
+		handler:   handler,
+		logger:    logger,
+		auditRepo: models.NewAuditRepository(db.DB),
+		userRepo:  models.NewUserRepository(db.DB),
+	}
+}
+
+func (m AuditMiddleware) Setup() {
+	m.logger.Info("Setting up audit middleware")
+	m.handler.Gin.Use(m.Handler())
+}
+
+func (m AuditMiddleware) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(requestIDHeader, requestID)
+		c.Set(auditKey, m)
+
+		c.Next()
+
+		if c.GetBool(auditRecordedKey) {
+			return
+		}
+		event := &models.AuditEvent{
+			Action:  c.GetString(auditActionKey),
+			Target:  c.GetString(auditTargetKey),
+			Outcome: statusOutcome(c.Writer.Status()),
+		}
+		if event.Action == "" {
+			if !auditedRequest(c.Request) {
+				return
+			}
+			route := c.FullPath()
+			if route == "" {
+				route = c.Request.URL.Path
+			}
+			event.Action = c.Request.Method + " " + route
+			event.Target = c.Request.URL.RequestURI()
+		}
+		m.record(c, event)
+	}
+}
+
+// AuditAction names the action the request performs and its target. The
+// middleware records the event once the handler is done, taking the
+// outcome from the response status.
+func AuditAction(c *gin.Context, action, target string) {
+	c.Set(auditActionKey, action)
+	c.Set(auditTargetKey, target)
+}
+
+// AuditContext names the Kubernetes context the request acts on, for
+// requests that don't name it in the context query parameter.
+func AuditContext(c *gin.Context, contextName string) {
+	c.Set(auditContextKey, contextName)
+}
+
+// Audit records event for the request, filling in the actor, request ID,
+// source IP and Kubernetes context from the request where event leaves them
+// empty. Recording an event stops the middleware logging the request
+// itself. It does nothing if the audit middleware is not installed.
+func Audit(c *gin.Context, event *models.AuditEvent) {
+	value, ok := c.Get(auditKey)
+	if !ok {
+		return
+	}
+	value.(AuditMiddleware).record(c, event)
+	c.Set(auditRecordedKey, true)
+}
+
+func (m AuditMiddleware) record(c *gin.Context, event *models.AuditEvent) {
+	if event.ActorID == nil {
+		if userID := contextUserID(c); userID != 0 {
+			event.ActorID = &userID
+		}
+	}
+	if event.Actor == "" {
+		if username := c.GetString("username"); username != "" {
+			event.Actor = username
+		} else if event.ActorID != nil {
+			if user, err := m.userRepo.FindByID(*event.ActorID); err == nil && user != nil {
+				event.Actor = user.Username
+			}
+		}
+	}
+	if event.Context == "" {
+		event.Context = c.GetString(auditContextKey)
+	}
+	if event.Context == "" {
+		event.Context = c.Query("context")
+	}
+	if event.RequestID == "" {
+		event.RequestID = c.GetString(RequestIDKey)
+	}
+	if event.SourceIP == "" {
+		event.SourceIP = c.ClientIP()
+	}
+	if event.Outcome == "" {
+		event.Outcome = models.AuditSuccess
+	}
+
+	if err := m.auditRepo.Create(event); err != nil {
+		m.logger.Errorf("Failed to write audit event %s: %v", event.Action, err)
+	}
+}
+
+// auditedRequest reports whether the middleware logs req when no handler
+// recorded an event for it: API calls that may change something.
+func auditedRequest(req *http.Request) bool {
+	if !strings.HasPrefix(req.URL.Path, "/api/") {
+		return false
+	}
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func statusOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden, status == http.StatusTooManyRequests:
+		return models.AuditDenied
+	case status >= http.StatusBadRequest:
+		return models.AuditFailure
+	default:
+		return models.AuditSuccess
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
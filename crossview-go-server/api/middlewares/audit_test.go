@@ -0,0 +1,121 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAuditTest(t *testing.T) (*gin.Engine, *models.AuditRepository) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.AuditEvent{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	user := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "x", Role: models.RoleAdmin}
+	db.Create(user)
+
+	middleware := NewAuditMiddleware(setupTestRequestHandler(), setupTestLogger(), lib.Database{DB: db})
+	router := setupTestRouter()
+	router.Use(middleware.Handler())
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", user.ID)
+		c.Next()
+	})
+	return router, models.NewAuditRepository(db)
+}
+
+func auditEvents(t *testing.T, repo *models.AuditRepository) []models.AuditEvent {
+	events, _, err := repo.Find(models.AuditFilter{}, 0, 100)
+	if err != nil {
+		t.Fatalf("Failed to read audit events: %v", err)
+	}
+	return events
+}
+
+func TestAuditMiddleware_RequestID(t *testing.T) {
+	router, _ := setupAuditTest(t)
+	router.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(RequestIDKey))
+	})
+
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("X-Request-ID") != "abc-123" || w.Body.String() != "abc-123" {
+		t.Errorf("Expected the client's request ID to be kept, got '%s'", w.Header().Get("X-Request-ID"))
+	}
+
+	req, _ = http.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-Request-ID", "not a valid id\n")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if id := w.Header().Get("X-Request-ID"); len(id) != 32 {
+		t.Errorf("Expected a generated request ID, got '%s'", id)
+	}
+}
+
+func TestAuditMiddleware_RecordsMutatingRequests(t *testing.T) {
+	router, repo := setupAuditTest(t)
+	router.GET("/api/things", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.DELETE("/api/things/:id", func(c *gin.Context) { c.Status(http.StatusForbidden) })
+
+	for _, method := range []string{"GET", "DELETE"} {
+		req, _ := http.NewRequest(method, "/api/things/7?context=prod", nil)
+		if method == "GET" {
+			req, _ = http.NewRequest(method, "/api/things", nil)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	events := auditEvents(t, repo)
+	if len(events) != 1 {
+		t.Fatalf("Expected only the DELETE to be recorded, got %+v", events)
+	}
+	event := events[0]
+	if event.Action != "DELETE /api/things/:id" || event.Target != "/api/things/7?context=prod" {
+		t.Errorf("Unexpected action or target: %+v", event)
+	}
+	if event.Outcome != models.AuditDenied || event.Actor != "alice" || event.Context != "prod" || event.RequestID == "" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
+func TestAuditMiddleware_HandlerEvents(t *testing.T) {
+	router, repo := setupAuditTest(t)
+	router.POST("/api/named", func(c *gin.Context) {
+		AuditAction(c, "thing.update", "thing:7")
+		c.Status(http.StatusInternalServerError)
+	})
+	router.POST("/api/explicit", func(c *gin.Context) {
+		Audit(c, &models.AuditEvent{Action: "thing.login", Actor: "bob", Outcome: models.AuditFailure, Details: "Wrong password"})
+		c.Status(http.StatusUnauthorized)
+	})
+
+	for _, path := range []string{"/api/named", "/api/explicit"} {
+		req, _ := http.NewRequest("POST", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	events := auditEvents(t, repo)
+	if len(events) != 2 {
+		t.Fatalf("Expected one event per request, got %+v", events)
+	}
+	explicit, named := events[0], events[1]
+	if named.Action != "thing.update" || named.Target != "thing:7" || named.Outcome != models.AuditFailure {
+		t.Errorf("Unexpected named event: %+v", named)
+	}
+	if explicit.Action != "thing.login" || explicit.Actor != "bob" || explicit.Details != "Wrong password" {
+		t.Errorf("Unexpected explicit event: %+v", explicit)
+	}
+}
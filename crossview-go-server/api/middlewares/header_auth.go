@@ -3,6 +3,7 @@ package middlewares
 import (
 	"crypto/rand"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"crossview-go-server/lib"
@@ -57,10 +58,25 @@ func (m HeaderAuthMiddleware) Handler() gin.HandlerFunc {
 			}
 		}
 		c.Set("userId", user.ID)
+		c.Set("username", user.Username)
+		if groups := headerGroups(c.GetHeader(m.env.AuthGroupsHeader)); len(groups) > 0 {
+			c.Set("userGroups", groups)
+		}
 		c.Next()
 	}
 }
 
+// headerGroups splits a comma separated groups header.
+func headerGroups(value string) []string {
+	var groups []string
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
 func headerRandomPassword() string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, 32)
@@ -13,7 +13,10 @@ var Module = fx.Options(
 	fx.Provide(NewSessionAuthMiddleware),
 	fx.Provide(NewHeaderAuthMiddleware),
 	fx.Provide(NewNoAuthMiddleware),
+	fx.Provide(NewTokenAuthMiddleware),
 	fx.Provide(NewAuthMiddleware),
+	fx.Provide(NewPermissionMiddleware),
+	fx.Provide(NewAuditMiddleware),
 	fx.Provide(NewMiddlewares),
 )
 
@@ -26,10 +29,12 @@ type Middlewares []IMiddleware
 func NewMiddlewares(
 	corsMiddleware CorsMiddleware,
 	sessionMiddleware SessionMiddleware,
+	auditMiddleware AuditMiddleware,
 ) Middlewares {
 	return Middlewares{
 		corsMiddleware,
 		sessionMiddleware,
+		auditMiddleware,
 	}
 }
 
@@ -52,13 +57,19 @@ func NewAuthMiddleware(
 	sessionAuth SessionAuthMiddleware,
 	headerAuth HeaderAuthMiddleware,
 	noAuth NoAuthMiddleware,
+	tokenAuth TokenAuthMiddleware,
 ) AuthMiddleware {
+	var handler gin.HandlerFunc
 	switch env.AuthMode {
 	case "header":
-		return AuthMiddleware{handler: headerAuth.Handler()}
+		handler = headerAuth.Handler()
 	case "none":
-		return AuthMiddleware{handler: noAuth.Handler()}
+		handler = noAuth.Handler()
 	default:
-		return AuthMiddleware{handler: sessionAuth.Handler()}
+		handler = sessionAuth.Handler()
 	}
+	// API tokens are checked first in every mode. They live in the
+	// database, so header and none modes, which run without one, reject
+	// them.
+	return AuthMiddleware{handler: tokenAuth.Handler(handler)}
 }
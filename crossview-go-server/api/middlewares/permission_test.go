@@ -0,0 +1,145 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupPermissionTest(t *testing.T, role string) (*gin.Engine, PermissionMiddleware) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", Role: role, PasswordHash: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+
+	middleware := PermissionMiddleware{
+		logger:   setupTestLogger(),
+		userRepo: models.NewUserRepository(db),
+		rbac: lib.RBACConfig{Roles: map[string][]string{
+			models.RoleViewer: {lib.PermissionResourcesRead},
+			models.RoleEditor: {lib.PermissionResourcesRead, lib.PermissionResourcesWrite},
+			models.RoleAdmin:  {"*"},
+		}},
+	}
+
+	router := setupTestRouter()
+	authenticate := func(c *gin.Context) {
+		c.Set("userId", user.ID)
+		c.Next()
+	}
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"role": c.GetString("userRole")})
+	}
+	router.GET("/api/resources", authenticate, middleware.Handler(), ok)
+	router.DELETE("/api/resource", authenticate, middleware.Handler(), ok)
+	router.POST("/api/contexts/add", authenticate, middleware.Handler(), ok)
+	router.GET("/api/unmapped", authenticate, middleware.Handler(), ok)
+	return router, middleware
+}
+
+func TestPermissionMiddleware_Matrix(t *testing.T) {
+	tests := []struct {
+		role   string
+		method string
+		path   string
+		want   int
+	}{
+		{models.RoleViewer, "GET", "/api/resources", http.StatusOK},
+		{models.RoleViewer, "DELETE", "/api/resource", http.StatusForbidden},
+		{models.RoleEditor, "DELETE", "/api/resource", http.StatusOK},
+		{models.RoleUser, "DELETE", "/api/resource", http.StatusOK},
+		{models.RoleEditor, "POST", "/api/contexts/add", http.StatusForbidden},
+		{models.RoleAdmin, "POST", "/api/contexts/add", http.StatusOK},
+		{models.RoleAdmin, "GET", "/api/unmapped", http.StatusForbidden},
+		{"unknown", "GET", "/api/resources", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			router, _ := setupPermissionTest(t, tt.role)
+
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestPermissionMiddleware_Unauthenticated(t *testing.T) {
+	_, middleware := setupPermissionTest(t, models.RoleAdmin)
+
+	router := setupTestRouter()
+	router.GET("/api/resources", middleware.Handler(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	req, _ := http.NewRequest("GET", "/api/resources", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestPermissionMiddleware_APITokenScope(t *testing.T) {
+	_, middleware := setupPermissionTest(t, models.RoleAdmin)
+
+	router := setupTestRouter()
+	authenticate := func(c *gin.Context) {
+		c.Set("userId", uint(1))
+		c.Set(APITokenKey, &models.APIToken{ReadOnly: true, Contexts: []string{"prod"}})
+		c.Next()
+	}
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	}
+	router.GET("/api/resources", authenticate, middleware.Handler(), ok)
+	router.DELETE("/api/resource", authenticate, middleware.Handler(), ok)
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{"GET", "/api/resources?context=prod", http.StatusOK},
+		{"GET", "/api/resources?context=staging", http.StatusForbidden},
+		{"DELETE", "/api/resource?context=prod", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status code %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestHeaderGroups(t *testing.T) {
+	groups := headerGroups(" platform, dev ,,")
+	if len(groups) != 2 || groups[0] != "platform" || groups[1] != "dev" {
+		t.Errorf("Unexpected groups: %v", groups)
+	}
+	if headerGroups("") != nil {
+		t.Error("Expected no groups for an empty header")
+	}
+}
@@ -5,13 +5,20 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"crossview-go-server/lib"
+	"crossview-go-server/models"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-contrib/sessions/redis"
 )
 
+// sessionCleanupInterval is how often expired sessions are purged from the
+// database.
+const sessionCleanupInterval = 15 * time.Minute
+
 type filteredWriter struct {
 	writer io.Writer
 }
@@ -25,16 +32,18 @@ func (w *filteredWriter) Write(p []byte) (n int, err error) {
 }
 
 type SessionMiddleware struct {
-	handler lib.RequestHandler
-	logger  lib.Logger
-	env     lib.Env
+	handler     lib.RequestHandler
+	logger      lib.Logger
+	env         lib.Env
+	sessionRepo *models.SessionRepository
 }
 
-func NewSessionMiddleware(handler lib.RequestHandler, logger lib.Logger, env lib.Env) SessionMiddleware {
+func NewSessionMiddleware(handler lib.RequestHandler, logger lib.Logger, env lib.Env, db lib.Database) SessionMiddleware {
 	return SessionMiddleware{
-		handler: handler,
-		logger:  logger,
-		env:     env,
+		handler:     handler,
+		logger:      logger,
+		env:         env,
+		sessionRepo: models.NewSessionRepository(db.DB),
 	}
 }
 
@@ -49,15 +58,57 @@ func (m SessionMiddleware) Setup() {
 	log.SetOutput(filteredLog)
 	log.SetPrefix("")
 
-	store := cookie.NewStore([]byte(m.env.SessionSecret))
-
+	store := m.newStore()
 	store.Options(sessions.Options{
 		Path:     "/",
-		MaxAge:   86400,
+		MaxAge:   int(m.env.SessionAbsoluteTimeout.Seconds()),
 		HttpOnly: true,
 		Secure:   m.env.Environment == "production",
 		SameSite: 1,
 	})
 
 	m.handler.Gin.Use(sessions.Sessions("session", store))
+	go m.cleanupExpiredSessions()
+}
+
+// newStore returns the session store selected by SessionStore. The server-
+// side stores move a session to a new ID whenever it is saved.
+func (m SessionMiddleware) newStore() sessions.Store {
+	secret := []byte(m.env.SessionSecret)
+	switch m.env.SessionStore {
+	case "cookie":
+		m.logger.Info("Keeping sessions in cookies; they cannot be revoked before they expire")
+		return cookie.NewStore(secret)
+	case "redis":
+		store, err := redis.NewStoreWithDB(10, "tcp", m.env.SessionRedisAddress, m.env.SessionRedisPassword, m.env.SessionRedisDB, secret)
+		if err != nil {
+			m.logger.Panicf("Failed to connect to the Redis session store at %s: %v", m.env.SessionRedisAddress, err)
+		}
+		if err, rediStore := redis.GetRedisStore(store); err == nil {
+			rediStore.SetMaxAge(int(m.env.SessionAbsoluteTimeout.Seconds()))
+		}
+		m.logger.Infof("Keeping sessions in Redis at %s", m.env.SessionRedisAddress)
+		return rotatingStore{store: store}
+	default:
+		m.logger.Info("Keeping sessions in the database")
+		return rotatingStore{store: newDatabaseStore(m.sessionRepo, secret)}
+	}
+}
+
+// cleanupExpiredSessions periodically deletes sessions past their idle or
+// absolute timeout. Validation rejects them anyway; this keeps the tables
+// from growing.
+func (m SessionMiddleware) cleanupExpiredSessions() {
+	ticker := time.NewTicker(sessionCleanupInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		removed, err := m.sessionRepo.DeleteExpired(m.env.SessionIdleTimeout, m.env.SessionAbsoluteTimeout)
+		if err != nil {
+			m.logger.Errorf("Failed to delete expired sessions: %v", err)
+			continue
+		}
+		if removed > 0 {
+			m.logger.Infof("Deleted %d expired sessions", removed)
+		}
+	}
 }
@@ -10,17 +10,31 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// SessionIDKey is the context key holding the ID of the session a request
+// was authenticated with. It is unset for other requests.
+const SessionIDKey = "sessionId"
+
+// MFAPendingUserKey is the session key holding the user whose login waits
+// for their two-factor code.
+const MFAPendingUserKey = "mfaPendingUserId"
+
+// authSessionKeys are the session values that say who a session belongs to.
+// The session gets a new ID whenever one of them changes.
+var authSessionKeys = []string{SessionIDKey, "userId", MFAPendingUserKey}
+
 type SessionAuthMiddleware struct {
-	handler lib.RequestHandler
-	logger  lib.Logger
-	env     lib.Env
+	handler     lib.RequestHandler
+	logger      lib.Logger
+	env         lib.Env
+	sessionRepo *models.SessionRepository
 }
 
-func NewSessionAuthMiddleware(handler lib.RequestHandler, logger lib.Logger, env lib.Env) SessionAuthMiddleware {
+func NewSessionAuthMiddleware(handler lib.RequestHandler, logger lib.Logger, env lib.Env, db lib.Database) SessionAuthMiddleware {
 	return SessionAuthMiddleware{
-		handler: handler,
-		logger:  logger,
-		env:     env,
+		handler:     handler,
+		logger:      logger,
+		env:         env,
+		sessionRepo: models.NewSessionRepository(db.DB),
 	}
 }
 
@@ -32,33 +46,38 @@ func (m SessionAuthMiddleware) Handler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 		userID := session.Get("userId")
+		sessionID, _ := session.Get("sessionId").(string)
 
-		if userID == nil {
+		if userID == nil || sessionID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		// A session missing from the registry was logged out elsewhere,
+		// e.g. by the IdP through back-channel logout, revoked by an admin,
+		// or timed out.
+		record, err := m.sessionRepo.Validate(sessionID, m.env.SessionIdleTimeout, m.env.SessionAbsoluteTimeout)
+		if err != nil || record == nil {
+			session.Clear()
+			session.Save()
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
 
 		c.Set("userId", userID)
+		c.Set(SessionIDKey, sessionID)
+		if groups, ok := session.Get("userGroups").([]string); ok {
+			c.Set("userGroups", groups)
+		}
 		c.Next()
 	}
 }
 
 func RequireAdmin(userRepo *models.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var userID uint
-		if id, exists := c.Get("userId"); exists && id != nil {
-			switch v := id.(type) {
-			case uint:
-				userID = v
-			case int:
-				userID = uint(v)
-			case float64:
-				userID = uint(v)
-			default:
-				userID = 0
-			}
-		}
+		userID := contextUserID(c)
 		if userID == 0 {
 			session := sessions.Default(c)
 			if sid := session.Get("userId"); sid != nil {
@@ -71,7 +90,7 @@ func RequireAdmin(userRepo *models.UserRepository) gin.HandlerFunc {
 			return
 		}
 		user, err := userRepo.FindByID(userID)
-		if err != nil || user == nil || user.Role != "admin" {
+		if err != nil || user == nil || models.NormalizeRole(user.Role) != models.RoleAdmin {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
 			c.Abort()
 			return
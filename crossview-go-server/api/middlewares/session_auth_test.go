@@ -4,11 +4,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"crossview-go-server/lib"
+	"crossview-go-server/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func setupTestRouter() *gin.Engine {
@@ -25,7 +29,18 @@ func setupTestEnv() lib.Env {
 }
 
 func setupTestRequestHandler() lib.RequestHandler {
-	return lib.NewRequestHandler(setupTestLogger())
+	return lib.NewRequestHandler(setupTestLogger(), setupTestEnv())
+}
+
+func setupSessionTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.UserSession{}, &models.SessionData{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
 }
 
 func TestSessionAuthMiddleware_Handler_Unauthorized(t *testing.T) {
@@ -37,7 +52,7 @@ func TestSessionAuthMiddleware_Handler_Unauthorized(t *testing.T) {
 	store := cookie.NewStore([]byte(env.SessionSecret))
 	router.Use(sessions.Sessions("session", store))
 
-	middleware := NewSessionAuthMiddleware(handler, logger, env)
+	middleware := NewSessionAuthMiddleware(handler, logger, env, lib.Database{DB: setupSessionTestDB(t)})
 	router.GET("/test", middleware.Handler(), func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "success"})
 	})
@@ -60,7 +75,13 @@ func TestSessionAuthMiddleware_Handler_Authorized(t *testing.T) {
 	store := cookie.NewStore([]byte(env.SessionSecret))
 	router.Use(sessions.Sessions("session", store))
 
-	middleware := NewSessionAuthMiddleware(handler, logger, env)
+	db := setupSessionTestDB(t)
+	record := &models.UserSession{UserID: 1, Provider: "local"}
+	if err := models.NewSessionRepository(db).Create(record); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	middleware := NewSessionAuthMiddleware(handler, logger, env, lib.Database{DB: db})
 	router.GET("/test", middleware.Handler(), func(c *gin.Context) {
 		userID, _ := c.Get("userId")
 		c.JSON(http.StatusOK, gin.H{"userId": userID})
@@ -70,6 +91,7 @@ func TestSessionAuthMiddleware_Handler_Authorized(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	session, _ := store.Get(req, "session")
+	session.Values["sessionId"] = record.ID
 	session.Values["userId"] = uint(1)
 	session.Save(req, w)
 
@@ -80,12 +102,90 @@ func TestSessionAuthMiddleware_Handler_Authorized(t *testing.T) {
 	}
 }
 
+func TestSessionAuthMiddleware_Handler_EndedSession(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	handler := setupTestRequestHandler()
+
+	store := cookie.NewStore([]byte(env.SessionSecret))
+	router.Use(sessions.Sessions("session", store))
+
+	db := setupSessionTestDB(t)
+	repo := models.NewSessionRepository(db)
+	record := &models.UserSession{UserID: 1, Provider: "oidc:default", SID: "idp-session"}
+	if err := repo.Create(record); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if _, err := repo.DeleteBySID("oidc:default", "idp-session"); err != nil {
+		t.Fatalf("Failed to end session: %v", err)
+	}
+
+	middleware := NewSessionAuthMiddleware(handler, logger, env, lib.Database{DB: db})
+	router.GET("/test", middleware.Handler(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	req, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+
+	session, _ := store.Get(req, "session")
+	session.Values["sessionId"] = record.ID
+	session.Values["userId"] = uint(1)
+	session.Save(req, w)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestSessionAuthMiddleware_Handler_IdleSession(t *testing.T) {
+	router := setupTestRouter()
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	env.SessionIdleTimeout = time.Hour
+	handler := setupTestRequestHandler()
+
+	store := cookie.NewStore([]byte(env.SessionSecret))
+	router.Use(sessions.Sessions("session", store))
+
+	db := setupSessionTestDB(t)
+	record := &models.UserSession{UserID: 1, Provider: "local", LastSeenAt: time.Now().Add(-2 * time.Hour)}
+	if err := models.NewSessionRepository(db).Create(record); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	middleware := NewSessionAuthMiddleware(handler, logger, env, lib.Database{DB: db})
+	router.GET("/test", middleware.Handler(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	req, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+
+	session, _ := store.Get(req, "session")
+	session.Values["sessionId"] = record.ID
+	session.Values["userId"] = uint(1)
+	session.Save(req, w)
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if found, _ := models.NewSessionRepository(db).FindByID(record.ID); found != nil {
+		t.Error("Expected the idle session to be removed from the registry")
+	}
+}
+
 func TestSessionAuthMiddleware_Setup(t *testing.T) {
 	logger := setupTestLogger()
 	env := setupTestEnv()
 	handler := setupTestRequestHandler()
 
-	middleware := NewSessionAuthMiddleware(handler, logger, env)
+	middleware := NewSessionAuthMiddleware(handler, logger, env, lib.Database{})
 	middleware.Setup()
 }
 
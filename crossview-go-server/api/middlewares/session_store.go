@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"time"
+
+	"crossview-go-server/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+)
+
+// databaseStore keeps session values in the session_data table. The cookie
+// carries only the signed session ID, so a session can be ended server-side
+// by deleting its row.
+type databaseStore struct {
+	repo    *models.SessionRepository
+	codecs  []securecookie.Codec
+	options *gsessions.Options
+}
+
+func newDatabaseStore(repo *models.SessionRepository, keyPairs ...[]byte) *databaseStore {
+	return &databaseStore{
+		repo:    repo,
+		codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		options: &gsessions.Options{Path: "/", MaxAge: 86400},
+	}
+}
+
+func (s *databaseStore) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+	for _, codec := range s.codecs {
+		if cookie, ok := codec.(*securecookie.SecureCookie); ok {
+			cookie.MaxAge(options.MaxAge)
+		}
+	}
+}
+
+func (s *databaseStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session named by the request's cookie, or returns a new one
+// when there is no cookie or its session has expired or been deleted.
+func (s *databaseStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, s.codecs...); err != nil {
+		return session, err
+	}
+	data, err := s.repo.FindData(id)
+	if err != nil || data == nil {
+		return session, err
+	}
+	if err := securecookie.DecodeMulti(name, data.Data, &session.Values, s.codecs...); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+	return session, nil
+}
+
+// Save writes the session's values to the database, or deletes them when
+// the session's MaxAge is negative, and sets the cookie accordingly.
+func (s *databaseStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repo.DeleteData(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id := make([]byte, 32)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		session.ID = hex.EncodeToString(id)
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, s.codecs...)
+	if err != nil {
+		return err
+	}
+	lifetime := time.Duration(session.Options.MaxAge) * time.Second
+	if lifetime == 0 {
+		lifetime = 24 * time.Hour
+	}
+	if err := s.repo.SaveData(&models.SessionData{
+		ID:        session.ID,
+		Data:      encoded,
+		ExpiresAt: time.Now().Add(lifetime),
+	}); err != nil {
+		return err
+	}
+
+	value, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), value, session.Options))
+	return nil
+}
+
+// rotatingStore wraps a server-side store so that a save which changes who
+// the session belongs to moves the session to a new ID and discards the old
+// one. An ID planted in a browser before login (session fixation) is then
+// worthless once the user logs in. Other saves, such as switching context,
+// keep the ID, so requests still in flight with the cookie keep working.
+type rotatingStore struct {
+	store sessions.Store
+}
+
+func (s rotatingStore) Options(options sessions.Options) {
+	s.store.Options(options)
+}
+
+func (s rotatingStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session through the wrapped store and rebinds it to s, so
+// that saving it goes through Save below.
+func (s rotatingStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	loaded, err := s.store.New(r, name)
+	session := gsessions.NewSession(s, name)
+	if loaded != nil {
+		session.ID = loaded.ID
+		session.Values = loaded.Values
+		session.Options = loaded.Options
+		session.IsNew = loaded.IsNew
+	}
+	return session, err
+}
+
+func (s rotatingStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.ID != "" && session.Options.MaxAge >= 0 && s.authChanged(r, session) {
+		old := *session
+		options := *session.Options
+		options.MaxAge = -1
+		old.Options = &options
+		if err := s.store.Save(r, discardResponseWriter{header: http.Header{}}, &old); err != nil {
+			return err
+		}
+		session.ID = ""
+	}
+	return s.store.Save(r, w, session)
+}
+
+// authChanged reports whether any of the session's authSessionKeys differ
+// from the copy stored under its ID, i.e. whether the save logs a user in or
+// out or moves their login on to the next step.
+func (s rotatingStore) authChanged(r *http.Request, session *gsessions.Session) bool {
+	stored, err := s.store.New(r, session.Name())
+	if err != nil || stored == nil || stored.ID != session.ID {
+		return true
+	}
+	for _, key := range authSessionKeys {
+		if !reflect.DeepEqual(stored.Values[key], session.Values[key]) {
+			return true
+		}
+	}
+	return false
+}
+
+// discardResponseWriter swallows the cookie a store sets while deleting the
+// old copy of a rotated session.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
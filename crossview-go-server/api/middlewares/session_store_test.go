@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"crossview-go-server/models"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// setupDatabaseStoreRouter serves a router backed by the database session
+// store, with routes to start an anonymous session, log in, read the
+// session and log out.
+func setupDatabaseStoreRouter(t *testing.T) (*gin.Engine, *models.SessionRepository) {
+	repo := models.NewSessionRepository(setupSessionTestDB(t))
+	store := rotatingStore{store: newDatabaseStore(repo, []byte("test-secret-key"))}
+	store.Options(sessions.Options{Path: "/", MaxAge: 3600, HttpOnly: true})
+
+	router := setupTestRouter()
+	router.Use(sessions.Sessions("session", store))
+	router.GET("/visit", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("oidcState", "state")
+		session.Save()
+		c.Status(http.StatusOK)
+	})
+	router.POST("/login", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("userId", uint(1))
+		session.Save()
+		c.Status(http.StatusOK)
+	})
+	router.POST("/context", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("kubernetesContext", "context-b")
+		session.Save()
+		c.Status(http.StatusOK)
+	})
+	router.GET("/me", func(c *gin.Context) {
+		userID := sessions.Default(c).Get("userId")
+		if userID == nil {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"userId": userID})
+	})
+	router.POST("/logout", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Clear()
+		session.Save()
+		c.Status(http.StatusOK)
+	})
+	return router, repo
+}
+
+func serveWithCookie(router *gin.Engine, method, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestDatabaseStore_KeepsValuesServerSide(t *testing.T) {
+	router, _ := setupDatabaseStoreRouter(t)
+
+	login := serveWithCookie(router, "POST", "/login", nil)
+	cookie := sessionCookie(login)
+	if cookie == nil {
+		t.Fatal("Expected a session cookie")
+	}
+	if cookie.MaxAge != 3600 || !cookie.HttpOnly {
+		t.Errorf("Unexpected cookie attributes: %+v", cookie)
+	}
+
+	if w := serveWithCookie(router, "GET", "/me", cookie); w.Code != http.StatusOK {
+		t.Errorf("Expected the session to be loaded, got status %d", w.Code)
+	}
+}
+
+func TestDatabaseStore_RotatesIDOnSave(t *testing.T) {
+	router, _ := setupDatabaseStoreRouter(t)
+
+	// A cookie obtained before login, e.g. one planted by an attacker.
+	planted := sessionCookie(serveWithCookie(router, "GET", "/visit", nil))
+	login := serveWithCookie(router, "POST", "/login", planted)
+	cookie := sessionCookie(login)
+	if cookie == nil || cookie.Value == planted.Value {
+		t.Fatal("Expected login to issue a new session cookie")
+	}
+
+	if w := serveWithCookie(router, "GET", "/me", planted); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the pre-login cookie to be worthless, got status %d", w.Code)
+	}
+	if w := serveWithCookie(router, "GET", "/me", cookie); w.Code != http.StatusOK {
+		t.Errorf("Expected the new cookie to work, got status %d", w.Code)
+	}
+}
+
+func TestDatabaseStore_KeepsIDWhenLoginUnchanged(t *testing.T) {
+	router, _ := setupDatabaseStoreRouter(t)
+	cookie := sessionCookie(serveWithCookie(router, "POST", "/login", nil))
+
+	if rotated := sessionCookie(serveWithCookie(router, "POST", "/context", cookie)); rotated != nil && rotated.Value != cookie.Value {
+		t.Error("Expected a save that doesn't change the login to keep the session ID")
+	}
+	if w := serveWithCookie(router, "GET", "/me", cookie); w.Code != http.StatusOK {
+		t.Errorf("Expected the cookie to keep working after the save, got status %d", w.Code)
+	}
+}
+
+func TestDatabaseStore_DeletedDataEndsSession(t *testing.T) {
+	router, repo := setupDatabaseStoreRouter(t)
+	cookie := sessionCookie(serveWithCookie(router, "POST", "/login", nil))
+
+	if _, err := repo.DeleteExpired(0, 0); err != nil {
+		t.Fatalf("Failed to delete expired sessions: %v", err)
+	}
+	if w := serveWithCookie(router, "GET", "/me", cookie); w.Code != http.StatusOK {
+		t.Fatalf("Expected a live session to survive cleanup, got status %d", w.Code)
+	}
+
+	serveWithCookie(router, "POST", "/logout", cookie)
+	if w := serveWithCookie(router, "GET", "/me", cookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the cookie to stop working after logout, got status %d", w.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenKey is the context key holding the *models.APIToken a request
+// was authenticated with. It is unset for other requests.
+const APITokenKey = "apiToken"
+
+// TokenAuthMiddleware authenticates requests that carry a personal API
+// token as "Authorization: Bearer <token>". Requests without one, including
+// those bearing some other kind of token (e.g. one an auth proxy passes
+// through), are left to the auth mode's own middleware.
+type TokenAuthMiddleware struct {
+	logger    lib.Logger
+	tokenRepo *models.APITokenRepository
+}
+
+func NewTokenAuthMiddleware(logger lib.Logger, db lib.Database) TokenAuthMiddleware {
+	return TokenAuthMiddleware{
+		logger:    logger,
+		tokenRepo: models.NewAPITokenRepository(db.DB),
+	}
+}
+
+// Handler authenticates bearer requests itself and hands every other
+// request to next.
+func (m TokenAuthMiddleware) Handler(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok || !strings.HasPrefix(raw, models.APITokenPrefix) {
+			next(c)
+			return
+		}
+
+		token, err := m.tokenRepo.Authenticate(raw)
+		if err != nil {
+			m.logger.Error("Token auth: failed to look up token: " + err.Error())
+		}
+		if token == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("userId", token.UserID)
+		c.Set(APITokenKey, token)
+		c.Next()
+	}
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// tokenAllows applies an API token's scope on top of its user's role: a
+// read-only token gets resources:read at most, and a token limited to some
+// contexts may only read or write resources in a context it names with
+// ?context=.
+func tokenAllows(token *models.APIToken, permission, contextName string) bool {
+	if token.ReadOnly && permission != lib.PermissionResourcesRead {
+		return false
+	}
+	if len(token.Contexts) > 0 {
+		if permission != lib.PermissionResourcesRead && permission != lib.PermissionResourcesWrite {
+			return false
+		}
+		return token.AllowsContext(contextName)
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupTokenAuthTest(t *testing.T) (*gin.Engine, string) {
+	db := setupSessionTestDB(t)
+	if err := db.AutoMigrate(&models.APIToken{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	raw, err := models.NewAPITokenRepository(db).Create(&models.APIToken{UserID: 7, Name: "ci", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	fallback := func(c *gin.Context) {
+		c.JSON(http.StatusTeapot, gin.H{"auth": "fallback"})
+		c.Abort()
+	}
+	middleware := NewTokenAuthMiddleware(setupTestLogger(), lib.Database{DB: db})
+	router := setupTestRouter()
+	router.GET("/test", middleware.Handler(fallback), func(c *gin.Context) {
+		_, hasToken := c.Get(APITokenKey)
+		c.JSON(http.StatusOK, gin.H{"userId": contextUserID(c), "token": hasToken})
+	})
+	return router, raw
+}
+
+func TestTokenAuthMiddleware_Handler(t *testing.T) {
+	router, raw := setupTokenAuthTest(t)
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"valid token", "Bearer " + raw, http.StatusOK},
+		{"lowercase scheme", "bearer " + raw, http.StatusOK},
+		{"unknown token", "Bearer " + models.APITokenPrefix + "0000", http.StatusUnauthorized},
+		{"no header", "", http.StatusTeapot},
+		{"another kind of bearer token", "Bearer eyJhbGciOiJSUzI1NiJ9.e30.sig", http.StatusTeapot},
+		{"basic auth", "Basic YWxpY2U6c2VjcmV0", http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/test", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("Expected status code %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	full := &models.APIToken{}
+	readOnly := &models.APIToken{ReadOnly: true}
+	scoped := &models.APIToken{Contexts: []string{"prod"}}
+
+	tests := []struct {
+		name       string
+		token      *models.APIToken
+		permission string
+		context    string
+		want       bool
+	}{
+		{"full token writes", full, lib.PermissionResourcesWrite, "", true},
+		{"full token manages users", full, lib.PermissionUsersManage, "", true},
+		{"read-only token reads", readOnly, lib.PermissionResourcesRead, "", true},
+		{"read-only token writes", readOnly, lib.PermissionResourcesWrite, "", false},
+		{"read-only token selects contexts", readOnly, lib.PermissionContextsSelect, "", false},
+		{"scoped token in its context", scoped, lib.PermissionResourcesWrite, "prod", true},
+		{"scoped token in another context", scoped, lib.PermissionResourcesRead, "staging", false},
+		{"scoped token without a context", scoped, lib.PermissionResourcesRead, "", false},
+		{"scoped token manages contexts", scoped, lib.PermissionContextsManage, "prod", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenAllows(tt.token, tt.permission, tt.context); got != tt.want {
+				t.Errorf("Expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
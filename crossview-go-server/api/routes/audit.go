@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"crossview-go-server/api/controllers/audit"
+	"crossview-go-server/api/middlewares"
+	"crossview-go-server/lib"
+)
+
+type AuditRoutes struct {
+	logger         lib.Logger
+	handler        lib.RequestHandler
+	controller     audit.AuditController
+	authMiddleware middlewares.AuthMiddleware
+	permission     middlewares.PermissionMiddleware
+}
+
+func NewAuditRoutes(
+	logger lib.Logger,
+	handler lib.RequestHandler,
+	controller audit.AuditController,
+	authMiddleware middlewares.AuthMiddleware,
+	permission middlewares.PermissionMiddleware,
+) AuditRoutes {
+	return AuditRoutes{
+		logger:         logger,
+		handler:        handler,
+		controller:     controller,
+		authMiddleware: authMiddleware,
+		permission:     permission,
+	}
+}
+
+func (r AuditRoutes) Setup() {
+	r.logger.Info("Setting up audit routes")
+	api := r.handler.Gin.Group("/api")
+	{
+		api.GET("/audit", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetEvents)
+		api.GET("/audit/export", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.ExportEvents)
+	}
+}
@@ -29,6 +29,7 @@ func (r AuthRoutes) Setup() {
 	{
 		api.GET("/auth/check", r.controller.Check)
 		api.POST("/auth/login", r.controller.Login)
+		api.POST("/auth/login/mfa", r.controller.LoginMFA)
 		api.POST("/auth/logout", r.controller.Logout)
 		api.POST("/auth/register", r.controller.Register)
 	}
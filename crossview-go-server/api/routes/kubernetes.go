@@ -12,6 +12,7 @@ type KubernetesRoutes struct {
 	controller      kubernetes.KubernetesController
 	watchController *kubernetes.WatchController
 	authMiddleware  middlewares.AuthMiddleware
+	permission      middlewares.PermissionMiddleware
 }
 
 func NewKubernetesRoutes(
@@ -20,6 +21,7 @@ func NewKubernetesRoutes(
 	controller kubernetes.KubernetesController,
 	watchController *kubernetes.WatchController,
 	authMiddleware middlewares.AuthMiddleware,
+	permission middlewares.PermissionMiddleware,
 ) KubernetesRoutes {
 	return KubernetesRoutes{
 		logger:          logger,
@@ -27,6 +29,7 @@ func NewKubernetesRoutes(
 		controller:      controller,
 		watchController: watchController,
 		authMiddleware:  authMiddleware,
+		permission:      permission,
 	}
 }
 
@@ -35,21 +38,26 @@ func (r KubernetesRoutes) Setup() {
 	api := r.handler.Gin.Group("/api")
 	{
 		api.GET("/kubernetes/status", r.controller.GetStatus)
-		api.POST("/kubernetes/context", r.authMiddleware.Handler(), r.controller.SetContext)
-		api.PUT("/kubernetes/context", r.authMiddleware.Handler(), r.controller.SetContext)
-		api.GET("/kubernetes/context", r.authMiddleware.Handler(), r.controller.GetCurrentContext)
-		api.GET("/kubernetes/contexts", r.authMiddleware.Handler(), r.controller.GetContexts)
-		api.GET("/kubernetes/connection", r.authMiddleware.Handler(), r.controller.CheckConnection)
-		api.POST("/kubernetes/kubeconfig", r.authMiddleware.Handler(), r.controller.AddKubeConfig)
-		api.GET("/contexts", r.authMiddleware.Handler(), r.controller.GetContexts)
-		api.GET("/contexts/current", r.authMiddleware.Handler(), r.controller.GetCurrentContext)
-		api.POST("/contexts/current", r.authMiddleware.Handler(), r.controller.SetContext)
-		api.POST("/contexts/add", r.authMiddleware.Handler(), r.controller.AddKubeConfig)
-		api.DELETE("/contexts", r.authMiddleware.Handler(), r.controller.RemoveContext)
-		api.GET("/resources", r.authMiddleware.Handler(), r.controller.GetResources)
-		api.GET("/resource", r.authMiddleware.Handler(), r.controller.GetResource)
-		api.GET("/events", r.authMiddleware.Handler(), r.controller.GetEvents)
-		api.GET("/managed", r.authMiddleware.Handler(), r.controller.GetManagedResources)
-		api.GET("/watch", r.authMiddleware.Handler(), r.watchController.WatchResources)
+		api.POST("/kubernetes/context", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.SetContext)
+		api.PUT("/kubernetes/context", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.SetContext)
+		api.GET("/kubernetes/context", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetCurrentContext)
+		api.GET("/kubernetes/contexts", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetContexts)
+		api.GET("/kubernetes/connection", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.CheckConnection)
+		api.POST("/kubernetes/kubeconfig", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.AddKubeConfig)
+		api.GET("/contexts", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetContexts)
+		api.GET("/contexts/current", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetCurrentContext)
+		api.POST("/contexts/current", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.SetContext)
+		api.POST("/contexts/add", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.AddKubeConfig)
+		api.DELETE("/contexts", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.RemoveContext)
+		api.GET("/resources", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetResources)
+		api.GET("/resource", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetResource)
+		api.POST("/resource", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.ApplyResource)
+		api.PATCH("/resource", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.PatchResource)
+		api.DELETE("/resource", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.DeleteResource)
+		api.POST("/resource/actions/:action", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.RunResourceAction)
+		api.GET("/trace", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetTrace)
+		api.GET("/events", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetEvents)
+		api.GET("/managed", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetManagedResources)
+		api.GET("/watch", r.authMiddleware.Handler(), r.permission.Handler(), r.watchController.WatchResources)
 	}
 }
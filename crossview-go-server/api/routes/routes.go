@@ -9,6 +9,7 @@ var Module = fx.Options(
 	fx.Provide(NewKubernetesRoutes),
 	fx.Provide(NewConfigRoutes),
 	fx.Provide(NewUserRoutes),
+	fx.Provide(NewAuditRoutes),
 	fx.Provide(NewFrontendRoutes),
 	fx.Provide(NewRoutes),
 )
@@ -26,6 +27,7 @@ func NewRoutes(
 	kubernetesRoutes KubernetesRoutes,
 	configRoutes ConfigRoutes,
 	userRoutes UserRoutes,
+	auditRoutes AuditRoutes,
 	frontendRoutes FrontendRoutes,
 ) Routes {
 	return Routes{
@@ -35,6 +37,7 @@ func NewRoutes(
 		kubernetesRoutes,
 		configRoutes,
 		userRoutes,
+		auditRoutes,
 		frontendRoutes,
 	}
 }
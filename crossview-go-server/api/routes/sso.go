@@ -30,8 +30,13 @@ func (r SSORoutes) Setup() {
 		api.GET("/auth/sso/status", r.controller.GetStatus)
 		api.GET("/auth/oidc", r.controller.InitiateOIDC)
 		api.GET("/auth/oidc/callback", r.controller.HandleOIDCCallback)
+		api.GET("/auth/oidc/:provider", r.controller.InitiateOIDC)
+		api.GET("/auth/oidc/:provider/callback", r.controller.HandleOIDCCallback)
+		api.POST("/auth/oidc/backchannel-logout", r.controller.HandleBackChannelLogout)
+		api.POST("/auth/oidc/:provider/backchannel-logout", r.controller.HandleBackChannelLogout)
 		api.GET("/auth/saml", r.controller.InitiateSAML)
 		api.POST("/auth/saml/callback", r.controller.HandleSAMLCallback)
+		api.GET("/auth/saml/metadata", r.controller.GetSAMLMetadata)
 	}
 }
 
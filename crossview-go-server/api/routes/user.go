@@ -4,28 +4,35 @@ import (
 	"crossview-go-server/api/controllers/user"
 	"crossview-go-server/api/middlewares"
 	"crossview-go-server/lib"
-	"crossview-go-server/models"
 )
 
 type UserRoutes struct {
-	logger     lib.Logger
-	handler    lib.RequestHandler
-	controller user.UserController
-	userRepo   *models.UserRepository
+	logger         lib.Logger
+	handler        lib.RequestHandler
+	controller     user.UserController
+	tokens         user.TokenController
+	mfa            user.MFAController
+	authMiddleware middlewares.AuthMiddleware
+	permission     middlewares.PermissionMiddleware
 }
 
 func NewUserRoutes(
 	logger lib.Logger,
 	handler lib.RequestHandler,
 	controller user.UserController,
-	db lib.Database,
+	tokens user.TokenController,
+	mfa user.MFAController,
+	authMiddleware middlewares.AuthMiddleware,
+	permission middlewares.PermissionMiddleware,
 ) UserRoutes {
-	userRepo := models.NewUserRepository(db.DB)
 	return UserRoutes{
-		logger:     logger,
-		handler:    handler,
-		controller: controller,
-		userRepo:   userRepo,
+		logger:         logger,
+		handler:        handler,
+		controller:     controller,
+		tokens:         tokens,
+		mfa:            mfa,
+		authMiddleware: authMiddleware,
+		permission:     permission,
 	}
 }
 
@@ -33,9 +40,28 @@ func (r UserRoutes) Setup() {
 	r.logger.Info("Setting up user routes")
 	api := r.handler.Gin.Group("/api")
 	{
-		api.GET("/users", middlewares.RequireAdmin(r.userRepo), r.controller.GetUsers)
-		api.POST("/users", middlewares.RequireAdmin(r.userRepo), r.controller.CreateUser)
-		api.PUT("/users/:id", middlewares.RequireAdmin(r.userRepo), r.controller.UpdateUser)
+		api.GET("/users/me", r.authMiddleware.Handler(), r.controller.GetMe)
+		api.PUT("/users/me", r.authMiddleware.Handler(), r.controller.UpdateMe)
+		api.POST("/users/me/change-password", r.authMiddleware.Handler(), r.controller.ChangePassword)
+		api.GET("/users/me/tokens", r.authMiddleware.Handler(), r.tokens.GetTokens)
+		api.POST("/users/me/tokens", r.authMiddleware.Handler(), r.tokens.CreateToken)
+		api.DELETE("/users/me/tokens/:tokenId", r.authMiddleware.Handler(), r.tokens.RevokeToken)
+		api.GET("/users/me/mfa", r.authMiddleware.Handler(), r.mfa.GetMFA)
+		api.DELETE("/users/me/mfa", r.authMiddleware.Handler(), r.mfa.DisableMFA)
+		api.POST("/users/me/mfa/enroll", r.authMiddleware.Handler(), r.mfa.EnrollMFA)
+		api.POST("/users/me/mfa/verify", r.authMiddleware.Handler(), r.mfa.VerifyMFA)
+		api.POST("/users/me/mfa/recovery-codes", r.authMiddleware.Handler(), r.mfa.RegenerateRecoveryCodes)
+		api.GET("/users", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetUsers)
+		api.POST("/users", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.CreateUser)
+		api.PUT("/users/:id", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.UpdateUser)
+		api.DELETE("/users/:id", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.DeleteUser)
+		api.POST("/users/:id/unlock", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.UnlockUser)
+		api.DELETE("/users/:id/mfa", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.ResetUserMFA)
+		api.GET("/users/:id/identities", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetUserIdentities)
+		api.DELETE("/users/:id/identities/:identityId", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.UnlinkUserIdentity)
+		api.GET("/users/:id/sessions", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.GetUserSessions)
+		api.DELETE("/users/:id/sessions", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.RevokeUserSessions)
+		api.DELETE("/users/:id/sessions/:sessionId", r.authMiddleware.Handler(), r.permission.Handler(), r.controller.RevokeUserSession)
 	}
 }
 
@@ -10,7 +10,13 @@ import (
 )
 
 var cmds = map[string]lib.Command{
-	"app:serve": NewServeCommand(),
+	"app:serve":           NewServeCommand(),
+	"app:migrate":         NewMigrateCommand(),
+	"user:create":         NewUserCreateCommand(),
+	"user:list":           NewUserListCommand(),
+	"user:set-role":       NewUserSetRoleCommand(),
+	"user:reset-password": NewUserResetPasswordCommand(),
+	"user:delete":         NewUserDeleteCommand(),
 }
 
 // GetSubCommands gives a list of sub commands
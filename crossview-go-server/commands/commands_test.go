@@ -13,16 +13,15 @@ func TestGetSubCommands(t *testing.T) {
 		t.Error("Expected at least one sub command")
 	}
 
-	found := false
+	names := make(map[string]bool)
 	for _, cmd := range subCommands {
-		if cmd.Use == "app:serve" {
-			found = true
-			break
-		}
+		names[cmd.Name()] = true
 	}
 
-	if !found {
-		t.Error("Expected to find 'app:serve' command")
+	for _, name := range []string{"app:serve", "app:migrate", "user:create", "user:list", "user:set-role", "user:reset-password", "user:delete"} {
+		if !names[name] {
+			t.Errorf("Expected to find '%s' command", name)
+		}
 	}
 }
 
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/migrations"
+
+	"github.com/spf13/cobra"
+)
+
+// MigrateCommand applies, reverts or lists the database migrations.
+type MigrateCommand struct {
+	action string
+	steps  int
+	dryRun bool
+	out    io.Writer
+}
+
+func (s *MigrateCommand) Short() string {
+	return "apply (up), revert (down) or list (status) database migrations"
+}
+
+func (s *MigrateCommand) Setup(cmd *cobra.Command) {
+	cmd.Use += " up|down|status"
+	cmd.ValidArgs = []string{"up", "down", "status"}
+	cmd.Args = cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs)
+	cmd.Flags().BoolVar(&s.dryRun, "dry-run", false, "list the migrations that would run, without running them")
+	cmd.Flags().IntVar(&s.steps, "steps", 1, "number of migrations for down to revert")
+	cmd.PreRun = func(_ *cobra.Command, args []string) {
+		s.action = args[0]
+	}
+}
+
+func (s *MigrateCommand) Run() lib.CommandRunner {
+	return func(database lib.Database) error {
+		if database.DB == nil {
+			return errors.New("no database to migrate: auth modes header and none don't use one")
+		}
+		migrator := migrations.NewMigrator(database.DB)
+
+		switch s.action {
+		case "up":
+			applied, err := migrator.Up(s.dryRun)
+			s.printMigrations("apply", applied)
+			return err
+		case "down":
+			if s.steps < 1 {
+				return fmt.Errorf("--steps must be at least 1, got %d", s.steps)
+			}
+			reverted, err := migrator.Down(s.steps, s.dryRun)
+			s.printMigrations("revert", reverted)
+			return err
+		case "status":
+			statuses, err := migrator.Status()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.AppliedAt != nil {
+					appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+				}
+				fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+			}
+			return w.Flush()
+		default:
+			return fmt.Errorf("unknown action '%s'", s.action)
+		}
+	}
+}
+
+// printMigrations reports what up or down did, or would do with --dry-run.
+func (s *MigrateCommand) printMigrations(verb string, done []migrations.Migration) {
+	if len(done) == 0 {
+		fmt.Fprintf(s.out, "Nothing to %s\n", verb)
+		return
+	}
+	for _, migration := range done {
+		if s.dryRun {
+			fmt.Fprintf(s.out, "Would %s %s\n", verb, migration)
+		} else {
+			fmt.Fprintf(s.out, "%s %s\n", pastTense[verb], migration)
+		}
+	}
+}
+
+var pastTense = map[string]string{"apply": "Applied", "revert": "Reverted"}
+
+func NewMigrateCommand() *MigrateCommand {
+	return &MigrateCommand{out: os.Stdout}
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"crossview-go-server/lib"
+
+	"go.uber.org/fx"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func runMigrate(t *testing.T, db *gorm.DB, args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd := &MigrateCommand{out: &out}
+	wrapped := WrapSubCommand("app:migrate", cmd, fx.Options())
+	if err := wrapped.ParseFlags(args); err != nil {
+		t.Fatalf("Failed to parse %v: %v", args, err)
+	}
+	if err := wrapped.Args(wrapped, wrapped.Flags().Args()); err != nil {
+		return "", err
+	}
+	wrapped.PreRun(wrapped, wrapped.Flags().Args())
+	err := cmd.Run().(func(lib.Database) error)(lib.Database{DB: db})
+	return out.String(), err
+}
+
+func TestMigrateCommand(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	out, err := runMigrate(t, db, "up", "--dry-run")
+	if err != nil || !strings.Contains(out, "Would apply 0001_initial_schema") {
+		t.Errorf("Unexpected dry run output %q (%v)", out, err)
+	}
+	if db.Migrator().HasTable("users") {
+		t.Error("Expected a dry run to change nothing")
+	}
+
+	out, err = runMigrate(t, db, "up")
+	if err != nil || !strings.Contains(out, "Applied 0005_audit_events") {
+		t.Errorf("Unexpected output %q (%v)", out, err)
+	}
+	if out, _ = runMigrate(t, db, "up"); out != "Nothing to apply\n" {
+		t.Errorf("Expected nothing to apply, got %q", out)
+	}
+
+	out, err = runMigrate(t, db, "down", "--steps", "2")
+	if err != nil || !strings.Contains(out, "Reverted 0006_sso_link_pending\nReverted 0005_audit_events") {
+		t.Errorf("Unexpected output %q (%v)", out, err)
+	}
+
+	out, err = runMigrate(t, db, "status")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 7 || strings.HasSuffix(lines[4], "pending") || !strings.HasSuffix(lines[5], "pending") {
+		t.Errorf("Unexpected status:\n%s", out)
+	}
+}
+
+func TestMigrateCommand_InvalidArgs(t *testing.T) {
+	for _, args := range [][]string{{}, {"sideways"}, {"up", "down"}} {
+		if _, err := runMigrate(t, nil, args...); err == nil {
+			t.Errorf("Expected %v to be refused", args)
+		}
+	}
+	if _, err := runMigrate(t, nil, "status"); err == nil {
+		t.Error("Expected an error without a database")
+	}
+}
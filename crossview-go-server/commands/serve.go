@@ -5,7 +5,7 @@ import (
 	"crossview-go-server/api/middlewares"
 	"crossview-go-server/api/routes"
 	"crossview-go-server/lib"
-	"crossview-go-server/models"
+	"crossview-go-server/migrations"
 )
 
 // ServeCommand test command
@@ -40,24 +40,25 @@ func (s *ServeCommand) Run() lib.CommandRunner {
 				logger.Panicf("Failed to ping database: %v", err)
 			}
 			logger.Info("Database ping successful")
-			logger.Info("Running database migrations...")
-			userRepo := models.NewUserRepository(database.DB)
-			if err := userRepo.AutoMigrate(); err != nil {
-				logger.Errorf("Migration error details: %+v", err)
-				logger.Errorf("Migration error type: %T", err)
-				logger.Errorf("Migration error string: %s", err.Error())
-				logger.Errorf("Migration error wrapped: %#v", err)
-				sqlDB, pingErr := database.DB.DB()
-				if pingErr == nil {
-					if pingErr := sqlDB.Ping(); pingErr != nil {
-						logger.Errorf("Database connection is broken after migration error: %v", pingErr)
-					} else {
-						logger.Info("Database connection is still valid after migration error")
-					}
+			migrator := migrations.NewMigrator(database.DB)
+			if env.DBAutoMigrate {
+				logger.Info("Running database migrations...")
+				applied, err := migrator.Up(false)
+				for _, migration := range applied {
+					logger.Infof("Applied migration %s", migration)
 				}
-				logger.Panicf("Failed to run database migrations: %v", err)
+				if err != nil {
+					logger.Panicf("Failed to run database migrations: %v", err)
+				}
+			}
+			pending, err := migrator.Pending()
+			if err != nil {
+				logger.Panicf("Failed to check database migrations: %v", err)
+			}
+			if len(pending) > 0 {
+				logger.Panicf("Database schema is behind: %d migration(s) pending, starting with %s. Run 'app:migrate up' first", len(pending), pending[0])
 			}
-			logger.Info("Database migrations completed successfully")
+			logger.Info("Database schema is up to date")
 		}
 
 		middleware.Setup()
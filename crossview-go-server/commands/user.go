@@ -0,0 +1,394 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/migrations"
+	"crossview-go-server/models"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// The user commands manage local accounts without the web UI, e.g. to
+// create the first admin or to let an admin back in when SSO is broken.
+// They take everything as flags and print JSON, so that they can be
+// scripted.
+
+// userStore checks that the database can hold users before a user command
+// runs.
+func userStore(database lib.Database) error {
+	if database.DB == nil {
+		return errors.New("no database: auth modes header and none don't store users")
+	}
+	pending, err := migrations.NewMigrator(database.DB).Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind: %d migration(s) pending, run 'app:migrate up' first", len(pending))
+	}
+	return nil
+}
+
+// auditCLI records a user command in the audit log. The change has been
+// made by then, so a failure to record it is reported on errOut rather than
+// failing the command.
+func auditCLI(database lib.Database, action string, user *models.User, details string) {
+	err := models.NewAuditRepository(database.DB).Create(&models.AuditEvent{
+		Actor:   "cli",
+		Action:  action,
+		Target:  models.UserTarget(user.ID),
+		Outcome: models.AuditSuccess,
+		Details: details,
+	})
+	if err != nil {
+		fmt.Fprintf(errOut, "warning: failed to record %s for user %d in the audit log: %v\n", action, user.ID, err)
+	}
+}
+
+// errOut receives warnings that don't fail a command.
+var errOut io.Writer = os.Stderr
+
+func writeJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// userSelector picks the user a command applies to, by ID or username.
+type userSelector struct {
+	id       uint
+	username string
+}
+
+func (s *userSelector) addFlags(cmd *cobra.Command) {
+	cmd.Flags().UintVar(&s.id, "id", 0, "ID of the user")
+	cmd.Flags().StringVar(&s.username, "username", "", "username of the user")
+}
+
+func (s *userSelector) find(repo *models.UserRepository) (*models.User, error) {
+	var user *models.User
+	var err error
+	switch {
+	case s.id != 0 && s.username != "":
+		return nil, errors.New("give --id or --username, not both")
+	case s.id != 0:
+		user, err = repo.FindByID(s.id)
+	case s.username != "":
+		user, err = repo.FindByUsername(s.username)
+	default:
+		return nil, errors.New("--id or --username is required")
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("user not found")
+	}
+	return user, err
+}
+
+// passwordFlags reads a new password from --password or --password-file,
+// where "-" is standard input. The file keeps it out of the process list.
+type passwordFlags struct {
+	password string
+	file     string
+}
+
+func (p *passwordFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&p.password, "password", "", "new password")
+	cmd.Flags().StringVar(&p.file, "password-file", "", "file to read the new password from, or - for standard input")
+}
+
+func (p *passwordFlags) read(stdin io.Reader) (string, error) {
+	if p.password != "" && p.file != "" {
+		return "", errors.New("give --password or --password-file, not both")
+	}
+	password := p.password
+	if p.file != "" {
+		var content []byte
+		var err error
+		if p.file == "-" {
+			content, err = io.ReadAll(stdin)
+		} else {
+			content, err = os.ReadFile(p.file)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimRight(string(content), "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("--password or --password-file is required")
+	}
+	return password, nil
+}
+
+// UserCreateCommand creates a local user.
+type UserCreateCommand struct {
+	username    string
+	email       string
+	role        string
+	firstName   string
+	lastName    string
+	ifNotExists bool
+	password    passwordFlags
+	stdin       io.Reader
+	out         io.Writer
+}
+
+func (s *UserCreateCommand) Short() string {
+	return "create a local user"
+}
+
+func (s *UserCreateCommand) Setup(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&s.username, "username", "", "username (required)")
+	cmd.Flags().StringVar(&s.email, "email", "", "email address (required)")
+	cmd.Flags().StringVar(&s.role, "role", models.RoleEditor, "role: viewer, editor or admin")
+	cmd.Flags().StringVar(&s.firstName, "first-name", "", "first name")
+	cmd.Flags().StringVar(&s.lastName, "last-name", "", "last name")
+	cmd.Flags().BoolVar(&s.ifNotExists, "if-not-exists", false, "succeed without changes when the username is taken")
+	s.password.addFlags(cmd)
+}
+
+func (s *UserCreateCommand) Run() lib.CommandRunner {
+	return func(database lib.Database, userRepo *models.UserRepository) error {
+		if err := userStore(database); err != nil {
+			return err
+		}
+		if s.username == "" || s.email == "" {
+			return errors.New("--username and --email are required")
+		}
+		if !models.IsValidRole(s.role) {
+			return errors.New("--role must be 'viewer', 'editor' or 'admin'")
+		}
+
+		if existing, _ := userRepo.FindByUsername(s.username); existing != nil {
+			if s.ifNotExists {
+				return writeJSON(s.out, existing)
+			}
+			return errors.New("username already exists")
+		}
+		if existing, _ := userRepo.FindByEmail(s.email); existing != nil {
+			return errors.New("email already exists")
+		}
+		password, err := s.password.read(s.stdin)
+		if err != nil {
+			return err
+		}
+
+		user := &models.User{Username: s.username, Email: s.email, Role: models.NormalizeRole(s.role)}
+		if s.firstName != "" {
+			user.FirstName = &s.firstName
+		}
+		if s.lastName != "" {
+			user.LastName = &s.lastName
+		}
+		if err := user.SetPassword(password); err != nil {
+			return err
+		}
+		if err := userRepo.Create(user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		auditCLI(database, "user.create", user, "")
+		return writeJSON(s.out, user)
+	}
+}
+
+func NewUserCreateCommand() *UserCreateCommand {
+	return &UserCreateCommand{stdin: os.Stdin, out: os.Stdout}
+}
+
+// UserListCommand lists the users.
+type UserListCommand struct {
+	role string
+	out  io.Writer
+}
+
+func (s *UserListCommand) Short() string {
+	return "list users"
+}
+
+func (s *UserListCommand) Setup(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&s.role, "role", "", "list only users with this role")
+}
+
+func (s *UserListCommand) Run() lib.CommandRunner {
+	return func(database lib.Database, userRepo *models.UserRepository) error {
+		if err := userStore(database); err != nil {
+			return err
+		}
+		users, err := userRepo.FindAll()
+		if err != nil {
+			return err
+		}
+		listed := make([]models.User, 0, len(users))
+		for _, user := range users {
+			if s.role == "" || models.NormalizeRole(user.Role) == models.NormalizeRole(s.role) {
+				listed = append(listed, user)
+			}
+		}
+		return writeJSON(s.out, listed)
+	}
+}
+
+func NewUserListCommand() *UserListCommand {
+	return &UserListCommand{out: os.Stdout}
+}
+
+// UserSetRoleCommand changes a user's role and ends their sessions, so
+// that the new role applies at once. The last admin keeps their role.
+type UserSetRoleCommand struct {
+	user userSelector
+	role string
+	out  io.Writer
+}
+
+func (s *UserSetRoleCommand) Short() string {
+	return "change a user's role"
+}
+
+func (s *UserSetRoleCommand) Setup(cmd *cobra.Command) {
+	s.user.addFlags(cmd)
+	cmd.Flags().StringVar(&s.role, "role", "", "new role: viewer, editor or admin (required)")
+}
+
+func (s *UserSetRoleCommand) Run() lib.CommandRunner {
+	return func(database lib.Database, userRepo *models.UserRepository) error {
+		if err := userStore(database); err != nil {
+			return err
+		}
+		if !models.IsValidRole(s.role) {
+			return errors.New("--role must be 'viewer', 'editor' or 'admin'")
+		}
+		user, err := s.user.find(userRepo)
+		if err != nil {
+			return err
+		}
+
+		role := models.NormalizeRole(s.role)
+		if role == models.NormalizeRole(user.Role) {
+			return writeJSON(s.out, user)
+		}
+		previous := user.Role
+		if err := userRepo.UpdateRole(user.ID, role); err != nil {
+			return fmt.Errorf("failed to change role: %w", err)
+		}
+		user.Role = role
+		if _, err := models.NewSessionRepository(database.DB).DeleteByUserID(user.ID); err != nil {
+			return fmt.Errorf("role changed, but failed to end sessions: %w", err)
+		}
+		auditCLI(database, "user.update", user, "Role changed from "+previous+" to "+role)
+		return writeJSON(s.out, user)
+	}
+}
+
+func NewUserSetRoleCommand() *UserSetRoleCommand {
+	return &UserSetRoleCommand{out: os.Stdout}
+}
+
+// UserResetPasswordCommand sets a new password for a user, lifts any
+// lockout and ends their sessions. With --reset-mfa it also turns off
+// two-factor authentication, for a user who lost their authenticator.
+type UserResetPasswordCommand struct {
+	user     userSelector
+	password passwordFlags
+	resetMFA bool
+	stdin    io.Reader
+	out      io.Writer
+}
+
+func (s *UserResetPasswordCommand) Short() string {
+	return "set a new password for a user"
+}
+
+func (s *UserResetPasswordCommand) Setup(cmd *cobra.Command) {
+	s.user.addFlags(cmd)
+	s.password.addFlags(cmd)
+	cmd.Flags().BoolVar(&s.resetMFA, "reset-mfa", false, "also turn off two-factor authentication")
+}
+
+func (s *UserResetPasswordCommand) Run() lib.CommandRunner {
+	return func(database lib.Database, userRepo *models.UserRepository) error {
+		if err := userStore(database); err != nil {
+			return err
+		}
+		user, err := s.user.find(userRepo)
+		if err != nil {
+			return err
+		}
+		password, err := s.password.read(s.stdin)
+		if err != nil {
+			return err
+		}
+
+		if err := user.SetPassword(password); err != nil {
+			return err
+		}
+		if err := userRepo.Update(user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if err := userRepo.Unlock(user.ID); err != nil {
+			return fmt.Errorf("password reset, but failed to unlock the user: %w", err)
+		}
+		if s.resetMFA {
+			if err := models.NewMFARepository(database.DB).Disable(user.ID); err != nil {
+				return fmt.Errorf("password reset, but failed to turn off two-factor authentication: %w", err)
+			}
+			auditCLI(database, "user.mfa_reset", user, "")
+		}
+		if _, err := models.NewSessionRepository(database.DB).DeleteByUserID(user.ID); err != nil {
+			return fmt.Errorf("password reset, but failed to end sessions: %w", err)
+		}
+		auditCLI(database, "user.password_reset", user, "")
+
+		user, err = userRepo.FindByID(user.ID)
+		if err != nil {
+			return err
+		}
+		return writeJSON(s.out, user)
+	}
+}
+
+func NewUserResetPasswordCommand() *UserResetPasswordCommand {
+	return &UserResetPasswordCommand{stdin: os.Stdin, out: os.Stdout}
+}
+
+// UserDeleteCommand deletes a user. The last admin can't be deleted.
+type UserDeleteCommand struct {
+	user userSelector
+	out  io.Writer
+}
+
+func (s *UserDeleteCommand) Short() string {
+	return "delete a user"
+}
+
+func (s *UserDeleteCommand) Setup(cmd *cobra.Command) {
+	s.user.addFlags(cmd)
+}
+
+func (s *UserDeleteCommand) Run() lib.CommandRunner {
+	return func(database lib.Database, userRepo *models.UserRepository) error {
+		if err := userStore(database); err != nil {
+			return err
+		}
+		user, err := s.user.find(userRepo)
+		if err != nil {
+			return err
+		}
+		if err := userRepo.Delete(user.ID); err != nil {
+			return err
+		}
+		auditCLI(database, "user.delete", user, "Deleted "+user.Username)
+		return writeJSON(s.out, user)
+	}
+}
+
+func NewUserDeleteCommand() *UserDeleteCommand {
+	return &UserDeleteCommand{out: os.Stdout}
+}
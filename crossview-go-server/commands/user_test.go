@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/migrations"
+	"crossview-go-server/models"
+
+	"go.uber.org/fx"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openUserTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if _, err := migrations.NewMigrator(db).Up(false); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+// runUserCommand runs a user command with args and decodes its output into
+// result.
+func runUserCommand(t *testing.T, db *gorm.DB, cmd lib.Command, result interface{}, args ...string) error {
+	if err := WrapSubCommand("user:test", cmd, fx.Options()).ParseFlags(args); err != nil {
+		t.Fatalf("Failed to parse %v: %v", args, err)
+	}
+	var out bytes.Buffer
+	switch c := cmd.(type) {
+	case *UserCreateCommand:
+		c.out = &out
+	case *UserListCommand:
+		c.out = &out
+	case *UserSetRoleCommand:
+		c.out = &out
+	case *UserResetPasswordCommand:
+		c.out = &out
+	case *UserDeleteCommand:
+		c.out = &out
+	}
+	run := cmd.Run().(func(lib.Database, *models.UserRepository) error)
+	if err := run(lib.Database{DB: db}, models.NewUserRepository(db)); err != nil {
+		return err
+	}
+	if result != nil {
+		if err := json.Unmarshal(out.Bytes(), result); err != nil {
+			t.Fatalf("Expected JSON output, got %q: %v", out.String(), err)
+		}
+	}
+	return nil
+}
+
+func TestUserCommands(t *testing.T) {
+	db := openUserTestDB(t)
+	repo := models.NewUserRepository(db)
+
+	var admin models.User
+	err := runUserCommand(t, db, NewUserCreateCommand(), &admin, "--username", "admin", "--email", "admin@example.com", "--role", "admin", "--password", "secret")
+	if err != nil || admin.ID == 0 || admin.Role != models.RoleAdmin {
+		t.Fatalf("Unexpected user %+v (%v)", admin, err)
+	}
+	if err := runUserCommand(t, db, NewUserCreateCommand(), nil, "--username", "admin", "--email", "other@example.com", "--password", "secret"); err == nil {
+		t.Error("Expected a taken username to be refused")
+	}
+	var existing models.User
+	if err := runUserCommand(t, db, NewUserCreateCommand(), &existing, "--username", "admin", "--email", "admin@example.com", "--if-not-exists"); err != nil || existing.ID != admin.ID {
+		t.Errorf("Expected --if-not-exists to return the existing user, got %+v (%v)", existing, err)
+	}
+
+	create := NewUserCreateCommand()
+	create.stdin = strings.NewReader("from-stdin\n")
+	var bob models.User
+	if err := runUserCommand(t, db, create, &bob, "--username", "bob", "--email", "bob@example.com", "--password-file", "-"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if found, _ := repo.FindByID(bob.ID); !found.VerifyPassword("from-stdin") || found.Role != models.RoleEditor {
+		t.Errorf("Expected an editor with the password from stdin, got %+v", found)
+	}
+
+	var users []models.User
+	if err := runUserCommand(t, db, NewUserListCommand(), &users, "--role", "admin"); err != nil || len(users) != 1 || users[0].Username != "admin" {
+		t.Errorf("Expected only the admin, got %+v (%v)", users, err)
+	}
+
+	if err := runUserCommand(t, db, NewUserSetRoleCommand(), nil, "--username", "admin", "--role", "viewer"); !errors.Is(err, models.ErrLastAdmin) {
+		t.Errorf("Expected the last admin to keep their role, got %v", err)
+	}
+	models.NewSessionRepository(db).Create(&models.UserSession{ID: "bob-session", UserID: bob.ID})
+	var updated models.User
+	if err := runUserCommand(t, db, NewUserSetRoleCommand(), &updated, "--username", "bob", "--role", "admin"); err != nil || updated.Role != models.RoleAdmin {
+		t.Errorf("Expected bob to be admin, got %+v (%v)", updated, err)
+	}
+	if sessions, _ := models.NewSessionRepository(db).FindByUserID(bob.ID); len(sessions) != 0 {
+		t.Errorf("Expected a role change to end the user's sessions, got %+v", sessions)
+	}
+
+	if err := runUserCommand(t, db, NewUserDeleteCommand(), nil, "--id", "999"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected an unknown user to be reported, got %v", err)
+	}
+	if err := runUserCommand(t, db, NewUserDeleteCommand(), nil, "--username", "admin"); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if err := runUserCommand(t, db, NewUserDeleteCommand(), nil, "--username", "bob"); !errors.Is(err, models.ErrLastAdmin) {
+		t.Errorf("Expected the last admin to be kept, got %v", err)
+	}
+
+	_, total, _ := models.NewAuditRepository(db).Find(models.AuditFilter{Actor: "cli"}, 0, 10)
+	if total != 4 {
+		t.Errorf("Expected 4 audited changes, got %d", total)
+	}
+}
+
+func TestUserCommand_AuditFailureReported(t *testing.T) {
+	db := openUserTestDB(t)
+	var admin models.User
+	if err := runUserCommand(t, db, NewUserCreateCommand(), &admin, "--username", "admin", "--email", "admin@example.com", "--role", "admin", "--password", "secret123"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := db.Migrator().DropTable(&models.AuditEvent{}); err != nil {
+		t.Fatalf("Failed to drop the audit table: %v", err)
+	}
+
+	var warnings bytes.Buffer
+	errOut = &warnings
+	t.Cleanup(func() { errOut = os.Stderr })
+	if err := runUserCommand(t, db, NewUserResetPasswordCommand(), nil, "--username", "admin", "--password", "new-secret"); err != nil {
+		t.Fatalf("Expected the reset to succeed without the audit log, got %v", err)
+	}
+	if !strings.Contains(warnings.String(), "failed to record user.password_reset") {
+		t.Errorf("Expected the audit failure to be reported, got %q", warnings.String())
+	}
+}
+
+func TestUserResetPasswordCommand(t *testing.T) {
+	db := openUserTestDB(t)
+	repo := models.NewUserRepository(db)
+	user := &models.User{Username: "alice", Email: "alice@example.com", Role: models.RoleAdmin, FailedLoginCount: 5, MFAEnabled: true, MFASecret: "SECRET"}
+	user.SetPassword("old")
+	repo.Create(user)
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(passwordFile, []byte("new-password\n"), 0o600)
+
+	var reset models.User
+	if err := runUserCommand(t, db, NewUserResetPasswordCommand(), &reset, "--username", "alice", "--password-file", passwordFile, "--reset-mfa"); err != nil {
+		t.Fatalf("Failed to reset password: %v", err)
+	}
+	found, _ := repo.FindByID(user.ID)
+	if !found.VerifyPassword("new-password") || found.FailedLoginCount != 0 || found.MFAEnabled {
+		t.Errorf("Expected a new password, no failed logins and no MFA, got %+v", found)
+	}
+	if reset.MFAEnabled {
+		t.Error("Expected the output to show MFA turned off")
+	}
+
+	for _, args := range [][]string{
+		{"--username", "alice"},
+		{"--password", "x"},
+		{"--username", "alice", "--id", "1", "--password", "x"},
+		{"--username", "alice", "--password", "x", "--password-file", passwordFile},
+	} {
+		if err := runUserCommand(t, db, NewUserResetPasswordCommand(), nil, args...); err == nil {
+			t.Errorf("Expected %v to be refused", args)
+		}
+	}
+}
+
+func TestUserCommands_RequireMigratedDatabase(t *testing.T) {
+	if err := runUserCommand(t, nil, NewUserListCommand(), nil); err == nil {
+		t.Error("Expected an error without a database")
+	}
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err := runUserCommand(t, db, NewUserListCommand(), nil); err == nil || !strings.Contains(err.Error(), "app:migrate") {
+		t.Errorf("Expected an unmigrated database to be refused, got %v", err)
+	}
+}
@@ -1,10 +1,17 @@
 package lib
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -17,32 +24,28 @@ func NewDatabase(env Env, logger Logger) Database {
 		logger.Info("Skipping database connection (auth mode is " + env.AuthMode + ")")
 		return Database{DB: nil}
 	}
-	username := env.DBUsername
-	password := env.DBPassword
-	host := env.DBHost
-	port := env.DBPort
-	dbname := env.DBName
-
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC", host, username, password, dbname, port)
+	dialector, dsn, err := newDialector(env)
+	if err != nil {
+		logger.Panic(err)
+	}
 
 	var db *gorm.DB
-	var err error
-	maxRetries := 5
-	for i := 0; i < maxRetries; i++ {
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	attempts := env.DBConnectRetries + 1
+	backoff := env.DBConnectBackoff
+	for i := 1; ; i++ {
+		db, err = gorm.Open(dialector, &gorm.Config{
 			Logger: logger.GetGormLogger(),
 		})
-		if err == nil {
+		if err == nil || i >= attempts {
 			break
 		}
-		if i < maxRetries-1 {
-			logger.Infof("Database connection attempt %d/%d failed, retrying in 2 seconds...", i+1, maxRetries)
-			time.Sleep(2 * time.Second)
-		}
+		logger.Infof("Database connection attempt %d/%d failed, retrying in %s...", i, attempts, backoff)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, max(env.DBConnectMaxBackoff, env.DBConnectBackoff))
 	}
 
 	if err != nil {
-		logger.Info("DSN: ", dsn)
+		logger.Errorf("Failed to connect to the database (%s): %v", redactDSN(dsn), err)
 		logger.Panic(err)
 	}
 
@@ -51,18 +54,143 @@ func NewDatabase(env Env, logger Logger) Database {
 		logger.Panic(err)
 	}
 
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-	sqlDB.SetConnMaxIdleTime(10 * time.Minute)
+	if env.DBDriver == "sqlite" {
+		// SQLite allows one writer at a time. A single connection queues
+		// writes instead of failing them with "database is locked", and
+		// keeps an in-memory database from being dropped with its
+		// connection.
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	} else {
+		sqlDB.SetMaxIdleConns(env.DBMaxIdleConns)
+		sqlDB.SetMaxOpenConns(env.DBMaxOpenConns)
+		sqlDB.SetConnMaxLifetime(env.DBConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(env.DBConnMaxIdleTime)
+	}
 
-	logger.Info("Database connection established")
+	logger.Infof("Database connection established (%s)", env.DBDriver)
 
 	return Database{
 		DB: db,
 	}
 }
 
+// newDialector returns the GORM dialector for DBDriver, and the DSN it
+// connects with.
+func newDialector(env Env) (gorm.Dialector, string, error) {
+	switch env.DBDriver {
+	case "postgres", "postgresql", "":
+		dsn, err := postgresDSN(env)
+		if err != nil {
+			return nil, "", err
+		}
+		return postgres.Open(dsn), dsn, nil
+	case "sqlite":
+		if env.DBPath == ":memory:" {
+			return sqlite.Open(env.DBPath), env.DBPath, nil
+		}
+		if err := os.MkdirAll(filepath.Dir(env.DBPath), 0o755); err != nil {
+			return nil, "", fmt.Errorf("failed to create database directory: %w", err)
+		}
+		dsn := "file:" + env.DBPath + "?_busy_timeout=5000&_journal_mode=WAL"
+		return sqlite.Open(dsn), dsn, nil
+	default:
+		return nil, "", fmt.Errorf("unknown database driver %q: use postgres or sqlite", env.DBDriver)
+	}
+}
+
+// postgresDSN returns DBURL with the TLS settings added, or else a
+// keyword/value DSN built from the separate settings.
+func postgresDSN(env Env) (string, error) {
+	rawURL, err := secretSetting(env.DBURL, env.DBURLFile)
+	if err != nil {
+		return "", err
+	}
+	tls := [][2]string{
+		{"sslmode", env.DBSSLMode},
+		{"sslrootcert", env.DBSSLRootCert},
+		{"sslcert", env.DBSSLCert},
+		{"sslkey", env.DBSSLKey},
+	}
+
+	if rawURL != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			return "", errors.New("DATABASE_URL must be a postgres:// URL")
+		}
+		// Settings in the URL win over the separate ones.
+		query := u.Query()
+		for _, setting := range tls {
+			if setting[1] != "" && !query.Has(setting[0]) {
+				query.Set(setting[0], setting[1])
+			}
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	password, err := secretSetting(env.DBPassword, env.DBPasswordFile)
+	if err != nil {
+		return "", err
+	}
+	if env.DBSSLMode == "" {
+		tls[0][1] = "disable"
+	}
+	settings := append([][2]string{
+		{"host", env.DBHost},
+		{"user", env.DBUsername},
+		{"password", password},
+		{"dbname", env.DBName},
+		{"port", env.DBPort},
+	}, tls...)
+	settings = append(settings, [2]string{"TimeZone", "UTC"})
+
+	var dsn []string
+	for _, setting := range settings {
+		if setting[1] != "" {
+			dsn = append(dsn, setting[0]+"="+quoteDSNValue(setting[1]))
+		}
+	}
+	return strings.Join(dsn, " "), nil
+}
+
+// quoteDSNValue quotes a keyword/value DSN value when it is empty or holds
+// spaces, quotes or backslashes.
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\\t\n") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// secretSetting returns the content of file, if one is named, and value
+// otherwise. A trailing newline in the file is dropped.
+func secretSetting(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database secret: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+var dsnPassword = regexp.MustCompile(`password=('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactDSN hides the password in a DSN so that it can be logged.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		if query := u.Query(); query.Has("password") {
+			query.Set("password", "xxxxx")
+			u.RawQuery = query.Encode()
+		}
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password=xxxxx")
+}
+
 func (d Database) Close() error {
 	if d.DB == nil {
 		return nil
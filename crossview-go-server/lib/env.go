@@ -4,26 +4,92 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Env struct {
-	ServerPort        string `mapstructure:"SERVER_PORT"`
-	Environment       string `mapstructure:"ENV"`
-	LogOutput         string `mapstructure:"LOG_OUTPUT"`
-	LogLevel          string `mapstructure:"LOG_LEVEL"`
-	DBUsername        string `mapstructure:"DB_USER"`
-	DBPassword        string `mapstructure:"DB_PASS"`
-	DBHost            string `mapstructure:"DB_HOST"`
-	DBPort            string `mapstructure:"DB_PORT"`
-	DBName            string `mapstructure:"DB_NAME"`
-	SessionSecret     string `mapstructure:"SESSION_SECRET"`
-	CORSOrigin        string `mapstructure:"CORS_ORIGIN"`
-	AuthMode          string `mapstructure:"AUTH_MODE"`
-	AuthTrustedHeader string `mapstructure:"AUTH_TRUSTED_HEADER"`
-	AuthCreateUsers   bool   `mapstructure:"AUTH_CREATE_USERS"`
-	AuthDefaultRole   string `mapstructure:"AUTH_DEFAULT_ROLE"`
+	ServerPort  string `mapstructure:"SERVER_PORT"`
+	Environment string `mapstructure:"ENV"`
+	LogOutput   string `mapstructure:"LOG_OUTPUT"`
+	LogLevel    string `mapstructure:"LOG_LEVEL"`
+	// DBDriver selects the database: "postgres" (the default) or "sqlite",
+	// which keeps everything in the file at DBPath.
+	DBDriver   string `mapstructure:"DB_DRIVER"`
+	DBPath     string `mapstructure:"DB_PATH"`
+	DBUsername string `mapstructure:"DB_USER"`
+	DBPassword string `mapstructure:"DB_PASS"`
+	DBHost     string `mapstructure:"DB_HOST"`
+	DBPort     string `mapstructure:"DB_PORT"`
+	DBName     string `mapstructure:"DB_NAME"`
+	// DBURL, when set, is a postgres:// URL to connect with instead of the
+	// host, port, user, password and name above. DBPasswordFile and
+	// DBURLFile name files, e.g. mounted secrets, to read them from.
+	DBURL          string `mapstructure:"DATABASE_URL"`
+	DBPasswordFile string `mapstructure:"DB_PASS_FILE"`
+	DBURLFile      string `mapstructure:"DATABASE_URL_FILE"`
+	// DBSSLMode is the Postgres sslmode: disable (the default), require,
+	// verify-ca or verify-full. DBSSLRootCert is the CA the server is
+	// verified with, and DBSSLCert and DBSSLKey are a client certificate.
+	DBSSLMode     string `mapstructure:"DB_SSLMODE"`
+	DBSSLRootCert string `mapstructure:"DB_SSLROOTCERT"`
+	DBSSLCert     string `mapstructure:"DB_SSLCERT"`
+	DBSSLKey      string `mapstructure:"DB_SSLKEY"`
+	// Connection pool limits for Postgres. SQLite always uses a single
+	// connection.
+	DBMaxOpenConns    int           `mapstructure:"DB_MAX_OPEN_CONNS"`
+	DBMaxIdleConns    int           `mapstructure:"DB_MAX_IDLE_CONNS"`
+	DBConnMaxLifetime time.Duration `mapstructure:"DB_CONN_MAX_LIFETIME"`
+	DBConnMaxIdleTime time.Duration `mapstructure:"DB_CONN_MAX_IDLE_TIME"`
+	// A failed connection at startup is retried DBConnectRetries times,
+	// waiting DBConnectBackoff at first and twice as long each time after,
+	// up to DBConnectMaxBackoff.
+	DBConnectRetries    int           `mapstructure:"DB_CONNECT_RETRIES"`
+	DBConnectBackoff    time.Duration `mapstructure:"DB_CONNECT_BACKOFF"`
+	DBConnectMaxBackoff time.Duration `mapstructure:"DB_CONNECT_MAX_BACKOFF"`
+	// DBAutoMigrate lets app:serve apply pending migrations itself instead
+	// of refusing to start until app:migrate has run.
+	DBAutoMigrate bool   `mapstructure:"DB_AUTO_MIGRATE"`
+	SessionSecret string `mapstructure:"SESSION_SECRET"`
+	// SessionStore selects where session data lives: "database" (the
+	// default), "redis" or "cookie".
+	SessionStore           string        `mapstructure:"SESSION_STORE"`
+	SessionIdleTimeout     time.Duration `mapstructure:"SESSION_IDLE_TIMEOUT"`
+	SessionAbsoluteTimeout time.Duration `mapstructure:"SESSION_ABSOLUTE_TIMEOUT"`
+	SessionRedisAddress    string        `mapstructure:"SESSION_REDIS_ADDRESS"`
+	SessionRedisPassword   string        `mapstructure:"SESSION_REDIS_PASSWORD"`
+	SessionRedisDB         string        `mapstructure:"SESSION_REDIS_DB"`
+	CORSOrigin             string        `mapstructure:"CORS_ORIGIN"`
+	AuthMode               string        `mapstructure:"AUTH_MODE"`
+	AuthTrustedHeader      string        `mapstructure:"AUTH_TRUSTED_HEADER"`
+	AuthCreateUsers        bool          `mapstructure:"AUTH_CREATE_USERS"`
+	AuthDefaultRole        string        `mapstructure:"AUTH_DEFAULT_ROLE"`
+	AuthGroupsHeader       string        `mapstructure:"AUTH_GROUPS_HEADER"`
+	// Login throttling: each failed password login doubles the wait before
+	// the next attempt for that username and client IP, starting at
+	// LoginBackoff, and LoginMaxAttempts failures in a row (LoginIPMaxAttempts
+	// for an IP) lock it out for LoginLockoutDuration. Zero attempts
+	// disables the lockout.
+	LoginMaxAttempts     int           `mapstructure:"AUTH_LOGIN_MAX_ATTEMPTS"`
+	LoginIPMaxAttempts   int           `mapstructure:"AUTH_LOGIN_IP_MAX_ATTEMPTS"`
+	LoginBackoff         time.Duration `mapstructure:"AUTH_LOGIN_BACKOFF"`
+	LoginLockoutDuration time.Duration `mapstructure:"AUTH_LOGIN_LOCKOUT_DURATION"`
+	// TrustedProxies lists the proxy addresses or CIDRs whose
+	// X-Forwarded-For header is believed when working out a client's IP.
+	// None are by default.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+	// MFAIssuer is the name authenticator apps show for Crossview accounts.
+	// Local accounts with one of MFARequiredRoles must enroll in two-factor
+	// authentication before they can log in.
+	MFAIssuer        string   `mapstructure:"AUTH_MFA_ISSUER"`
+	MFARequiredRoles []string `mapstructure:"AUTH_MFA_REQUIRED_ROLES"`
+	// KubernetesAuthorization selects how cluster access is authorized:
+	// "service-account" (the server's own credentials), "impersonate" or
+	// "subjectaccessreview".
+	KubernetesAuthorization string `mapstructure:"KUBERNETES_AUTHORIZATION"`
 }
 
 func NewEnv() Env {
@@ -65,6 +131,10 @@ func NewEnv() Env {
 	env.LogLevel = getEnvOrDefault("LOG_LEVEL",
 		getConfigValue("server.log.level", viper.GetString("LOG_LEVEL"), ""))
 
+	env.DBDriver = strings.ToLower(getEnvOrDefault("DB_DRIVER",
+		getConfigValue("database.driver", viper.GetString("DB_DRIVER"), "postgres")))
+	env.DBPath = getEnvOrDefault("DB_PATH",
+		getConfigValue("database.path", viper.GetString("DB_PATH"), "crossview.db"))
 	env.DBUsername = getEnvOrDefault("DB_USER", getEnvOrDefault("DB_USERNAME",
 		getConfigValue("database.username", viper.GetString("DB_USER"), "postgres")))
 	env.DBPassword = getEnvOrDefault("DB_PASS", getEnvOrDefault("DB_PASSWORD",
@@ -75,10 +145,50 @@ func NewEnv() Env {
 		getConfigValue("database.port", viper.GetString("DB_PORT"), "5432"))
 	env.DBName = getEnvOrDefault("DB_NAME", getEnvOrDefault("DB_DATABASE",
 		getConfigValue("database.database", viper.GetString("DB_NAME"), "crossview")))
+	env.DBURL = getEnvOrDefault("DATABASE_URL",
+		getConfigValue("database.url", "", ""))
+	env.DBPasswordFile = getEnvOrDefault("DB_PASS_FILE", getEnvOrDefault("DB_PASSWORD_FILE",
+		getConfigValue("database.passwordFile", "", "")))
+	env.DBURLFile = getEnvOrDefault("DATABASE_URL_FILE",
+		getConfigValue("database.urlFile", "", ""))
+	env.DBSSLMode = getEnvOrDefault("DB_SSLMODE",
+		getConfigValue("database.sslMode", "", ""))
+	env.DBSSLRootCert = getEnvOrDefault("DB_SSLROOTCERT",
+		getConfigValue("database.sslRootCert", "", ""))
+	env.DBSSLCert = getEnvOrDefault("DB_SSLCERT",
+		getConfigValue("database.sslCert", "", ""))
+	env.DBSSLKey = getEnvOrDefault("DB_SSLKEY",
+		getConfigValue("database.sslKey", "", ""))
+	env.DBMaxOpenConns = parseIntSetting(getEnvOrDefault("DB_MAX_OPEN_CONNS",
+		getConfigValue("database.pool.maxOpenConns", "", "")), 100)
+	env.DBMaxIdleConns = parseIntSetting(getEnvOrDefault("DB_MAX_IDLE_CONNS",
+		getConfigValue("database.pool.maxIdleConns", "", "")), 10)
+	env.DBConnMaxLifetime = parseDurationSetting(getEnvOrDefault("DB_CONN_MAX_LIFETIME",
+		getConfigValue("database.pool.connMaxLifetime", "", "")), time.Hour)
+	env.DBConnMaxIdleTime = parseDurationSetting(getEnvOrDefault("DB_CONN_MAX_IDLE_TIME",
+		getConfigValue("database.pool.connMaxIdleTime", "", "")), 10*time.Minute)
+	env.DBConnectRetries = parseIntSetting(getEnvOrDefault("DB_CONNECT_RETRIES",
+		getConfigValue("database.connect.retries", "", "")), 4)
+	env.DBConnectBackoff = parseDurationSetting(getEnvOrDefault("DB_CONNECT_BACKOFF",
+		getConfigValue("database.connect.backoff", "", "")), 2*time.Second)
+	env.DBConnectMaxBackoff = parseDurationSetting(getEnvOrDefault("DB_CONNECT_MAX_BACKOFF",
+		getConfigValue("database.connect.maxBackoff", "", "")), 30*time.Second)
 
 	env.SessionSecret = getEnvOrDefault("SESSION_SECRET",
 		getConfigValue("server.session.secret", viper.GetString("SESSION_SECRET"),
 			"crossview-secret-key-change-in-production"))
+	env.SessionStore = getEnvOrDefault("SESSION_STORE",
+		getConfigValue("server.session.store", viper.GetString("SESSION_STORE"), "database"))
+	env.SessionIdleTimeout = parseDurationSetting(getEnvOrDefault("SESSION_IDLE_TIMEOUT",
+		getConfigValue("server.session.idleTimeout", "", "")), 8*time.Hour)
+	env.SessionAbsoluteTimeout = parseDurationSetting(getEnvOrDefault("SESSION_ABSOLUTE_TIMEOUT",
+		getConfigValue("server.session.absoluteTimeout", "", "")), 24*time.Hour)
+	env.SessionRedisAddress = getEnvOrDefault("SESSION_REDIS_ADDRESS",
+		getConfigValue("server.session.redis.address", "", "localhost:6379"))
+	env.SessionRedisPassword = getEnvOrDefault("SESSION_REDIS_PASSWORD",
+		getConfigValue("server.session.redis.password", "", ""))
+	env.SessionRedisDB = getEnvOrDefault("SESSION_REDIS_DB",
+		getConfigValue("server.session.redis.db", "", "0"))
 
 	env.CORSOrigin = getEnvOrDefault("CORS_ORIGIN",
 		getConfigValue("server.cors.origin", viper.GetString("CORS_ORIGIN"),
@@ -89,6 +199,34 @@ func NewEnv() Env {
 		getConfigValue("server.auth.header.trustedHeader", viper.GetString("AUTH_TRUSTED_HEADER"), "X-Auth-User")))
 	env.AuthDefaultRole = getEnvOrDefault("AUTH_DEFAULT_ROLE",
 		getConfigValue("server.auth.header.defaultRole", viper.GetString("AUTH_DEFAULT_ROLE"), "viewer"))
+	env.AuthGroupsHeader = getEnvOrDefault("AUTH_GROUPS_HEADER",
+		getConfigValue("server.auth.header.groupsHeader", viper.GetString("AUTH_GROUPS_HEADER"), "X-Auth-Groups"))
+	env.KubernetesAuthorization = getEnvOrDefault("KUBERNETES_AUTHORIZATION",
+		getConfigValue("server.auth.kubernetes.authorization", viper.GetString("KUBERNETES_AUTHORIZATION"), "service-account"))
+	env.LoginMaxAttempts = parseIntSetting(getEnvOrDefault("AUTH_LOGIN_MAX_ATTEMPTS",
+		getConfigValue("server.auth.login.maxAttempts", "", "")), 5)
+	env.LoginIPMaxAttempts = parseIntSetting(getEnvOrDefault("AUTH_LOGIN_IP_MAX_ATTEMPTS",
+		getConfigValue("server.auth.login.ipMaxAttempts", "", "")), 20)
+	env.LoginBackoff = parseDurationSetting(getEnvOrDefault("AUTH_LOGIN_BACKOFF",
+		getConfigValue("server.auth.login.backoff", "", "")), time.Second)
+	env.LoginLockoutDuration = parseDurationSetting(getEnvOrDefault("AUTH_LOGIN_LOCKOUT_DURATION",
+		getConfigValue("server.auth.login.lockoutDuration", "", "")), 15*time.Minute)
+	// No proxy is trusted by default, so the client IP is the peer address
+	// and X-Forwarded-For is ignored.
+	trustedProxies := ""
+	if viper.IsSet("server.trustedProxies") {
+		trustedProxies = strings.Join(viper.GetStringSlice("server.trustedProxies"), ",")
+	}
+	env.TrustedProxies = splitList(getEnvOrDefault("TRUSTED_PROXIES", trustedProxies))
+	env.MFAIssuer = getEnvOrDefault("AUTH_MFA_ISSUER",
+		getConfigValue("server.auth.mfa.issuer", "", "Crossview"))
+	env.MFARequiredRoles = splitList(getEnvOrDefault("AUTH_MFA_REQUIRED_ROLES",
+		strings.Join(viper.GetStringSlice("server.auth.mfa.requiredRoles"), ",")))
+	if v := os.Getenv("DB_AUTO_MIGRATE"); v != "" {
+		env.DBAutoMigrate = v == "true" || v == "1"
+	} else {
+		env.DBAutoMigrate = viper.GetBool("database.autoMigrate")
+	}
 	if v := os.Getenv("AUTH_CREATE_USERS"); v != "" {
 		env.AuthCreateUsers = v == "true" || v == "1"
 	} else if viper.IsSet("server.auth.header.createUsers") {
@@ -121,6 +259,30 @@ func getConfigValue(key, envValue, defaultValue string) string {
 	return defaultValue
 }
 
+// parseIntSetting parses a non-negative integer setting, returning fallback
+// when it is unset or invalid.
+func parseIntSetting(value string, fallback int) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fallback
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+		return n
+	}
+	return fallback
+}
+
+// splitList splits a comma separated setting, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
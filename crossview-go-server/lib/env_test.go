@@ -3,6 +3,7 @@ package lib
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestNewEnv(t *testing.T) {
@@ -59,3 +60,138 @@ func TestGetEnvOrDefault(t *testing.T) {
 	}
 }
 
+
+func TestNewEnv_SessionSettings(t *testing.T) {
+	env := NewEnv()
+	if env.SessionStore != "database" {
+		t.Errorf("Expected session store 'database' by default, got '%s'", env.SessionStore)
+	}
+	if env.SessionIdleTimeout != 8*time.Hour || env.SessionAbsoluteTimeout != 24*time.Hour {
+		t.Errorf("Unexpected default timeouts: idle=%s, absolute=%s", env.SessionIdleTimeout, env.SessionAbsoluteTimeout)
+	}
+
+	os.Setenv("SESSION_STORE", "redis")
+	os.Setenv("SESSION_IDLE_TIMEOUT", "30m")
+	os.Setenv("SESSION_ABSOLUTE_TIMEOUT", "43200")
+	defer func() {
+		os.Unsetenv("SESSION_STORE")
+		os.Unsetenv("SESSION_IDLE_TIMEOUT")
+		os.Unsetenv("SESSION_ABSOLUTE_TIMEOUT")
+	}()
+
+	env = NewEnv()
+	if env.SessionStore != "redis" {
+		t.Errorf("Expected session store 'redis', got '%s'", env.SessionStore)
+	}
+	if env.SessionIdleTimeout != 30*time.Minute {
+		t.Errorf("Expected idle timeout 30m, got %s", env.SessionIdleTimeout)
+	}
+	if env.SessionAbsoluteTimeout != 12*time.Hour {
+		t.Errorf("Expected absolute timeout 12h, got %s", env.SessionAbsoluteTimeout)
+	}
+}
+
+func TestNewEnv_LoginSettings(t *testing.T) {
+	env := NewEnv()
+	if env.LoginMaxAttempts != 5 || env.LoginIPMaxAttempts != 20 {
+		t.Errorf("Unexpected default attempt limits: user=%d, ip=%d", env.LoginMaxAttempts, env.LoginIPMaxAttempts)
+	}
+	if env.LoginBackoff != time.Second || env.LoginLockoutDuration != 15*time.Minute {
+		t.Errorf("Unexpected default timings: backoff=%s, lockout=%s", env.LoginBackoff, env.LoginLockoutDuration)
+	}
+	if len(env.TrustedProxies) != 0 {
+		t.Errorf("Expected no trusted proxies by default, got %v", env.TrustedProxies)
+	}
+
+	os.Setenv("AUTH_LOGIN_MAX_ATTEMPTS", "0")
+	os.Setenv("AUTH_LOGIN_IP_MAX_ATTEMPTS", "not-a-number")
+	os.Setenv("AUTH_LOGIN_LOCKOUT_DURATION", "1h")
+	os.Setenv("TRUSTED_PROXIES", "10.1.0.0/16, 10.2.0.1")
+	defer func() {
+		os.Unsetenv("AUTH_LOGIN_MAX_ATTEMPTS")
+		os.Unsetenv("AUTH_LOGIN_IP_MAX_ATTEMPTS")
+		os.Unsetenv("AUTH_LOGIN_LOCKOUT_DURATION")
+		os.Unsetenv("TRUSTED_PROXIES")
+	}()
+
+	env = NewEnv()
+	if env.LoginMaxAttempts != 0 {
+		t.Errorf("Expected 0 to disable the lockout, got %d", env.LoginMaxAttempts)
+	}
+	if env.LoginIPMaxAttempts != 20 {
+		t.Errorf("Expected an invalid value to fall back to 20, got %d", env.LoginIPMaxAttempts)
+	}
+	if env.LoginLockoutDuration != time.Hour {
+		t.Errorf("Expected lockout 1h, got %s", env.LoginLockoutDuration)
+	}
+	if len(env.TrustedProxies) != 2 || env.TrustedProxies[1] != "10.2.0.1" {
+		t.Errorf("Unexpected trusted proxies: %v", env.TrustedProxies)
+	}
+}
+
+func TestNewEnv_MFASettings(t *testing.T) {
+	env := NewEnv()
+	if env.MFAIssuer != "Crossview" || len(env.MFARequiredRoles) != 0 {
+		t.Errorf("Unexpected defaults: issuer=%s, requiredRoles=%v", env.MFAIssuer, env.MFARequiredRoles)
+	}
+
+	os.Setenv("AUTH_MFA_REQUIRED_ROLES", "admin, editor")
+	defer os.Unsetenv("AUTH_MFA_REQUIRED_ROLES")
+
+	env = NewEnv()
+	if len(env.MFARequiredRoles) != 2 || env.MFARequiredRoles[0] != "admin" || env.MFARequiredRoles[1] != "editor" {
+		t.Errorf("Unexpected required roles: %v", env.MFARequiredRoles)
+	}
+}
+
+func TestNewEnv_DatabaseDriver(t *testing.T) {
+	env := NewEnv()
+	if env.DBDriver != "postgres" || env.DBPath != "crossview.db" || env.DBAutoMigrate {
+		t.Errorf("Unexpected defaults: driver=%s, path=%s, autoMigrate=%v", env.DBDriver, env.DBPath, env.DBAutoMigrate)
+	}
+
+	os.Setenv("DB_DRIVER", "SQLite")
+	os.Setenv("DB_PATH", "/data/crossview.db")
+	os.Setenv("DB_AUTO_MIGRATE", "true")
+	defer func() {
+		os.Unsetenv("DB_DRIVER")
+		os.Unsetenv("DB_PATH")
+		os.Unsetenv("DB_AUTO_MIGRATE")
+	}()
+
+	env = NewEnv()
+	if env.DBDriver != "sqlite" || env.DBPath != "/data/crossview.db" || !env.DBAutoMigrate {
+		t.Errorf("Unexpected settings: driver=%s, path=%s, autoMigrate=%v", env.DBDriver, env.DBPath, env.DBAutoMigrate)
+	}
+}
+
+func TestNewEnv_DatabaseConnectionSettings(t *testing.T) {
+	env := NewEnv()
+	if env.DBSSLMode != "" || env.DBMaxOpenConns != 100 || env.DBMaxIdleConns != 10 || env.DBConnectRetries != 4 || env.DBConnectBackoff != 2*time.Second {
+		t.Errorf("Unexpected defaults: %+v", env)
+	}
+
+	os.Setenv("DATABASE_URL", "postgres://db/crossview")
+	os.Setenv("DB_PASSWORD_FILE", "/run/secrets/db-password")
+	os.Setenv("DB_SSLMODE", "verify-full")
+	os.Setenv("DB_SSLROOTCERT", "/etc/ssl/ca.crt")
+	os.Setenv("DB_MAX_OPEN_CONNS", "20")
+	os.Setenv("DB_CONNECT_RETRIES", "0")
+	os.Setenv("DB_CONNECT_MAX_BACKOFF", "1m")
+	defer func() {
+		for _, key := range []string{"DATABASE_URL", "DB_PASSWORD_FILE", "DB_SSLMODE", "DB_SSLROOTCERT", "DB_MAX_OPEN_CONNS", "DB_CONNECT_RETRIES", "DB_CONNECT_MAX_BACKOFF"} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	env = NewEnv()
+	if env.DBURL != "postgres://db/crossview" || env.DBPasswordFile != "/run/secrets/db-password" {
+		t.Errorf("Unexpected URL or password file: '%s', '%s'", env.DBURL, env.DBPasswordFile)
+	}
+	if env.DBSSLMode != "verify-full" || env.DBSSLRootCert != "/etc/ssl/ca.crt" {
+		t.Errorf("Unexpected TLS settings: '%s', '%s'", env.DBSSLMode, env.DBSSLRootCert)
+	}
+	if env.DBMaxOpenConns != 20 || env.DBConnectRetries != 0 || env.DBConnectMaxBackoff != time.Minute {
+		t.Errorf("Unexpected pool or retry settings: %d, %d, %s", env.DBMaxOpenConns, env.DBConnectRetries, env.DBConnectMaxBackoff)
+	}
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	PermissionResourcesRead  = "resources:read"
+	PermissionResourcesWrite = "resources:write"
+	PermissionContextsSelect = "contexts:select"
+	PermissionContextsManage = "contexts:manage"
+	PermissionUsersManage    = "users:manage"
+	PermissionAuditRead      = "audit:read"
+)
+
+// RBACConfig maps each role to the permissions it grants. A "*" permission
+// grants everything.
+type RBACConfig struct {
+	Roles map[string][]string
+}
+
+func defaultRBACRoles() map[string][]string {
+	return map[string][]string{
+		"viewer": {PermissionResourcesRead, PermissionContextsSelect},
+		"editor": {PermissionResourcesRead, PermissionContextsSelect, PermissionResourcesWrite},
+		"admin":  {"*"},
+	}
+}
+
+// GetRBACConfig loads the role matrix from rbac.roles in the config file,
+// falling back to the defaults for roles it does not mention. A role can
+// also be overridden with RBAC_ROLE_<NAME>, a comma separated permission
+// list.
+func GetRBACConfig() RBACConfig {
+	roles := defaultRBACRoles()
+
+	if viper.IsSet("rbac.roles") {
+		for role, permissions := range viper.GetStringMapStringSlice("rbac.roles") {
+			roles[strings.ToLower(role)] = permissions
+		}
+	}
+
+	for role := range roles {
+		if v := os.Getenv("RBAC_ROLE_" + strings.ToUpper(role)); v != "" {
+			roles[role] = splitPermissions(v)
+		}
+	}
+
+	return RBACConfig{Roles: roles}
+}
+
+// Allows reports whether role grants permission.
+func (c RBACConfig) Allows(role, permission string) bool {
+	for _, granted := range c.Roles[role] {
+		if granted == "*" || granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPermissions(value string) []string {
+	var permissions []string
+	for _, p := range strings.Split(value, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
@@ -0,0 +1,41 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestGetRBACConfig_Defaults(t *testing.T) {
+	config := GetRBACConfig()
+
+	if !config.Allows("viewer", PermissionResourcesRead) {
+		t.Error("Expected viewer to read resources")
+	}
+	if config.Allows("viewer", PermissionResourcesWrite) {
+		t.Error("Expected viewer not to write resources")
+	}
+	if !config.Allows("editor", PermissionResourcesWrite) {
+		t.Error("Expected editor to write resources")
+	}
+	if config.Allows("editor", PermissionContextsManage) {
+		t.Error("Expected editor not to manage contexts")
+	}
+	if !config.Allows("admin", PermissionUsersManage) {
+		t.Error("Expected admin to manage users")
+	}
+	if config.Allows("unknown", PermissionResourcesRead) {
+		t.Error("Expected unknown role to have no permissions")
+	}
+}
+
+func TestGetRBACConfig_EnvOverride(t *testing.T) {
+	t.Setenv("RBAC_ROLE_VIEWER", "resources:read, contexts:manage")
+
+	config := GetRBACConfig()
+
+	if !config.Allows("viewer", PermissionContextsManage) {
+		t.Error("Expected override to grant contexts:manage")
+	}
+	if config.Allows("viewer", PermissionContextsSelect) {
+		t.Error("Expected override to replace the default permissions")
+	}
+}
@@ -10,8 +10,13 @@ type RequestHandler struct {
 }
 
 // NewRequestHandler creates a new request handler
-func NewRequestHandler(logger Logger) RequestHandler {
+func NewRequestHandler(logger Logger, env Env) RequestHandler {
 	gin.DefaultWriter = logger.GetGinLogger()
 	engine := gin.New()
+	// Only these proxies may name the client's IP in X-Forwarded-For;
+	// anyone else could use it to dodge per-IP login throttling.
+	if err := engine.SetTrustedProxies(env.TrustedProxies); err != nil {
+		logger.Errorf("Invalid trusted proxies %v: %v", env.TrustedProxies, err)
+	}
 	return RequestHandler{Gin: engine}
 }
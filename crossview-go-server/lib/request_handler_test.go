@@ -0,0 +1,31 @@
+package lib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func clientIP(env Env) string {
+	gin.SetMode(gin.TestMode)
+	handler := NewRequestHandler(GetLogger(), env)
+	var ip string
+	handler.Gin.GET("/", func(c *gin.Context) { ip = c.ClientIP() })
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	handler.Gin.ServeHTTP(httptest.NewRecorder(), req)
+	return ip
+}
+
+func TestNewRequestHandler_TrustedProxies(t *testing.T) {
+	if ip := clientIP(Env{}); ip != "10.0.0.5" {
+		t.Errorf("Expected X-Forwarded-For to be ignored without trusted proxies, got %s", ip)
+	}
+	if ip := clientIP(Env{TrustedProxies: []string{"10.0.0.0/8"}}); ip != "203.0.113.7" {
+		t.Errorf("Expected X-Forwarded-For from a trusted proxy to be used, got %s", ip)
+	}
+}
@@ -3,6 +3,9 @@ package lib
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -10,10 +13,67 @@ import (
 type SSOConfig struct {
 	Enabled bool
 	OIDC    OIDCConfig
-	SAML    SAMLConfig
+	// OIDCProviders lists the named providers from sso.oidc.providers. When
+	// it is empty, OIDC is the only provider; otherwise OIDC is the first
+	// entry, which the unnamed /api/auth/oidc routes use.
+	OIDCProviders []OIDCConfig
+	SAML          SAMLConfig
+	HTTP          SSOHTTPConfig
+	// LinkByEmail lets a first SSO login take over the existing user with
+	// the same email. Otherwise such a login is refused.
+	LinkByEmail bool
+}
+
+// DefaultOIDCProvider names the provider configured directly under sso.oidc.
+const DefaultOIDCProvider = "default"
+
+// EnabledOIDCProviders returns the providers users can sign in with, in
+// configured order.
+func (c SSOConfig) EnabledOIDCProviders() []OIDCConfig {
+	providers := c.OIDCProviders
+	if len(providers) == 0 {
+		providers = []OIDCConfig{c.OIDC}
+	}
+	var enabled []OIDCConfig
+	for _, provider := range providers {
+		if !provider.Enabled {
+			continue
+		}
+		if provider.Name == "" {
+			provider.Name = DefaultOIDCProvider
+		}
+		enabled = append(enabled, provider)
+	}
+	return enabled
+}
+
+// OIDCProvider returns the enabled provider called name, or the first one
+// when name is empty.
+func (c SSOConfig) OIDCProvider(name string) (OIDCConfig, bool) {
+	for _, provider := range c.EnabledOIDCProviders() {
+		if name == "" || provider.Name == name {
+			return provider, true
+		}
+	}
+	return OIDCConfig{}, false
+}
+
+// SSOHTTPConfig configures the client used to reach identity providers:
+// discovery, token, userinfo and JWKS requests all go through it.
+type SSOHTTPConfig struct {
+	Timeout time.Duration
+	// CACert is a PEM bundle trusted in addition to the system roots.
+	CACert string
+	// ProxyURL overrides the HTTPS_PROXY/NO_PROXY environment.
+	ProxyURL string
+	// ClientCert and ClientKey, both PEM, enable mutual TLS.
+	ClientCert string
+	ClientKey  string
 }
 
 type OIDCConfig struct {
+	Name               string
+	DisplayName        string
 	Enabled            bool
 	Issuer             string
 	ClientId           string
@@ -21,19 +81,54 @@ type OIDCConfig struct {
 	AuthorizationURL   string
 	TokenURL           string
 	UserInfoURL        string
+	JWKSURL            string
+	EndSessionURL      string
+	DiscoveryCacheTTL  time.Duration
 	CallbackURL        string
+	// LogoutRedirectURL is where the IdP sends the browser after logout.
+	// Empty means the Crossview login page.
+	LogoutRedirectURL  string
 	Scope              string
 	UsernameAttribute  string
 	EmailAttribute     string
 	FirstNameAttribute string
 	LastNameAttribute  string
+	GroupsAttribute    string
+	RoleMapping        RoleMapping
+}
+
+// RoleMappingDeny as the default role refuses login to users that match no
+// rule.
+const RoleMappingDeny = "deny"
+
+// RoleMapping assigns a role from the claims an identity provider returns.
+// When it has rules or a default, the role is recomputed on every login.
+type RoleMapping struct {
+	Rules       []RoleMappingRule
+	DefaultRole string
+}
+
+// RoleMappingRule grants Role when Claim, a string or list of strings,
+// contains Value. An empty Claim means the groups claim.
+type RoleMappingRule struct {
+	Claim string `mapstructure:"claim"`
+	Value string `mapstructure:"value"`
+	Role  string `mapstructure:"role"`
+}
+
+// Configured reports whether any mapping applies.
+func (m RoleMapping) Configured() bool {
+	return len(m.Rules) > 0 || m.DefaultRole != ""
 }
 
 type SAMLConfig struct {
 	Enabled            bool
 	EntryPoint         string
 	Issuer             string
+	IdPIssuer          string
 	Cert               string
+	PrivateKey         string
+	SigningCert        string
 	CallbackURL        string
 	UsernameAttribute  string
 	EmailAttribute     string
@@ -53,10 +148,37 @@ func GetSSOConfig(env Env) SSOConfig {
 	
 	enabled := ssoEnabled == "true"
 	
+	oidc := getOIDCConfig(env)
+	providers := getOIDCProviders(oidc)
+	if len(providers) > 0 {
+		oidc = providers[0]
+		for _, provider := range providers {
+			oidc.Enabled = oidc.Enabled || provider.Enabled
+		}
+	}
+	
+	linkByEmail := getEnvOrDefault("SSO_LINK_BY_EMAIL", "")
+	if linkByEmail == "" && viper.IsSet("sso.linkByEmail") {
+		linkByEmail = fmt.Sprintf("%v", viper.Get("sso.linkByEmail"))
+	}
+	
 	return SSOConfig{
-		Enabled: enabled,
-		OIDC:    getOIDCConfig(env),
-		SAML:    getSAMLConfig(env),
+		Enabled:       enabled,
+		OIDC:          oidc,
+		OIDCProviders: providers,
+		SAML:          getSAMLConfig(env),
+		HTTP:          getSSOHTTPConfig(),
+		LinkByEmail:   linkByEmail == "true",
+	}
+}
+
+func getSSOHTTPConfig() SSOHTTPConfig {
+	return SSOHTTPConfig{
+		Timeout:    parseDurationSetting(getEnvOrDefault("SSO_HTTP_TIMEOUT", getConfigValue("sso.http.timeout", "", "")), 10*time.Second),
+		CACert:     readPEMSetting(getEnvOrDefault("SSO_HTTP_CA_CERT", getConfigValue("sso.http.caCert", "", ""))),
+		ProxyURL:   getEnvOrDefault("SSO_HTTP_PROXY", getConfigValue("sso.http.proxy", "", "")),
+		ClientCert: readPEMSetting(getEnvOrDefault("SSO_HTTP_CLIENT_CERT", getConfigValue("sso.http.clientCert", "", ""))),
+		ClientKey:  readPEMSetting(getEnvOrDefault("SSO_HTTP_CLIENT_KEY", getConfigValue("sso.http.clientKey", "", ""))),
 	}
 }
 
@@ -71,6 +193,8 @@ func getOIDCConfig(env Env) OIDCConfig {
 	}
 	
 	return OIDCConfig{
+		Name:               DefaultOIDCProvider,
+		DisplayName:        getEnvOrDefault("OIDC_DISPLAY_NAME", getConfigValue("sso.oidc.displayName", "", "OIDC")),
 		Enabled:            oidcEnabled == "true",
 		Issuer:             getEnvOrDefault("OIDC_ISSUER", getConfigValue("sso.oidc.issuer", "", "http://localhost:8080/realms/crossview")),
 		ClientId:           getEnvOrDefault("OIDC_CLIENT_ID", getConfigValue("sso.oidc.clientId", "", "crossview-client")),
@@ -78,13 +202,137 @@ func getOIDCConfig(env Env) OIDCConfig {
 		AuthorizationURL:   getEnvOrDefault("OIDC_AUTHORIZATION_URL", getConfigValue("sso.oidc.authorizationURL", "", "")),
 		TokenURL:           getEnvOrDefault("OIDC_TOKEN_URL", getConfigValue("sso.oidc.tokenURL", "", "")),
 		UserInfoURL:        getEnvOrDefault("OIDC_USERINFO_URL", getConfigValue("sso.oidc.userInfoURL", "", "")),
+		JWKSURL:            getEnvOrDefault("OIDC_JWKS_URL", getConfigValue("sso.oidc.jwksURL", "", "")),
+		EndSessionURL:      getEnvOrDefault("OIDC_END_SESSION_URL", getConfigValue("sso.oidc.endSessionURL", "", "")),
+		DiscoveryCacheTTL:  parseDurationSetting(getEnvOrDefault("OIDC_DISCOVERY_CACHE_TTL", getConfigValue("sso.oidc.discoveryCacheTTL", "", "")), time.Hour),
 		CallbackURL:        getEnvOrDefault("OIDC_CALLBACK_URL", getConfigValue("sso.oidc.callbackURL", "", "http://localhost:3001/api/auth/oidc/callback")),
+		LogoutRedirectURL:  getEnvOrDefault("OIDC_POST_LOGOUT_REDIRECT_URL", getConfigValue("sso.oidc.postLogoutRedirectURL", "", "")),
 		Scope:              getEnvOrDefault("OIDC_SCOPE", getConfigValue("sso.oidc.scope", "", "openid profile email")),
 		UsernameAttribute:  getEnvOrDefault("OIDC_USERNAME_ATTRIBUTE", getConfigValue("sso.oidc.usernameAttribute", "", "preferred_username")),
 		EmailAttribute:     getEnvOrDefault("OIDC_EMAIL_ATTRIBUTE", getConfigValue("sso.oidc.emailAttribute", "", "email")),
 		FirstNameAttribute: getEnvOrDefault("OIDC_FIRSTNAME_ATTRIBUTE", getConfigValue("sso.oidc.firstNameAttribute", "", "given_name")),
 		LastNameAttribute:  getEnvOrDefault("OIDC_LASTNAME_ATTRIBUTE", getConfigValue("sso.oidc.lastNameAttribute", "", "family_name")),
+		GroupsAttribute:    getEnvOrDefault("OIDC_GROUPS_ATTRIBUTE", getConfigValue("sso.oidc.groupsAttribute", "", "groups")),
+		RoleMapping:        getRoleMapping("sso.oidc.roleMapping", "OIDC"),
+	}
+}
+
+// oidcProviderSettings is one entry of sso.oidc.providers.
+type oidcProviderSettings struct {
+	Name               string `mapstructure:"name"`
+	DisplayName        string `mapstructure:"displayName"`
+	Enabled            *bool  `mapstructure:"enabled"`
+	Issuer             string `mapstructure:"issuer"`
+	ClientId           string `mapstructure:"clientId"`
+	ClientSecret       string `mapstructure:"clientSecret"`
+	AuthorizationURL   string `mapstructure:"authorizationURL"`
+	TokenURL           string `mapstructure:"tokenURL"`
+	UserInfoURL        string `mapstructure:"userInfoURL"`
+	JWKSURL            string `mapstructure:"jwksURL"`
+	EndSessionURL      string `mapstructure:"endSessionURL"`
+	DiscoveryCacheTTL  string `mapstructure:"discoveryCacheTTL"`
+	CallbackURL        string `mapstructure:"callbackURL"`
+	LogoutRedirectURL  string `mapstructure:"postLogoutRedirectURL"`
+	Scope              string `mapstructure:"scope"`
+	UsernameAttribute  string `mapstructure:"usernameAttribute"`
+	EmailAttribute     string `mapstructure:"emailAttribute"`
+	FirstNameAttribute string `mapstructure:"firstNameAttribute"`
+	LastNameAttribute  string `mapstructure:"lastNameAttribute"`
+	GroupsAttribute    string `mapstructure:"groupsAttribute"`
+	RoleMapping        struct {
+		Rules   []RoleMappingRule `mapstructure:"rules"`
+		Default string            `mapstructure:"default"`
+	} `mapstructure:"roleMapping"`
+}
+
+// getOIDCProviders reads sso.oidc.providers. Entries are enabled unless they
+// say otherwise, and unset attributes take the same defaults as the single
+// provider. A client secret can come from OIDC_<NAME>_CLIENT_SECRET, with the
+// name upper-cased and dashes replaced by underscores.
+func getOIDCProviders(defaults OIDCConfig) []OIDCConfig {
+	if !viper.IsSet("sso.oidc.providers") {
+		return nil
+	}
+	var settings []oidcProviderSettings
+	if err := viper.UnmarshalKey("sso.oidc.providers", &settings); err != nil {
+		return nil
+	}
+	
+	providers := make([]OIDCConfig, 0, len(settings))
+	for _, entry := range settings {
+		name := strings.ToLower(strings.TrimSpace(entry.Name))
+		envName := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		providers = append(providers, OIDCConfig{
+			Name:               name,
+			DisplayName:        firstSetting(entry.DisplayName, entry.Name),
+			Enabled:            entry.Enabled == nil || *entry.Enabled,
+			Issuer:             entry.Issuer,
+			ClientId:           entry.ClientId,
+			ClientSecret:       getEnvOrDefault("OIDC_"+envName+"_CLIENT_SECRET", entry.ClientSecret),
+			AuthorizationURL:   entry.AuthorizationURL,
+			TokenURL:           entry.TokenURL,
+			UserInfoURL:        entry.UserInfoURL,
+			JWKSURL:            entry.JWKSURL,
+			EndSessionURL:      entry.EndSessionURL,
+			DiscoveryCacheTTL:  parseDurationSetting(entry.DiscoveryCacheTTL, defaults.DiscoveryCacheTTL),
+			CallbackURL:        firstSetting(entry.CallbackURL, "http://localhost:3001/api/auth/oidc/"+name+"/callback"),
+			LogoutRedirectURL:  entry.LogoutRedirectURL,
+			Scope:              firstSetting(entry.Scope, "openid profile email"),
+			UsernameAttribute:  firstSetting(entry.UsernameAttribute, "preferred_username"),
+			EmailAttribute:     firstSetting(entry.EmailAttribute, "email"),
+			FirstNameAttribute: firstSetting(entry.FirstNameAttribute, "given_name"),
+			LastNameAttribute:  firstSetting(entry.LastNameAttribute, "family_name"),
+			GroupsAttribute:    firstSetting(entry.GroupsAttribute, "groups"),
+			RoleMapping: RoleMapping{
+				Rules:       entry.RoleMapping.Rules,
+				DefaultRole: strings.ToLower(entry.RoleMapping.Default),
+			},
+		})
+	}
+	return providers
+}
+
+func firstSetting(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// getRoleMapping reads rules and a default role from the config file under
+// key. PREFIX_ROLE_MAPPING, a comma separated list of value=role pairs
+// matched against the groups claim, replaces the file's rules, and
+// PREFIX_DEFAULT_ROLE replaces its default.
+func getRoleMapping(key, envPrefix string) RoleMapping {
+	var mapping RoleMapping
+	if viper.IsSet(key + ".rules") {
+		if err := viper.UnmarshalKey(key+".rules", &mapping.Rules); err != nil {
+			mapping.Rules = nil
+		}
+	}
+	if v := os.Getenv(envPrefix + "_ROLE_MAPPING"); v != "" {
+		mapping.Rules = parseRoleMappingRules(v)
 	}
+	mapping.DefaultRole = strings.ToLower(getEnvOrDefault(envPrefix+"_DEFAULT_ROLE", getConfigValue(key+".default", "", "")))
+	return mapping
+}
+
+func parseRoleMappingRules(value string) []RoleMappingRule {
+	var rules []RoleMappingRule
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		match, role := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if match == "" || role == "" {
+			continue
+		}
+		rules = append(rules, RoleMappingRule{Value: match, Role: strings.ToLower(role)})
+	}
+	return rules
 }
 
 func getSAMLConfig(env Env) SAMLConfig {
@@ -97,21 +345,19 @@ func getSAMLConfig(env Env) SAMLConfig {
 		}
 	}
 	
-	cert := getEnvOrDefault("SAML_CERT", getConfigValue("sso.saml.cert", "", ""))
-	if cert != "" {
-		if _, err := os.Stat(cert); err == nil {
-			if certBytes, err := os.ReadFile(cert); err == nil {
-				cert = string(certBytes)
-			}
-		}
-	}
+	cert := readPEMSetting(getEnvOrDefault("SAML_CERT", getConfigValue("sso.saml.cert", "", "")))
+	privateKey := readPEMSetting(getEnvOrDefault("SAML_PRIVATE_KEY", getConfigValue("sso.saml.privateKey", "", "")))
+	signingCert := readPEMSetting(getEnvOrDefault("SAML_SIGNING_CERT", getConfigValue("sso.saml.signingCert", "", "")))
 	
 	return SAMLConfig{
 		Enabled:            samlEnabled == "true",
 		EntryPoint:         getEnvOrDefault("SAML_ENTRY_POINT", getConfigValue("sso.saml.entryPoint", "", "http://localhost:8080/realms/crossview/protocol/saml")),
 		Issuer:             getEnvOrDefault("SAML_ISSUER", getConfigValue("sso.saml.issuer", "", "crossview")),
+		IdPIssuer:          getEnvOrDefault("SAML_IDP_ISSUER", getConfigValue("sso.saml.idpIssuer", "", "http://localhost:8080/realms/crossview")),
 		Cert:               cert,
-		CallbackURL:        getEnvOrDefault("SAML_CALLBACK_URL", getConfigValue("sso.saml.callbackURL", "", "http://localhost:3001/api/auth/saml/callback")),
+		PrivateKey:         privateKey,
+		SigningCert:        signingCert,
+		CallbackURL:        getEnvOrDefault("SAML_CALLBACK_URL", getConfigValue("sso.saml.callbackURL", "", "")),
 		UsernameAttribute:  getEnvOrDefault("SAML_USERNAME_ATTRIBUTE", getConfigValue("sso.saml.usernameAttribute", "", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name")),
 		EmailAttribute:     getEnvOrDefault("SAML_EMAIL_ATTRIBUTE", getConfigValue("sso.saml.emailAttribute", "", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress")),
 		FirstNameAttribute: getEnvOrDefault("SAML_FIRSTNAME_ATTRIBUTE", getConfigValue("sso.saml.firstNameAttribute", "", "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname")),
@@ -119,3 +365,33 @@ func getSAMLConfig(env Env) SAMLConfig {
 	}
 }
 
+
+// readPEMSetting returns the contents of the file value names, or value
+// itself when it is not a readable file.
+func readPEMSetting(value string) string {
+	if value == "" {
+		return value
+	}
+	if _, err := os.Stat(value); err == nil {
+		if contents, err := os.ReadFile(value); err == nil {
+			return string(contents)
+		}
+	}
+	return value
+}
+
+// parseDurationSetting accepts a Go duration ("30s", "1h") or a number of
+// seconds, returning fallback when value is empty or invalid.
+func parseDurationSetting(value string, fallback time.Duration) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fallback
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
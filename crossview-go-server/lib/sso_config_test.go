@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestGetRoleMapping_Env(t *testing.T) {
+	t.Setenv("OIDC_ROLE_MAPPING", "platform-admins=admin, devs = Editor,broken")
+	t.Setenv("OIDC_DEFAULT_ROLE", "Deny")
+
+	mapping := getRoleMapping("sso.oidc.roleMapping", "OIDC")
+
+	if len(mapping.Rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d: %+v", len(mapping.Rules), mapping.Rules)
+	}
+	if mapping.Rules[1].Value != "devs" || mapping.Rules[1].Role != "editor" {
+		t.Errorf("Unexpected rule: %+v", mapping.Rules[1])
+	}
+	if mapping.DefaultRole != RoleMappingDeny {
+		t.Errorf("Expected default role '%s', got '%s'", RoleMappingDeny, mapping.DefaultRole)
+	}
+	if !mapping.Configured() {
+		t.Error("Expected mapping to be configured")
+	}
+}
+
+func TestGetRoleMapping_Unset(t *testing.T) {
+	mapping := getRoleMapping("sso.oidc.roleMapping", "OIDC")
+
+	if mapping.Configured() {
+		t.Errorf("Expected no mapping, got %+v", mapping)
+	}
+}
+
+func TestParseDurationSetting(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", time.Hour},
+		{"30s", 30 * time.Second},
+		{"15", 15 * time.Second},
+		{"-5m", time.Hour},
+		{"soon", time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := parseDurationSetting(tt.value, time.Hour); got != tt.expected {
+			t.Errorf("parseDurationSetting(%q) = %v, expected %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestGetSSOHTTPConfig_Env(t *testing.T) {
+	t.Setenv("SSO_HTTP_TIMEOUT", "3s")
+	t.Setenv("SSO_HTTP_PROXY", "http://proxy.internal:3128")
+
+	config := getSSOHTTPConfig()
+
+	if config.Timeout != 3*time.Second {
+		t.Errorf("Expected timeout 3s, got %v", config.Timeout)
+	}
+	if config.ProxyURL != "http://proxy.internal:3128" {
+		t.Errorf("Expected proxy from env, got '%s'", config.ProxyURL)
+	}
+}
+
+func TestGetSSOConfig_Providers(t *testing.T) {
+	viper.Set("sso.oidc.providers", []map[string]interface{}{
+		{
+			"name":        "Employees",
+			"displayName": "Employees",
+			"issuer":      "https://keycloak.internal/realms/staff",
+			"clientId":    "crossview",
+			"roleMapping": map[string]interface{}{
+				"rules":   []map[string]interface{}{{"value": "platform-admins", "role": "admin"}},
+				"default": "Viewer",
+			},
+		},
+		{
+			"name":              "contractors",
+			"enabled":           false,
+			"issuer":            "https://contractors.okta.com",
+			"usernameAttribute": "email",
+		},
+	})
+	t.Cleanup(func() { viper.Set("sso.oidc.providers", nil) })
+	t.Setenv("OIDC_CONTRACTORS_CLIENT_SECRET", "from-env")
+
+	config := GetSSOConfig(Env{})
+
+	if len(config.OIDCProviders) != 2 {
+		t.Fatalf("Expected 2 providers, got %d", len(config.OIDCProviders))
+	}
+	employees, contractors := config.OIDCProviders[0], config.OIDCProviders[1]
+	if employees.Name != "employees" || !employees.Enabled || employees.UsernameAttribute != "preferred_username" {
+		t.Errorf("Unexpected employees provider: %+v", employees)
+	}
+	if employees.CallbackURL != "http://localhost:3001/api/auth/oidc/employees/callback" {
+		t.Errorf("Unexpected callback URL '%s'", employees.CallbackURL)
+	}
+	if len(employees.RoleMapping.Rules) != 1 || employees.RoleMapping.DefaultRole != "viewer" {
+		t.Errorf("Unexpected role mapping: %+v", employees.RoleMapping)
+	}
+	if contractors.Enabled || contractors.UsernameAttribute != "email" || contractors.ClientSecret != "from-env" {
+		t.Errorf("Unexpected contractors provider: %+v", contractors)
+	}
+	if config.OIDC.Name != "employees" || !config.OIDC.Enabled {
+		t.Errorf("Expected the first provider to be the default, got %+v", config.OIDC)
+	}
+
+	enabled := config.EnabledOIDCProviders()
+	if len(enabled) != 1 || enabled[0].Name != "employees" {
+		t.Errorf("Expected only employees to be enabled, got %+v", enabled)
+	}
+	if _, ok := config.OIDCProvider("contractors"); ok {
+		t.Error("Expected a disabled provider not to be found")
+	}
+	if provider, ok := config.OIDCProvider(""); !ok || provider.Name != "employees" {
+		t.Errorf("Expected an empty name to select the first provider, got %+v", provider)
+	}
+}
+
+func TestSSOConfig_SingleProvider(t *testing.T) {
+	config := SSOConfig{Enabled: true, OIDC: OIDCConfig{Enabled: true}}
+
+	provider, ok := config.OIDCProvider(DefaultOIDCProvider)
+	if !ok || provider.Name != DefaultOIDCProvider {
+		t.Errorf("Expected the single provider as '%s', got %+v", DefaultOIDCProvider, provider)
+	}
+}
@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// initialSchema creates the users and their SSO identities and sessions.
+// Databases created before migrations were numbered already have these
+// tables, which it leaves as they are.
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&initialUser{}, &initialUserIdentity{}, &initialUserSession{}, &initialSessionData{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&initialSessionData{}, &initialUserSession{}, &initialUserIdentity{}, &initialUser{})
+	},
+}
+
+type initialUser struct {
+	ID           uint      `gorm:"primaryKey"`
+	Username     string    `gorm:"uniqueIndex;not null"`
+	Email        string    `gorm:"uniqueIndex;not null"`
+	PasswordHash string    `gorm:"column:password_hash;not null"`
+	Role         string    `gorm:"default:editor"`
+	FirstName    *string   `gorm:"column:first_name"`
+	LastName     *string   `gorm:"column:last_name"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+	UpdatedAt    time.Time `gorm:"column:updated_at"`
+}
+
+func (initialUser) TableName() string {
+	return "users"
+}
+
+type initialUserIdentity struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"index;not null"`
+	Provider    string `gorm:"uniqueIndex:idx_user_identities_provider_subject;not null"`
+	Subject     string `gorm:"uniqueIndex:idx_user_identities_provider_subject;not null"`
+	Email       string
+	CreatedAt   time.Time  `gorm:"column:created_at"`
+	LastLoginAt *time.Time `gorm:"column:last_login_at"`
+}
+
+func (initialUserIdentity) TableName() string {
+	return "user_identities"
+}
+
+type initialUserSession struct {
+	ID         string    `gorm:"primaryKey;size:64"`
+	UserID     uint      `gorm:"index;not null"`
+	Provider   string    `gorm:"index:idx_user_sessions_provider_sid"`
+	SID        string    `gorm:"column:sid;index:idx_user_sessions_provider_sid"`
+	IDToken    string    `gorm:"column:id_token;type:text"`
+	CreatedAt  time.Time `gorm:"column:created_at"`
+	LastSeenAt time.Time `gorm:"column:last_seen_at"`
+}
+
+func (initialUserSession) TableName() string {
+	return "user_sessions"
+}
+
+type initialSessionData struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	Data      string    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (initialSessionData) TableName() string {
+	return "session_data"
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var apiTokens = Migration{
+	Version: 2,
+	Name:    "api_tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&apiToken{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&apiToken{})
+	},
+}
+
+type apiToken struct {
+	ID           uint       `gorm:"primaryKey"`
+	UserID       uint       `gorm:"index;not null"`
+	Name         string     `gorm:"not null"`
+	Prefix       string     `gorm:"size:16"`
+	TokenHash    string     `gorm:"column:token_hash;uniqueIndex;size:64;not null"`
+	ReadOnly     bool       `gorm:"column:read_only;not null;default:false"`
+	ContextsJSON string     `gorm:"column:contexts;type:text"`
+	ExpiresAt    time.Time  `gorm:"column:expires_at;index"`
+	LastUsedAt   *time.Time `gorm:"column:last_used_at"`
+	CreatedAt    time.Time  `gorm:"column:created_at"`
+}
+
+func (apiToken) TableName() string {
+	return "api_tokens"
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var loginThrottling = Migration{
+	Version: 3,
+	Name:    "login_throttling",
+	Up: func(tx *gorm.DB) error {
+		return addColumns(tx, &throttledUser{}, "FailedLoginCount", "LastFailedLoginAt", "LockedUntil", "LastLoginAt")
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropColumns(tx, &throttledUser{}, "FailedLoginCount", "LastFailedLoginAt", "LockedUntil", "LastLoginAt")
+	},
+}
+
+type throttledUser struct {
+	FailedLoginCount  int        `gorm:"column:failed_login_count;not null;default:0"`
+	LastFailedLoginAt *time.Time `gorm:"column:last_failed_login_at"`
+	LockedUntil       *time.Time `gorm:"column:locked_until"`
+	LastLoginAt       *time.Time `gorm:"column:last_login_at"`
+}
+
+func (throttledUser) TableName() string {
+	return "users"
+}
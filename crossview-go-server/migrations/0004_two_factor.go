@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var twoFactor = Migration{
+	Version: 4,
+	Name:    "two_factor",
+	Up: func(tx *gorm.DB) error {
+		if err := addColumns(tx, &twoFactorUser{}, "MFAEnabled", "MFASecret", "MFALastCounter"); err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&recoveryCode{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&recoveryCode{}); err != nil {
+			return err
+		}
+		return dropColumns(tx, &twoFactorUser{}, "MFAEnabled", "MFASecret", "MFALastCounter")
+	},
+}
+
+type twoFactorUser struct {
+	MFAEnabled     bool   `gorm:"column:mfa_enabled;not null;default:false"`
+	MFASecret      string `gorm:"column:mfa_secret"`
+	MFALastCounter int64  `gorm:"column:mfa_last_counter;not null;default:0"`
+}
+
+func (twoFactorUser) TableName() string {
+	return "users"
+}
+
+type recoveryCode struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	CodeHash  string     `gorm:"column:code_hash;size:64;not null"`
+	UsedAt    *time.Time `gorm:"column:used_at"`
+	CreatedAt time.Time  `gorm:"column:created_at"`
+}
+
+func (recoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
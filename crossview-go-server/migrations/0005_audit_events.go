@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var auditEvents = Migration{
+	Version: 5,
+	Name:    "audit_events",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&auditEvent{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&auditEvent{})
+	},
+}
+
+type auditEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	Time      time.Time `gorm:"column:time;index;not null"`
+	ActorID   *uint     `gorm:"column:actor_id;index"`
+	Actor     string    `gorm:"column:actor;index"`
+	Action    string    `gorm:"column:action;index;not null"`
+	Target    string    `gorm:"column:target"`
+	Context   string    `gorm:"column:context"`
+	RequestID string    `gorm:"column:request_id;index"`
+	Outcome   string    `gorm:"column:outcome;index;not null"`
+	SourceIP  string    `gorm:"column:source_ip"`
+	Details   string    `gorm:"column:details;type:text"`
+}
+
+func (auditEvent) TableName() string {
+	return "audit_events"
+}
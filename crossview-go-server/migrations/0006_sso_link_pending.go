@@ -0,0 +1,31 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// ssoLinkPending upgrades users from before SSO identities were recorded.
+// Their SSO logins were matched by email, so those users have no identity
+// and a first login with linkByEmail off would be refused. Each user without
+// an identity is marked so that its next SSO login with a verified, matching
+// email links the identity once, as it would have been matched before. A
+// password login clears the mark, as does the link.
+var ssoLinkPending = Migration{
+	Version: 6,
+	Name:    "sso_link_pending",
+	Up: func(tx *gorm.DB) error {
+		if err := addColumns(tx, &ssoLinkUser{}, "SSOLinkPending"); err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE users SET sso_link_pending = ? WHERE id NOT IN (SELECT user_id FROM user_identities)", true).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropColumns(tx, &ssoLinkUser{}, "SSOLinkPending")
+	},
+}
+
+type ssoLinkUser struct {
+	SSOLinkPending bool `gorm:"column:sso_link_pending;not null;default:false"`
+}
+
+func (ssoLinkUser) TableName() string {
+	return "users"
+}
@@ -0,0 +1,214 @@
+// Package migrations holds the numbered schema migrations and applies them,
+// recording each in the schema_migrations table.
+//
+// A migration never changes once released. Each declares the tables and
+// columns as they were when it was written, rather than using the models,
+// so that replaying the history builds the same schema the models expect.
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one numbered step of the schema. Down undoes Up.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// all lists every migration, oldest first.
+var all = []Migration{
+	initialSchema,
+	apiTokens,
+	loginThrottling,
+	twoFactor,
+	auditEvents,
+	ssoLinkPending,
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"not null" json:"name"`
+	AppliedAt time.Time `gorm:"column:applied_at;not null" json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status is a migration and when it was applied, if it was.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+	return &Migrator{db: db, migrations: all}
+}
+
+// applied returns the recorded migrations by version. A database without
+// the schema_migrations table has none.
+func (m *Migrator) applied() (map[int]SchemaMigration, error) {
+	applied := make(map[int]SchemaMigration)
+	if !m.db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+	var rows []SchemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Status lists every migration known to this build, oldest first.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations not applied yet, oldest first.
+func (m *Migrator) Pending() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations in order, each in its own transaction,
+// and returns them. With dryRun it only returns them.
+func (m *Migrator) Up(dryRun bool) ([]Migration, error) {
+	pending, err := m.Pending()
+	if err != nil || dryRun || len(pending) == 0 {
+		return pending, err
+	}
+	if err := m.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	var done []Migration
+	for _, migration := range pending {
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s failed: %w", migration, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and
+// returns them. With dryRun it only returns them.
+func (m *Migrator) Down(steps int, dryRun bool) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	var revert []Migration
+	for _, version := range versions {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("migration %04d (%s) was applied by a newer version and can't be reverted by this one", version, applied[version].Name)
+		}
+		revert = append(revert, migration)
+	}
+	if dryRun {
+		return revert, nil
+	}
+
+	var done []Migration
+	for _, migration := range revert {
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %s failed: %w", migration, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// addColumns adds the columns of the fields named, unless they exist.
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns drops the columns of the fields named, if they exist.
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if !tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().DropColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
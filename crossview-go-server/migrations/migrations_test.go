@@ -0,0 +1,179 @@
+package migrations
+
+import (
+	"sync"
+	"testing"
+
+	"crossview-go-server/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	// Every connection to ":memory:" opens a new, empty database.
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+var currentModels = []interface{}{
+	&models.User{}, &models.UserIdentity{}, &models.UserSession{}, &models.SessionData{},
+	&models.APIToken{}, &models.RecoveryCode{}, &models.AuditEvent{},
+}
+
+func TestMigrator_UpMatchesModels(t *testing.T) {
+	db := openTestDB(t)
+	migrator := NewMigrator(db)
+
+	applied, err := migrator.Up(false)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if len(applied) != len(all) {
+		t.Errorf("Expected %d migrations to be applied, got %d", len(all), len(applied))
+	}
+	if pending, _ := migrator.Pending(); len(pending) != 0 {
+		t.Errorf("Expected nothing pending, got %v", pending)
+	}
+	if again, err := migrator.Up(false); err != nil || len(again) != 0 {
+		t.Errorf("Expected a second run to do nothing, got %v (%v)", again, err)
+	}
+
+	// Every column the models use must have been created.
+	for _, model := range currentModels {
+		parsed, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			t.Fatalf("Failed to parse %T: %v", model, err)
+		}
+		for _, field := range parsed.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("Expected column %s.%s", parsed.Table, field.DBName)
+			}
+		}
+	}
+}
+
+func TestMigrator_ExistingSchema(t *testing.T) {
+	db := openTestDB(t)
+	// A database the server created before migrations were numbered.
+	if err := db.AutoMigrate(currentModels...); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	db.Create(&models.User{Username: "admin", Email: "admin@example.com", Role: models.RoleAdmin, MFAEnabled: true})
+
+	migrator := NewMigrator(db)
+	if pending, _ := migrator.Pending(); len(pending) != len(all) {
+		t.Fatalf("Expected every migration to be pending, got %d", len(pending))
+	}
+	if _, err := migrator.Up(false); err != nil {
+		t.Fatalf("Failed to migrate an existing schema: %v", err)
+	}
+	var user models.User
+	if err := db.First(&user, "username = ?", "admin").Error; err != nil || !user.MFAEnabled {
+		t.Errorf("Expected the existing user to be kept, got %+v (%v)", user, err)
+	}
+	if !user.SSOLinkPending {
+		t.Error("Expected a user without SSO identities to be marked for linking")
+	}
+}
+
+func TestMigrator_SSOLinkPending(t *testing.T) {
+	db := openTestDB(t)
+	migrator := NewMigrator(db)
+	migrator.Up(false)
+	if _, err := migrator.Down(1, false); err != nil {
+		t.Fatalf("Failed to revert: %v", err)
+	}
+
+	db.Exec("INSERT INTO users (username, email, password_hash) VALUES ('local', 'local@example.com', 'x'), ('linked', 'linked@example.com', 'x')")
+	db.Exec("INSERT INTO user_identities (user_id, provider, subject) SELECT id, 'saml', 'linked' FROM users WHERE username = 'linked'")
+	if _, err := migrator.Up(false); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+
+	for username, pending := range map[string]bool{"local": true, "linked": false} {
+		var user models.User
+		if err := db.First(&user, "username = ?", username).Error; err != nil {
+			t.Fatalf("Failed to find %s: %v", username, err)
+		}
+		if user.SSOLinkPending != pending {
+			t.Errorf("Expected %s to have SSOLinkPending %v", username, pending)
+		}
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	db := openTestDB(t)
+	migrator := NewMigrator(db)
+	migrator.Up(false)
+
+	reverted, err := migrator.Down(2, false)
+	if err != nil {
+		t.Fatalf("Failed to revert: %v", err)
+	}
+	if len(reverted) != 2 || reverted[0].Version != 6 || reverted[1].Version != 5 {
+		t.Fatalf("Expected migrations 6 and 5 to be reverted, got %v", reverted)
+	}
+	if db.Migrator().HasTable("audit_events") || !db.Migrator().HasTable("mfa_recovery_codes") {
+		t.Error("Expected only the audit table to be dropped")
+	}
+	if db.Migrator().HasColumn(&models.User{}, "sso_link_pending") || !db.Migrator().HasColumn(&models.User{}, "mfa_enabled") {
+		t.Error("Expected only the SSO link column to be dropped from users")
+	}
+
+	statuses, _ := migrator.Status()
+	for _, status := range statuses {
+		if pending := status.AppliedAt == nil; pending != (status.Version >= 5) {
+			t.Errorf("Unexpected status for %04d: applied at %v", status.Version, status.AppliedAt)
+		}
+	}
+
+	if applied, err := migrator.Up(false); err != nil || len(applied) != 2 {
+		t.Errorf("Expected the reverted migrations to be applied again, got %v (%v)", applied, err)
+	}
+	if _, err := migrator.Down(len(all), false); err != nil {
+		t.Fatalf("Failed to revert everything: %v", err)
+	}
+	if db.Migrator().HasTable("users") {
+		t.Error("Expected every table to be dropped")
+	}
+}
+
+func TestMigrator_DryRun(t *testing.T) {
+	db := openTestDB(t)
+	migrator := NewMigrator(db)
+
+	planned, err := migrator.Up(true)
+	if err != nil || len(planned) != len(all) {
+		t.Fatalf("Expected every migration to be planned, got %v (%v)", planned, err)
+	}
+	if db.Migrator().HasTable("users") || db.Migrator().HasTable(&SchemaMigration{}) {
+		t.Error("Expected a dry run to change nothing")
+	}
+
+	migrator.Up(false)
+	planned, err = migrator.Down(1, true)
+	if err != nil || len(planned) != 1 || planned[0].Version != 6 {
+		t.Fatalf("Expected the last migration to be planned, got %v (%v)", planned, err)
+	}
+	if pending, _ := migrator.Pending(); len(pending) != 0 || !db.Migrator().HasTable("audit_events") {
+		t.Error("Expected a dry run to change nothing")
+	}
+}
+
+func TestMigrator_UnknownVersion(t *testing.T) {
+	db := openTestDB(t)
+	migrator := NewMigrator(db)
+	migrator.Up(false)
+	db.Create(&SchemaMigration{Version: 999, Name: "from_the_future"})
+
+	if _, err := migrator.Down(1, false); err == nil {
+		t.Error("Expected a migration unknown to this build not to be reverted")
+	}
+}
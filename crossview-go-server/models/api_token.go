@@ -0,0 +1,163 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix starts every personal API token, which makes them easy to
+// recognise in logs and secret scanners.
+const APITokenPrefix = "cvt_"
+
+// APIToken is a personal access token scripts use to call the API as the
+// user who created it. Only a SHA-256 hash of the token is stored; the
+// token itself is shown once, when it is created.
+type APIToken struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"index;not null" json:"user_id"`
+	Name   string `gorm:"not null" json:"name"`
+	// Prefix is the start of the token, shown so that users can tell their
+	// tokens apart.
+	Prefix    string `gorm:"size:16" json:"prefix"`
+	TokenHash string `gorm:"column:token_hash;uniqueIndex;size:64;not null" json:"-"`
+	// ReadOnly limits the token to the resources:read permission.
+	ReadOnly bool `gorm:"column:read_only;not null;default:false" json:"read_only"`
+	// Contexts, when not empty, are the only Kubernetes contexts the token
+	// may be used against.
+	Contexts     []string   `gorm:"-" json:"contexts"`
+	ContextsJSON string     `gorm:"column:contexts;type:text" json:"-"`
+	ExpiresAt    time.Time  `gorm:"column:expires_at;index" json:"expires_at"`
+	LastUsedAt   *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+	CreatedAt    time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+func (t *APIToken) BeforeSave(tx *gorm.DB) error {
+	t.ContextsJSON = ""
+	if len(t.Contexts) > 0 {
+		encoded, err := json.Marshal(t.Contexts)
+		if err != nil {
+			return err
+		}
+		t.ContextsJSON = string(encoded)
+	}
+	return nil
+}
+
+func (t *APIToken) AfterFind(tx *gorm.DB) error {
+	t.Contexts = nil
+	if t.ContextsJSON != "" {
+		return json.Unmarshal([]byte(t.ContextsJSON), &t.Contexts)
+	}
+	return nil
+}
+
+// AllowsContext reports whether the token may be used against the named
+// Kubernetes context.
+func (t *APIToken) AllowsContext(name string) bool {
+	if len(t.Contexts) == 0 {
+		return true
+	}
+	for _, allowed := range t.Contexts {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type APITokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepository(db *gorm.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+// Create generates a new secret for token, stores it and returns the
+// secret. It cannot be recovered afterwards.
+func (r *APITokenRepository) Create(token *APIToken) (string, error) {
+	if r.db == nil {
+		return "", fmt.Errorf("database not available")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	raw := APITokenPrefix + hex.EncodeToString(secret)
+	token.Prefix = raw[:len(APITokenPrefix)+8]
+	token.TokenHash = hashAPIToken(raw)
+	if err := r.db.Create(token).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Authenticate returns the unexpired token matching raw, or nil, and
+// records that it was used.
+func (r *APITokenRepository) Authenticate(raw string) (*APIToken, error) {
+	if r.db == nil || !strings.HasPrefix(raw, APITokenPrefix) {
+		return nil, nil
+	}
+	var token APIToken
+	err := r.db.Where("token_hash = ?", hashAPIToken(raw)).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.After(token.ExpiresAt) {
+		return nil, nil
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastSeenResolution {
+		token.LastUsedAt = &now
+		if err := r.db.Model(&APIToken{}).Where("id = ?", token.ID).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &token, nil
+}
+
+// FindByUserID returns a user's tokens, newest first.
+func (r *APITokenRepository) FindByUserID(userID uint) ([]APIToken, error) {
+	if r.db == nil {
+		return nil, nil
+	}
+	var tokens []APIToken
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteForUser revokes one of a user's tokens. It returns
+// gorm.ErrRecordNotFound when the user has no token with that ID.
+func (r *APITokenRepository) DeleteForUser(userID, id uint) error {
+	if r.db == nil {
+		return nil
+	}
+	result := r.db.Where("user_id = ? AND id = ?", userID, id).Delete(&APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func setupAPITokenTestRepo(t *testing.T) *APITokenRepository {
+	return NewAPITokenRepository(openTestDB(t))
+}
+
+func TestAPITokenRepository_CreateAndAuthenticate(t *testing.T) {
+	repo := setupAPITokenTestRepo(t)
+
+	token := &APIToken{UserID: 1, Name: "ci", ReadOnly: true, Contexts: []string{"prod"}, ExpiresAt: time.Now().Add(time.Hour)}
+	raw, err := repo.Create(token)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if !strings.HasPrefix(raw, APITokenPrefix) || !strings.HasPrefix(raw, token.Prefix) {
+		t.Errorf("Unexpected token '%s' with prefix '%s'", raw, token.Prefix)
+	}
+	if token.TokenHash == "" || strings.Contains(token.TokenHash, raw) {
+		t.Error("Expected only a hash of the token to be stored")
+	}
+
+	found, err := repo.Authenticate(raw)
+	if err != nil || found == nil {
+		t.Fatalf("Expected the token to authenticate, got %v", err)
+	}
+	if found.UserID != 1 || !found.ReadOnly || found.LastUsedAt == nil {
+		t.Errorf("Unexpected token: %+v", found)
+	}
+	if !found.AllowsContext("prod") || found.AllowsContext("staging") {
+		t.Errorf("Expected the token to be limited to 'prod', got %v", found.Contexts)
+	}
+
+	for _, wrong := range []string{raw + "x", APITokenPrefix + "unknown", "not-a-token"} {
+		if found, _ := repo.Authenticate(wrong); found != nil {
+			t.Errorf("Expected '%s' not to authenticate", wrong)
+		}
+	}
+}
+
+func TestAPITokenRepository_Expired(t *testing.T) {
+	repo := setupAPITokenTestRepo(t)
+
+	raw, err := repo.Create(&APIToken{UserID: 1, Name: "old", ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if found, _ := repo.Authenticate(raw); found != nil {
+		t.Error("Expected an expired token not to authenticate")
+	}
+}
+
+func TestAPITokenRepository_DeleteForUser(t *testing.T) {
+	repo := setupAPITokenTestRepo(t)
+
+	token := &APIToken{UserID: 1, Name: "ci", ExpiresAt: time.Now().Add(time.Hour)}
+	raw, err := repo.Create(token)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	if err := repo.DeleteForUser(2, token.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected another user's token to be out of reach, got %v", err)
+	}
+	if err := repo.DeleteForUser(1, token.ID); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if found, _ := repo.Authenticate(raw); found != nil {
+		t.Error("Expected a revoked token not to authenticate")
+	}
+}
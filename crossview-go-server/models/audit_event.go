@@ -0,0 +1,136 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit event outcomes.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	// AuditDenied is an attempt refused for lack of authentication or
+	// permission, or because of login throttling.
+	AuditDenied = "denied"
+)
+
+// AuditEvent records who did what, to what, and how it went.
+type AuditEvent struct {
+	ID   uint      `gorm:"primaryKey" json:"id"`
+	Time time.Time `gorm:"column:time;index;not null" json:"time"`
+	// ActorID is the acting user, unset when there is none, e.g. for a
+	// failed login. Actor is their username, or the username tried.
+	ActorID *uint  `gorm:"column:actor_id;index" json:"actor_id,omitempty"`
+	Actor   string `gorm:"column:actor;index" json:"actor"`
+	// Action names what was done, e.g. "auth.login" or "user.update". Requests
+	// no handler records an event for are recorded as "<METHOD> <route>".
+	Action string `gorm:"column:action;index;not null" json:"action"`
+	// Target is what the action was applied to, e.g. "user:12".
+	Target string `gorm:"column:target" json:"target,omitempty"`
+	// Context is the Kubernetes context the action was made against.
+	Context   string `gorm:"column:context" json:"context,omitempty"`
+	RequestID string `gorm:"column:request_id;index" json:"request_id,omitempty"`
+	Outcome   string `gorm:"column:outcome;index;not null" json:"outcome"`
+	SourceIP  string `gorm:"column:source_ip" json:"source_ip,omitempty"`
+	// Details is free text, e.g. the reason for a failure.
+	Details string `gorm:"column:details;type:text" json:"details,omitempty"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// UserTarget is the audit event target naming the user with id.
+func UserTarget(id uint) string {
+	return "user:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// AuditFilter selects audit events. Empty fields match everything.
+type AuditFilter struct {
+	ActorID   uint
+	Actor     string
+	Action    string
+	Target    string
+	Context   string
+	Outcome   string
+	RequestID string
+	Since     time.Time
+	Until     time.Time
+}
+
+func (f AuditFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.ActorID != 0 {
+		db = db.Where("actor_id = ?", f.ActorID)
+	}
+	for column, value := range map[string]string{
+		"actor":      f.Actor,
+		"action":     f.Action,
+		"target":     f.Target,
+		"context":    f.Context,
+		"outcome":    f.Outcome,
+		"request_id": f.RequestID,
+	} {
+		if value != "" {
+			db = db.Where(column+" = ?", value)
+		}
+	}
+	if !f.Since.IsZero() {
+		db = db.Where("time >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		db = db.Where("time < ?", f.Until)
+	}
+	return db
+}
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(event *AuditEvent) error {
+	if r.db == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	return r.db.Create(event).Error
+}
+
+// Find returns a page of the events matching filter, newest first, and how
+// many match in all.
+func (r *AuditRepository) Find(filter AuditFilter, offset, limit int) ([]AuditEvent, int64, error) {
+	if r.db == nil {
+		return nil, 0, nil
+	}
+	var total int64
+	if err := filter.apply(r.db.Model(&AuditEvent{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []AuditEvent
+	err := filter.apply(r.db).Order("time DESC, id DESC").Offset(offset).Limit(limit).Find(&events).Error
+	return events, total, err
+}
+
+// Each calls fn with every event matching filter, oldest first, loading
+// them in batches. It stops at the first error fn returns.
+func (r *AuditRepository) Each(filter AuditFilter, fn func(*AuditEvent) error) error {
+	if r.db == nil {
+		return nil
+	}
+	var batch []AuditEvent
+	return filter.apply(r.db).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func setupAuditTestRepo(t *testing.T) *AuditRepository {
+	return NewAuditRepository(openTestDB(t))
+}
+
+func TestAuditRepository_Find(t *testing.T) {
+	repo := setupAuditTestRepo(t)
+	start := time.Now().Add(-time.Hour)
+	for i, event := range []AuditEvent{
+		{Actor: "alice", Action: "auth.login", Outcome: AuditSuccess},
+		{Actor: "bob", Action: "auth.login", Outcome: AuditFailure},
+		{Actor: "alice", Action: "resource.delete", Context: "prod", Outcome: AuditSuccess},
+		{Actor: "alice", Action: "resource.delete", Context: "dev", Outcome: AuditDenied},
+	} {
+		event.Time = start.Add(time.Duration(i) * time.Minute)
+		if err := repo.Create(&event); err != nil {
+			t.Fatalf("Failed to create event: %v", err)
+		}
+	}
+
+	events, total, err := repo.Find(AuditFilter{Actor: "alice"}, 0, 2)
+	if err != nil {
+		t.Fatalf("Failed to find events: %v", err)
+	}
+	if total != 3 || len(events) != 2 {
+		t.Fatalf("Expected 2 of 3 events, got %d of %d", len(events), total)
+	}
+	if events[0].Context != "dev" || events[1].Context != "prod" {
+		t.Errorf("Expected newest first, got %+v", events)
+	}
+
+	events, total, _ = repo.Find(AuditFilter{Action: "resource.delete", Outcome: AuditSuccess}, 0, 10)
+	if total != 1 || events[0].Context != "prod" {
+		t.Errorf("Expected the successful delete, got %+v", events)
+	}
+
+	_, total, _ = repo.Find(AuditFilter{Since: start.Add(90 * time.Second), Until: start.Add(3 * time.Minute)}, 0, 10)
+	if total != 1 {
+		t.Errorf("Expected 1 event in the time range, got %d", total)
+	}
+}
+
+func TestAuditRepository_Each(t *testing.T) {
+	repo := setupAuditTestRepo(t)
+	for _, action := range []string{"a", "b", "c"} {
+		repo.Create(&AuditEvent{Action: action, Outcome: AuditSuccess})
+	}
+
+	var actions []string
+	err := repo.Each(AuditFilter{}, func(event *AuditEvent) error {
+		actions = append(actions, event.Action)
+		return nil
+	})
+	if err != nil || len(actions) != 3 {
+		t.Fatalf("Expected 3 events, got %v (%v)", actions, err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.Each(AuditFilter{}, func(*AuditEvent) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected Each to stop at the first error, got %d calls (%v)", calls, err)
+	}
+}
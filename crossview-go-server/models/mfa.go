@@ -0,0 +1,259 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	// totpPeriod is how long each TOTP code is valid, and totpSkew how many
+	// periods either side of the current one are accepted to allow for
+	// clock drift.
+	totpPeriod = 30
+	totpSkew   = 1
+
+	// recoveryCodeCount is how many recovery codes a user gets at a time.
+	recoveryCodeCount = 10
+)
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when the
+// user has lost their authenticator. Only a SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"column:code_hash;size:64;not null" json:"-"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at"`
+	CreatedAt time.Time  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFAEnrollment is what an authenticator app needs to add an account: the
+// otpauth:// provisioning URI, also as a QR code PNG data URI, and the
+// secret for manual entry.
+type MFAEnrollment struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauthUrl"`
+	QRCode string `json:"qrCode"`
+}
+
+// MFARequired reports whether role is one of requiredRoles, the roles
+// whose local accounts must use two-factor authentication.
+func MFARequired(requiredRoles []string, role string) bool {
+	role = NormalizeRole(role)
+	for _, required := range requiredRoles {
+		if NormalizeRole(required) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRecoveryCode ignores case and the separators users tend to type.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+type MFARepository struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// StartEnrollment gives the user a new TOTP secret. It is pending, and MFA
+// stays off, until a code from it is confirmed with Enable.
+func (r *MFARepository) StartEnrollment(user *User, issuer string) (*MFAEnrollment, error) {
+	if r.db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	if user.MFAEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: user.Username,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, err
+	}
+	image, err := key.Image(200, 200)
+	if err != nil {
+		return nil, err
+	}
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, image); err != nil {
+		return nil, err
+	}
+
+	user.MFASecret = key.Secret()
+	user.MFALastCounter = 0
+	if err := r.db.Model(user).Select("mfa_secret", "mfa_last_counter").Updates(user).Error; err != nil {
+		return nil, err
+	}
+	return &MFAEnrollment{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr.Bytes()),
+	}, nil
+}
+
+// VerifyTOTP checks code against the user's secret, pending or enabled.
+// Each code is accepted once: a code from a period at or before the last
+// one used is refused.
+func (r *MFARepository) VerifyTOTP(user *User, code string, now time.Time) (bool, error) {
+	if r.db == nil || user.MFASecret == "" {
+		return false, nil
+	}
+	code = strings.TrimSpace(code)
+	current := now.Unix() / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= user.MFALastCounter {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(user.MFASecret, time.Unix(counter*totpPeriod, 0), totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			// The counter is checked again in the update, so that of two
+			// requests racing with the same code only one gets through.
+			result := r.db.Model(&User{}).
+				Where("id = ? AND mfa_last_counter < ?", user.ID, counter).
+				UpdateColumn("mfa_last_counter", counter)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return false, result.Error
+			}
+			user.MFALastCounter = counter
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// VerifyCode checks a code from the user's authenticator app or, once MFA
+// is enabled, one of their recovery codes, which is then used up.
+func (r *MFARepository) VerifyCode(user *User, code string, now time.Time) (bool, error) {
+	if ok, err := r.VerifyTOTP(user, code, now); ok || err != nil {
+		return ok, err
+	}
+	if !user.MFAEnabled {
+		return false, nil
+	}
+	return r.UseRecoveryCode(user.ID, code)
+}
+
+// Enable turns on MFA for a user whose pending secret has been confirmed
+// and returns their first recovery codes.
+func (r *MFARepository) Enable(user *User) ([]string, error) {
+	if r.db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	var codes []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", user.ID).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.MFAEnabled = true
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with new ones.
+func (r *MFARepository) RegenerateRecoveryCodes(userID uint) ([]string, error) {
+	if r.db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	var codes []string
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		secret := make([]byte, 5)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(secret))
+		codes[i] = code[:4] + "-" + code[4:]
+		if err := tx.Create(&RecoveryCode{UserID: userID, CodeHash: hashAPIToken(code)}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode marks one of the user's unused recovery codes as used and
+// reports whether code matched one.
+func (r *MFARepository) UseRecoveryCode(userID uint, code string) (bool, error) {
+	if r.db == nil {
+		return false, nil
+	}
+	result := r.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashAPIToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountRecoveryCodes returns how many of the user's recovery codes are unused.
+func (r *MFARepository) CountRecoveryCodes(userID uint) (int64, error) {
+	if r.db == nil {
+		return 0, nil
+	}
+	var count int64
+	err := r.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// Disable turns off MFA for a user and removes their secret and recovery
+// codes.
+func (r *MFARepository) Disable(userID uint) error {
+	if r.db == nil {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"mfa_enabled":      false,
+			"mfa_secret":       "",
+			"mfa_last_counter": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
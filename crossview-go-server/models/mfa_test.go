@@ -0,0 +1,132 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func setupMFATestRepo(t *testing.T) (*MFARepository, *User) {
+	db := openTestDB(t)
+	user := &User{Username: "alice", Email: "alice@example.com", PasswordHash: "x", Role: RoleAdmin}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("Failed to create test user: %v", err)
+	}
+	return NewMFARepository(db), user
+}
+
+func TestMFARepository_Enrollment(t *testing.T) {
+	repo, user := setupMFATestRepo(t)
+
+	enrollment, err := repo.StartEnrollment(user, "Crossview")
+	if err != nil {
+		t.Fatalf("Failed to start enrollment: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URL, "otpauth://totp/Crossview:alice?") || !strings.Contains(enrollment.URL, "secret="+enrollment.Secret) {
+		t.Errorf("Unexpected provisioning URI '%s'", enrollment.URL)
+	}
+	if !strings.HasPrefix(enrollment.QRCode, "data:image/png;base64,") {
+		t.Error("Expected a PNG QR code")
+	}
+
+	now := time.Now()
+	code, _ := totp.GenerateCode(enrollment.Secret, now)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	if ok, err := repo.VerifyTOTP(user, wrong, now); err != nil || ok {
+		t.Errorf("Expected a wrong code to be refused, got %t (%v)", ok, err)
+	}
+	if ok, err := repo.VerifyTOTP(user, code, now); err != nil || !ok {
+		t.Fatalf("Expected the current code to be accepted, got %t (%v)", ok, err)
+	}
+	if ok, _ := repo.VerifyTOTP(user, code, now); ok {
+		t.Error("Expected a code to be accepted only once")
+	}
+
+	recoveryCodes, err := repo.Enable(user)
+	if err != nil {
+		t.Fatalf("Failed to enable MFA: %v", err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount || !user.MFAEnabled {
+		t.Errorf("Expected %d recovery codes and MFA enabled, got %d", recoveryCodeCount, len(recoveryCodes))
+	}
+	if _, err := repo.StartEnrollment(user, "Crossview"); err == nil {
+		t.Error("Expected enrollment to be refused once MFA is enabled")
+	}
+}
+
+func TestMFARepository_VerifyTOTP_StaleUser(t *testing.T) {
+	repo, user := setupMFATestRepo(t)
+	enrollment, err := repo.StartEnrollment(user, "Crossview")
+	if err != nil {
+		t.Fatalf("Failed to start enrollment: %v", err)
+	}
+
+	// Two requests load the user before either has used the code.
+	var first, second User
+	repo.db.First(&first, user.ID)
+	repo.db.First(&second, user.ID)
+
+	now := time.Now()
+	code, _ := totp.GenerateCode(enrollment.Secret, now)
+	if ok, err := repo.VerifyTOTP(&first, code, now); err != nil || !ok {
+		t.Fatalf("Expected the current code to be accepted, got %t (%v)", ok, err)
+	}
+	if ok, err := repo.VerifyTOTP(&second, code, now); err != nil || ok {
+		t.Errorf("Expected a used code to be refused for a stale copy of the user, got %t (%v)", ok, err)
+	}
+}
+
+func TestMFARepository_RecoveryCodes(t *testing.T) {
+	repo, user := setupMFATestRepo(t)
+	repo.StartEnrollment(user, "Crossview")
+	recoveryCodes, _ := repo.Enable(user)
+
+	// Recovery codes are accepted without their dash and in upper case.
+	typed := strings.ToUpper(strings.Replace(recoveryCodes[0], "-", "", 1))
+	if ok, err := repo.VerifyCode(user, typed, time.Now()); err != nil || !ok {
+		t.Fatalf("Expected the recovery code to be accepted, got %t (%v)", ok, err)
+	}
+	if ok, _ := repo.VerifyCode(user, recoveryCodes[0], time.Now()); ok {
+		t.Error("Expected a recovery code to work only once")
+	}
+	if remaining, _ := repo.CountRecoveryCodes(user.ID); remaining != recoveryCodeCount-1 {
+		t.Errorf("Expected %d unused recovery codes, got %d", recoveryCodeCount-1, remaining)
+	}
+
+	regenerated, err := repo.RegenerateRecoveryCodes(user.ID)
+	if err != nil || len(regenerated) != recoveryCodeCount {
+		t.Fatalf("Failed to regenerate recovery codes: %v", err)
+	}
+	if ok, _ := repo.VerifyCode(user, recoveryCodes[1], time.Now()); ok {
+		t.Error("Expected old recovery codes to stop working")
+	}
+
+	if err := repo.Disable(user.ID); err != nil {
+		t.Fatalf("Failed to disable MFA: %v", err)
+	}
+	var disabled User
+	repo.db.First(&disabled, user.ID)
+	if disabled.MFAEnabled || disabled.MFASecret != "" {
+		t.Errorf("Expected MFA to be off, got %+v", disabled)
+	}
+	if remaining, _ := repo.CountRecoveryCodes(user.ID); remaining != 0 {
+		t.Errorf("Expected recovery codes to be removed, got %d", remaining)
+	}
+}
+
+func TestMFARequired(t *testing.T) {
+	if !MFARequired([]string{"admin"}, RoleAdmin) {
+		t.Error("Expected MFA to be required for admin")
+	}
+	if MFARequired([]string{"admin"}, RoleEditor) || MFARequired(nil, RoleAdmin) {
+		t.Error("Expected MFA to be required only for the listed roles")
+	}
+	if !MFARequired([]string{"editor"}, RoleUser) {
+		t.Error("Expected the legacy user role to count as editor")
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+
+	// RoleUser is the role given to regular users before roles were split
+	// into viewer and editor. It is treated as editor.
+	RoleUser = "user"
+)
+
+// Roles lists the assignable roles, from least to most privileged.
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
+// NormalizeRole maps legacy role names to their current equivalent.
+func NormalizeRole(role string) string {
+	if role == RoleUser {
+		return RoleEditor
+	}
+	return role
+}
+
+// IsValidRole reports whether role, after normalization, is assignable.
+func IsValidRole(role string) bool {
+	role = NormalizeRole(role)
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SessionData holds the values of one session for the database session
+// store. The session cookie carries only the row's ID.
+type SessionData struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	Data      string    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (SessionData) TableName() string {
+	return "session_data"
+}
+
+// FindData returns the session data with the given ID, or nil when there is
+// none or it has expired.
+func (r *SessionRepository) FindData(id string) (*SessionData, error) {
+	if r.db == nil {
+		return nil, nil
+	}
+	var data SessionData
+	err := r.db.Where("id = ? AND expires_at > ?", id, time.Now()).First(&data).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// SaveData creates or replaces session data.
+func (r *SessionRepository) SaveData(data *SessionData) error {
+	if r.db == nil {
+		return errors.New("database not available")
+	}
+	return r.db.Save(data).Error
+}
+
+func (r *SessionRepository) DeleteData(id string) error {
+	if r.db == nil {
+		return nil
+	}
+	return r.db.Where("id = ?", id).Delete(&SessionData{}).Error
+}
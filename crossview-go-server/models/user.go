@@ -2,23 +2,50 @@ package models
 
 import (
 	"crypto/rand"
-	"strings"
+	"errors"
 	"time"
-	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrLastAdmin is returned when a change would leave no admin.
+var ErrLastAdmin = errors.New("cannot remove the last admin")
+
 type User struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
 	Username     string    `gorm:"uniqueIndex;not null" json:"username"`
 	Email        string    `gorm:"uniqueIndex;not null" json:"email"`
 	PasswordHash string    `gorm:"column:password_hash;not null" json:"-"`
-	Role         string    `gorm:"default:user" json:"role"`
+	Role         string    `gorm:"default:editor" json:"role"`
 	FirstName    *string   `gorm:"column:first_name" json:"first_name,omitempty"`
 	LastName     *string   `gorm:"column:last_name" json:"last_name,omitempty"`
 	CreatedAt    time.Time `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt    time.Time `gorm:"column:updated_at" json:"updated_at"`
+
+	// Failed password logins since the last successful one, used to throttle
+	// guessing. LockedUntil is set while too many failures lock the account.
+	FailedLoginCount  int        `gorm:"column:failed_login_count;not null;default:0" json:"failed_login_count"`
+	LastFailedLoginAt *time.Time `gorm:"column:last_failed_login_at" json:"-"`
+	LockedUntil       *time.Time `gorm:"column:locked_until" json:"locked_until,omitempty"`
+	LastLoginAt       *time.Time `gorm:"column:last_login_at" json:"last_login_at,omitempty"`
+
+	// Two-factor authentication. MFASecret is the TOTP secret, set while
+	// enrollment is pending and kept once MFAEnabled; MFALastCounter is the
+	// time step of the last code accepted, so no code works twice.
+	MFAEnabled     bool   `gorm:"column:mfa_enabled;not null;default:false" json:"mfa_enabled"`
+	MFASecret      string `gorm:"column:mfa_secret" json:"-"`
+	MFALastCounter int64  `gorm:"column:mfa_last_counter;not null;default:0" json:"-"`
+
+	// SSOLinkPending marks a user that existed before SSO identities were
+	// recorded. Its first SSO login with a verified, matching email is
+	// linked to it, as such logins were then. The link or a password login
+	// clears it.
+	SSOLinkPending bool `gorm:"column:sso_link_pending;not null;default:false" json:"-"`
+
+	// Groups holds the groups reported by the identity provider at login.
+	// It is not stored.
+	Groups []string `gorm:"-" json:"-"`
 }
 
 func (User) TableName() string {
@@ -104,7 +131,7 @@ func (r *UserRepository) HasAdmin() (bool, error) {
 		return false, nil
 	}
 	var count int64
-	err := r.db.Model(&User{}).Where("role = ?", "admin").Count(&count).Error
+	err := r.db.Model(&User{}).Where("role = ?", RoleAdmin).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
@@ -127,127 +154,145 @@ func (r *UserRepository) Update(user *User) error {
 	return r.db.Save(user).Error
 }
 
-func (r *UserRepository) Delete(id uint) error {
+// UpdateLoginState saves the user's login counters and timestamps without
+// touching the rest of the record.
+func (r *UserRepository) UpdateLoginState(user *User) error {
 	if r.db == nil {
 		return nil
 	}
-	return r.db.Delete(&User{}, id).Error
+	return r.db.Model(user).
+		Select("failed_login_count", "last_failed_login_at", "locked_until", "last_login_at", "sso_link_pending").
+		Updates(user).Error
 }
 
-func (r *UserRepository) AutoMigrate() error {
+// RecordLoginFailure counts a failed login for the user in the database, so
+// that failures made at the same time all count. The count starts over when
+// the previous failure is at least window old, and once it reaches
+// maxAttempts (0 for no limit) the user is locked until window from now. The
+// user's login state is updated to match.
+func (r *UserRepository) RecordLoginFailure(user *User, now time.Time, window time.Duration, maxAttempts int) error {
 	if r.db == nil {
 		return nil
 	}
-	sqlDB, err := r.db.DB()
-	if err != nil {
-		return fmt.Errorf("failed to get underlying SQL DB: %w", err)
-	}
-	
-	if err := sqlDB.Ping(); err != nil {
-		return fmt.Errorf("database ping failed: %w", err)
-	}
-	
-	var tableExists bool
-	err = r.db.Raw("SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_schema = 'public' AND table_name = 'users')").Scan(&tableExists).Error
-	if err != nil {
-		return fmt.Errorf("failed to check if users table exists: %w", err)
-	}
-	
-	if !tableExists {
-		if err := r.db.AutoMigrate(&User{}); err != nil {
-			return fmt.Errorf("auto migrate failed: %w", err)
+	var count int
+	var lockedUntil *time.Time
+	// The update locks the row until the transaction ends, so the count read
+	// back is the one this failure produced.
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE users SET
+			failed_login_count = CASE WHEN last_failed_login_at IS NULL OR last_failed_login_at <= ? THEN 1 ELSE failed_login_count + 1 END,
+			last_failed_login_at = ?,
+			locked_until = NULL
+			WHERE id = ?`, now.Add(-window), now, user.ID).Error
+		if err != nil {
+			return err
 		}
-		return nil
-	}
-	
-	migrator := r.db.Migrator()
-	if err := migrator.AutoMigrate(&User{}); err != nil {
-		errStr := err.Error()
-		if errStr == "insufficient arguments" || errStr == "auto migrate failed: insufficient arguments" {
-			return nil
+		if err := tx.Model(&User{}).Where("id = ?", user.ID).Select("failed_login_count").Scan(&count).Error; err != nil {
+			return err
 		}
-		return fmt.Errorf("auto migrate failed: %w", err)
+		if maxAttempts > 0 && count >= maxAttempts {
+			until := now.Add(window)
+			lockedUntil = &until
+			return tx.Model(&User{}).Where("id = ?", user.ID).UpdateColumn("locked_until", until).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	
+	user.FailedLoginCount = count
+	user.LastFailedLoginAt = &now
+	user.LockedUntil = lockedUntil
 	return nil
 }
 
-func (r *UserRepository) FindOrCreateSSOUser(username, email, firstName, lastName string) (*User, error) {
+// Unlock clears a user's failed logins and lockout.
+func (r *UserRepository) Unlock(id uint) error {
 	if r.db == nil {
-		return nil, fmt.Errorf("database not available")
+		return nil
 	}
-	if username == "" && email == "" {
-		return nil, fmt.Errorf("username or email is required from SSO provider")
+	return r.db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"failed_login_count":   0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	}).Error
+}
+
+// Delete removes a user along with their identities, sessions, API tokens
+// and recovery codes. It returns ErrLastAdmin rather than delete the only
+// admin.
+func (r *UserRepository) Delete(id uint) error {
+	if r.db == nil {
+		return nil
 	}
-	
-	var user *User
-	var err error
-	
-	if email != "" {
-		user, err = r.FindByEmail(email)
-		if err == nil && user != nil {
-			return r.updateSSOUserInfo(user, email, firstName, lastName)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureNotLastAdmin(tx, id); err != nil {
+			return err
 		}
-	}
-	
-	if user == nil && username != "" {
-		user, err = r.FindByUsername(username)
-		if err == nil && user != nil {
-			return r.updateSSOUserInfo(user, email, firstName, lastName)
+		if err := tx.Where("user_id = ?", id).Delete(&UserIdentity{}).Error; err != nil {
+			return err
 		}
+		if err := tx.Where("user_id = ?", id).Delete(&UserSession{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&User{}, id).Error
+	})
+}
+
+// UpdateRole changes the user's role. Demoting an admin checks for another
+// admin in the same transaction, so that two admins demoting each other at
+// once can't leave none. It returns ErrLastAdmin rather than demote the
+// only admin.
+func (r *UserRepository) UpdateRole(id uint, role string) error {
+	if r.db == nil {
+		return nil
 	}
-	
-	if user != nil {
-		return user, nil
-	}
-	
-	hasUsers, _ := r.Count()
-	role := "user"
-	if hasUsers == 0 {
-		role = "admin"
-	}
-	
-	if username == "" {
-		if email != "" {
-			if idx := strings.Index(email, "@"); idx > 0 {
-				username = email[:idx]
-			} else {
-				username = "sso_user"
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if role != RoleAdmin {
+			if err := ensureNotLastAdmin(tx, id); err != nil {
+				return err
 			}
-		} else {
-			username = "sso_user"
 		}
+		return tx.Model(&User{}).Where("id = ?", id).Update("role", role).Error
+	})
+}
+
+// ensureNotLastAdmin returns ErrLastAdmin if id is the only admin. The admin
+// rows are locked so that two admins can't be removed at the same time.
+func ensureNotLastAdmin(tx *gorm.DB, id uint) error {
+	var adminIDs []uint
+	err := tx.Model(&User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("role = ?", RoleAdmin).Pluck("id", &adminIDs).Error
+	if err != nil {
+		return err
 	}
-	if email == "" {
-		email = fmt.Sprintf("%s@sso.local", username)
-	}
-	
-	user = &User{
-		Username:  username,
-		Email:     email,
-		Role:      role,
-		FirstName: stringPtr(firstName),
-		LastName:  stringPtr(lastName),
-	}
-	
-	randomPassword := generateRandomPassword()
-	if err := user.SetPassword(randomPassword); err != nil {
-		return nil, err
-	}
-	
-	if err := r.Create(user); err != nil {
-		return nil, err
+	if len(adminIDs) == 1 && adminIDs[0] == id {
+		return ErrLastAdmin
 	}
-	
-	return user, nil
+	return nil
 }
 
-func (r *UserRepository) updateSSOUserInfo(user *User, email, firstName, lastName string) (*User, error) {
+func (r *UserRepository) updateSSOUserInfo(user *User, email, firstName, lastName, role string) (*User, error) {
 	updated := false
+	roleChanged := false
 	
-	if email != "" && user.Email != email {
-		user.Email = email
+	if role != "" && user.Role != role {
+		user.Role = role
 		updated = true
+		roleChanged = true
+	}
+	if email != "" && user.Email != email {
+		// Keep the old email rather than take one another user holds.
+		if other, _ := r.FindByEmail(email); other == nil || other.ID == user.ID {
+			user.Email = email
+			updated = true
+		}
 	}
 	if firstName != "" && (user.FirstName == nil || *user.FirstName != firstName) {
 		user.FirstName = stringPtr(firstName)
@@ -263,6 +308,13 @@ func (r *UserRepository) updateSSOUserInfo(user *User, email, firstName, lastNam
 			return nil, err
 		}
 	}
+	// The IdP changed the user's role: end the sessions started under the
+	// old one. The login in progress records its session afterwards.
+	if roleChanged {
+		if err := r.db.Where("user_id = ?", user.ID).Delete(&UserSession{}).Error; err != nil {
+			return nil, err
+		}
+	}
 	
 	return user, nil
 }
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSSOEmailInUse is returned when a new SSO identity's email belongs to an
+// existing user and linking by email is not allowed.
+var ErrSSOEmailInUse = errors.New("email belongs to an existing user")
+
+// UserIdentity links a subject at an identity provider to a user. SSO logins
+// are matched on (Provider, Subject), which stays stable when the user's
+// username or email changes at the provider.
+type UserIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"`
+	Provider    string     `gorm:"uniqueIndex:idx_user_identities_provider_subject;not null" json:"provider"`
+	Subject     string     `gorm:"uniqueIndex:idx_user_identities_provider_subject;not null" json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at" json:"created_at"`
+	LastLoginAt *time.Time `gorm:"column:last_login_at" json:"last_login_at,omitempty"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// SSOLogin is a successful SSO authentication to resolve to a user.
+type SSOLogin struct {
+	// Provider names the identity provider, e.g. "oidc:employees" or "saml".
+	Provider string
+	// Subject is the provider's stable identifier for the user.
+	Subject   string
+	Username  string
+	Email     string
+	FirstName string
+	LastName  string
+	// Role, when set, is assigned to the user whether it is new or not.
+	Role string
+	// LinkByEmail allows a new identity to be linked to an existing user
+	// with the same email. Callers set it only when the provider vouches
+	// for the email.
+	LinkByEmail bool
+	// EmailVerified reports that the provider vouches for Email. It lets a
+	// new identity be linked to a user with User.SSOLinkPending set.
+	EmailVerified bool
+}
+
+// FindOrCreateSSOUser returns the user an SSO login belongs to. A known
+// identity resolves to its user. A new identity is linked to the user with
+// the same email only when login.LinkByEmail is set, or once when that user
+// has SSOLinkPending and the email is verified; otherwise a new user is
+// created, with a numeric suffix on the username if it is taken. Without a
+// role, the first user becomes admin and later users editors.
+func (r *UserRepository) FindOrCreateSSOUser(login SSOLogin) (*User, error) {
+	if r.db == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+	if login.Provider == "" || login.Subject == "" {
+		return nil, fmt.Errorf("provider and subject are required from SSO provider")
+	}
+	if login.Username == "" && login.Email == "" {
+		return nil, fmt.Errorf("username or email is required from SSO provider")
+	}
+
+	var user *User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		repo := &UserRepository{db: tx}
+		now := time.Now()
+
+		var identity UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", login.Provider, login.Subject).First(&identity).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			user, err = repo.FindByID(identity.UserID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if user != nil {
+				identity.Email = login.Email
+				identity.LastLoginAt = &now
+				if err := tx.Save(&identity).Error; err != nil {
+					return err
+				}
+				user, err = repo.updateSSOUserInfo(user, login.Email, login.FirstName, login.LastName, login.Role)
+				return err
+			}
+			// The user was deleted; the identity starts over.
+			if err := tx.Delete(&identity).Error; err != nil {
+				return err
+			}
+		}
+
+		if login.Email != "" {
+			existing, err := repo.FindByEmail(login.Email)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if existing != nil {
+				if !login.LinkByEmail && !(existing.SSOLinkPending && login.EmailVerified) {
+					return ErrSSOEmailInUse
+				}
+				user = existing
+				user.SSOLinkPending = false
+			}
+		}
+
+		if user == nil {
+			user, err = repo.createSSOUser(login)
+			if err != nil {
+				return err
+			}
+		} else if user, err = repo.updateSSOUserInfo(user, login.Email, login.FirstName, login.LastName, login.Role); err != nil {
+			return err
+		}
+
+		return tx.Create(&UserIdentity{
+			UserID:      user.ID,
+			Provider:    login.Provider,
+			Subject:     login.Subject,
+			Email:       login.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	if err := r.UpdateLoginState(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *UserRepository) createSSOUser(login SSOLogin) (*User, error) {
+	role := login.Role
+	if role == "" {
+		hasUsers, _ := r.Count()
+		role = RoleEditor
+		if hasUsers == 0 {
+			role = RoleAdmin
+		}
+	}
+
+	username := login.Username
+	if username == "" {
+		username = "sso_user"
+		if idx := strings.Index(login.Email, "@"); idx > 0 {
+			username = login.Email[:idx]
+		}
+	}
+	username, err := r.availableUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	email := login.Email
+	if email == "" {
+		email = fmt.Sprintf("%s@sso.local", username)
+	}
+
+	user := &User{
+		Username:  username,
+		Email:     email,
+		Role:      role,
+		FirstName: stringPtr(login.FirstName),
+		LastName:  stringPtr(login.LastName),
+	}
+	if err := user.SetPassword(generateRandomPassword()); err != nil {
+		return nil, err
+	}
+	if err := r.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// availableUsername returns username, or username-2, username-3 and so on
+// when it already belongs to another user.
+func (r *UserRepository) availableUsername(username string) (string, error) {
+	candidate := username
+	for i := 2; ; i++ {
+		var count int64
+		if err := r.db.Model(&User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", username, i)
+	}
+}
+
+// FindIdentity returns the identity a provider's subject is linked to.
+func (r *UserRepository) FindIdentity(provider, subject string) (*UserIdentity, error) {
+	if r.db == nil {
+		return nil, nil
+	}
+	var identity UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// FindIdentitiesByUserID returns the SSO identities linked to a user.
+func (r *UserRepository) FindIdentitiesByUserID(userID uint) ([]UserIdentity, error) {
+	if r.db == nil {
+		return nil, nil
+	}
+	var identities []UserIdentity
+	err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	return identities, err
+}
+
+// DeleteIdentity unlinks an identity from a user. The next login with it is
+// treated as a new identity.
+func (r *UserRepository) DeleteIdentity(userID, identityID uint) error {
+	if r.db == nil {
+		return nil
+	}
+	result := r.db.Where("id = ? AND user_id = ?", identityID, userID).Delete(&UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
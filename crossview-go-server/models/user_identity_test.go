@@ -0,0 +1,226 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func setupIdentityTestRepo(t *testing.T) *UserRepository {
+	return NewUserRepository(openTestDB(t))
+}
+
+func TestFindOrCreateSSOUser_MatchesOnSubject(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+
+	first, err := repo.FindOrCreateSSOUser(SSOLogin{Provider: "oidc:default", Subject: "sub-1", Username: "alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Role != RoleAdmin {
+		t.Errorf("Expected the first user to be admin, got '%s'", first.Role)
+	}
+
+	renamed, err := repo.FindOrCreateSSOUser(SSOLogin{Provider: "oidc:default", Subject: "sub-1", Username: "alice.smith", Email: "alice.smith@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if renamed.ID != first.ID {
+		t.Errorf("Expected the same user for the same subject, got %d and %d", first.ID, renamed.ID)
+	}
+	if renamed.Email != "alice.smith@example.com" {
+		t.Errorf("Expected email to follow the provider, got '%s'", renamed.Email)
+	}
+
+	identities, err := repo.FindIdentitiesByUserID(first.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(identities) != 1 || identities[0].Subject != "sub-1" || identities[0].LastLoginAt == nil {
+		t.Errorf("Unexpected identities: %+v", identities)
+	}
+}
+
+func TestFindOrCreateSSOUser_DoesNotTakeOverUsername(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+	local := &User{Username: "admin", Email: "admin@corp.local", Role: RoleAdmin}
+	local.SetPassword("secret")
+	if err := repo.Create(local); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	user, err := repo.FindOrCreateSSOUser(SSOLogin{Provider: "oidc:default", Subject: "sub-evil", Username: "admin", Email: "attacker@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.ID == local.ID {
+		t.Fatal("Expected a new user, not the local account")
+	}
+	if user.Username != "admin-2" || user.Role != RoleEditor {
+		t.Errorf("Expected 'admin-2' as editor, got '%s' as '%s'", user.Username, user.Role)
+	}
+}
+
+func TestFindOrCreateSSOUser_LinkByEmail(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+	local := &User{Username: "bob", Email: "bob@example.com", Role: RoleViewer}
+	local.SetPassword("secret")
+	if err := repo.Create(local); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	login := SSOLogin{Provider: "saml", Subject: "bob-nameid", Username: "bob", Email: "bob@example.com"}
+
+	if _, err := repo.FindOrCreateSSOUser(login); !errors.Is(err, ErrSSOEmailInUse) {
+		t.Errorf("Expected ErrSSOEmailInUse, got %v", err)
+	}
+	if identities, _ := repo.FindIdentitiesByUserID(local.ID); len(identities) != 0 {
+		t.Errorf("Expected no identity to be linked, got %+v", identities)
+	}
+
+	login.LinkByEmail = true
+	user, err := repo.FindOrCreateSSOUser(login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.ID != local.ID {
+		t.Errorf("Expected the existing user to be linked, got user %d", user.ID)
+	}
+	if identities, _ := repo.FindIdentitiesByUserID(local.ID); len(identities) != 1 {
+		t.Errorf("Expected one linked identity, got %+v", identities)
+	}
+}
+
+func TestFindOrCreateSSOUser_LinkPending(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+	legacy := &User{Username: "carol", Email: "carol@example.com", Role: RoleEditor, SSOLinkPending: true}
+	legacy.SetPassword("random")
+	if err := repo.Create(legacy); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	login := SSOLogin{Provider: "oidc:default", Subject: "carol-sub", Username: "carol", Email: "carol@example.com"}
+
+	if _, err := repo.FindOrCreateSSOUser(login); !errors.Is(err, ErrSSOEmailInUse) {
+		t.Errorf("Expected an unverified email not to be linked, got %v", err)
+	}
+
+	login.EmailVerified = true
+	user, err := repo.FindOrCreateSSOUser(login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.ID != legacy.ID {
+		t.Errorf("Expected the pending user to be linked, got user %d", user.ID)
+	}
+	stored, _ := repo.FindByID(legacy.ID)
+	if stored.SSOLinkPending {
+		t.Error("Expected the link to clear SSOLinkPending")
+	}
+
+	// The link happens once; another identity with the email is refused.
+	other := SSOLogin{Provider: "saml", Subject: "carol-nameid", Email: "carol@example.com", EmailVerified: true}
+	if _, err := repo.FindOrCreateSSOUser(other); !errors.Is(err, ErrSSOEmailInUse) {
+		t.Errorf("Expected ErrSSOEmailInUse after the link, got %v", err)
+	}
+}
+
+func TestFindOrCreateSSOUser_DeletedUser(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+	login := SSOLogin{Provider: "oidc:default", Subject: "sub-1", Username: "carol", Email: "carol@example.com"}
+	// An admin to remain, since the last admin can't be deleted.
+	if err := repo.Create(&User{Username: "admin", Email: "admin@example.com", Role: RoleAdmin}); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+
+	user, err := repo.FindOrCreateSSOUser(login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := repo.Delete(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if identities, _ := repo.FindIdentitiesByUserID(user.ID); len(identities) != 0 {
+		t.Errorf("Expected identities to be deleted with the user, got %+v", identities)
+	}
+
+	again, err := repo.FindOrCreateSSOUser(login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again.ID == user.ID {
+		t.Error("Expected a new user after the old one was deleted")
+	}
+}
+
+func TestUserRepository_UpdateRole(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+	admin := &User{Username: "admin", Email: "admin@example.com", Role: RoleAdmin}
+	other := &User{Username: "other", Email: "other@example.com", Role: RoleViewer}
+	repo.Create(admin)
+	repo.Create(other)
+
+	if err := repo.UpdateRole(admin.ID, RoleEditor); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("Expected ErrLastAdmin, got %v", err)
+	}
+	if err := repo.UpdateRole(other.ID, RoleAdmin); err != nil {
+		t.Fatalf("Failed to promote user: %v", err)
+	}
+	if err := repo.UpdateRole(admin.ID, RoleEditor); err != nil {
+		t.Fatalf("Expected an admin to be demoted while another remains, got %v", err)
+	}
+	if err := repo.UpdateRole(other.ID, RoleViewer); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected the remaining admin to keep their role, got %v", err)
+	}
+	if found, _ := repo.FindByID(admin.ID); found.Role != RoleEditor {
+		t.Errorf("Expected role %s, got %s", RoleEditor, found.Role)
+	}
+}
+
+func TestUserRepository_DeleteLastAdmin(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+	admin := &User{Username: "admin", Email: "admin@example.com", Role: RoleAdmin}
+	other := &User{Username: "other", Email: "other@example.com", Role: RoleAdmin}
+	repo.Create(admin)
+
+	if err := repo.Delete(admin.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("Expected ErrLastAdmin, got %v", err)
+	}
+	if found, _ := repo.FindByID(admin.ID); found == nil {
+		t.Fatal("Expected the last admin to remain")
+	}
+
+	repo.Create(other)
+	if err := repo.Delete(admin.ID); err != nil {
+		t.Fatalf("Expected an admin to be deleted while another remains, got %v", err)
+	}
+	if err := repo.Delete(other.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected the remaining admin to be protected, got %v", err)
+	}
+}
+
+func TestDeleteIdentity(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+	user, err := repo.FindOrCreateSSOUser(SSOLogin{Provider: "oidc:default", Subject: "sub-1", Username: "dave", Email: "dave@example.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	identities, _ := repo.FindIdentitiesByUserID(user.ID)
+
+	if err := repo.DeleteIdentity(user.ID+1, identities[0].ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected not found for another user's identity, got %v", err)
+	}
+	if err := repo.DeleteIdentity(user.ID, identities[0].ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if remaining, _ := repo.FindIdentitiesByUserID(user.ID); len(remaining) != 0 {
+		t.Errorf("Expected the identity to be unlinked, got %+v", remaining)
+	}
+}
+
+func TestFindOrCreateSSOUser_RequiresSubject(t *testing.T) {
+	repo := setupIdentityTestRepo(t)
+
+	if _, err := repo.FindOrCreateSSOUser(SSOLogin{Provider: "saml", Username: "erin"}); err == nil {
+		t.Error("Expected an error without a subject")
+	}
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserSession is a login recorded in the server-side session registry. The
+// session cookie carries its ID, and a session whose row is gone is no longer
+// accepted, so deleting rows logs users out wherever their cookies are.
+type UserSession struct {
+	ID     string `gorm:"primaryKey;size:64" json:"id"`
+	UserID uint   `gorm:"index;not null" json:"user_id"`
+	// Provider is how the user logged in: "local", "oidc:<name>" or "saml".
+	Provider string `gorm:"index:idx_user_sessions_provider_sid" json:"provider"`
+	// SID is the IdP's session ID (the OIDC sid claim), which back-channel
+	// logout tokens may name instead of the user.
+	SID string `gorm:"column:sid;index:idx_user_sessions_provider_sid" json:"-"`
+	// IDToken is sent back to the IdP as id_token_hint on logout. It is kept
+	// here rather than in the cookie, which it would not fit in.
+	IDToken   string    `gorm:"column:id_token;type:text" json:"-"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	// LastSeenAt is when the session was last used, refreshed at most once
+	// per lastSeenResolution. The idle timeout is measured from it.
+	LastSeenAt time.Time `gorm:"column:last_seen_at" json:"last_seen_at"`
+}
+
+// lastSeenResolution bounds how often a session's LastSeenAt is written, so
+// that busy sessions don't cost a write per request.
+const lastSeenResolution = time.Minute
+
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create records session under a new random ID.
+func (r *SessionRepository) Create(session *UserSession) error {
+	if r.db == nil {
+		return fmt.Errorf("database not available")
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	session.ID = hex.EncodeToString(id)
+	if session.LastSeenAt.IsZero() {
+		session.LastSeenAt = time.Now()
+	}
+	return r.db.Create(session).Error
+}
+
+func (r *SessionRepository) FindByID(id string) (*UserSession, error) {
+	if r.db == nil {
+		return nil, nil
+	}
+	var session UserSession
+	err := r.db.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindByUserID returns a user's sessions, most recent first.
+func (r *SessionRepository) FindByUserID(userID uint) ([]UserSession, error) {
+	if r.db == nil {
+		return nil, nil
+	}
+	var sessions []UserSession
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// Validate returns the session with the given ID if it is still live, and
+// records that it was used. A session idle for longer than idle, or older
+// than absolute, is deleted and nil is returned; a zero timeout disables
+// that check.
+func (r *SessionRepository) Validate(id string, idle, absolute time.Duration) (*UserSession, error) {
+	session, err := r.FindByID(id)
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	lastSeen := session.LastSeenAt
+	if lastSeen.IsZero() {
+		lastSeen = session.CreatedAt
+	}
+	if (idle > 0 && now.Sub(lastSeen) > idle) || (absolute > 0 && now.Sub(session.CreatedAt) > absolute) {
+		if err := r.Delete(id); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if now.Sub(lastSeen) > lastSeenResolution {
+		session.LastSeenAt = now
+		if err := r.db.Model(&UserSession{}).Where("id = ?", id).Update("last_seen_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+func (r *SessionRepository) Delete(id string) error {
+	if r.db == nil {
+		return nil
+	}
+	return r.db.Where("id = ?", id).Delete(&UserSession{}).Error
+}
+
+// DeleteByUserID ends all of a user's sessions and returns how many there
+// were.
+func (r *SessionRepository) DeleteByUserID(userID uint) (int64, error) {
+	if r.db == nil {
+		return 0, nil
+	}
+	result := r.db.Where("user_id = ?", userID).Delete(&UserSession{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteOthers ends all of a user's sessions except keepID, e.g. after they
+// change their password.
+func (r *SessionRepository) DeleteOthers(userID uint, keepID string) (int64, error) {
+	if r.db == nil {
+		return 0, nil
+	}
+	result := r.db.Where("user_id = ? AND id <> ?", userID, keepID).Delete(&UserSession{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteForUser ends one of a user's sessions. It returns
+// gorm.ErrRecordNotFound when the user has no session with that ID.
+func (r *SessionRepository) DeleteForUser(userID uint, id string) error {
+	if r.db == nil {
+		return nil
+	}
+	result := r.db.Where("user_id = ? AND id = ?", userID, id).Delete(&UserSession{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes sessions past their idle or absolute timeout, along
+// with expired session data, and returns how many sessions it removed.
+func (r *SessionRepository) DeleteExpired(idle, absolute time.Duration) (int64, error) {
+	if r.db == nil {
+		return 0, nil
+	}
+	now := time.Now()
+	query := r.db.Where("1 = 0")
+	if idle > 0 {
+		query = query.Or("last_seen_at < ?", now.Add(-idle))
+	}
+	if absolute > 0 {
+		query = query.Or("created_at < ?", now.Add(-absolute))
+	}
+	result := query.Delete(&UserSession{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := r.db.Where("expires_at < ?", now).Delete(&SessionData{}).Error; err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteBySID ends the sessions started from one IdP session and returns how
+// many there were.
+func (r *SessionRepository) DeleteBySID(provider, sid string) (int64, error) {
+	if r.db == nil {
+		return 0, nil
+	}
+	result := r.db.Where("provider = ? AND sid = ?", provider, sid).Delete(&UserSession{})
+	return result.RowsAffected, result.Error
+}
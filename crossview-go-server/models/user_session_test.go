@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestSessionRepository_Lifecycle(t *testing.T) {
+	users := setupIdentityTestRepo(t)
+	repo := NewSessionRepository(users.db)
+
+	first := &UserSession{UserID: 1, Provider: "oidc:default", SID: "idp-1"}
+	second := &UserSession{UserID: 1, Provider: "local"}
+	other := &UserSession{UserID: 2, Provider: "oidc:default", SID: "idp-2"}
+	for _, session := range []*UserSession{first, second, other} {
+		if err := repo.Create(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+	if first.ID == "" || first.ID == second.ID {
+		t.Fatalf("Expected distinct random IDs, got '%s' and '%s'", first.ID, second.ID)
+	}
+
+	ended, err := repo.DeleteBySID("oidc:default", "idp-2")
+	if err != nil || ended != 1 {
+		t.Fatalf("Expected to end 1 session by sid, got %d (%v)", ended, err)
+	}
+	if found, _ := repo.FindByID(other.ID); found != nil {
+		t.Error("Expected the session named by sid to be gone")
+	}
+
+	ended, err = repo.DeleteByUserID(1)
+	if err != nil || ended != 2 {
+		t.Fatalf("Expected to end 2 sessions for the user, got %d (%v)", ended, err)
+	}
+	if found, _ := repo.FindByID(first.ID); found != nil {
+		t.Error("Expected the user's sessions to be gone")
+	}
+}
+
+func TestUserRepository_DeleteEndsSessions(t *testing.T) {
+	users := setupIdentityTestRepo(t)
+	repo := NewSessionRepository(users.db)
+
+	user := &User{Username: "alice", Email: "alice@example.com", Role: RoleViewer}
+	user.SetPassword("secret")
+	if err := users.Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	session := &UserSession{UserID: user.ID, Provider: "local"}
+	if err := repo.Create(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if err := users.Delete(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if found, _ := repo.FindByID(session.ID); found != nil {
+		t.Error("Expected deleting the user to end their sessions")
+	}
+}
+
+func TestSessionRepository_Validate(t *testing.T) {
+	users := setupIdentityTestRepo(t)
+	repo := NewSessionRepository(users.db)
+
+	now := time.Now()
+	live := &UserSession{UserID: 1, Provider: "local", LastSeenAt: now.Add(-10 * time.Minute)}
+	idle := &UserSession{UserID: 1, Provider: "local", LastSeenAt: now.Add(-2 * time.Hour)}
+	old := &UserSession{UserID: 1, Provider: "local", CreatedAt: now.Add(-48 * time.Hour), LastSeenAt: now}
+	for _, session := range []*UserSession{live, idle, old} {
+		if err := repo.Create(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	found, err := repo.Validate(live.ID, time.Hour, 24*time.Hour)
+	if err != nil || found == nil {
+		t.Fatalf("Expected the live session to validate, got %v", err)
+	}
+	if stored, _ := repo.FindByID(live.ID); !stored.LastSeenAt.After(live.LastSeenAt) {
+		t.Error("Expected validation to refresh LastSeenAt")
+	}
+
+	for name, session := range map[string]*UserSession{"idle": idle, "expired": old} {
+		if found, err := repo.Validate(session.ID, time.Hour, 24*time.Hour); err != nil || found != nil {
+			t.Errorf("Expected the %s session to be rejected, got %v (%v)", name, found, err)
+		}
+		if stored, _ := repo.FindByID(session.ID); stored != nil {
+			t.Errorf("Expected the %s session to be deleted", name)
+		}
+	}
+}
+
+func TestSessionRepository_ListAndRevoke(t *testing.T) {
+	users := setupIdentityTestRepo(t)
+	repo := NewSessionRepository(users.db)
+
+	first := &UserSession{UserID: 1, Provider: "local"}
+	second := &UserSession{UserID: 1, Provider: "oidc:default"}
+	other := &UserSession{UserID: 2, Provider: "local"}
+	for _, session := range []*UserSession{first, second, other} {
+		if err := repo.Create(session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+	}
+
+	sessions, err := repo.FindByUserID(1)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions for the user, got %d (%v)", len(sessions), err)
+	}
+
+	if err := repo.DeleteForUser(1, other.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected another user's session to be out of reach, got %v", err)
+	}
+	if err := repo.DeleteForUser(1, first.ID); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+	if found, _ := repo.FindByID(first.ID); found != nil {
+		t.Error("Expected the revoked session to be gone")
+	}
+	if found, _ := repo.FindByID(second.ID); found == nil {
+		t.Error("Expected the user's other session to remain")
+	}
+}
+
+func TestFindOrCreateSSOUser_RoleChangeEndsSessions(t *testing.T) {
+	users := setupIdentityTestRepo(t)
+	repo := NewSessionRepository(users.db)
+
+	login := SSOLogin{Provider: "oidc:default", Subject: "sub-1", Username: "alice", Email: "alice@example.com", Role: RoleAdmin}
+	user, err := users.FindOrCreateSSOUser(login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	session := &UserSession{UserID: user.ID, Provider: "oidc:default"}
+	if err := repo.Create(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	if _, err := users.FindOrCreateSSOUser(login); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found, _ := repo.FindByID(session.ID); found == nil {
+		t.Fatal("Expected a login with the same role to keep existing sessions")
+	}
+
+	login.Role = RoleViewer
+	if _, err := users.FindOrCreateSSOUser(login); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found, _ := repo.FindByID(session.ID); found != nil {
+		t.Error("Expected a role change to end existing sessions")
+	}
+}
@@ -2,8 +2,30 @@ package models
 
 import (
 	"testing"
+	"time"
+
+	"crossview-go-server/migrations"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
+// openTestDB returns an in-memory SQLite database migrated the way the
+// server migrates its own.
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	// Every connection to ":memory:" opens a new, empty database.
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if _, err := migrations.NewMigrator(db).Up(false); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	return db
+}
+
 func TestUser_SetPassword(t *testing.T) {
 	user := &User{}
 	password := "test-password-123"
@@ -77,3 +99,40 @@ func TestGenerateRandomPassword(t *testing.T) {
 	}
 }
 
+
+func TestUserRepository_RecordLoginFailure(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewUserRepository(db)
+	user := &User{Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := repo.Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := repo.RecordLoginFailure(user, now, time.Minute, 3); err != nil {
+			t.Fatalf("Failed to record failure: %v", err)
+		}
+	}
+	if user.FailedLoginCount != 2 || user.LockedUntil != nil {
+		t.Errorf("Expected 2 failures and no lockout, got %d, locked until %v", user.FailedLoginCount, user.LockedUntil)
+	}
+
+	// A stale copy still adds to the stored count.
+	stale := &User{ID: user.ID}
+	if err := repo.RecordLoginFailure(stale, now, time.Minute, 3); err != nil {
+		t.Fatalf("Failed to record failure: %v", err)
+	}
+	if stale.FailedLoginCount != 3 || stale.LockedUntil == nil || !stale.LockedUntil.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected the third failure to lock the user, got %d, locked until %v", stale.FailedLoginCount, stale.LockedUntil)
+	}
+
+	later := now.Add(time.Minute)
+	if err := repo.RecordLoginFailure(user, later, time.Minute, 3); err != nil {
+		t.Fatalf("Failed to record failure: %v", err)
+	}
+	stored, _ := repo.FindByID(user.ID)
+	if stored.FailedLoginCount != 1 || stored.LockedUntil != nil {
+		t.Errorf("Expected the count to start over after the window, got %d, locked until %v", stored.FailedLoginCount, stored.LockedUntil)
+	}
+}
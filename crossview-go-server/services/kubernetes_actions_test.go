@@ -0,0 +1,92 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func annotationsOf(obj map[string]interface{}) map[string]interface{} {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	return annotations
+}
+
+func TestKubernetesService_RunResourceAction_PauseAndResume(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	setupFakeClusterClients(service, "fake",
+		newTestObject("s3.aws.upbound.io/v1beta1", "Bucket", "", "orders-data"),
+	)
+
+	result, err := service.RunResourceAction("s3.aws.upbound.io/v1beta1", "Bucket", "orders-data", "", "fake", ResourceActionPause, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if annotationsOf(result.Resource)[pausedAnnotation] != "true" {
+		t.Errorf("Expected paused annotation, got %v", annotationsOf(result.Resource))
+	}
+
+	result, err = service.RunResourceAction("s3.aws.upbound.io/v1beta1", "Bucket", "orders-data", "", "fake", ResourceActionResume, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, exists := annotationsOf(result.Resource)[pausedAnnotation]; exists {
+		t.Errorf("Expected paused annotation to be removed, got %v", annotationsOf(result.Resource))
+	}
+}
+
+func TestKubernetesService_RunResourceAction_IncludeComposed(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	objects := setupTraceObjects()
+	setupFakeClusterClients(service, "fake", objects[0], objects[1], objects[2])
+
+	result, err := service.RunResourceAction("example.crossplane.io/v1alpha1", "XDatabase", "orders-x7k2p", "", "fake", ResourceActionReconcile, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if annotationsOf(result.Resource)[reconcileRequestAnnotation] == nil {
+		t.Error("Expected reconcile request annotation on the XR")
+	}
+	if len(result.Composed) != 1 {
+		t.Fatalf("Expected 1 composed resource, got %d", len(result.Composed))
+	}
+	if annotationsOf(result.Composed[0])[reconcileRequestAnnotation] == nil {
+		t.Error("Expected reconcile request annotation on the composed bucket")
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Name != "orders-missing" {
+		t.Errorf("Expected missing bucket to be reported as failed, got %+v", result.Failed)
+	}
+}
+
+func TestResourceActionPatch(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		action  ResourceAction
+		want    string
+		wantErr bool
+	}{
+		{action: ResourceActionPause, want: `{"metadata":{"annotations":{"crossplane.io/paused":"true"}}}`},
+		{action: ResourceActionResume, want: `{"metadata":{"annotations":{"crossplane.io/paused":null}}}`},
+		{action: ResourceActionReconcile, want: `{"metadata":{"annotations":{"crossview.io/reconcile-requested-at":"2026-01-02T03:04:05Z"}}}`},
+		{action: "restart", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			patch, err := resourceActionPatch(tt.action, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(patch) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, patch)
+			}
+		})
+	}
+}
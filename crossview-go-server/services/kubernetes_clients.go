@@ -0,0 +1,215 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	defaultClientIdleTTL = 30 * time.Minute
+	defaultMaxClients    = 32
+)
+
+// ClusterClients holds the clients for a single kubeconfig context. All of
+// them share one HTTP transport so connections are reused across clients.
+type ClusterClients struct {
+	Context   string
+	Config    *rest.Config
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+	Discovery discovery.DiscoveryInterface
+
+	mapper       *resourceMapper
+	sharedMapper bool
+	httpClient   *http.Client
+	lastUsed     time.Time
+
+	// identities caches the impersonated clients made from these ones. They
+	// share the mapper, so they are closed along with it rather than left
+	// holding a stopped one.
+	identities *clientPool
+}
+
+func newClusterClients(contextName string, config *rest.Config) (*ClusterClients, error) {
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfigAndClient(config, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+
+	return &ClusterClients{
+		Context:    contextName,
+		Config:     config,
+		Clientset:  clientset,
+		Dynamic:    dynamicClient,
+		Discovery:  discoveryClient,
+		mapper:     newResourceMapper(discoveryClient, dynamicClient),
+		httpClient: httpClient,
+		lastUsed:   time.Now(),
+		identities: newClientPool(defaultClientIdleTTL, defaultMaxClients),
+	}, nil
+}
+
+// forIdentity returns the cached clients acting as identity, creating them
+// on first use.
+func (c *ClusterClients) forIdentity(identity *Identity) (*ClusterClients, error) {
+	return c.identities.get(identity.key(), func() (*ClusterClients, error) {
+		return c.impersonate(identity)
+	})
+}
+
+// impersonate returns clients for the same cluster that act as identity.
+// They reuse this context's resource mapper, since discovery results do not
+// depend on who is asking and the user may not be allowed to watch CRDs.
+func (c *ClusterClients) impersonate(identity *Identity) (*ClusterClients, error) {
+	config := rest.CopyConfig(c.Config)
+	config.Impersonate = rest.ImpersonationConfig{
+		UserName: identity.Username,
+		Groups:   identity.Groups,
+	}
+
+	clients, err := newClusterClients(c.Context, config)
+	if err != nil {
+		return nil, err
+	}
+	clients.mapper.close()
+	clients.mapper = c.mapper
+	clients.sharedMapper = true
+	clients.identities = nil
+	return clients, nil
+}
+
+func (c *ClusterClients) close() {
+	if c.identities != nil {
+		c.identities.closeAll()
+	}
+	if c.mapper != nil && !c.sharedMapper {
+		c.mapper.close()
+	}
+	if c.httpClient != nil {
+		c.httpClient.CloseIdleConnections()
+	}
+}
+
+// clientPool caches ClusterClients per context, or per identity for a
+// context's impersonated clients. Entries unused for longer
+// than idleTTL are evicted on access, and the least recently used entry is
+// dropped once maxEntries is reached.
+type clientPool struct {
+	entries    map[string]*ClusterClients
+	idleTTL    time.Duration
+	maxEntries int
+	mu         sync.Mutex
+}
+
+func newClientPool(idleTTL time.Duration, maxEntries int) *clientPool {
+	return &clientPool{
+		entries:    make(map[string]*ClusterClients),
+		idleTTL:    idleTTL,
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the cached clients for key, calling build to create them on a
+// miss.
+func (p *clientPool) get(key string, build func() (*ClusterClients, error)) (*ClusterClients, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.evictIdleLocked(now)
+
+	if clients, exists := p.entries[key]; exists {
+		clients.lastUsed = now
+		return clients, nil
+	}
+
+	clients, err := build()
+	if err != nil {
+		return nil, err
+	}
+	clients.lastUsed = now
+
+	if p.maxEntries > 0 && len(p.entries) >= p.maxEntries {
+		p.evictOldestLocked()
+	}
+	p.entries[key] = clients
+	return clients, nil
+}
+
+func (p *clientPool) peek(contextName string) (*ClusterClients, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clients, exists := p.entries[contextName]
+	return clients, exists
+}
+
+// invalidate drops every entry for contextName, and with them their
+// impersonated clients.
+func (p *clientPool) invalidate(contextName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, clients := range p.entries {
+		if clients.Context == contextName {
+			clients.close()
+			delete(p.entries, key)
+		}
+	}
+}
+
+func (p *clientPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, clients := range p.entries {
+		clients.close()
+		delete(p.entries, name)
+	}
+}
+
+func (p *clientPool) evictIdleLocked(now time.Time) {
+	if p.idleTTL <= 0 {
+		return
+	}
+	for name, clients := range p.entries {
+		if now.Sub(clients.lastUsed) > p.idleTTL {
+			clients.close()
+			delete(p.entries, name)
+		}
+	}
+}
+
+func (p *clientPool) evictOldestLocked() {
+	var oldestName string
+	var oldest time.Time
+	for name, clients := range p.entries {
+		if oldestName == "" || clients.lastUsed.Before(oldest) {
+			oldestName = name
+			oldest = clients.lastUsed
+		}
+	}
+	if oldestName != "" {
+		p.entries[oldestName].close()
+		delete(p.entries, oldestName)
+	}
+}
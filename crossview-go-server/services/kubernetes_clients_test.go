@@ -0,0 +1,217 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: cluster-a
+  cluster:
+    server: https://cluster-a.example.com
+- name: cluster-b
+  cluster:
+    server: https://cluster-b.example.com
+users:
+- name: user
+  user:
+    token: test-token
+contexts:
+- name: context-a
+  context:
+    cluster: cluster-a
+    user: user
+- name: context-b
+  context:
+    cluster: cluster-b
+    user: user
+current-context: context-a
+`
+
+func setupTestKubeConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testKubeConfig), 0600); err != nil {
+		t.Fatalf("Failed to write kubeconfig: %v", err)
+	}
+	t.Setenv("KUBECONFIG", path)
+}
+
+func testClients(contextName, host string) func() (*ClusterClients, error) {
+	return func() (*ClusterClients, error) {
+		return newClusterClients(contextName, &rest.Config{Host: host})
+	}
+}
+
+func TestClientPool_CachesPerContext(t *testing.T) {
+	pool := newClientPool(time.Hour, 10)
+
+	first, err := pool.get("a", testClients("a", "https://a.example.com"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, err := pool.get("a", testClients("a", "https://other.example.com"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first != second {
+		t.Error("Expected cached clients to be reused for the same context")
+	}
+
+	other, err := pool.get("b", testClients("b", "https://b.example.com"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if other == first || other.Config.Host != "https://b.example.com" {
+		t.Error("Expected separate clients for a different context")
+	}
+}
+
+func TestClientPool_EvictsIdleEntries(t *testing.T) {
+	pool := newClientPool(time.Minute, 10)
+
+	clients, err := pool.get("a", testClients("a", "https://a.example.com"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	clients.lastUsed = time.Now().Add(-2 * time.Minute)
+
+	if _, err := pool.get("b", testClients("b", "https://b.example.com")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, exists := pool.peek("a"); exists {
+		t.Error("Expected idle context to be evicted")
+	}
+}
+
+func TestClientPool_EvictsLeastRecentlyUsed(t *testing.T) {
+	pool := newClientPool(time.Hour, 2)
+
+	a, _ := pool.get("a", testClients("a", "https://a.example.com"))
+	a.lastUsed = time.Now().Add(-time.Minute)
+	pool.get("b", testClients("b", "https://b.example.com"))
+	pool.get("c", testClients("c", "https://c.example.com"))
+
+	if _, exists := pool.peek("a"); exists {
+		t.Error("Expected least recently used context to be evicted")
+	}
+	if len(pool.entries) != 2 {
+		t.Errorf("Expected 2 pooled contexts, got %d", len(pool.entries))
+	}
+}
+
+func TestClientPool_ImpersonatedClientsLiveWithTheirContext(t *testing.T) {
+	pool := newClientPool(time.Hour, 1)
+
+	base, _ := pool.get("a", testClients("a", "https://a.example.com"))
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := base.forIdentity(&Identity{Username: username}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if _, exists := pool.peek("a"); !exists {
+		t.Fatal("Expected impersonated clients not to evict their context")
+	}
+
+	pool.get("b", testClients("b", "https://b.example.com"))
+	if len(base.identities.entries) != 0 {
+		t.Errorf("Expected evicting the context to close its impersonated clients, %d left", len(base.identities.entries))
+	}
+	select {
+	case <-base.mapper.stop:
+	default:
+		t.Error("Expected the shared mapper to be stopped with its context")
+	}
+}
+
+func TestClientPool_Invalidate(t *testing.T) {
+	pool := newClientPool(time.Hour, 10)
+	pool.get("a", testClients("a", "https://a.example.com"))
+
+	pool.invalidate("a")
+
+	if _, exists := pool.peek("a"); exists {
+		t.Error("Expected invalidated context to be removed")
+	}
+}
+
+func TestKubernetesService_GetClients_DoesNotChangeDefaultContext(t *testing.T) {
+	setupTestKubeConfig(t)
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv())
+
+	clientsA, err := service.GetClients("context-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	clientsB, err := service.GetClients("context-b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if clientsA.Config.Host != "https://cluster-a.example.com" {
+		t.Errorf("Expected cluster-a host, got '%s'", clientsA.Config.Host)
+	}
+	if clientsB.Config.Host != "https://cluster-b.example.com" {
+		t.Errorf("Expected cluster-b host, got '%s'", clientsB.Config.Host)
+	}
+	if current := service.GetCurrentContext(); current != "" {
+		t.Errorf("Expected default context to stay empty, got '%s'", current)
+	}
+}
+
+func TestKubernetesService_GetClients_RequiresContext(t *testing.T) {
+	setupTestKubeConfig(t)
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv())
+
+	if _, err := service.GetClients("context-b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := service.GetClients(""); err == nil {
+		t.Error("Expected a request without a context to be refused outside the cluster")
+	}
+	if current := service.GetCurrentContext(); current != "" {
+		t.Errorf("Expected no default context outside the cluster, got '%s'", current)
+	}
+}
+
+// setupFakeClusterClients registers in-memory clients for contextName so
+// service methods can run without a cluster.
+func setupFakeClusterClients(service *KubernetesService, contextName string, objects ...runtime.Object) *ClusterClients {
+	fakeClients := setupFakeDiscoveryClients()
+
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, list := range fakeClients.Discovery.(*fakediscovery.FakeDiscovery).Resources {
+		gv, _ := schema.ParseGroupVersion(list.GroupVersion)
+		for _, resource := range list.APIResources {
+			listKinds[gv.WithResource(resource.Name)] = resource.Kind + "List"
+		}
+	}
+
+	fakeClients.Context = contextName
+	fakeClients.Dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+	fakeClients.lastUsed = time.Now()
+
+	service.clients.mu.Lock()
+	service.clients.entries[contextName] = fakeClients
+	service.clients.mu.Unlock()
+	return fakeClients
+}
+
+func newTestObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
@@ -2,17 +2,23 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// Errors for contexts that can't be used, matched with errors.Is.
+var (
+	ErrContextRequired = errors.New("context parameter is required when not running in cluster")
+	ErrContextNotFound = errors.New("context not found in kubeconfig")
+)
+
 func init() {
 	os.Setenv("AWS_SDK_LOAD_CONFIG", "false")
 	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", "")
@@ -56,107 +62,106 @@ func (k *KubernetesService) isInCluster() bool {
 		fileExists(filepath.Join(serviceAccountPath, "ca.crt"))
 }
 
-func (k *KubernetesService) SetContext(ctxName string) error {
-	k.mu.Lock()
-	defer k.mu.Unlock()
+// ResolveContext returns the context name a request for ctxName is served
+// from and makes sure its clients can be built.
+func (k *KubernetesService) ResolveContext(ctxName string) (string, error) {
+	clients, err := k.GetClients(ctxName)
+	if err != nil {
+		return "", err
+	}
+	return clients.Context, nil
+}
 
-	targetContext := ctxName
-	if k.isInCluster() {
-		targetContext = "in-cluster"
+// GetClients returns the pooled clients for ctxName. Inside the cluster every
+// context resolves to "in-cluster"; outside it ctxName is required.
+func (k *KubernetesService) GetClients(ctxName string) (*ClusterClients, error) {
+	targetContext, err := k.targetContext(ctxName)
+	if err != nil {
+		return nil, err
 	}
 
-	if k.currentContext == targetContext && k.clientset != nil && k.config != nil {
-		return nil
+	k.mu.RLock()
+	failed := k.failedContexts[targetContext]
+	k.mu.RUnlock()
+	if failed {
+		return nil, fmt.Errorf("context '%s' has previously failed and will not be retried", targetContext)
 	}
 
-	if k.failedContexts[targetContext] {
-		return fmt.Errorf("context '%s' has previously failed and will not be retried", targetContext)
+	clients, err := k.clients.get(targetContext, func() (*ClusterClients, error) {
+		config, err := k.buildRestConfig(targetContext)
+		if err != nil {
+			return nil, err
+		}
+		return newClusterClients(targetContext, config)
+	})
+	if err != nil {
+		k.mu.Lock()
+		k.failedContexts[targetContext] = true
+		k.mu.Unlock()
+		return nil, err
+	}
+
+	if k.impersonating() {
+		return clients.forIdentity(k.identity)
+	}
+	return clients, nil
+}
+
+func (k *KubernetesService) targetContext(ctxName string) (string, error) {
+	if k.isInCluster() {
+		return "in-cluster", nil
+	}
+	if ctxName != "" {
+		return ctxName, nil
 	}
+	return "", ErrContextRequired
+}
 
+func (k *KubernetesService) buildRestConfig(targetContext string) (*rest.Config, error) {
 	var restConfig *rest.Config
 	var err error
 
 	if k.isInCluster() {
 		restConfig, err = rest.InClusterConfig()
 		if err != nil {
-			k.failedContexts[targetContext] = true
-			return fmt.Errorf("failed to create in-cluster config: %w", err)
+			return nil, fmt.Errorf("failed to create in-cluster config: %w", err)
 		}
-		k.currentContext = "in-cluster"
 	} else {
-		if ctxName == "" {
-			return fmt.Errorf("context parameter is required when not running in cluster")
-		}
+		k.mu.Lock()
+		defer k.mu.Unlock()
 
 		if err := k.loadKubeConfig(); err != nil {
-			k.failedContexts[targetContext] = true
-			return err
+			return nil, err
 		}
 
-		if _, exists := k.kubeConfig.Contexts[ctxName]; !exists {
-			k.failedContexts[targetContext] = true
-			return fmt.Errorf("context '%s' not found in kubeconfig", ctxName)
+		if _, exists := k.kubeConfig.Contexts[targetContext]; !exists {
+			return nil, fmt.Errorf("%w: %s", ErrContextNotFound, targetContext)
 		}
 
-		k.kubeConfig.CurrentContext = ctxName
-		k.currentContext = ctxName
-
-		restConfig, err = clientcmd.NewDefaultClientConfig(*k.kubeConfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+		restConfig, err = clientcmd.NewNonInteractiveClientConfig(*k.kubeConfig, targetContext, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
 		if err != nil {
-			k.failedContexts[targetContext] = true
-			return fmt.Errorf("failed to create rest config: %w", err)
+			return nil, fmt.Errorf("failed to create rest config: %w", err)
 		}
 	}
 
 	restConfig.WarningHandler = rest.NoWarnings{}
-
-	clientset, err := kubernetes.NewForConfig(restConfig)
-	if err != nil {
-		k.failedContexts[targetContext] = true
-		return fmt.Errorf("failed to create clientset: %w", err)
-	}
-
-	k.config = restConfig
-	k.clientset = clientset
-	k.dynamicClient = nil
-	delete(k.failedContexts, targetContext)
-	
-	// Clear managed resources cache when context changes
-	k.managedResourcesCache = make(map[string]map[string]interface{})
-	k.managedResourcesCacheTime = make(map[string]time.Time)
-
-	if k.isInCluster() {
-		k.logger.Infof("Kubernetes client initialized with context: %s", k.currentContext)
-	} else {
-		k.logger.Infof("Kubernetes client initialized with context: %s", ctxName)
-	}
-	return nil
+	return restConfig, nil
 }
 
 func (k *KubernetesService) IsConnected(ctxName string) (bool, error) {
-	originalContext := k.GetCurrentContext()
-	
-	if err := k.SetContext(ctxName); err != nil {
-		return false, err
+	if !k.isInCluster() && ctxName == "" {
+		return false, ErrContextRequired
 	}
 
-	clientset, err := k.GetClientset()
+	clients, err := k.GetClients(ctxName)
 	if err != nil {
-		if originalContext != "" {
-			k.SetContext(originalContext)
-		}
 		return false, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err = clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: 1})
-	if originalContext != "" && originalContext != ctxName {
-		k.SetContext(originalContext)
-	}
-	
-	if err != nil {
+	if _, err := clients.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
 		return false, err
 	}
 
@@ -185,6 +190,7 @@ func (k *KubernetesService) AddKubeConfig(kubeConfigYAML string) ([]string, erro
 		if _, exists := k.kubeConfig.Contexts[name]; !exists {
 			k.kubeConfig.Contexts[name] = context
 			addedContexts = append(addedContexts, name)
+			delete(k.failedContexts, name)
 		}
 	}
 
@@ -222,6 +228,10 @@ func (k *KubernetesService) RemoveContext(ctxName string) error {
 		return err
 	}
 
+	// Registered before the unlock so the pool entry is dropped after k.mu
+	// is released; the pool takes k.mu while building clients.
+	defer k.clients.invalidate(ctxName)
+
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
@@ -234,6 +244,7 @@ func (k *KubernetesService) RemoveContext(ctxName string) error {
 	userName := context.AuthInfo
 
 	delete(k.kubeConfig.Contexts, ctxName)
+	delete(k.failedContexts, ctxName)
 
 	if k.kubeConfig.CurrentContext == ctxName {
 		if len(k.kubeConfig.Contexts) > 0 {
@@ -4,15 +4,15 @@ import (
 	"testing"
 )
 
-func TestKubernetesService_SetContext_EmptyContextWhenNotInCluster(t *testing.T) {
+func TestKubernetesService_ResolveContext_EmptyContextWhenNotInCluster(t *testing.T) {
 	logger := setupTestLogger()
 	env := setupTestEnv()
 	service := NewKubernetesService(logger, env)
 
-	err := service.SetContext("")
+	_, err := service.ResolveContext("")
 
 	if err == nil {
-		t.Error("Expected error when setting empty context and not in cluster")
+		t.Error("Expected error when resolving empty context and not in cluster")
 	}
 
 	expectedError := "context parameter is required when not running in cluster"
@@ -21,15 +21,15 @@ func TestKubernetesService_SetContext_EmptyContextWhenNotInCluster(t *testing.T)
 	}
 }
 
-func TestKubernetesService_SetContext_NonExistentContext(t *testing.T) {
+func TestKubernetesService_ResolveContext_NonExistentContext(t *testing.T) {
 	logger := setupTestLogger()
 	env := setupTestEnv()
 	service := NewKubernetesService(logger, env)
 
-	err := service.SetContext("non-existent-context")
+	_, err := service.ResolveContext("non-existent-context")
 
 	if err == nil {
-		t.Error("Expected error when setting non-existent context")
+		t.Error("Expected error when resolving non-existent context")
 	}
 
 	if err.Error() == "" {
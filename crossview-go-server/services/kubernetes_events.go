@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func (k *KubernetesService) GetEvents(kind, name, namespace, contextName string) ([]map[string]interface{}, error) {
@@ -12,24 +13,18 @@ func (k *KubernetesService) GetEvents(kind, name, namespace, contextName string)
 		return []map[string]interface{}{}, nil
 	}
 
-	if contextName != "" {
-		if err := k.SetContext(contextName); err != nil {
-			return nil, fmt.Errorf("failed to set context: %w", err)
-		}
-	} else {
-		currentContext := k.GetCurrentContext()
-		if currentContext == "" {
-			if err := k.SetContext(""); err != nil {
-				return nil, fmt.Errorf("failed to initialize kubernetes context: %w", err)
-			}
-		}
+	clients, err := k.GetClients(contextName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve context: %w", err)
 	}
 
-	clientset, err := k.GetClientset()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get clientset: %w", err)
+	eventsGVR := schema.GroupVersionResource{Version: "v1", Resource: "events"}
+	if err := k.authorize(clients, "list", eventsGVR, namespace, ""); err != nil {
+		return nil, err
 	}
 
+	clientset := clients.Clientset
+
 	fieldSelector := fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s,involvedObject.namespace=%s", kind, name, namespace)
 
 	events, err := clientset.CoreV1().Events(namespace).List(context.Background(), metav1.ListOptions{
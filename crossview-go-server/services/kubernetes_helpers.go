@@ -1,118 +1,49 @@
 package services
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
-	"strings"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
 )
 
-func (k *KubernetesService) resolvePluralName(apiVersion, kind, contextName string) (string, error) {
-	if contextName != "" {
-		if err := k.SetContext(contextName); err != nil {
-			return "", err
-		}
-	}
-
-	config, err := k.GetConfig()
-	if err != nil {
-		return "", err
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
+// ResolveResource returns the resource and scope serving kind in apiVersion
+// on contextName.
+func (k *KubernetesService) ResolveResource(contextName, apiVersion, kind, plural string) (ResourceInfo, error) {
+	clients, err := k.GetClients(contextName)
 	if err != nil {
-		return "", err
+		return ResourceInfo{}, err
 	}
+	return k.resolveResource(clients, apiVersion, kind, plural)
+}
 
-	apiVersionParts := strings.Split(apiVersion, "/")
-	if len(apiVersionParts) != 2 {
-		return "", fmt.Errorf("invalid apiVersion format")
+// resolveResource looks kind up in the context's discovery RESTMapper. An
+// explicit plural overrides the discovered resource name, and is used as-is
+// when discovery does not know the kind.
+func (k *KubernetesService) resolveResource(clients *ClusterClients, apiVersion, kind, plural string) (ResourceInfo, error) {
+	if err := validateAPIVersion(apiVersion); err != nil {
+		return ResourceInfo{}, err
 	}
-
-	group := strings.TrimSpace(apiVersionParts[0])
-
-	crdGVR := schema.GroupVersionResource{
-		Group:    "apiextensions.k8s.io",
-		Version:  "v1",
-		Resource: "customresourcedefinitions",
+	if kind == "" {
+		return ResourceInfo{}, ErrKindRequired
 	}
 
-	crdList, err := dynamicClient.Resource(crdGVR).List(context.Background(), metav1.ListOptions{})
+	gvk, err := parseGroupVersionKind(apiVersion, kind)
 	if err != nil {
-		return "", err
+		return ResourceInfo{}, err
 	}
 
-	for _, crdItem := range crdList.Items {
-		crd := crdItem.UnstructuredContent()
-		spec, _ := crd["spec"].(map[string]interface{})
-		if spec == nil {
-			continue
-		}
-
-		crdGroup, _ := spec["group"].(string)
-		if crdGroup != group {
-			continue
-		}
-
-		names, _ := spec["names"].(map[string]interface{})
-		if names == nil {
-			continue
-		}
-
-		crdKind, _ := names["kind"].(string)
-		if crdKind == kind {
-			if plural, ok := names["plural"].(string); ok && plural != "" {
-				return plural, nil
-			}
-		}
+	info, err := clients.mapper.resourceFor(gvk)
+	if plural == "" {
+		return info, err
 	}
 
-	if group == "apiextensions.crossplane.io" || strings.HasSuffix(group, ".crossplane.io") {
-		versions := []string{"v2", "v1"}
-		for _, xrdVersion := range versions {
-			xrdGVR := schema.GroupVersionResource{
-				Group:    "apiextensions.crossplane.io",
-				Version:  xrdVersion,
-				Resource: "compositeresourcedefinitions",
-			}
-
-			xrdList, err := dynamicClient.Resource(xrdGVR).List(context.Background(), metav1.ListOptions{})
-			if err == nil {
-				for _, xrdItem := range xrdList.Items {
-					xrd := xrdItem.UnstructuredContent()
-					spec, _ := xrd["spec"].(map[string]interface{})
-					if spec == nil {
-						continue
-					}
-
-					xrdGroup, _ := spec["group"].(string)
-					if xrdGroup != group {
-						continue
-					}
-
-					names, _ := spec["names"].(map[string]interface{})
-					if names == nil {
-						continue
-					}
-
-					xrdKind, _ := names["kind"].(string)
-					if xrdKind == kind {
-						if plural, ok := names["plural"].(string); ok && plural != "" {
-							return plural, nil
-						}
-					}
-				}
-			}
-		}
+	gvr := gvk.GroupVersion().WithResource(plural)
+	if err != nil {
+		return ResourceInfo{GVR: gvr, Namespaced: true}, nil
 	}
-
-	return "", fmt.Errorf("plural not found")
+	info.GVR = gvr
+	return info, nil
 }
 
 func (k *KubernetesService) objectToMap(obj interface{}) map[string]interface{} {
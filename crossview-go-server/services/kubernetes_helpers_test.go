@@ -2,6 +2,11 @@ package services
 
 import (
 	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
 )
 
 func TestKubernetesService_objectToMap_WithMap(t *testing.T) {
@@ -41,27 +46,116 @@ func TestKubernetesService_objectToMap_WithNil(t *testing.T) {
 	}
 }
 
-func TestKubernetesService_resolvePluralName_InvalidApiVersion(t *testing.T) {
+func TestKubernetesService_ResolveResource_InvalidApiVersion(t *testing.T) {
 	logger := setupTestLogger()
 	env := setupTestEnv()
 	service := NewKubernetesService(logger, env).(*KubernetesService)
 
-	_, err := service.resolvePluralName("invalid", "Kind", "")
+	_, err := service.resolveResource(setupFakeDiscoveryClients(), "a/b/c", "Kind", "")
 
 	if err == nil {
 		t.Error("Expected error for invalid apiVersion format")
 	}
 }
 
-func TestKubernetesService_resolvePluralName_EmptyApiVersion(t *testing.T) {
+func TestKubernetesService_ResolveResource_EmptyApiVersion(t *testing.T) {
 	logger := setupTestLogger()
 	env := setupTestEnv()
 	service := NewKubernetesService(logger, env).(*KubernetesService)
 
-	_, err := service.resolvePluralName("", "Kind", "")
+	_, err := service.resolveResource(setupFakeDiscoveryClients(), "", "Kind", "")
 
 	if err == nil {
 		t.Error("Expected error for empty apiVersion")
 	}
 }
 
+func TestKubernetesService_ResolveResource_UsesDiscovery(t *testing.T) {
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	service := NewKubernetesService(logger, env).(*KubernetesService)
+	clients := setupFakeDiscoveryClients()
+
+	tests := []struct {
+		apiVersion string
+		kind       string
+		resource   string
+		namespaced bool
+	}{
+		{"networking.k8s.io/v1", "NetworkPolicy", "networkpolicies", true},
+		{"v1", "Namespace", "namespaces", false},
+		{"example.crossplane.io/v1alpha1", "XDatabase", "xdatabases", false},
+		{"example.crossplane.io/v1alpha1", "Database", "databases", true},
+	}
+
+	for _, tt := range tests {
+		info, err := service.resolveResource(clients, tt.apiVersion, tt.kind, "")
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %v", tt.kind, err)
+			continue
+		}
+		if info.GVR.Resource != tt.resource {
+			t.Errorf("Expected resource '%s' for %s, got '%s'", tt.resource, tt.kind, info.GVR.Resource)
+		}
+		if info.Namespaced != tt.namespaced {
+			t.Errorf("Expected namespaced=%t for %s, got %t", tt.namespaced, tt.kind, info.Namespaced)
+		}
+	}
+}
+
+func TestKubernetesService_ResolveResource_UnknownKind(t *testing.T) {
+	logger := setupTestLogger()
+	env := setupTestEnv()
+	service := NewKubernetesService(logger, env).(*KubernetesService)
+	clients := setupFakeDiscoveryClients()
+
+	_, err := service.resolveResource(clients, "example.crossplane.io/v1alpha1", "Missing", "")
+	if !meta.IsNoMatchError(err) {
+		t.Errorf("Expected no match error, got %v", err)
+	}
+
+	info, err := service.resolveResource(clients, "example.crossplane.io/v1alpha1", "Missing", "missings")
+	if err != nil {
+		t.Fatalf("Expected explicit plural to be used, got error: %v", err)
+	}
+	if info.GVR.Resource != "missings" {
+		t.Errorf("Expected resource 'missings', got '%s'", info.GVR.Resource)
+	}
+}
+
+func setupFakeDiscoveryClients() *ClusterClients {
+	fakeDiscovery := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}}
+	fakeDiscovery.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Kind: "Namespace", Namespaced: false},
+				{Name: "secrets", Kind: "Secret", Namespaced: true},
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "networkpolicies", Kind: "NetworkPolicy", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "example.crossplane.io/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "xdatabases", Kind: "XDatabase", Namespaced: false},
+				{Name: "databases", Kind: "Database", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "s3.aws.upbound.io/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "buckets", Kind: "Bucket", Namespaced: false},
+			},
+		},
+	}
+	return &ClusterClients{
+		Discovery: fakeDiscovery,
+		mapper:    newResourceMapper(fakeDiscovery, nil),
+	}
+}
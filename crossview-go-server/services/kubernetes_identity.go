@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	AuthorizationServiceAccount      = "service-account"
+	AuthorizationImpersonate         = "impersonate"
+	AuthorizationSubjectAccessReview = "subjectaccessreview"
+
+	accessReviewTTL = 30 * time.Second
+)
+
+// Identity is the Crossview user a request is made for, as Kubernetes sees
+// them.
+type Identity struct {
+	Username string
+	Groups   []string
+}
+
+func (i *Identity) key() string {
+	groups := append([]string(nil), i.Groups...)
+	sort.Strings(groups)
+	return i.Username + "\x00" + strings.Join(groups, ",")
+}
+
+// WithIdentity returns a view of the service that acts for identity. With
+// impersonation, its clients send Impersonate-User and Impersonate-Group
+// headers; with subject access review, every read is checked against the
+// cluster's RBAC first. With the default service account mode, or without an
+// identity, the service itself is returned.
+func (k *KubernetesService) WithIdentity(identity *Identity) KubernetesServiceInterface {
+	if identity == nil || identity.Username == "" || k.authorizationMode() == AuthorizationServiceAccount {
+		return k
+	}
+	scoped := *k
+	scoped.identity = identity
+	return &scoped
+}
+
+func (k *KubernetesService) authorizationMode() string {
+	switch strings.ToLower(k.env.KubernetesAuthorization) {
+	case AuthorizationImpersonate:
+		return AuthorizationImpersonate
+	case AuthorizationSubjectAccessReview:
+		return AuthorizationSubjectAccessReview
+	default:
+		return AuthorizationServiceAccount
+	}
+}
+
+func (k *KubernetesService) impersonating() bool {
+	return k.identity != nil && k.authorizationMode() == AuthorizationImpersonate
+}
+
+// Authorize checks that the service's identity may perform verb on the
+// resource. It only does work in subject access review mode; impersonated
+// requests are authorized by the API server itself.
+func (k *KubernetesService) Authorize(contextName, verb string, info ResourceInfo, namespace, name string) error {
+	if k.identity == nil || k.authorizationMode() != AuthorizationSubjectAccessReview {
+		return nil
+	}
+	clients, err := k.GetClients(contextName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve context: %w", err)
+	}
+	return k.authorize(clients, verb, info.GVR, namespace, name)
+}
+
+func (k *KubernetesService) authorize(clients *ClusterClients, verb string, gvr schema.GroupVersionResource, namespace, name string) error {
+	if k.identity == nil || k.authorizationMode() != AuthorizationSubjectAccessReview {
+		return nil
+	}
+
+	attributes := &authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      verb,
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Name:      name,
+	}
+	cacheKey := strings.Join([]string{clients.Context, k.identity.key(), verb, gvr.String(), namespace, name}, "\x00")
+
+	allowed, reason, cached := k.accessReviews.get(cacheKey)
+	if !cached {
+		review := &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:               k.identity.Username,
+				Groups:             k.identity.Groups,
+				ResourceAttributes: attributes,
+			},
+		}
+		result, err := clients.Clientset.AuthorizationV1().SubjectAccessReviews().Create(context.Background(), review, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to review access: %w", err)
+		}
+		allowed, reason = result.Status.Allowed, result.Status.Reason
+		k.accessReviews.set(cacheKey, allowed, reason)
+	}
+
+	if !allowed {
+		if reason == "" {
+			reason = fmt.Sprintf("user %q cannot %s %s", k.identity.Username, verb, gvr.GroupResource())
+		}
+		return apierrors.NewForbidden(gvr.GroupResource(), name, fmt.Errorf("%s", reason))
+	}
+	return nil
+}
+
+// accessReviewCache remembers subject access review decisions briefly, so a
+// page that lists many kinds does not send a review per request.
+type accessReviewCache struct {
+	ttl     time.Duration
+	entries map[string]accessReviewEntry
+	mu      sync.Mutex
+}
+
+type accessReviewEntry struct {
+	allowed bool
+	reason  string
+	expires time.Time
+}
+
+func newAccessReviewCache(ttl time.Duration) *accessReviewCache {
+	return &accessReviewCache{
+		ttl:     ttl,
+		entries: make(map[string]accessReviewEntry),
+	}
+}
+
+func (c *accessReviewCache) get(key string) (bool, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, exists := c.entries[key]
+	if !exists || time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return false, "", false
+	}
+	return entry.allowed, entry.reason, true
+}
+
+func (c *accessReviewCache) set(key string, allowed bool, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = accessReviewEntry{allowed: allowed, reason: reason, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newIdentityTestService(mode string) *KubernetesService {
+	env := setupTestEnv()
+	env.KubernetesAuthorization = mode
+	return NewKubernetesService(setupTestLogger(), env).(*KubernetesService)
+}
+
+func TestKubernetesService_WithIdentity_ServiceAccountMode(t *testing.T) {
+	service := newIdentityTestService(AuthorizationServiceAccount)
+
+	scoped := service.WithIdentity(&Identity{Username: "alice"})
+	if scoped != KubernetesServiceInterface(service) {
+		t.Error("Expected service account mode to ignore the identity")
+	}
+}
+
+func TestKubernetesService_WithIdentity_SharesState(t *testing.T) {
+	setupTestKubeConfig(t)
+	service := newIdentityTestService(AuthorizationImpersonate)
+
+	scoped := service.WithIdentity(&Identity{Username: "alice"}).(*KubernetesService)
+	if scoped == service {
+		t.Fatal("Expected a scoped copy of the service")
+	}
+
+	if _, err := service.GetClients("context-b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, exists := scoped.clients.peek("context-b"); !exists {
+		t.Error("Expected scoped service to share the client pool")
+	}
+}
+
+func TestKubernetesService_GetClients_Impersonates(t *testing.T) {
+	setupTestKubeConfig(t)
+	service := newIdentityTestService(AuthorizationImpersonate)
+
+	base, err := service.GetClients("context-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if base.Config.Impersonate.UserName != "" {
+		t.Error("Expected base clients not to impersonate")
+	}
+
+	identity := &Identity{Username: "alice", Groups: []string{"platform", "dev"}}
+	scoped := service.WithIdentity(identity)
+	clients, err := scoped.GetClients("context-a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if clients.Config.Impersonate.UserName != "alice" || len(clients.Config.Impersonate.Groups) != 2 {
+		t.Errorf("Unexpected impersonation config: %+v", clients.Config.Impersonate)
+	}
+	if clients.Context != "context-a" {
+		t.Errorf("Expected context 'context-a', got %q", clients.Context)
+	}
+	if clients.mapper != base.mapper {
+		t.Error("Expected impersonated clients to share the context's mapper")
+	}
+
+	again, _ := service.WithIdentity(&Identity{Username: "alice", Groups: []string{"dev", "platform"}}).GetClients("context-a")
+	if again != clients {
+		t.Error("Expected impersonated clients to be cached per identity")
+	}
+
+	if len(service.clients.entries) != 1 {
+		t.Errorf("Expected impersonated clients to be kept off the context pool, got %d entries", len(service.clients.entries))
+	}
+
+	service.clients.invalidate("context-a")
+	if len(service.clients.entries) != 0 {
+		t.Errorf("Expected invalidate to drop the context's clients, %d left", len(service.clients.entries))
+	}
+	if len(base.identities.entries) != 0 {
+		t.Errorf("Expected invalidate to drop impersonated clients, %d left", len(base.identities.entries))
+	}
+}
+
+func TestKubernetesService_SubjectAccessReview(t *testing.T) {
+	service := newIdentityTestService(AuthorizationSubjectAccessReview)
+	fakeClients := setupFakeClusterClients(service, "fake",
+		newTestObject("v1", "ConfigMap", "default", "settings"),
+	)
+
+	reviews := 0
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "alice" && review.Spec.ResourceAttributes.Verb == "get"
+		return true, review, nil
+	})
+	fakeClients.Clientset = clientset
+
+	alice := service.WithIdentity(&Identity{Username: "alice"})
+	if _, err := alice.GetResource("v1", "ConfigMap", "settings", "default", "fake", ""); err != nil {
+		t.Fatalf("Expected alice to get the config map, got %v", err)
+	}
+	if _, err := alice.GetResource("v1", "ConfigMap", "settings", "default", "fake", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reviews != 1 {
+		t.Errorf("Expected the decision to be cached, got %d reviews", reviews)
+	}
+
+	_, err := alice.GetResources("v1", "ConfigMap", "default", "fake", "", nil, "")
+	if !apierrors.IsForbidden(err) {
+		t.Errorf("Expected alice to be forbidden from listing, got %v", err)
+	}
+
+	bob := service.WithIdentity(&Identity{Username: "bob"})
+	_, err = bob.GetResource("v1", "ConfigMap", "settings", "default", "fake", "")
+	if !apierrors.IsForbidden(err) {
+		t.Errorf("Expected bob to be forbidden, got %v", err)
+	}
+
+	if _, err := service.GetResources("v1", "ConfigMap", "default", "fake", "", nil, ""); err != nil {
+		t.Errorf("Expected requests without an identity to skip review, got %v", err)
+	}
+}
+
+func TestKubernetesService_SubjectAccessReview_ManagedResources(t *testing.T) {
+	service := newIdentityTestService(AuthorizationSubjectAccessReview)
+	fakeClients := setupFakeClusterClients(service, "fake")
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.ResourceAttributes.Resource != "customresourcedefinitions"
+		return true, review, nil
+	})
+	fakeClients.Clientset = clientset
+
+	alice := service.WithIdentity(&Identity{Username: "alice"})
+	if _, err := alice.GetManagedResources("fake", true); !apierrors.IsForbidden(err) {
+		t.Errorf("Expected listing CRDs to be reviewed, got %v", err)
+	}
+}
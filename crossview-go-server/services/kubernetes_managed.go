@@ -7,30 +7,26 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
 )
 
 func (k *KubernetesService) GetManagedResources(contextName string, forceRefresh bool) (map[string]interface{}, error) {
-	if contextName != "" {
-		if err := k.SetContext(contextName); err != nil {
-			return nil, fmt.Errorf("failed to set context: %w", err)
-		}
-	} else {
-		currentContext := k.GetCurrentContext()
-		if currentContext == "" {
-			if err := k.SetContext(""); err != nil {
-				return nil, fmt.Errorf("failed to initialize kubernetes context: %w", err)
-			}
-		}
-		contextName = k.GetCurrentContext()
+	clients, err := k.GetClients(contextName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve context: %w", err)
+	}
+	contextName = clients.Context
+
+	// Results depend on what the identity may see, so cache them per identity
+	cacheKey := contextName
+	if k.identity != nil {
+		cacheKey = contextName + "\x00" + k.identity.key()
 	}
 
 	// Check cache if not forcing refresh
 	if !forceRefresh {
 		k.mu.RLock()
-		if cachedResult, exists := k.managedResourcesCache[contextName]; exists {
-			if cacheTime, timeExists := k.managedResourcesCacheTime[contextName]; timeExists {
+		if cachedResult, exists := k.managedResourcesCache[cacheKey]; exists {
+			if cacheTime, timeExists := k.managedResourcesCacheTime[cacheKey]; timeExists {
 				if time.Since(cacheTime) < k.managedResourcesCacheTTL {
 					k.logger.Infof("Returning cached managed resources for context: %s", contextName)
 					// Create a copy with fromCache: true
@@ -49,15 +45,7 @@ func (k *KubernetesService) GetManagedResources(contextName string, forceRefresh
 
 	k.logger.Infof("Fetching fresh managed resources for context: %s (forceRefresh: %t)", contextName, forceRefresh)
 
-	config, err := k.GetConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get kubernetes config: %w", err)
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
-	}
+	dynamicClient := clients.Dynamic
 
 	providersResult, err := k.GetResources("pkg.crossplane.io/v1", "Provider", "", contextName, "", nil, "")
 	if err != nil {
@@ -117,10 +105,8 @@ func (k *KubernetesService) GetManagedResources(contextName string, forceRefresh
 		}
 	}
 
-	crdGVR := schema.GroupVersionResource{
-		Group:    "apiextensions.k8s.io",
-		Version:  "v1",
-		Resource: "customresourcedefinitions",
+	if err := k.authorize(clients, "list", crdGVR, "", ""); err != nil {
+		return nil, err
 	}
 	crdList, err := dynamicClient.Resource(crdGVR).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
@@ -285,8 +271,8 @@ func (k *KubernetesService) GetManagedResources(contextName string, forceRefresh
 	}
 
 	k.mu.Lock()
-	k.managedResourcesCache[contextName] = result
-	k.managedResourcesCacheTime[contextName] = time.Now()
+	k.managedResourcesCache[cacheKey] = result
+	k.managedResourcesCacheTime[cacheKey] = time.Now()
 	k.mu.Unlock()
 
 	k.logger.Infof("Cached managed resources for context: %s (%d items)", contextName, len(allResources))
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+)
+
+var crdGVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// ResourceInfo describes how a kind is served by the API server.
+type ResourceInfo struct {
+	GVR        schema.GroupVersionResource
+	Namespaced bool
+}
+
+// resourceMapper resolves kinds to resources through a cached discovery
+// RESTMapper. Built-ins, CRDs and the CRDs Crossplane generates for XRDs all
+// come from discovery, so one lookup covers every kind. The cache is reset
+// whenever a CRD is added, changed or removed.
+type resourceMapper struct {
+	dynamicClient dynamic.Interface
+	cached        discovery.CachedDiscoveryInterface
+	mapper        *restmapper.DeferredDiscoveryRESTMapper
+	watchOnce     sync.Once
+	stop          chan struct{}
+	stopOnce      sync.Once
+}
+
+func newResourceMapper(discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface) *resourceMapper {
+	cached := memory.NewMemCacheClient(discoveryClient)
+	return &resourceMapper{
+		dynamicClient: dynamicClient,
+		cached:        cached,
+		mapper:        restmapper.NewDeferredDiscoveryRESTMapper(cached),
+		stop:          make(chan struct{}),
+	}
+}
+
+// resourceFor maps gvk to its resource and scope.
+func (m *resourceMapper) resourceFor(gvk schema.GroupVersionKind) (ResourceInfo, error) {
+	m.watchOnce.Do(m.watchCRDs)
+
+	mapping, err := m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return ResourceInfo{}, err
+	}
+
+	return ResourceInfo{
+		GVR:        mapping.Resource,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
+
+func (m *resourceMapper) reset() {
+	m.mapper.Reset()
+}
+
+// watchCRDs resets the mapper on CRD changes so new kinds resolve without
+// waiting for a cache miss.
+func (m *resourceMapper) watchCRDs() {
+	if m.dynamicClient == nil {
+		return
+	}
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(m.dynamicClient, 10*time.Minute)
+	informer := factory.ForResource(crdGVR).Informer()
+	informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if !isInInitialList {
+				m.reset()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCRD, okOld := oldObj.(*unstructured.Unstructured)
+			newCRD, okNew := newObj.(*unstructured.Unstructured)
+			if okOld && okNew && oldCRD.GetGeneration() == newCRD.GetGeneration() {
+				return
+			}
+			m.reset()
+		},
+		DeleteFunc: func(obj interface{}) {
+			m.reset()
+		},
+	})
+
+	go informer.Run(m.stop)
+}
+
+func (m *resourceMapper) close() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+}
+
+func parseGroupVersionKind(apiVersion, kind string) (schema.GroupVersionKind, error) {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("%w: %s: %w", ErrInvalidAPIVersion, apiVersion, err)
+	}
+	return gv.WithKind(kind), nil
+}
@@ -6,82 +6,43 @@ import (
 	"fmt"
 	"strings"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/client-go/dynamic"
 )
 
 func (k *KubernetesService) GetResources(apiVersion, kind, namespace, contextName, plural string, limit *int64, continueToken string) (map[string]interface{}, error) {
-	if contextName != "" {
-		if err := k.SetContext(contextName); err != nil {
-			return nil, fmt.Errorf("failed to set context: %w", err)
-		}
-	} else {
-		currentContext := k.GetCurrentContext()
-		if currentContext == "" {
-			if err := k.SetContext(""); err != nil {
-				return nil, fmt.Errorf("failed to initialize kubernetes context: %w", err)
-			}
-		}
-	}
-
-	config, err := k.GetConfig()
+	clients, err := k.GetClients(contextName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get kubernetes config: %w", err)
+		return nil, fmt.Errorf("failed to resolve context: %w", err)
 	}
 
-	if apiVersion == "" {
-		return nil, fmt.Errorf("apiVersion is required")
+	if err := validateAPIVersion(apiVersion); err != nil {
+		return nil, err
 	}
 
-	apiVersionParts := strings.Split(apiVersion, "/")
-	if len(apiVersionParts) != 2 {
-		return nil, fmt.Errorf("invalid apiVersion format: %s, expected group/version", apiVersion)
-	}
-
-	group := strings.TrimSpace(apiVersionParts[0])
-	version := strings.TrimSpace(apiVersionParts[1])
-
-	if group == "" {
-		return nil, fmt.Errorf("invalid apiVersion format: %s, group is required", apiVersion)
-	}
-	if version == "" {
-		return nil, fmt.Errorf("invalid apiVersion format: %s, version is required", apiVersion)
-	}
-
-	if plural == "" {
-		cacheKey := fmt.Sprintf("%s/%s", apiVersion, kind)
-		k.mu.RLock()
-		cachedPlural, exists := k.pluralCache[cacheKey]
-		k.mu.RUnlock()
-		
-		if exists {
-			plural = cachedPlural
-		} else {
-			resolvedPlural, err := k.resolvePluralName(apiVersion, kind, contextName)
-			if err == nil && resolvedPlural != "" {
-				plural = resolvedPlural
-				k.mu.Lock()
-				k.pluralCache[cacheKey] = plural
-				k.mu.Unlock()
-			} else {
-				plural = strings.ToLower(kind) + "s"
-			}
+	info, err := k.resolveResource(clients, apiVersion, kind, plural)
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return map[string]interface{}{
+				"items":              []interface{}{},
+				"continueToken":      nil,
+				"remainingItemCount": nil,
+			}, nil
 		}
+		return nil, fmt.Errorf("failed to resolve resource: %w", err)
 	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	if !info.Namespaced || namespace == "undefined" || namespace == "null" {
+		namespace = ""
 	}
-
-	gvr := schema.GroupVersionResource{
-		Group:    group,
-		Version:  version,
-		Resource: plural,
+	if err := k.authorize(clients, "list", info.GVR, namespace, ""); err != nil {
+		return nil, err
 	}
 
+	dynamicClient := clients.Dynamic
+	gvr := info.GVR
+
 	listOptions := metav1.ListOptions{}
 	if continueToken != "" {
 		listOptions.Continue = continueToken
@@ -158,159 +119,37 @@ func (k *KubernetesService) GetResources(apiVersion, kind, namespace, contextNam
 }
 
 func (k *KubernetesService) GetResource(apiVersion, kind, name, namespace, contextName, plural string) (map[string]interface{}, error) {
-	if contextName != "" {
-		if err := k.SetContext(contextName); err != nil {
-			return nil, fmt.Errorf("failed to set context: %w", err)
-		}
-	} else {
-		currentContext := k.GetCurrentContext()
-		if currentContext == "" {
-			if err := k.SetContext(""); err != nil {
-				return nil, fmt.Errorf("failed to initialize kubernetes context: %w", err)
-			}
-		}
-	}
-
-	config, err := k.GetConfig()
+	clients, err := k.GetClients(contextName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get kubernetes config: %w", err)
+		return nil, fmt.Errorf("failed to resolve context: %w", err)
 	}
 
-	if apiVersion == "" {
-		return nil, fmt.Errorf("apiVersion is required")
+	if err := validateAPIVersion(apiVersion); err != nil {
+		return nil, err
 	}
 	if kind == "" {
-		return nil, fmt.Errorf("kind is required")
+		return nil, ErrKindRequired
 	}
 	if name == "" {
-		return nil, fmt.Errorf("name is required")
+		return nil, ErrNameRequired
 	}
 
-	clientset, err := k.GetClientset()
+	info, err := k.resolveResource(clients, apiVersion, kind, plural)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get clientset: %w", err)
-	}
-
-	if apiVersion == "v1" {
-		if namespace != "" && namespace != "undefined" && namespace != "null" {
-			switch kind {
-			case "Service":
-				svc, err := clientset.CoreV1().Services(namespace).Get(context.Background(), name, metav1.GetOptions{})
-				if err != nil {
-					return nil, fmt.Errorf("failed to get service: %w", err)
-				}
-				return k.objectToMap(svc), nil
-			case "Pod":
-				pod, err := clientset.CoreV1().Pods(namespace).Get(context.Background(), name, metav1.GetOptions{})
-				if err != nil {
-					return nil, fmt.Errorf("failed to get pod: %w", err)
-				}
-				return k.objectToMap(pod), nil
-			case "ConfigMap":
-				cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{})
-				if err != nil {
-					return nil, fmt.Errorf("failed to get configmap: %w", err)
-				}
-				return k.objectToMap(cm), nil
-			case "Secret":
-				secret, err := clientset.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{})
-				if err != nil {
-					return nil, fmt.Errorf("failed to get secret: %w", err)
-				}
-				return k.objectToMap(secret), nil
-			}
-		} else {
-			switch kind {
-			case "Namespace":
-				ns, err := clientset.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
-				if err != nil {
-					return nil, fmt.Errorf("failed to get namespace: %w", err)
-				}
-				return k.objectToMap(ns), nil
-			case "Node":
-				node, err := clientset.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
-				if err != nil {
-					return nil, fmt.Errorf("failed to get node: %w", err)
-				}
-				return k.objectToMap(node), nil
-			case "PersistentVolume":
-				pv, err := clientset.CoreV1().PersistentVolumes().Get(context.Background(), name, metav1.GetOptions{})
-				if err != nil {
-					return nil, fmt.Errorf("failed to get persistentvolume: %w", err)
-				}
-				return k.objectToMap(pv), nil
-			}
+		if meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("%w: %s/%s", ErrResourceNotFound, kind, name)
 		}
+		return nil, fmt.Errorf("failed to resolve resource: %w", err)
 	}
-
-	if apiVersion == "apps/v1" && namespace != "" && namespace != "undefined" && namespace != "null" {
-		switch kind {
-		case "Deployment":
-			deploy, err := clientset.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
-			if err != nil {
-				return nil, fmt.Errorf("failed to get deployment: %w", err)
-			}
-			return k.objectToMap(deploy), nil
-		case "StatefulSet":
-			sts, err := clientset.AppsV1().StatefulSets(namespace).Get(context.Background(), name, metav1.GetOptions{})
-			if err != nil {
-				return nil, fmt.Errorf("failed to get statefulset: %w", err)
-			}
-			return k.objectToMap(sts), nil
-		case "DaemonSet":
-			ds, err := clientset.AppsV1().DaemonSets(namespace).Get(context.Background(), name, metav1.GetOptions{})
-			if err != nil {
-				return nil, fmt.Errorf("failed to get daemonset: %w", err)
-			}
-			return k.objectToMap(ds), nil
-		case "ReplicaSet":
-			rs, err := clientset.AppsV1().ReplicaSets(namespace).Get(context.Background(), name, metav1.GetOptions{})
-			if err != nil {
-				return nil, fmt.Errorf("failed to get replicaset: %w", err)
-			}
-			return k.objectToMap(rs), nil
-		}
+	if !info.Namespaced || namespace == "undefined" || namespace == "null" {
+		namespace = ""
 	}
-
-	apiVersionParts := strings.Split(apiVersion, "/")
-	if len(apiVersionParts) != 2 {
-		return nil, fmt.Errorf("invalid apiVersion format: %s, expected group/version", apiVersion)
+	if err := k.authorize(clients, "get", info.GVR, namespace, name); err != nil {
+		return nil, err
 	}
 
-	group := strings.TrimSpace(apiVersionParts[0])
-	version := strings.TrimSpace(apiVersionParts[1])
-
-	if plural == "" {
-		cacheKey := fmt.Sprintf("%s/%s", apiVersion, kind)
-		k.mu.RLock()
-		cachedPlural, exists := k.pluralCache[cacheKey]
-		k.mu.RUnlock()
-		
-		if exists {
-			plural = cachedPlural
-		} else {
-			resolvedPlural, err := k.resolvePluralName(apiVersion, kind, contextName)
-			if err == nil && resolvedPlural != "" {
-				plural = resolvedPlural
-				k.mu.Lock()
-				k.pluralCache[cacheKey] = plural
-				k.mu.Unlock()
-			} else {
-				plural = strings.ToLower(kind) + "s"
-			}
-		}
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
-	}
-
-	gvr := schema.GroupVersionResource{
-		Group:    group,
-		Version:  version,
-		Resource: plural,
-	}
+	dynamicClient := clients.Dynamic
+	gvr := info.GVR
 
 	var obj interface{}
 	if namespace != "" && namespace != "undefined" && namespace != "null" {
@@ -320,8 +159,8 @@ func (k *KubernetesService) GetResource(apiVersion, kind, name, namespace, conte
 	}
 
 	if err != nil {
-		if strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "NotFound") {
-			return nil, fmt.Errorf("resource not found: %s/%s", kind, name)
+		if apierrors.IsNotFound(err) || strings.Contains(err.Error(), "404") || strings.Contains(err.Error(), "NotFound") {
+			return nil, fmt.Errorf("%w: %s/%s", ErrResourceNotFound, kind, name)
 		}
 		return nil, fmt.Errorf("failed to get resource: %w", err)
 	}
@@ -341,3 +180,29 @@ func (k *KubernetesService) GetResource(apiVersion, kind, name, namespace, conte
 	return k.objectToMap(obj), nil
 }
 
+
+// validateAPIVersion accepts "version" for the core group and
+// "group/version" for every other group.
+func validateAPIVersion(apiVersion string) error {
+	if apiVersion == "" {
+		return ErrAPIVersionRequired
+	}
+
+	apiVersionParts := strings.Split(apiVersion, "/")
+	switch len(apiVersionParts) {
+	case 1:
+		if strings.TrimSpace(apiVersionParts[0]) == "" {
+			return fmt.Errorf("%w: %s, version is required", ErrInvalidAPIVersion, apiVersion)
+		}
+	case 2:
+		if strings.TrimSpace(apiVersionParts[0]) == "" {
+			return fmt.Errorf("%w: %s, group is required", ErrInvalidAPIVersion, apiVersion)
+		}
+		if strings.TrimSpace(apiVersionParts[1]) == "" {
+			return fmt.Errorf("%w: %s, version is required", ErrInvalidAPIVersion, apiVersion)
+		}
+	default:
+		return fmt.Errorf("%w: %s, expected version or group/version", ErrInvalidAPIVersion, apiVersion)
+	}
+	return nil
+}
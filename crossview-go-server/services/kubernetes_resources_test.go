@@ -30,13 +30,13 @@ func TestKubernetesService_GetResources_InvalidApiVersion(t *testing.T) {
 	env := setupTestEnv()
 	service := NewKubernetesService(logger, env)
 
-	_, err := service.GetResources("invalid", "Kind", "", "test-context", "", nil, "")
+	_, err := service.GetResources("a/b/c", "Kind", "", "test-context", "", nil, "")
 
 	if err == nil {
 		t.Error("Expected error for invalid apiVersion format")
 	}
 
-	expectedError := "invalid apiVersion format: invalid, expected group/version"
+	expectedError := "invalid apiVersion format: a/b/c, expected version or group/version"
 	if err.Error() != expectedError && !contains(err.Error(), "context") {
 		t.Errorf("Expected '%s' or context error, got '%s'", expectedError, err.Error())
 	}
@@ -129,15 +129,78 @@ func TestKubernetesService_GetResource_InvalidApiVersion(t *testing.T) {
 	env := setupTestEnv()
 	service := NewKubernetesService(logger, env)
 
-	_, err := service.GetResource("invalid", "Kind", "name", "", "test-context", "")
+	_, err := service.GetResource("a/b/c", "Kind", "name", "", "test-context", "")
 
 	if err == nil {
 		t.Error("Expected error for invalid apiVersion format")
 	}
 
-	expectedError := "invalid apiVersion format: invalid, expected group/version"
+	expectedError := "invalid apiVersion format: a/b/c, expected version or group/version"
 	if err.Error() != expectedError && !contains(err.Error(), "context") {
 		t.Errorf("Expected '%s' or context error, got '%s'", expectedError, err.Error())
 	}
 }
 
+
+func TestValidateAPIVersion(t *testing.T) {
+	tests := []struct {
+		apiVersion string
+		valid      bool
+	}{
+		{"v1", true},
+		{"apps/v1", true},
+		{"pkg.crossplane.io/v1", true},
+		{"", false},
+		{"/v1", false},
+		{"apps/", false},
+		{"a/b/c", false},
+	}
+
+	for _, tt := range tests {
+		err := validateAPIVersion(tt.apiVersion)
+		if tt.valid && err != nil {
+			t.Errorf("Expected '%s' to be valid, got '%s'", tt.apiVersion, err.Error())
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("Expected '%s' to be invalid", tt.apiVersion)
+		}
+	}
+}
+
+func TestKubernetesService_GetResources_CoreGroup(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	setupFakeClusterClients(service, "fake",
+		newTestObject("v1", "Secret", "default", "db-conn"),
+		newTestObject("v1", "Secret", "other", "api-conn"),
+	)
+
+	result, err := service.GetResources("v1", "Secret", "default", "fake", "", nil, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	items, _ := result["items"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 secret, got %d", len(items))
+	}
+}
+
+func TestKubernetesService_GetResource_CoreGroup(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	setupFakeClusterClients(service, "fake",
+		newTestObject("v1", "ConfigMap", "default", "settings"),
+	)
+
+	resource, err := service.GetResource("v1", "ConfigMap", "settings", "default", "fake", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resource["kind"] != "ConfigMap" {
+		t.Errorf("Expected kind 'ConfigMap', got '%v'", resource["kind"])
+	}
+
+	_, err = service.GetResource("v1", "ConfigMap", "missing", "default", "fake", "")
+	if err == nil || !contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
@@ -1,9 +1,9 @@
 package services
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,11 +14,13 @@ import (
 )
 
 type KubernetesServiceInterface interface {
-	SetContext(ctxName string) error
 	GetCurrentContext() string
+	ResolveContext(ctxName string) (string, error)
 	GetContexts() ([]string, error)
 	GetClientset() (kubernetes.Interface, error)
 	GetConfig() (*rest.Config, error)
+	GetClients(ctxName string) (*ClusterClients, error)
+	ResolveResource(contextName, apiVersion, kind, plural string) (ResourceInfo, error)
 	IsConnected(ctxName string) (bool, error)
 	AddKubeConfig(kubeConfigYAML string) ([]string, error)
 	RemoveContext(ctxName string) error
@@ -26,45 +28,58 @@ type KubernetesServiceInterface interface {
 	ClearManagedResourcesCache(contextName string)
 	GetResources(apiVersion, kind, namespace, contextName, plural string, limit *int64, continueToken string) (map[string]interface{}, error)
 	GetResource(apiVersion, kind, name, namespace, contextName, plural string) (map[string]interface{}, error)
+	ApplyResource(contextName string, manifest map[string]interface{}, opts ApplyOptions) (map[string]interface{}, error)
+	PatchResource(apiVersion, kind, name, namespace, contextName string, patch []byte, dryRun bool) (map[string]interface{}, error)
+	DeleteResource(apiVersion, kind, name, namespace, contextName string, opts DeleteOptions) error
+	RunResourceAction(apiVersion, kind, name, namespace, contextName string, action ResourceAction, includeComposed bool) (*ResourceActionResult, error)
+	GetResourceTrace(apiVersion, kind, name, namespace, contextName string) (*TraceNode, error)
 	GetEvents(kind, name, namespace, contextName string) ([]map[string]interface{}, error)
 	GetManagedResources(contextName string, forceRefresh bool) (map[string]interface{}, error)
+	WithIdentity(identity *Identity) KubernetesServiceInterface
+	Authorize(contextName, verb string, info ResourceInfo, namespace, name string) error
 }
 
+// KubernetesService is safe to copy: WithIdentity returns copies that share
+// kubernetesState and differ only in the identity they act for.
 type KubernetesService struct {
+	*kubernetesState
+	identity *Identity
+}
+
+type kubernetesState struct {
 	logger        lib.Logger
 	env           lib.Env
-	currentContext string
 	kubeConfig    *api.Config
-	clientset     kubernetes.Interface
-	config        *rest.Config
-	dynamicClient interface{}
-	pluralCache   map[string]string
+	clients       *clientPool
 	failedContexts map[string]bool
 	
 	// Managed resources cache
 	managedResourcesCache map[string]map[string]interface{}
 	managedResourcesCacheTime map[string]time.Time
 	managedResourcesCacheTTL time.Duration
+
+	accessReviews *accessReviewCache
 	
 	mu            sync.RWMutex
 }
 
 func NewKubernetesService(logger lib.Logger, env lib.Env) KubernetesServiceInterface {
-	service := &KubernetesService{
+	service := &KubernetesService{kubernetesState: &kubernetesState{
 		logger:        logger,
 		env:           env,
-		pluralCache:   make(map[string]string),
+		clients:       newClientPool(defaultClientIdleTTL, defaultMaxClients),
 		failedContexts: make(map[string]bool),
 		managedResourcesCache: make(map[string]map[string]interface{}),
 		managedResourcesCacheTime: make(map[string]time.Time),
 		managedResourcesCacheTTL: 5 * time.Minute, // 5 minute TTL
-	}
+		accessReviews: newAccessReviewCache(accessReviewTTL),
+	}}
 
 	serviceAccountPath := "/var/run/secrets/kubernetes.io/serviceaccount"
 	if fileExists(serviceAccountPath) && 
 		fileExists(filepath.Join(serviceAccountPath, "token")) &&
 		fileExists(filepath.Join(serviceAccountPath, "ca.crt")) {
-		if err := service.SetContext(""); err != nil {
+		if _, err := service.GetClients(""); err != nil {
 			logger.Warnf("Failed to auto-initialize Kubernetes service account: %s", err.Error())
 		} else {
 			logger.Info("Kubernetes service initialized with service account (in-cluster mode)")
@@ -74,10 +89,14 @@ func NewKubernetesService(logger lib.Logger, env lib.Env) KubernetesServiceInter
 	return service
 }
 
+// GetCurrentContext returns the context requests use when they name none:
+// "in-cluster" inside the cluster, and none outside it, where each caller
+// keeps its own preference and names it on every request.
 func (k *KubernetesService) GetCurrentContext() string {
-	k.mu.RLock()
-	defer k.mu.RUnlock()
-	return k.currentContext
+	if k.isInCluster() {
+		return "in-cluster"
+	}
+	return ""
 }
 
 func (k *KubernetesService) GetContexts() ([]string, error) {
@@ -106,24 +125,27 @@ func (k *KubernetesService) GetContexts() ([]string, error) {
 	return contexts, nil
 }
 
+// GetClientset returns the clientset of the in-cluster context.
 func (k *KubernetesService) GetClientset() (kubernetes.Interface, error) {
-	k.mu.RLock()
-	defer k.mu.RUnlock()
-
-	if k.clientset == nil {
-		return nil, fmt.Errorf("kubernetes client not initialized, call SetContext first")
+	clients, err := k.GetClients("")
+	if err != nil {
+		return nil, err
 	}
-	return k.clientset, nil
+	return clients.Clientset, nil
 }
 
+// GetConfig returns the rest config of the in-cluster context.
 func (k *KubernetesService) GetConfig() (*rest.Config, error) {
-	k.mu.RLock()
-	defer k.mu.RUnlock()
-
-	if k.config == nil {
-		return nil, fmt.Errorf("kubernetes config not initialized, call SetContext first")
+	clients, err := k.GetClients("")
+	if err != nil {
+		return nil, err
 	}
-	return k.config, nil
+	return clients.Config, nil
+}
+
+// Close releases the connections held by every pooled client.
+func (k *KubernetesService) Close() {
+	k.clients.closeAll()
 }
 
 func (k *KubernetesService) ClearFailedContext(ctxName string) {
@@ -148,9 +170,13 @@ func (k *KubernetesService) ClearManagedResourcesCache(contextName string) {
 		k.managedResourcesCacheTime = make(map[string]time.Time)
 		k.logger.Info("Cleared all managed resources cache")
 	} else {
-		// Clear cache for specific context
-		delete(k.managedResourcesCache, contextName)
-		delete(k.managedResourcesCacheTime, contextName)
+		// Clear cache for specific context, for every identity
+		for key := range k.managedResourcesCache {
+			if key == contextName || strings.HasPrefix(key, contextName+"\x00") {
+				delete(k.managedResourcesCache, key)
+				delete(k.managedResourcesCacheTime, key)
+			}
+		}
 		k.logger.Infof("Cleared managed resources cache for context: %s", contextName)
 	}
 }
@@ -27,7 +27,7 @@ func TestKubernetesService_GetClientset_NotInitialized(t *testing.T) {
 		t.Error("Expected error when clientset is not initialized")
 	}
 
-	expectedError := "kubernetes client not initialized, call SetContext first"
+	expectedError := "context parameter is required when not running in cluster"
 	if err.Error() != expectedError {
 		t.Errorf("Expected '%s', got '%s'", expectedError, err.Error())
 	}
@@ -44,7 +44,7 @@ func TestKubernetesService_GetConfig_NotInitialized(t *testing.T) {
 		t.Error("Expected error when config is not initialized")
 	}
 
-	expectedError := "kubernetes config not initialized, call SetContext first"
+	expectedError := "context parameter is required when not running in cluster"
 	if err.Error() != expectedError {
 		t.Errorf("Expected '%s', got '%s'", expectedError, err.Error())
 	}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	maxTraceDepth = 10
+	maxTraceNodes = 500
+)
+
+// TraceNode is one resource in a Crossplane resource tree, from a claim down
+// through its composite resource to the composed resources.
+type TraceNode struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Name       string          `json:"name"`
+	Namespace  string          `json:"namespace,omitempty"`
+	Target     bool            `json:"target,omitempty"`
+	Ready      *TraceCondition `json:"ready,omitempty"`
+	Synced     *TraceCondition `json:"synced,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Children   []*TraceNode    `json:"children"`
+}
+
+type TraceCondition struct {
+	Status             string `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+type traceRef struct {
+	apiVersion string
+	kind       string
+	name       string
+	namespace  string
+}
+
+func (r traceRef) key() string {
+	return fmt.Sprintf("%s/%s/%s/%s", r.apiVersion, r.kind, r.namespace, r.name)
+}
+
+type resourceTracer struct {
+	k           *KubernetesService
+	contextName string
+	visited     map[string]bool
+	nodes       int
+}
+
+// GetResourceTrace returns the resource tree containing the given claim,
+// composite or managed resource. It first walks up claimRef, ownerReferences
+// and the crossplane.io/composite label to the topmost resource, then down
+// resourceRef and resourceRefs from there.
+func (k *KubernetesService) GetResourceTrace(apiVersion, kind, name, namespace, contextName string) (*TraceNode, error) {
+	clients, err := k.GetClients(contextName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve context: %w", err)
+	}
+	contextName = clients.Context
+
+	target := traceRef{apiVersion: apiVersion, kind: kind, name: name, namespace: namespace}
+	obj, err := k.GetResource(apiVersion, kind, name, namespace, contextName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	tracer := &resourceTracer{k: k, contextName: contextName, visited: map[string]bool{}}
+
+	rootRef, rootObj := target, obj
+	seen := map[string]bool{target.key(): true}
+	for depth := 0; depth < maxTraceDepth; depth++ {
+		parentRef, ok := traceParent(rootObj, rootRef.namespace)
+		if !ok || seen[parentRef.key()] {
+			break
+		}
+		parentObj, err := k.GetResource(parentRef.apiVersion, parentRef.kind, parentRef.name, parentRef.namespace, contextName, "")
+		if err != nil {
+			break
+		}
+		seen[parentRef.key()] = true
+		rootRef, rootObj = traceRefFor(parentObj, parentRef), parentObj
+	}
+
+	root := tracer.build(traceRefFor(rootObj, rootRef), rootObj, nil, 0)
+	markTraceTarget(root, traceRefFor(obj, target))
+	return root, nil
+}
+
+func (t *resourceTracer) build(ref traceRef, obj map[string]interface{}, fetchErr error, depth int) *TraceNode {
+	t.visited[ref.key()] = true
+	t.nodes++
+
+	node := &TraceNode{
+		APIVersion: ref.apiVersion,
+		Kind:       ref.kind,
+		Name:       ref.name,
+		Namespace:  ref.namespace,
+		Children:   []*TraceNode{},
+	}
+	if fetchErr != nil {
+		node.Error = fetchErr.Error()
+		return node
+	}
+	node.Ready = traceCondition(obj, "Ready")
+	node.Synced = traceCondition(obj, "Synced")
+
+	if depth >= maxTraceDepth {
+		return node
+	}
+
+	for _, childRef := range traceChildren(obj, ref.namespace) {
+		if t.visited[childRef.key()] || t.nodes >= maxTraceNodes {
+			continue
+		}
+		childObj, err := t.k.GetResource(childRef.apiVersion, childRef.kind, childRef.name, childRef.namespace, t.contextName, "")
+		if err == nil {
+			childRef = traceRefFor(childObj, childRef)
+		}
+		node.Children = append(node.Children, t.build(childRef, childObj, err, depth+1))
+	}
+
+	return node
+}
+
+// traceParent returns the resource that owns obj: the claim of a composite,
+// or the composite of a composed resource.
+func traceParent(obj map[string]interface{}, namespace string) (traceRef, bool) {
+	spec, _ := obj["spec"].(map[string]interface{})
+	if claimRef, ok := nestedMap(spec, "claimRef"); ok {
+		if ref, ok := refFromMap(claimRef, namespace); ok {
+			return ref, true
+		}
+	}
+	if claimRef, ok := nestedMap(spec, "crossplane", "claimRef"); ok {
+		if ref, ok := refFromMap(claimRef, namespace); ok {
+			return ref, true
+		}
+	}
+
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	composite, _ := labels["crossplane.io/composite"].(string)
+
+	ownerRefs, _ := metadata["ownerReferences"].([]interface{})
+	var labelled *traceRef
+	for _, item := range ownerRefs {
+		owner, _ := item.(map[string]interface{})
+		ref, ok := refFromMap(owner, namespace)
+		if !ok {
+			continue
+		}
+		if controller, _ := owner["controller"].(bool); controller {
+			return ref, true
+		}
+		if composite != "" && ref.name == composite && labelled == nil {
+			labelled = &ref
+		}
+	}
+	if labelled != nil {
+		return *labelled, true
+	}
+
+	return traceRef{}, false
+}
+
+// traceChildren returns the resources composed by obj: the composite bound
+// to a claim, or the resources referenced by a composite.
+func traceChildren(obj map[string]interface{}, namespace string) []traceRef {
+	spec, _ := obj["spec"].(map[string]interface{})
+	children := []traceRef{}
+
+	if resourceRef, ok := nestedMap(spec, "resourceRef"); ok {
+		if ref, ok := refFromMap(resourceRef, namespace); ok {
+			children = append(children, ref)
+		}
+	}
+
+	resourceRefs, _ := spec["resourceRefs"].([]interface{})
+	if crossplane, ok := nestedMap(spec, "crossplane"); ok {
+		if refs, ok := crossplane["resourceRefs"].([]interface{}); ok {
+			resourceRefs = append(resourceRefs, refs...)
+		}
+	}
+	for _, item := range resourceRefs {
+		refMap, _ := item.(map[string]interface{})
+		if ref, ok := refFromMap(refMap, namespace); ok {
+			children = append(children, ref)
+		}
+	}
+
+	return children
+}
+
+func traceCondition(obj map[string]interface{}, conditionType string) *TraceCondition {
+	status, _ := obj["status"].(map[string]interface{})
+	conditions, _ := status["conditions"].([]interface{})
+	for _, item := range conditions {
+		condition, _ := item.(map[string]interface{})
+		if t, _ := condition["type"].(string); t != conditionType {
+			continue
+		}
+		result := &TraceCondition{}
+		result.Status, _ = condition["status"].(string)
+		result.Reason, _ = condition["reason"].(string)
+		result.Message, _ = condition["message"].(string)
+		result.LastTransitionTime, _ = condition["lastTransitionTime"].(string)
+		return result
+	}
+	return nil
+}
+
+func markTraceTarget(node *TraceNode, target traceRef) bool {
+	if node.APIVersion == target.apiVersion && node.Kind == target.kind &&
+		node.Name == target.name && node.Namespace == target.namespace {
+		node.Target = true
+		return true
+	}
+	for _, child := range node.Children {
+		if markTraceTarget(child, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// traceRefFor returns ref with the namespace the API server reported for
+// obj, so cluster-scoped resources do not inherit a namespace from a parent.
+func traceRefFor(obj map[string]interface{}, ref traceRef) traceRef {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	ref.namespace = namespace
+	return ref
+}
+
+func refFromMap(m map[string]interface{}, namespace string) (traceRef, bool) {
+	if m == nil {
+		return traceRef{}, false
+	}
+	apiVersion, _ := m["apiVersion"].(string)
+	kind, _ := m["kind"].(string)
+	name, _ := m["name"].(string)
+	if apiVersion == "" || kind == "" || name == "" {
+		return traceRef{}, false
+	}
+	if ns, ok := m["namespace"].(string); ok && strings.TrimSpace(ns) != "" {
+		namespace = ns
+	}
+	return traceRef{apiVersion: apiVersion, kind: kind, name: name, namespace: namespace}, true
+}
+
+func nestedMap(m map[string]interface{}, keys ...string) (map[string]interface{}, bool) {
+	current := m
+	for _, key := range keys {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
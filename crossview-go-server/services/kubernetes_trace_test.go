@@ -0,0 +1,121 @@
+package services
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func setupTraceObjects() []*unstructured.Unstructured {
+	claim := newTestObject("example.crossplane.io/v1alpha1", "Database", "team-a", "orders")
+	unstructured.SetNestedMap(claim.Object, map[string]interface{}{
+		"apiVersion": "example.crossplane.io/v1alpha1",
+		"kind":       "XDatabase",
+		"name":       "orders-x7k2p",
+	}, "spec", "resourceRef")
+	setTestConditions(claim, "True", "True")
+
+	xr := newTestObject("example.crossplane.io/v1alpha1", "XDatabase", "", "orders-x7k2p")
+	unstructured.SetNestedMap(xr.Object, map[string]interface{}{
+		"apiVersion": "example.crossplane.io/v1alpha1",
+		"kind":       "Database",
+		"name":       "orders",
+		"namespace":  "team-a",
+	}, "spec", "claimRef")
+	unstructured.SetNestedSlice(xr.Object, []interface{}{
+		map[string]interface{}{"apiVersion": "s3.aws.upbound.io/v1beta1", "kind": "Bucket", "name": "orders-data"},
+		map[string]interface{}{"apiVersion": "s3.aws.upbound.io/v1beta1", "kind": "Bucket", "name": "orders-missing"},
+	}, "spec", "resourceRefs")
+	setTestConditions(xr, "False", "True")
+
+	bucket := newTestObject("s3.aws.upbound.io/v1beta1", "Bucket", "", "orders-data")
+	bucket.SetLabels(map[string]string{"crossplane.io/composite": "orders-x7k2p"})
+	unstructured.SetNestedSlice(bucket.Object, []interface{}{
+		map[string]interface{}{
+			"apiVersion": "example.crossplane.io/v1alpha1",
+			"kind":       "XDatabase",
+			"name":       "orders-x7k2p",
+			"uid":        "1234",
+			"controller": true,
+		},
+	}, "metadata", "ownerReferences")
+	setTestConditions(bucket, "False", "False")
+
+	return []*unstructured.Unstructured{claim, xr, bucket}
+}
+
+func setTestConditions(obj *unstructured.Unstructured, ready, synced string) {
+	unstructured.SetNestedSlice(obj.Object, []interface{}{
+		map[string]interface{}{"type": "Ready", "status": ready, "reason": "Available"},
+		map[string]interface{}{"type": "Synced", "status": synced, "reason": "ReconcileSuccess"},
+	}, "status", "conditions")
+}
+
+func TestKubernetesService_GetResourceTrace_FromManagedResource(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	objects := setupTraceObjects()
+	setupFakeClusterClients(service, "fake", objects[0], objects[1], objects[2])
+
+	root, err := service.GetResourceTrace("s3.aws.upbound.io/v1beta1", "Bucket", "orders-data", "", "fake")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if root.Kind != "Database" || root.Namespace != "team-a" {
+		t.Fatalf("Expected claim at the root, got %s %s/%s", root.Kind, root.Namespace, root.Name)
+	}
+	if root.Ready == nil || root.Ready.Status != "True" {
+		t.Errorf("Expected claim to be ready, got %+v", root.Ready)
+	}
+	if len(root.Children) != 1 {
+		t.Fatalf("Expected claim to have 1 child, got %d", len(root.Children))
+	}
+
+	xr := root.Children[0]
+	if xr.Kind != "XDatabase" || xr.Namespace != "" {
+		t.Errorf("Expected cluster-scoped XDatabase, got %s in %q", xr.Kind, xr.Namespace)
+	}
+	if len(xr.Children) != 2 {
+		t.Fatalf("Expected XR to have 2 children, got %d", len(xr.Children))
+	}
+
+	bucket := xr.Children[0]
+	if !bucket.Target {
+		t.Error("Expected requested bucket to be marked as target")
+	}
+	if bucket.Synced == nil || bucket.Synced.Status != "False" {
+		t.Errorf("Expected bucket to be out of sync, got %+v", bucket.Synced)
+	}
+
+	missing := xr.Children[1]
+	if missing.Error == "" {
+		t.Error("Expected missing bucket to carry an error")
+	}
+}
+
+func TestKubernetesService_GetResourceTrace_NotFound(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	setupFakeClusterClients(service, "fake")
+
+	_, err := service.GetResourceTrace("example.crossplane.io/v1alpha1", "Database", "missing", "team-a", "fake")
+	if err == nil || !contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestTraceParent_UsesCompositeLabel(t *testing.T) {
+	obj := newTestObject("s3.aws.upbound.io/v1beta1", "Bucket", "", "orders-data")
+	obj.SetLabels(map[string]string{"crossplane.io/composite": "orders-x7k2p"})
+	unstructured.SetNestedSlice(obj.Object, []interface{}{
+		map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "name": "unrelated"},
+		map[string]interface{}{"apiVersion": "example.crossplane.io/v1alpha1", "kind": "XDatabase", "name": "orders-x7k2p"},
+	}, "metadata", "ownerReferences")
+
+	parent, ok := traceParent(obj.Object, "")
+	if !ok {
+		t.Fatal("Expected a parent")
+	}
+	if parent.kind != "XDatabase" || parent.name != "orders-x7k2p" {
+		t.Errorf("Expected XDatabase orders-x7k2p, got %s %s", parent.kind, parent.name)
+	}
+}
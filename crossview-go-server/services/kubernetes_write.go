@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// Errors for requests that are wrong as given. The errors returned wrap
+// them, with the details, so callers match them with errors.Is.
+var (
+	ErrAPIVersionRequired       = errors.New("apiVersion is required")
+	ErrInvalidAPIVersion        = errors.New("invalid apiVersion format")
+	ErrKindRequired             = errors.New("kind is required")
+	ErrNameRequired             = errors.New("name is required")
+	ErrNamespaceRequired        = errors.New("namespace is required")
+	ErrInvalidPatch             = errors.New("patch must be valid JSON")
+	ErrInvalidPropagationPolicy = errors.New("invalid propagationPolicy")
+	ErrInvalidAction            = errors.New("invalid action")
+	ErrResourceTypeNotFound     = errors.New("resource type not found")
+	ErrResourceNotFound         = errors.New("resource not found")
+)
+
+// DefaultFieldManager is the field manager recorded for server-side apply
+// when the caller does not name one.
+const DefaultFieldManager = "crossview"
+
+type ApplyOptions struct {
+	FieldManager string
+	Force        bool
+	DryRun       bool
+}
+
+type DeleteOptions struct {
+	PropagationPolicy string
+	DryRun            bool
+}
+
+// ApplyResource creates or updates manifest with server-side apply.
+func (k *KubernetesService) ApplyResource(contextName string, manifest map[string]interface{}, opts ApplyOptions) (map[string]interface{}, error) {
+	clients, err := k.GetClients(contextName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve context: %w", err)
+	}
+
+	obj := &unstructured.Unstructured{Object: manifest}
+	apiVersion := obj.GetAPIVersion()
+	kind := obj.GetKind()
+	name := obj.GetName()
+
+	if err := validateAPIVersion(apiVersion); err != nil {
+		return nil, err
+	}
+	if kind == "" {
+		return nil, ErrKindRequired
+	}
+	if name == "" {
+		return nil, fmt.Errorf("metadata.%w", ErrNameRequired)
+	}
+
+	resource, info, err := k.writeTarget(clients, "patch", apiVersion, kind, name, obj.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	if !info.Namespaced {
+		obj.SetNamespace("")
+	}
+
+	fieldManager := opts.FieldManager
+	if fieldManager == "" {
+		fieldManager = DefaultFieldManager
+	}
+	applyOptions := metav1.ApplyOptions{FieldManager: fieldManager, Force: opts.Force}
+	if opts.DryRun {
+		applyOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	result, err := resource.Apply(context.Background(), name, obj, applyOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply resource: %w", err)
+	}
+
+	if !opts.DryRun {
+		k.ClearManagedResourcesCache(clients.Context)
+	}
+	return result.UnstructuredContent(), nil
+}
+
+// PatchResource applies a JSON merge patch to a single resource.
+func (k *KubernetesService) PatchResource(apiVersion, kind, name, namespace, contextName string, patch []byte, dryRun bool) (map[string]interface{}, error) {
+	clients, err := k.GetClients(contextName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve context: %w", err)
+	}
+
+	if err := validateAPIVersion(apiVersion); err != nil {
+		return nil, err
+	}
+	if kind == "" {
+		return nil, ErrKindRequired
+	}
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	if !json.Valid(patch) {
+		return nil, ErrInvalidPatch
+	}
+
+	resource, _, err := k.writeTarget(clients, "patch", apiVersion, kind, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	patchOptions := metav1.PatchOptions{FieldManager: DefaultFieldManager}
+	if dryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	result, err := resource.Patch(context.Background(), name, types.MergePatchType, patch, patchOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch resource: %w", err)
+	}
+
+	if !dryRun {
+		k.ClearManagedResourcesCache(clients.Context)
+	}
+	return result.UnstructuredContent(), nil
+}
+
+// DeleteResource deletes a single resource. PropagationPolicy is one of
+// Foreground, Background or Orphan; empty leaves the server default.
+func (k *KubernetesService) DeleteResource(apiVersion, kind, name, namespace, contextName string, opts DeleteOptions) error {
+	clients, err := k.GetClients(contextName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve context: %w", err)
+	}
+
+	if err := validateAPIVersion(apiVersion); err != nil {
+		return err
+	}
+	if kind == "" {
+		return ErrKindRequired
+	}
+	if name == "" {
+		return ErrNameRequired
+	}
+
+	deleteOptions := metav1.DeleteOptions{}
+	switch opts.PropagationPolicy {
+	case "":
+	case string(metav1.DeletePropagationForeground), string(metav1.DeletePropagationBackground), string(metav1.DeletePropagationOrphan):
+		policy := metav1.DeletionPropagation(opts.PropagationPolicy)
+		deleteOptions.PropagationPolicy = &policy
+	default:
+		return fmt.Errorf("%w: %s, expected Foreground, Background or Orphan", ErrInvalidPropagationPolicy, opts.PropagationPolicy)
+	}
+	if opts.DryRun {
+		deleteOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	resource, _, err := k.writeTarget(clients, "delete", apiVersion, kind, name, namespace)
+	if err != nil {
+		return err
+	}
+
+	if err := resource.Delete(context.Background(), name, deleteOptions); err != nil {
+		return fmt.Errorf("failed to delete resource: %w", err)
+	}
+
+	if !opts.DryRun {
+		k.ClearManagedResourcesCache(clients.Context)
+	}
+	return nil
+}
+
+// writeTarget returns the dynamic client for kind, scoped to namespace when
+// the kind is namespaced, once verb on the named resource is authorized.
+// Unlike reads, writes to a namespaced kind require a namespace.
+func (k *KubernetesService) writeTarget(clients *ClusterClients, verb, apiVersion, kind, name, namespace string) (dynamic.ResourceInterface, ResourceInfo, error) {
+	info, err := k.resolveResource(clients, apiVersion, kind, "")
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, info, fmt.Errorf("%w: %s/%s", ErrResourceTypeNotFound, apiVersion, kind)
+		}
+		return nil, info, fmt.Errorf("failed to resolve resource: %w", err)
+	}
+
+	if !info.Namespaced {
+		namespace = ""
+	} else if namespace == "" {
+		return nil, info, fmt.Errorf("%w for %s", ErrNamespaceRequired, kind)
+	}
+	if err := k.authorize(clients, verb, info.GVR, namespace, name); err != nil {
+		return nil, info, err
+	}
+
+	if namespace == "" {
+		return clients.Dynamic.Resource(info.GVR), info, nil
+	}
+	return clients.Dynamic.Resource(info.GVR).Namespace(namespace), info, nil
+}
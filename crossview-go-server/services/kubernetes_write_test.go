@@ -0,0 +1,179 @@
+package services
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestKubernetesService_ApplyResource(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	fakeClients := setupFakeClusterClients(service, "fake")
+
+	// The fake tracker cannot merge apply patches into unstructured objects,
+	// so echo the applied manifest back the way the API server would.
+	fakeDynamic := fakeClients.Dynamic.(*dynamicfake.FakeDynamicClient)
+	fakeDynamic.PrependReactor("patch", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch := action.(clienttesting.PatchActionImpl)
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		return true, obj, nil
+	})
+
+	manifest := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "default"},
+		"data":       map[string]interface{}{"mode": "fast"},
+	}
+
+	result, err := service.ApplyResource("fake", manifest, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result["kind"] != "ConfigMap" {
+		t.Errorf("Expected kind 'ConfigMap', got '%v'", result["kind"])
+	}
+
+	actions := fakeDynamic.Actions()
+	patch, ok := actions[len(actions)-1].(clienttesting.PatchActionImpl)
+	if !ok {
+		t.Fatalf("Expected a patch action, got %T", actions[len(actions)-1])
+	}
+	if patch.GetPatchType() != types.ApplyPatchType {
+		t.Errorf("Expected server-side apply, got %s", patch.GetPatchType())
+	}
+	if patch.GetNamespace() != "default" {
+		t.Errorf("Expected namespace 'default', got %q", patch.GetNamespace())
+	}
+}
+
+func TestKubernetesService_ApplyResource_Validation(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	setupFakeClusterClients(service, "fake")
+
+	tests := []struct {
+		name     string
+		manifest map[string]interface{}
+		wantErr  string
+	}{
+		{
+			name:     "missing name",
+			manifest: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"},
+			wantErr:  "metadata.name is required",
+		},
+		{
+			name: "missing namespace",
+			manifest: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "settings"},
+			},
+			wantErr: "namespace is required",
+		},
+		{
+			name: "unknown kind",
+			manifest: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Widget",
+				"metadata":   map[string]interface{}{"name": "w", "namespace": "default"},
+			},
+			wantErr: "resource type not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.ApplyResource("fake", tt.manifest, ApplyOptions{})
+			if err == nil || !contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKubernetesService_PatchResource(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	setupFakeClusterClients(service, "fake",
+		newTestObject("v1", "ConfigMap", "default", "settings"),
+	)
+
+	result, err := service.PatchResource("v1", "ConfigMap", "settings", "default", "fake",
+		[]byte(`{"metadata":{"labels":{"team":"platform"}}}`), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	metadata, _ := result["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	if labels["team"] != "platform" {
+		t.Errorf("Expected patched label, got %v", labels)
+	}
+
+	_, err = service.PatchResource("v1", "ConfigMap", "settings", "default", "fake", []byte(`{not json`), false)
+	if err == nil || !contains(err.Error(), "valid JSON") {
+		t.Errorf("Expected invalid JSON error, got %v", err)
+	}
+}
+
+func TestKubernetesService_DeleteResource(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	fakeClients := setupFakeClusterClients(service, "fake",
+		newTestObject("example.crossplane.io/v1alpha1", "XDatabase", "", "orders"),
+	)
+
+	err := service.DeleteResource("example.crossplane.io/v1alpha1", "XDatabase", "orders", "ignored", "fake",
+		DeleteOptions{PropagationPolicy: "Foreground"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	actions := fakeClients.Dynamic.(*dynamicfake.FakeDynamicClient).Actions()
+	deleteAction := actions[len(actions)-1].(clienttesting.DeleteActionImpl)
+	if deleteAction.GetNamespace() != "" {
+		t.Errorf("Expected cluster-scoped delete, got namespace %q", deleteAction.GetNamespace())
+	}
+	policy := deleteAction.DeleteOptions.PropagationPolicy
+	if policy == nil || *policy != metav1.DeletePropagationForeground {
+		t.Errorf("Expected Foreground propagation, got %v", policy)
+	}
+
+	_, err = service.GetResource("example.crossplane.io/v1alpha1", "XDatabase", "orders", "", "fake", "")
+	if err == nil || !contains(err.Error(), "not found") {
+		t.Errorf("Expected resource to be deleted, got %v", err)
+	}
+
+	err = service.DeleteResource("example.crossplane.io/v1alpha1", "XDatabase", "orders", "", "fake",
+		DeleteOptions{PropagationPolicy: "Cascade"})
+	if err == nil || !contains(err.Error(), "invalid propagationPolicy") {
+		t.Errorf("Expected invalid propagationPolicy error, got %v", err)
+	}
+}
+
+func TestKubernetesService_DeleteResource_DryRun(t *testing.T) {
+	service := NewKubernetesService(setupTestLogger(), setupTestEnv()).(*KubernetesService)
+	fakeClients := setupFakeClusterClients(service, "fake",
+		newTestObject("v1", "ConfigMap", "default", "settings"),
+	)
+
+	err := service.DeleteResource("v1", "ConfigMap", "settings", "default", "fake", DeleteOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	actions := fakeClients.Dynamic.(*dynamicfake.FakeDynamicClient).Actions()
+	deleteAction := actions[len(actions)-1].(clienttesting.DeleteActionImpl)
+	if dryRun := deleteAction.DeleteOptions.DryRun; len(dryRun) != 1 || dryRun[0] != metav1.DryRunAll {
+		t.Errorf("Expected dryRun All, got %v", dryRun)
+	}
+	if deleteAction.DeleteOptions.PropagationPolicy != nil {
+		t.Errorf("Expected server default propagation, got %v", *deleteAction.DeleteOptions.PropagationPolicy)
+	}
+}
@@ -10,14 +10,51 @@ import (
 
 type SSOServiceInterface interface {
 	GetSSOStatus() lib.SSOConfig
-	InitiateOIDC(ctx context.Context, callbackURL string) (string, error)
-	HandleOIDCCallback(ctx context.Context, code, state string, callbackURL string) (*models.User, error)
-	InitiateSAML(ctx context.Context, callbackURL string) (string, error)
-	HandleSAMLCallback(ctx context.Context, samlResponse string, callbackURL string) (*models.User, error)
+	InitiateOIDC(ctx context.Context, provider string, callbackURL string) (string, *OIDCLogin, error)
+	HandleOIDCCallback(ctx context.Context, provider string, code, state string, callbackURL string, login *OIDCLogin) (*models.User, *models.UserSession, error)
+	OIDCLogoutURL(ctx context.Context, session *models.UserSession, redirectURL string) (string, error)
+	HandleBackChannelLogout(ctx context.Context, provider string, logoutToken string) (int64, error)
+	InitiateSAML(ctx context.Context) (string, string, error)
+	HandleSAMLCallback(ctx context.Context, samlResponse string, requestID string) (*models.User, *models.UserSession, error)
+	GetSAMLMetadata(ctx context.Context) ([]byte, error)
+	ValidateOIDCDiscovery(ctx context.Context) error
+	GetOIDCDiscoveryStatus(provider string) OIDCDiscoveryStatus
 }
 
 // Module exports services present
 var Module = fx.Options(
 	fx.Provide(NewSSOService),
 	fx.Provide(NewKubernetesService),
+	fx.Invoke(registerKubernetesLifecycle),
+	fx.Invoke(registerSSOLifecycle),
 )
+
+// registerSSOLifecycle checks the OIDC discovery document once the server
+// starts. A provider that is down only logs an error: local login keeps
+// working, and the status endpoint reports the problem.
+func registerSSOLifecycle(lc fx.Lifecycle, ssoService SSOServiceInterface, logger lib.Logger) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go func() {
+				if err := ssoService.ValidateOIDCDiscovery(context.Background()); err != nil {
+					logger.Errorf("OIDC discovery validation failed: %s", err.Error())
+				}
+			}()
+			return nil
+		},
+	})
+}
+
+func registerKubernetesLifecycle(lc fx.Lifecycle, kubernetesService KubernetesServiceInterface, logger lib.Logger) {
+	service, ok := kubernetesService.(*KubernetesService)
+	if !ok {
+		return
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			logger.Info("Closing Kubernetes clients...")
+			service.Close()
+			return nil
+		},
+	})
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"crossview-go-server/lib"
+)
+
+// OIDCDiscoveryStatus is the outcome of the most recent attempt to fetch and
+// validate the provider's discovery document.
+type OIDCDiscoveryStatus struct {
+	Checked   bool
+	Issuer    string
+	CheckedAt time.Time
+	Error     string
+}
+
+// oidcDiscoveryCache keeps each provider's last valid discovery document.
+// Documents are refetched after the provider's DiscoveryCacheTTL, or after
+// ttl when set. When a refresh fails the stale document keeps being served,
+// so a provider blip does not break logins that the cached endpoints would
+// still handle.
+//
+// mu guards the map and the entries' fields and is never held during a
+// fetch. Each entry's fetching lock lets one request refresh the document
+// while others for the same provider wait, so a slow provider holds up
+// only its own logins.
+type oidcDiscoveryCache struct {
+	ttl     time.Duration
+	entries map[string]*oidcDiscoveryEntry
+	mu      sync.Mutex
+}
+
+type oidcDiscoveryEntry struct {
+	endpoints *oidcEndpoints
+	issuer    string
+	fetchedAt time.Time
+	status    OIDCDiscoveryStatus
+	fetching  sync.Mutex
+}
+
+func newOIDCDiscoveryCache() *oidcDiscoveryCache {
+	return &oidcDiscoveryCache{entries: make(map[string]*oidcDiscoveryEntry)}
+}
+
+// entry returns the provider's entry, starting over when its issuer changed.
+func (c *oidcDiscoveryCache) entry(provider, issuer string) *oidcDiscoveryEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, exists := c.entries[provider]
+	if !exists || entry.issuer != issuer {
+		entry = &oidcDiscoveryEntry{issuer: issuer}
+		c.entries[provider] = entry
+	}
+	return entry
+}
+
+// fresh returns the entry's document if it was fetched less than ttl ago.
+func (c *oidcDiscoveryCache) fresh(entry *oidcDiscoveryEntry, ttl time.Duration) (*oidcEndpoints, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry.endpoints != nil && time.Since(entry.fetchedAt) < ttl {
+		return entry.endpoints, true
+	}
+	return nil, false
+}
+
+// discoverOIDC returns the provider's discovery document, from the cache
+// while it is fresh.
+func (s SSOService) discoverOIDC(ctx context.Context, oidcConfig lib.OIDCConfig) (*oidcEndpoints, error) {
+	issuer := strings.TrimSuffix(oidcConfig.Issuer, "/")
+	if issuer == "" {
+		return nil, fmt.Errorf("OIDC issuer not configured")
+	}
+
+	cache := s.discovery
+	if cache == nil {
+		return s.fetchOIDCDiscovery(ctx, issuer)
+	}
+
+	ttl := oidcConfig.DiscoveryCacheTTL
+	if cache.ttl > 0 {
+		ttl = cache.ttl
+	}
+	entry := cache.entry(oidcConfig.Name, issuer)
+	if endpoints, ok := cache.fresh(entry, ttl); ok {
+		return endpoints, nil
+	}
+
+	entry.fetching.Lock()
+	defer entry.fetching.Unlock()
+	// Another request may have refreshed the document while this one waited.
+	if endpoints, ok := cache.fresh(entry, ttl); ok {
+		return endpoints, nil
+	}
+
+	endpoints, err := s.fetchOIDCDiscovery(ctx, issuer)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	entry.status = OIDCDiscoveryStatus{Checked: true, Issuer: issuer, CheckedAt: time.Now()}
+	if err != nil {
+		entry.status.Error = err.Error()
+		if entry.endpoints != nil {
+			s.logger.Warnf("OIDC discovery refresh failed for provider %s, using cached document: %s", oidcConfig.Name, err.Error())
+			return entry.endpoints, nil
+		}
+		s.logger.Errorf("OIDC discovery failed for provider %s: %s", oidcConfig.Name, err.Error())
+		return nil, err
+	}
+
+	entry.endpoints = endpoints
+	entry.fetchedAt = time.Now()
+	return endpoints, nil
+}
+
+// fetchOIDCDiscovery downloads the discovery document and checks that it
+// describes issuer and names the endpoints a login needs.
+func (s SSOService) fetchOIDCDiscovery(ctx context.Context, issuer string) (*oidcEndpoints, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("discovery request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var endpoints oidcEndpoints
+	if err := json.NewDecoder(resp.Body).Decode(&endpoints); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(endpoints.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document issuer %q does not match configured issuer %q", endpoints.Issuer, issuer)
+	}
+	if endpoints.AuthorizationEndpoint == "" || endpoints.TokenEndpoint == "" || endpoints.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document missing authorization_endpoint, token_endpoint or jwks_uri")
+	}
+
+	return &endpoints, nil
+}
+
+// ValidateOIDCDiscovery fetches every provider's discovery document,
+// bypassing the cache's freshness, so configuration problems show up at
+// startup rather than on the first login.
+func (s SSOService) ValidateOIDCDiscovery(ctx context.Context) error {
+	if !s.ssoConfig.Enabled {
+		return nil
+	}
+	if s.discovery != nil {
+		s.discovery.mu.Lock()
+		for _, entry := range s.discovery.entries {
+			entry.fetchedAt = time.Time{}
+		}
+		s.discovery.mu.Unlock()
+	}
+
+	var errs []error
+	for _, provider := range s.ssoConfig.EnabledOIDCProviders() {
+		if _, err := s.discoverOIDC(ctx, provider); err != nil {
+			errs = append(errs, fmt.Errorf("provider %s: %w", provider.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GetOIDCDiscoveryStatus reports the result of the provider's last discovery
+// fetch.
+func (s SSOService) GetOIDCDiscoveryStatus(provider string) OIDCDiscoveryStatus {
+	if s.discovery == nil {
+		return OIDCDiscoveryStatus{}
+	}
+	s.discovery.mu.Lock()
+	defer s.discovery.mu.Unlock()
+	if entry, exists := s.discovery.entries[provider]; exists {
+		return entry.status
+	}
+	return OIDCDiscoveryStatus{}
+}
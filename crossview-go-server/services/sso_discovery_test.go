@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+)
+
+func TestSSOService_DiscoverOIDC_Cache(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+
+	for i := 0; i < 3; i++ {
+		startTestOIDCLogin(t, service, provider)
+	}
+	if provider.discoveries != 1 {
+		t.Errorf("Expected one discovery request while cached, got %d", provider.discoveries)
+	}
+
+	service.discovery.ttl = time.Nanosecond
+	startTestOIDCLogin(t, service, provider)
+	if provider.discoveries != 2 {
+		t.Errorf("Expected the document to be refetched after the TTL, got %d requests", provider.discoveries)
+	}
+}
+
+func TestSSOService_DiscoverOIDC_StaleOnFailure(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+
+	if _, err := service.discoverOIDC(context.Background(), service.ssoConfig.OIDC); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	service.discovery.ttl = time.Nanosecond
+	provider.server.Close()
+
+	endpoints, err := service.discoverOIDC(context.Background(), service.ssoConfig.OIDC)
+	if err != nil {
+		t.Fatalf("Expected the cached document to be served, got %v", err)
+	}
+	if endpoints.TokenEndpoint != provider.server.URL+"/token" {
+		t.Errorf("Unexpected token endpoint '%s'", endpoints.TokenEndpoint)
+	}
+	if status := service.GetOIDCDiscoveryStatus(lib.DefaultOIDCProvider); status.Error == "" {
+		t.Error("Expected the failed refresh to be reported in the status")
+	}
+}
+
+func TestSSOService_DiscoverOIDC_SlowProvider(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer slow.Close()
+	slowConfig := lib.OIDCConfig{Name: "slow", Issuer: slow.URL, DiscoveryCacheTTL: time.Hour}
+
+	done := make(chan error)
+	go func() {
+		_, err := service.discoverOIDC(context.Background(), slowConfig)
+		done <- err
+	}()
+	<-started
+
+	// Neither another provider nor the status waits for the slow fetch.
+	if _, err := service.discoverOIDC(context.Background(), service.ssoConfig.OIDC); err != nil {
+		t.Errorf("Expected the other provider to be discovered, got %v", err)
+	}
+	if status := service.GetOIDCDiscoveryStatus("slow"); status.Checked {
+		t.Errorf("Expected the slow provider to be unchecked, got %+v", status)
+	}
+
+	close(release)
+	if err := <-done; err == nil {
+		t.Error("Expected the slow provider's discovery to fail")
+	}
+	if status := service.GetOIDCDiscoveryStatus("slow"); status.Error == "" {
+		t.Error("Expected the failure to be recorded")
+	}
+}
+
+func TestSSOService_ValidateOIDCDiscovery(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+
+	if status := service.GetOIDCDiscoveryStatus(lib.DefaultOIDCProvider); status.Checked {
+		t.Error("Expected discovery to be unchecked before validation")
+	}
+
+	if err := service.ValidateOIDCDiscovery(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status := service.GetOIDCDiscoveryStatus(lib.DefaultOIDCProvider)
+	if !status.Checked || status.Error != "" || status.Issuer != provider.server.URL {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestSSOService_ValidateOIDCDiscovery_IssuerMismatch(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	provider.issuer = "https://idp.example.com"
+
+	err := service.ValidateOIDCDiscovery(context.Background())
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+	if !strings.Contains(err.Error(), "does not match configured issuer") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if status := service.GetOIDCDiscoveryStatus(lib.DefaultOIDCProvider); status.Error == "" {
+		t.Error("Expected the failure to be reported in the status")
+	}
+}
+
+func TestSSOService_ValidateOIDCDiscovery_Disabled(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	service.ssoConfig.OIDC.Enabled = false
+
+	if err := service.ValidateOIDCDiscovery(context.Background()); err != nil {
+		t.Errorf("Expected no validation when OIDC is disabled, got %v", err)
+	}
+	if provider.discoveries != 0 {
+		t.Errorf("Expected no discovery request, got %d", provider.discoveries)
+	}
+}
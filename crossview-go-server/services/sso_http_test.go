@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+)
+
+func TestNewSSOHTTPClient_CACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := newSSOHTTPClient(lib.SSOHTTPConfig{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("Expected a certificate error without the CA")
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	client, err = newSSOHTTPClient(lib.SSOHTTPConfig{Timeout: 5 * time.Second, CACert: string(caPEM)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the CA to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewSSOHTTPClient_ClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "crossview" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	certPEM, keyPEM := generateTestClientCert(t, "crossview")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	client, err := newSSOHTTPClient(lib.SSOHTTPConfig{CACert: string(caPEM), ClientCert: certPEM, ClientKey: keyPEM})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the client certificate to be presented, got status %d", resp.StatusCode)
+	}
+}
+
+func TestNewSSOHTTPClient_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	client, err := newSSOHTTPClient(lib.SSOHTTPConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := client.Get("http://idp.internal/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if proxied != "http://idp.internal/.well-known/openid-configuration" {
+		t.Errorf("Expected the request to go through the proxy, got '%s'", proxied)
+	}
+}
+
+func TestNewSSOHTTPClient_InvalidConfig(t *testing.T) {
+	certPEM, _ := generateTestClientCert(t, "crossview")
+
+	tests := []struct {
+		name     string
+		config   lib.SSOHTTPConfig
+		contains string
+	}{
+		{"bad proxy", lib.SSOHTTPConfig{ProxyURL: "://proxy"}, "invalid proxy URL"},
+		{"bad CA", lib.SSOHTTPConfig{CACert: "not a certificate"}, "caCert"},
+		{"cert without key", lib.SSOHTTPConfig{ClientCert: certPEM}, "both clientCert and clientKey"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSSOHTTPClient(tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing '%s', got %v", tt.contains, err)
+			}
+		})
+	}
+}
+
+func generateTestClientCert(t *testing.T, commonName string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return string(certPEM), string(keyPEM)
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"crossview-go-server/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"gorm.io/gorm"
+)
+
+// backChannelLogoutEvent is the event a logout token must carry.
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// OIDCLogoutURL returns the provider's end_session_endpoint URL that ends the
+// IdP session behind an OIDC login, or "" when the session is not an OIDC
+// one or the provider has no such endpoint. The IdP sends the browser on to
+// the provider's postLogoutRedirectURL, or to redirectURL when none is set.
+func (s SSOService) OIDCLogoutURL(ctx context.Context, session *models.UserSession, redirectURL string) (string, error) {
+	if session == nil || !strings.HasPrefix(session.Provider, "oidc:") {
+		return "", nil
+	}
+	oidcConfig, err := s.oidcProvider(strings.TrimPrefix(session.Provider, "oidc:"))
+	if err != nil {
+		return "", err
+	}
+
+	endpoints := s.oidcEndpoints(ctx, oidcConfig)
+	if endpoints.EndSessionEndpoint == "" {
+		return "", nil
+	}
+
+	params := url.Values{}
+	params.Set("client_id", oidcConfig.ClientId)
+	if session.IDToken != "" {
+		params.Set("id_token_hint", session.IDToken)
+	}
+	if redirectURL = firstNonEmpty(oidcConfig.LogoutRedirectURL, redirectURL); redirectURL != "" {
+		params.Set("post_logout_redirect_uri", redirectURL)
+	}
+
+	separator := "?"
+	if strings.Contains(endpoints.EndSessionEndpoint, "?") {
+		separator = "&"
+	}
+	return endpoints.EndSessionEndpoint + separator + params.Encode(), nil
+}
+
+// HandleBackChannelLogout validates a logout token the provider posted to
+// the back-channel logout endpoint and ends the sessions it names: all of
+// the user's sessions when it names a subject, otherwise those started from
+// the IdP session in its sid claim. It returns how many sessions ended.
+func (s SSOService) HandleBackChannelLogout(ctx context.Context, provider string, logoutToken string) (int64, error) {
+	oidcConfig, err := s.oidcProvider(provider)
+	if err != nil {
+		return 0, err
+	}
+
+	endpoints := s.oidcEndpoints(ctx, oidcConfig)
+	if endpoints.Issuer == "" || endpoints.JWKSURI == "" {
+		return 0, fmt.Errorf("OIDC issuer not configured")
+	}
+
+	verifier := oidc.NewVerifier(endpoints.Issuer, s.oidcKeys.get(endpoints.JWKSURI, s.client()), &oidc.Config{
+		ClientID:             oidcConfig.ClientId,
+		SupportedSigningAlgs: endpoints.SigningAlgs,
+	})
+	token, err := verifier.Verify(ctx, logoutToken)
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify logout token: %w", err)
+	}
+
+	var claims struct {
+		SID    string                     `json:"sid"`
+		Nonce  *string                    `json:"nonce"`
+		Events map[string]json.RawMessage `json:"events"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return 0, fmt.Errorf("failed to decode logout token: %w", err)
+	}
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok {
+		return 0, fmt.Errorf("logout token missing back-channel logout event")
+	}
+	// A nonce marks an ID token, which must not be accepted as a logout token.
+	if claims.Nonce != nil {
+		return 0, fmt.Errorf("logout token must not contain a nonce")
+	}
+
+	providerName := "oidc:" + oidcConfig.Name
+	switch {
+	case token.Subject != "":
+		identity, err := s.userRepo.FindIdentity(providerName, token.Subject)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && identity == nil) {
+			s.logger.Infof("OIDC back-channel logout for unknown subject: provider=%s, providerId=%s", oidcConfig.Name, token.Subject)
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to find identity: %w", err)
+		}
+		ended, err := s.sessionRepo.DeleteByUserID(identity.UserID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to end sessions: %w", err)
+		}
+		s.logger.Infof("OIDC back-channel logout: provider=%s, userId=%d, sessions=%d", oidcConfig.Name, identity.UserID, ended)
+		return ended, nil
+	case claims.SID != "":
+		ended, err := s.sessionRepo.DeleteBySID(providerName, claims.SID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to end sessions: %w", err)
+		}
+		s.logger.Infof("OIDC back-channel logout: provider=%s, sid=%s, sessions=%d", oidcConfig.Name, claims.SID, ended)
+		return ended, nil
+	default:
+		return 0, fmt.Errorf("logout token names neither a subject nor a session")
+	}
+}
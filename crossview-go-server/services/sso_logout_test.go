@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"crossview-go-server/models"
+)
+
+// loginTestOIDCUser runs a full login against the test provider and returns
+// the session it recorded.
+func loginTestOIDCUser(t *testing.T, service SSOService, provider *testOIDCProvider) *models.UserSession {
+	login, _ := startTestOIDCLogin(t, service, provider)
+	_, session, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return session
+}
+
+func TestSSOService_HandleOIDCCallback_RecordsSession(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	provider.claims = map[string]interface{}{"sid": "idp-session-1"}
+	service := setupOIDCService(t, provider)
+
+	session := loginTestOIDCUser(t, service, provider)
+
+	stored, err := service.sessionRepo.FindByID(session.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("Expected the session in the registry, got %v", err)
+	}
+	if stored.Provider != "oidc:default" || stored.SID != "idp-session-1" || stored.IDToken == "" {
+		t.Errorf("Unexpected session: %+v", stored)
+	}
+}
+
+func TestSSOService_OIDCLogoutURL(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	session := loginTestOIDCUser(t, service, provider)
+
+	logoutURL, err := service.OIDCLogoutURL(context.Background(), session, "http://localhost:5173/login")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(logoutURL, provider.server.URL+"/logout?") {
+		t.Fatalf("Expected the discovered end_session_endpoint, got '%s'", logoutURL)
+	}
+	parsed, _ := url.Parse(logoutURL)
+	params := parsed.Query()
+	if params.Get("id_token_hint") != session.IDToken {
+		t.Error("Expected the login's ID token as id_token_hint")
+	}
+	if params.Get("client_id") != "test-client" {
+		t.Errorf("Expected client_id 'test-client', got '%s'", params.Get("client_id"))
+	}
+	if params.Get("post_logout_redirect_uri") != "http://localhost:5173/login" {
+		t.Errorf("Unexpected post_logout_redirect_uri '%s'", params.Get("post_logout_redirect_uri"))
+	}
+
+	service.ssoConfig.OIDC.LogoutRedirectURL = "https://crossview.example.com/goodbye"
+	logoutURL, _ = service.OIDCLogoutURL(context.Background(), session, "http://localhost:5173/login")
+	parsed, _ = url.Parse(logoutURL)
+	if got := parsed.Query().Get("post_logout_redirect_uri"); got != "https://crossview.example.com/goodbye" {
+		t.Errorf("Expected the configured post_logout_redirect_uri, got '%s'", got)
+	}
+
+	logoutURL, err = service.OIDCLogoutURL(context.Background(), &models.UserSession{Provider: "local"}, "")
+	if err != nil || logoutURL != "" {
+		t.Errorf("Expected no logout URL for a local session, got '%s' (%v)", logoutURL, err)
+	}
+}
+
+func TestSSOService_HandleBackChannelLogout_Subject(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	first := loginTestOIDCUser(t, service, provider)
+	second := loginTestOIDCUser(t, service, provider)
+	local := &models.UserSession{UserID: first.UserID, Provider: "local"}
+	if err := service.sessionRepo.Create(local); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	ended, err := service.HandleBackChannelLogout(context.Background(), "", provider.logoutToken(t, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ended != 3 {
+		t.Errorf("Expected all 3 of the user's sessions to end, got %d", ended)
+	}
+	for _, session := range []*models.UserSession{first, second, local} {
+		if found, _ := service.sessionRepo.FindByID(session.ID); found != nil {
+			t.Errorf("Expected session %s (%s) to be gone", session.ID, session.Provider)
+		}
+	}
+
+	ended, err = service.HandleBackChannelLogout(context.Background(), "", provider.logoutToken(t, map[string]interface{}{"sub": "someone-else"}))
+	if err != nil || ended != 0 {
+		t.Errorf("Expected an unknown subject to end nothing, got %d (%v)", ended, err)
+	}
+}
+
+func TestSSOService_HandleBackChannelLogout_SessionID(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	provider.claims = map[string]interface{}{"sid": "idp-session-1"}
+	named := loginTestOIDCUser(t, service, provider)
+	provider.claims = map[string]interface{}{"sid": "idp-session-2"}
+	other := loginTestOIDCUser(t, service, provider)
+
+	token := provider.logoutToken(t, map[string]interface{}{"sub": nil, "sid": "idp-session-1"})
+	ended, err := service.HandleBackChannelLogout(context.Background(), "", token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ended != 1 {
+		t.Errorf("Expected 1 session to end, got %d", ended)
+	}
+	if found, _ := service.sessionRepo.FindByID(named.ID); found != nil {
+		t.Error("Expected the session named by sid to be gone")
+	}
+	if found, _ := service.sessionRepo.FindByID(other.ID); found == nil {
+		t.Error("Expected the user's other IdP session to remain")
+	}
+}
+
+func TestSSOService_HandleBackChannelLogout_Rejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		claims      map[string]interface{}
+		forged      bool
+		expectedErr string
+	}{
+		{"untrusted signature", nil, true, "failed to verify logout token"},
+		{"wrong audience", map[string]interface{}{"aud": "another-client"}, false, "failed to verify logout token"},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}, false, "failed to verify logout token"},
+		{"missing event", map[string]interface{}{"events": nil}, false, "back-channel logout event"},
+		{"ID token", map[string]interface{}{"nonce": "n-0S6_WzA2Mj"}, false, "nonce"},
+		{"no subject or session", map[string]interface{}{"sub": nil, "sid": nil}, false, "neither a subject nor a session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestOIDCProvider(t)
+			service := setupOIDCService(t, provider)
+			session := loginTestOIDCUser(t, service, provider)
+			if tt.forged {
+				forged, _ := rsa.GenerateKey(rand.Reader, 2048)
+				provider.forgedKey = forged
+			}
+
+			_, err := service.HandleBackChannelLogout(context.Background(), "", provider.logoutToken(t, tt.claims))
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("Expected error containing '%s', got %v", tt.expectedErr, err)
+			}
+			if found, _ := service.sessionRepo.FindByID(session.ID); found == nil {
+				t.Error("Expected the session to remain after a rejected logout token")
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// OIDCLogin is the per-login secret state of an authorization code flow. It
+// is kept in the user's session between InitiateOIDC and HandleOIDCCallback.
+type OIDCLogin struct {
+	Provider     string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+type oidcEndpoints struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserInfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	EndSessionEndpoint    string   `json:"end_session_endpoint"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// oidcKeySets keeps one JWKS client per key set URL, so signing keys are
+// fetched once and refetched only when a token names an unknown kid.
+type oidcKeySets struct {
+	sets map[string]*oidc.RemoteKeySet
+	mu   sync.Mutex
+}
+
+func newOIDCKeySets() *oidcKeySets {
+	return &oidcKeySets{sets: make(map[string]*oidc.RemoteKeySet)}
+}
+
+func (k *oidcKeySets) get(jwksURL string, client *http.Client) *oidc.RemoteKeySet {
+	ctx := oidc.ClientContext(context.Background(), client)
+	if k == nil {
+		return oidc.NewRemoteKeySet(ctx, jwksURL)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	set, exists := k.sets[jwksURL]
+	if !exists {
+		set = oidc.NewRemoteKeySet(ctx, jwksURL)
+		k.sets[jwksURL] = set
+	}
+	return set
+}
+
+// InitiateOIDC returns the authorization URL to send the browser to, and the
+// state, nonce and PKCE verifier the callback must be checked against. An
+// empty provider selects the first configured one.
+func (s SSOService) InitiateOIDC(ctx context.Context, provider string, callbackURL string) (string, *OIDCLogin, error) {
+	oidcConfig, err := s.oidcProvider(provider)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Use provided callback URL, fallback to config if not provided
+	if callbackURL == "" {
+		callbackURL = oidcConfig.CallbackURL
+	}
+
+	endpoints := s.oidcEndpoints(ctx, oidcConfig)
+	if endpoints.AuthorizationEndpoint == "" {
+		return "", nil, fmt.Errorf("OIDC authorization URL not configured")
+	}
+
+	login := &OIDCLogin{
+		Provider:     oidcConfig.Name,
+		State:        randomURLToken(),
+		Nonce:        randomURLToken(),
+		CodeVerifier: randomURLToken(),
+	}
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+
+	params := url.Values{}
+	params.Set("client_id", oidcConfig.ClientId)
+	params.Set("redirect_uri", callbackURL)
+	params.Set("response_type", "code")
+	params.Set("scope", oidcConfig.Scope)
+	params.Set("state", login.State)
+	params.Set("nonce", login.Nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	return endpoints.AuthorizationEndpoint + "?" + params.Encode(), login, nil
+}
+
+// HandleOIDCCallback checks state against the login started by InitiateOIDC,
+// exchanges the code with the PKCE verifier, and verifies the ID token's
+// signature, issuer, audience, expiry and nonce before reading userinfo.
+// The login is recorded in the session registry with its ID token, for
+// logout.
+func (s SSOService) HandleOIDCCallback(ctx context.Context, provider string, code, state string, callbackURL string, login *OIDCLogin) (*models.User, *models.UserSession, error) {
+	oidcConfig, err := s.oidcProvider(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	if login == nil || login.State == "" {
+		return nil, nil, fmt.Errorf("no OIDC login in progress")
+	}
+	if login.Provider != oidcConfig.Name {
+		return nil, nil, fmt.Errorf("OIDC login was started for provider %q", login.Provider)
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(login.State)) != 1 {
+		return nil, nil, fmt.Errorf("OIDC state mismatch")
+	}
+
+	// Use provided callback URL, fallback to config if not provided
+	if callbackURL == "" {
+		callbackURL = oidcConfig.CallbackURL
+	}
+
+	endpoints := s.oidcEndpoints(ctx, oidcConfig)
+	if endpoints.TokenEndpoint == "" {
+		return nil, nil, fmt.Errorf("OIDC token URL not configured")
+	}
+	if endpoints.UserInfoEndpoint == "" {
+		return nil, nil, fmt.Errorf("OIDC userinfo URL not configured")
+	}
+	if endpoints.Issuer == "" || endpoints.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("OIDC issuer not configured")
+	}
+
+	tokenData := url.Values{}
+	tokenData.Set("grant_type", "authorization_code")
+	tokenData.Set("code", code)
+	tokenData.Set("redirect_uri", callbackURL)
+	tokenData.Set("client_id", oidcConfig.ClientId)
+	tokenData.Set("client_secret", oidcConfig.ClientSecret)
+	tokenData.Set("code_verifier", login.CodeVerifier)
+
+	tokenReq, err := http.NewRequestWithContext(ctx, "POST", endpoints.TokenEndpoint, strings.NewReader(tokenData.Encode()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	tokenResp, err := s.client().Do(tokenReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+	defer tokenResp.Body.Close()
+
+	if tokenResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(tokenResp.Body)
+		return nil, nil, fmt.Errorf("token exchange failed: %s", string(body))
+	}
+
+	var tokenResult struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenResult); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResult.IDToken == "" {
+		return nil, nil, fmt.Errorf("token response missing id_token")
+	}
+
+	verifier := oidc.NewVerifier(endpoints.Issuer, s.oidcKeys.get(endpoints.JWKSURI, s.client()), &oidc.Config{
+		ClientID:             oidcConfig.ClientId,
+		SupportedSigningAlgs: endpoints.SigningAlgs,
+	})
+	idToken, err := verifier.Verify(ctx, tokenResult.IDToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(login.Nonce)) != 1 {
+		return nil, nil, fmt.Errorf("ID token nonce mismatch")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoints.UserInfoEndpoint, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create userinfo request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenResult.AccessToken)
+
+	userInfoResp, err := s.client().Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch userinfo: %w", err)
+	}
+	defer userInfoResp.Body.Close()
+
+	if userInfoResp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(userInfoResp.Body)
+		return nil, nil, fmt.Errorf("userinfo request failed: %s", string(body))
+	}
+
+	var userInfo map[string]interface{}
+	if err := json.NewDecoder(userInfoResp.Body).Decode(&userInfo); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode userinfo: %w", err)
+	}
+	if sub, _ := userInfo["sub"].(string); sub != idToken.Subject {
+		return nil, nil, fmt.Errorf("userinfo subject does not match ID token")
+	}
+
+	// Many providers put groups and roles only in the ID token, so its
+	// verified claims are read too; userinfo wins where both have a claim.
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode ID token claims: %w", err)
+	}
+	for key, value := range userInfo {
+		claims[key] = value
+	}
+
+	username := getStringFromMap(claims, oidcConfig.UsernameAttribute, "preferred_username", "sub")
+	email := getStringFromMap(claims, oidcConfig.EmailAttribute, "email")
+	firstName := getStringFromMap(claims, oidcConfig.FirstNameAttribute, "given_name")
+	lastName := getStringFromMap(claims, oidcConfig.LastNameAttribute, "family_name")
+	providerId := idToken.Subject
+
+	if username == "" && email == "" {
+		return nil, nil, fmt.Errorf("OIDC claims missing username and email")
+	}
+
+	role, err := s.mapRole(oidcConfig.RoleMapping, claims, oidcConfig.GroupsAttribute)
+	if err != nil {
+		s.logger.Warnf("OIDC login denied: provider=%s, username=%s, providerId=%s", oidcConfig.Name, username, providerId)
+		return nil, nil, err
+	}
+
+	emailVerified, _ := claims["email_verified"].(bool)
+	user, err := s.userRepo.FindOrCreateSSOUser(models.SSOLogin{
+		Provider:      "oidc:" + oidcConfig.Name,
+		Subject:       providerId,
+		Username:      username,
+		Email:         email,
+		FirstName:     firstName,
+		LastName:      lastName,
+		Role:          role,
+		LinkByEmail:   s.ssoConfig.LinkByEmail && emailVerified,
+		EmailVerified: emailVerified,
+	})
+	if errors.Is(err, models.ErrSSOEmailInUse) {
+		s.logger.Warnf("OIDC login refused: provider=%s, providerId=%s: email %s belongs to an existing user", oidcConfig.Name, providerId, email)
+		return nil, nil, fmt.Errorf("failed to find or create user: %w", err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find or create user: %w", err)
+	}
+	user.Groups = getStringSliceFromMap(claims, oidcConfig.GroupsAttribute)
+
+	var sessionClaims struct {
+		SID string `json:"sid"`
+	}
+	if err := idToken.Claims(&sessionClaims); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode ID token claims: %w", err)
+	}
+	session := &models.UserSession{
+		UserID:   user.ID,
+		Provider: "oidc:" + oidcConfig.Name,
+		SID:      sessionClaims.SID,
+		IDToken:  tokenResult.IDToken,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, nil, fmt.Errorf("failed to record session: %w", err)
+	}
+
+	s.logger.Infof("OIDC user authenticated: provider=%s, userId=%d, username=%s, providerId=%s", oidcConfig.Name, user.ID, user.Username, providerId)
+
+	return user, session, nil
+}
+
+// oidcEndpoints resolves the provider's endpoints from its (cached)
+// discovery document, falling back to the configured URLs and then to
+// Keycloak's layout under the issuer.
+func (s SSOService) oidcEndpoints(ctx context.Context, oidcConfig lib.OIDCConfig) oidcEndpoints {
+	issuer := strings.TrimSuffix(oidcConfig.Issuer, "/")
+
+	var endpoints oidcEndpoints
+	if issuer != "" {
+		if discovered, err := s.discoverOIDC(ctx, oidcConfig); err == nil {
+			endpoints = *discovered
+		} else {
+			s.logger.Debugf("OIDC discovery unavailable, using configured endpoints: %s", err.Error())
+		}
+	}
+
+	if endpoints.Issuer == "" {
+		endpoints.Issuer = oidcConfig.Issuer
+	}
+	if endpoints.AuthorizationEndpoint == "" {
+		endpoints.AuthorizationEndpoint = firstNonEmpty(oidcConfig.AuthorizationURL, keycloakEndpoint(issuer, "auth"))
+	}
+	if endpoints.TokenEndpoint == "" {
+		endpoints.TokenEndpoint = firstNonEmpty(oidcConfig.TokenURL, keycloakEndpoint(issuer, "token"))
+	}
+	if endpoints.UserInfoEndpoint == "" {
+		endpoints.UserInfoEndpoint = firstNonEmpty(oidcConfig.UserInfoURL, keycloakEndpoint(issuer, "userinfo"))
+	}
+	if endpoints.JWKSURI == "" {
+		endpoints.JWKSURI = firstNonEmpty(oidcConfig.JWKSURL, keycloakEndpoint(issuer, "certs"))
+	}
+	if endpoints.EndSessionEndpoint == "" {
+		endpoints.EndSessionEndpoint = firstNonEmpty(oidcConfig.EndSessionURL, keycloakEndpoint(issuer, "logout"))
+	}
+
+	return endpoints
+}
+
+// oidcProvider returns the enabled provider called name, or the first one
+// when name is empty.
+func (s SSOService) oidcProvider(name string) (lib.OIDCConfig, error) {
+	if !s.ssoConfig.Enabled {
+		return lib.OIDCConfig{}, fmt.Errorf("OIDC SSO is not enabled")
+	}
+	oidcConfig, ok := s.ssoConfig.OIDCProvider(name)
+	if !ok {
+		if name == "" {
+			return lib.OIDCConfig{}, fmt.Errorf("OIDC SSO is not enabled")
+		}
+		return lib.OIDCConfig{}, fmt.Errorf("unknown OIDC provider %q", name)
+	}
+	return oidcConfig, nil
+}
+
+// validateOIDCProviders checks that provider names are usable in the
+// /api/auth/oidc/:provider routes and unique.
+func validateOIDCProviders(providers []lib.OIDCConfig) error {
+	seen := make(map[string]bool)
+	for i, provider := range providers {
+		if !oidcProviderName.MatchString(provider.Name) || provider.Name == "callback" {
+			return fmt.Errorf("sso.oidc.providers[%d]: invalid name %q (use lowercase letters, digits and dashes)", i, provider.Name)
+		}
+		if seen[provider.Name] {
+			return fmt.Errorf("sso.oidc.providers[%d]: duplicate name %q", i, provider.Name)
+		}
+		seen[provider.Name] = true
+	}
+	return nil
+}
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func keycloakEndpoint(issuer, name string) string {
+	if issuer == "" {
+		return ""
+	}
+	return issuer + "/protocol/openid-connect/" + name
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func randomURLToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,488 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+)
+
+const testOIDCCallbackURL = "http://localhost:3001/api/auth/oidc/callback"
+
+// testOIDCProvider is a minimal OpenID provider: discovery, JWKS, token and
+// userinfo endpoints, issuing RS256 ID tokens for whatever login it is told
+// to answer.
+type testOIDCProvider struct {
+	server *httptest.Server
+
+	mu           sync.Mutex
+	key          *rsa.PrivateKey
+	kid          string
+	forgedKey    *rsa.PrivateKey
+	jwksRequests int
+	discoveries  int
+	issuer       string
+	userInfo     map[string]interface{}
+	tokenStatus  int
+	nonce        string
+	claims       map[string]interface{}
+	tokenForm    url.Values
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	p := &testOIDCProvider{
+		tokenStatus: http.StatusOK,
+		userInfo: map[string]interface{}{
+			"sub":                "user-123",
+			"preferred_username": "testuser",
+			"email":              "test@example.com",
+			"given_name":         "Test",
+			"family_name":        "User",
+		},
+	}
+	p.rotateKey(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.discoveries++
+		issuer := p.server.URL
+		if p.issuer != "" {
+			issuer = p.issuer
+		}
+		p.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                p.server.URL + "/auth",
+			"token_endpoint":                        p.server.URL + "/token",
+			"userinfo_endpoint":                     p.server.URL + "/userinfo",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"end_session_endpoint":                  p.server.URL + "/logout",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.jwksRequests++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": p.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.tokenForm = r.PostForm
+		if p.tokenStatus != http.StatusOK {
+			w.WriteHeader(p.tokenStatus)
+			w.Write([]byte("invalid_grant"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "test-access-token",
+			"id_token":     p.idToken(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer test-access-token" || p.userInfo == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("unauthorized"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.userInfo)
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *testOIDCProvider) rotateKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key, p.kid = key, kid
+}
+
+// idToken signs an ID token for the configured login; claims overrides or,
+// with a nil value, removes the defaults. Called with p.mu held.
+func (p *testOIDCProvider) idToken(t *testing.T) string {
+	claims := map[string]interface{}{
+		"iss":   p.server.URL,
+		"sub":   "user-123",
+		"aud":   "test-client",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": p.nonce,
+	}
+	for k, v := range p.claims {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+
+	return p.sign(t, claims)
+}
+
+// logoutToken signs a back-channel logout token; claims overrides or, with a
+// nil value, removes the defaults.
+func (p *testOIDCProvider) logoutToken(t *testing.T, claims map[string]interface{}) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token := map[string]interface{}{
+		"iss":    p.server.URL,
+		"sub":    "user-123",
+		"aud":    "test-client",
+		"exp":    time.Now().Add(2 * time.Minute).Unix(),
+		"iat":    time.Now().Unix(),
+		"jti":    randomURLToken(),
+		"sid":    "idp-session-1",
+		"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}},
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(token, k)
+		} else {
+			token[k] = v
+		}
+	}
+	return p.sign(t, token)
+}
+
+// sign returns claims as an RS256 JWT. Called with p.mu held.
+func (p *testOIDCProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	key := p.key
+	if p.forgedKey != nil {
+		key = p.forgedKey
+	}
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func setupOIDCService(t *testing.T, provider *testOIDCProvider) SSOService {
+	env := setupTestEnv()
+	db := setupTestDB(t)
+	service := SSOService{
+		logger:      setupTestLogger(),
+		env:         env,
+		ssoConfig:   lib.GetSSOConfig(env),
+		userRepo:    models.NewUserRepository(db),
+		sessionRepo: models.NewSessionRepository(db),
+		oidcKeys:    newOIDCKeySets(),
+		discovery:   newOIDCDiscoveryCache(),
+	}
+	service.ssoConfig.Enabled = true
+	service.ssoConfig.OIDC.Enabled = true
+	service.ssoConfig.OIDC.Issuer = provider.server.URL
+	service.ssoConfig.OIDC.ClientId = "test-client"
+	service.ssoConfig.OIDC.ClientSecret = "test-secret"
+	service.ssoConfig.OIDC.CallbackURL = testOIDCCallbackURL
+	return service
+}
+
+// startTestOIDCLogin runs InitiateOIDC and tells the provider which nonce to
+// put in the ID token, as a real provider would after the redirect.
+func startTestOIDCLogin(t *testing.T, service SSOService, provider *testOIDCProvider) (*OIDCLogin, url.Values) {
+	authURL, login, err := service.InitiateOIDC(context.Background(), "", testOIDCCallbackURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Invalid auth URL: %v", err)
+	}
+	params := parsed.Query()
+
+	provider.mu.Lock()
+	provider.nonce = params.Get("nonce")
+	provider.mu.Unlock()
+
+	return login, params
+}
+
+func TestSSOService_InitiateOIDC_PKCE(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+
+	login, params := startTestOIDCLogin(t, service, provider)
+
+	if params.Get("state") != login.State || login.State == "" {
+		t.Errorf("Expected state '%s' in auth URL, got '%s'", login.State, params.Get("state"))
+	}
+	if params.Get("nonce") != login.Nonce || login.Nonce == "" {
+		t.Errorf("Expected nonce '%s' in auth URL, got '%s'", login.Nonce, params.Get("nonce"))
+	}
+	if params.Get("code_challenge_method") != "S256" {
+		t.Errorf("Expected S256 challenge method, got '%s'", params.Get("code_challenge_method"))
+	}
+	digest := sha256.Sum256([]byte(login.CodeVerifier))
+	if params.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(digest[:]) {
+		t.Error("Expected code_challenge to be the S256 of the verifier")
+	}
+
+	other, _ := startTestOIDCLogin(t, service, provider)
+	if other.State == login.State || other.Nonce == login.Nonce || other.CodeVerifier == login.CodeVerifier {
+		t.Error("Expected every login to get fresh secrets")
+	}
+}
+
+func TestSSOService_HandleOIDCCallback_SendsCodeVerifier(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	login, _ := startTestOIDCLogin(t, service, provider)
+
+	if _, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if provider.tokenForm.Get("code_verifier") != login.CodeVerifier {
+		t.Errorf("Expected code_verifier '%s', got '%s'", login.CodeVerifier, provider.tokenForm.Get("code_verifier"))
+	}
+}
+
+func TestSSOService_HandleOIDCCallback_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		mutate   func(login *OIDCLogin) string
+		contains string
+	}{
+		{
+			name:     "state mismatch",
+			mutate:   func(login *OIDCLogin) string { return "forged-state" },
+			contains: "state mismatch",
+		},
+		{
+			name:     "no login in session",
+			mutate:   func(login *OIDCLogin) string { *login = OIDCLogin{}; return "" },
+			contains: "no OIDC login in progress",
+		},
+		{
+			name:     "nonce mismatch",
+			claims:   map[string]interface{}{"nonce": "replayed-nonce"},
+			contains: "nonce mismatch",
+		},
+		{
+			name:     "wrong audience",
+			claims:   map[string]interface{}{"aud": "another-client"},
+			contains: "audience",
+		},
+		{
+			name:     "wrong issuer",
+			claims:   map[string]interface{}{"iss": "https://evil.example.com"},
+			contains: "different provider",
+		},
+		{
+			name:     "expired",
+			claims:   map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()},
+			contains: "expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestOIDCProvider(t)
+			provider.claims = tt.claims
+			service := setupOIDCService(t, provider)
+			login, _ := startTestOIDCLogin(t, service, provider)
+
+			state := login.State
+			if tt.mutate != nil {
+				state = tt.mutate(login)
+			}
+
+			_, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", state, "", login)
+			if err == nil {
+				t.Fatal("Expected the callback to be rejected")
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing '%s', got '%s'", tt.contains, err.Error())
+			}
+		})
+	}
+}
+
+func TestSSOService_HandleOIDCCallback_UntrustedSignature(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	login, _ := startTestOIDCLogin(t, service, provider)
+
+	forged, _ := rsa.GenerateKey(rand.Reader, 2048)
+	provider.forgedKey = forged
+
+	_, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login)
+	if err == nil || !strings.Contains(err.Error(), "failed to verify ID token") {
+		t.Errorf("Expected signature verification to fail, got %v", err)
+	}
+}
+
+func TestSSOService_HandleOIDCCallback_KeyRotation(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+
+	login, _ := startTestOIDCLogin(t, service, provider)
+	if _, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	login, _ = startTestOIDCLogin(t, service, provider)
+	if _, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if provider.jwksRequests != 1 {
+		t.Errorf("Expected the key set to be cached, got %d fetches", provider.jwksRequests)
+	}
+
+	provider.rotateKey(t, "key-2")
+	login, _ = startTestOIDCLogin(t, service, provider)
+	if _, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login); err != nil {
+		t.Fatalf("Unexpected error after key rotation: %v", err)
+	}
+	if provider.jwksRequests != 2 {
+		t.Errorf("Expected the key set to be refetched for the new kid, got %d fetches", provider.jwksRequests)
+	}
+}
+
+func TestSSOService_HandleOIDCCallback_NamedProviders(t *testing.T) {
+	employees := newTestOIDCProvider(t)
+	contractors := newTestOIDCProvider(t)
+	service := setupOIDCService(t, employees)
+	service.ssoConfig.OIDCProviders = []lib.OIDCConfig{
+		{
+			Name: "employees", Enabled: true, Issuer: employees.server.URL,
+			ClientId: "test-client", UsernameAttribute: "preferred_username", GroupsAttribute: "groups",
+			RoleMapping: lib.RoleMapping{DefaultRole: models.RoleEditor},
+		},
+		{
+			Name: "contractors", Enabled: true, Issuer: contractors.server.URL,
+			ClientId: "test-client", UsernameAttribute: "email", GroupsAttribute: "groups",
+			RoleMapping: lib.RoleMapping{DefaultRole: models.RoleViewer},
+		},
+	}
+	contractors.userInfo["email"] = "contractor@example.com"
+
+	authURL, login, err := service.InitiateOIDC(context.Background(), "contractors", testOIDCCallbackURL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(authURL, contractors.server.URL) {
+		t.Errorf("Expected the contractors authorization endpoint, got %s", authURL)
+	}
+	if login.Provider != "contractors" {
+		t.Errorf("Expected login for 'contractors', got '%s'", login.Provider)
+	}
+	parsed, _ := url.Parse(authURL)
+	contractors.nonce = parsed.Query().Get("nonce")
+
+	if _, _, err := service.HandleOIDCCallback(context.Background(), "employees", "test-code", login.State, "", login); err == nil {
+		t.Error("Expected a login started for another provider to be rejected")
+	}
+
+	user, _, err := service.HandleOIDCCallback(context.Background(), "contractors", "test-code", login.State, "", login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.Username != "contractor@example.com" || user.Role != models.RoleViewer {
+		t.Errorf("Expected the contractors mappings to apply, got username '%s' role '%s'", user.Username, user.Role)
+	}
+
+	if _, _, err := service.InitiateOIDC(context.Background(), "partners", testOIDCCallbackURL); err == nil || !strings.Contains(err.Error(), "unknown OIDC provider") {
+		t.Errorf("Expected unknown provider error, got %v", err)
+	}
+}
+
+func TestValidateOIDCProviders(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []lib.OIDCConfig
+		valid     bool
+	}{
+		{"none", nil, true},
+		{"valid", []lib.OIDCConfig{{Name: "employees"}, {Name: "okta-2"}}, true},
+		{"missing name", []lib.OIDCConfig{{Name: ""}}, false},
+		{"reserved name", []lib.OIDCConfig{{Name: "callback"}}, false},
+		{"path characters", []lib.OIDCConfig{{Name: "a/b"}}, false},
+		{"duplicate", []lib.OIDCConfig{{Name: "okta"}, {Name: "okta"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOIDCProviders(tt.providers)
+			if (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestSSOService_HandleOIDCCallback_LinkByEmail(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	local := &models.User{Username: "local", Email: "test@example.com", Role: models.RoleViewer}
+	local.SetPassword("secret")
+	if err := service.userRepo.Create(local); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	login := func() (*models.User, error) {
+		l, _ := startTestOIDCLogin(t, service, provider)
+		user, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", l.State, "", l)
+		return user, err
+	}
+
+	if _, err := login(); err == nil {
+		t.Error("Expected the login to be refused while linking is off")
+	}
+
+	service.ssoConfig.LinkByEmail = true
+	if _, err := login(); err == nil {
+		t.Error("Expected an unverified email not to be linked")
+	}
+
+	provider.userInfo["email_verified"] = true
+	user, err := login()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.ID != local.ID {
+		t.Errorf("Expected the verified email to link user %d, got %d", local.ID, user.ID)
+	}
+}
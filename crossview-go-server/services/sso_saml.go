@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// InitiateSAML builds a SAML AuthnRequest for the HTTP-Redirect binding and
+// returns the URL to send the browser to, along with the request ID the
+// response must answer. The request is signed when an SP key is configured.
+func (s SSOService) InitiateSAML(ctx context.Context) (string, string, error) {
+	if !s.ssoConfig.Enabled || !s.ssoConfig.SAML.Enabled {
+		return "", "", fmt.Errorf("SAML SSO is not enabled")
+	}
+
+	samlConfig := s.ssoConfig.SAML
+
+	if samlConfig.EntryPoint == "" {
+		return "", "", fmt.Errorf("SAML entry point not configured")
+	}
+
+	sp, err := s.samlServiceProvider()
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := sp.MakeAuthenticationRequest(samlConfig.EntryPoint, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create SAML request: %w", err)
+	}
+
+	redirectURL, err := req.Redirect("", sp)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign SAML request: %w", err)
+	}
+
+	return redirectURL.String(), req.ID, nil
+}
+
+// HandleSAMLCallback validates a SAMLResponse posted to the assertion
+// consumer service: the signature against the IdP certificate, the issuer,
+// the audience, the destination and recipient, the validity window, that it
+// answers requestID and that its assertion hasn't been used before. The user
+// is then found or created from the assertion's attributes, and the login is
+// recorded in the session registry.
+func (s SSOService) HandleSAMLCallback(ctx context.Context, samlResponse string, requestID string) (*models.User, *models.UserSession, error) {
+	if !s.ssoConfig.Enabled || !s.ssoConfig.SAML.Enabled {
+		return nil, nil, fmt.Errorf("SAML SSO is not enabled")
+	}
+
+	samlConfig := s.ssoConfig.SAML
+
+	sp, err := s.samlServiceProvider()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	responseXML, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode SAML response: %w", err)
+	}
+
+	var possibleRequestIDs []string
+	if requestID != "" {
+		possibleRequestIDs = []string{requestID}
+	}
+
+	assertion, err := sp.ParseXMLResponse(responseXML, possibleRequestIDs)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) && invalid.PrivateErr != nil {
+			return nil, nil, fmt.Errorf("invalid SAML response: %w", invalid.PrivateErr)
+		}
+		return nil, nil, fmt.Errorf("invalid SAML response: %w", err)
+	}
+	if !s.samlAssertions.use(assertion.ID, samlAssertionExpiry(assertion), saml.TimeNow()) {
+		return nil, nil, fmt.Errorf("invalid SAML response: assertion %s has already been used", assertion.ID)
+	}
+
+	attributes := samlAttributes(assertion)
+	username := attributes.first(samlConfig.UsernameAttribute)
+	email := attributes.first(samlConfig.EmailAttribute)
+	firstName := attributes.first(samlConfig.FirstNameAttribute)
+	lastName := attributes.first(samlConfig.LastNameAttribute)
+
+	var nameID string
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		nameID = assertion.Subject.NameID.Value
+	}
+	if username == "" {
+		username = nameID
+	}
+
+	if username == "" && email == "" {
+		return nil, nil, fmt.Errorf("SAML assertion missing username and email")
+	}
+
+	if nameID == "" {
+		return nil, nil, fmt.Errorf("SAML assertion missing NameID")
+	}
+
+	user, err := s.userRepo.FindOrCreateSSOUser(models.SSOLogin{
+		Provider:    "saml",
+		Subject:     nameID,
+		Username:    username,
+		Email:       email,
+		FirstName:   firstName,
+		LastName:    lastName,
+		LinkByEmail: s.ssoConfig.LinkByEmail,
+		// The IdP signed the assertion, email attribute included.
+		EmailVerified: email != "",
+	})
+	if errors.Is(err, models.ErrSSOEmailInUse) {
+		s.logger.Warnf("SAML login refused: nameId=%s: email %s belongs to an existing user", nameID, email)
+		return nil, nil, fmt.Errorf("failed to find or create user: %w", err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find or create user: %w", err)
+	}
+
+	session := &models.UserSession{UserID: user.ID, Provider: "saml"}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, nil, fmt.Errorf("failed to record session: %w", err)
+	}
+
+	s.logger.Infof("SAML user authenticated: userId=%d, username=%s, nameId=%s", user.ID, user.Username, nameID)
+
+	return user, session, nil
+}
+
+// GetSAMLMetadata returns the service provider metadata to register with the
+// IdP.
+func (s SSOService) GetSAMLMetadata(ctx context.Context) ([]byte, error) {
+	if !s.ssoConfig.Enabled || !s.ssoConfig.SAML.Enabled {
+		return nil, fmt.Errorf("SAML SSO is not enabled")
+	}
+
+	sp, err := s.samlServiceProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SAML metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+// samlServiceProvider describes Crossview as a SAML service provider whose
+// assertion consumer service is the configured callback URL, trusting the
+// configured IdP. Responses are checked against that URL, so it must never
+// come from the request, whose Host and X-Forwarded-Host the client picks.
+func (s SSOService) samlServiceProvider() (*saml.ServiceProvider, error) {
+	samlConfig := s.ssoConfig.SAML
+
+	acsURL, err := parseSAMLCallbackURL(samlConfig.CallbackURL)
+	if err != nil {
+		return nil, err
+	}
+	metadataURL := *acsURL
+	metadataURL.Path = strings.TrimSuffix(metadataURL.Path, "/callback") + "/metadata"
+
+	idpCert, err := samlCertificateData(samlConfig.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML IdP certificate: %w", err)
+	}
+	if idpCert == "" {
+		return nil, fmt.Errorf("SAML IdP certificate not configured")
+	}
+
+	sp := &saml.ServiceProvider{
+		EntityID:    samlConfig.Issuer,
+		AcsURL:      *acsURL,
+		MetadataURL: metadataURL,
+		IDPMetadata: &saml.EntityDescriptor{
+			EntityID: samlConfig.IdPIssuer,
+			IDPSSODescriptors: []saml.IDPSSODescriptor{{
+				SSODescriptor: saml.SSODescriptor{
+					RoleDescriptor: saml.RoleDescriptor{
+						KeyDescriptors: []saml.KeyDescriptor{{
+							Use: "signing",
+							KeyInfo: saml.KeyInfo{
+								X509Data: saml.X509Data{
+									X509Certificates: []saml.X509Certificate{{Data: idpCert}},
+								},
+							},
+						}},
+					},
+				},
+				SingleSignOnServices: []saml.Endpoint{{
+					Binding:  saml.HTTPRedirectBinding,
+					Location: samlConfig.EntryPoint,
+				}},
+			}},
+		},
+	}
+
+	if samlConfig.PrivateKey != "" || samlConfig.SigningCert != "" {
+		key, cert, err := parseSAMLKeyPair(samlConfig.PrivateKey, samlConfig.SigningCert)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SAML signing key pair: %w", err)
+		}
+		sp.Key = key
+		sp.Certificate = cert
+		sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+
+	return sp, nil
+}
+
+// parseSAMLCallbackURL parses the configured assertion consumer service URL,
+// which must be absolute.
+func parseSAMLCallbackURL(callbackURL string) (*url.URL, error) {
+	if callbackURL == "" {
+		return nil, fmt.Errorf("SAML callback URL not configured")
+	}
+	acsURL, err := url.Parse(callbackURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML callback URL: %w", err)
+	}
+	if (acsURL.Scheme != "https" && acsURL.Scheme != "http") || acsURL.Host == "" {
+		return nil, fmt.Errorf("invalid SAML callback URL %q: must be an absolute http(s) URL", callbackURL)
+	}
+	return acsURL, nil
+}
+
+// validateSAMLConfig checks the settings an enabled SAML login can't do
+// without, so that a missing callback URL stops startup rather than logins.
+func validateSAMLConfig(ssoConfig lib.SSOConfig) error {
+	if !ssoConfig.Enabled || !ssoConfig.SAML.Enabled {
+		return nil
+	}
+	_, err := parseSAMLCallbackURL(ssoConfig.SAML.CallbackURL)
+	return err
+}
+
+// samlAssertionCache remembers the IDs of accepted assertions until they
+// expire, so that a captured response can't be posted again to log in. It
+// is kept in memory, so each replica refuses only the replays it sees.
+type samlAssertionCache struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+func newSAMLAssertionCache() *samlAssertionCache {
+	return &samlAssertionCache{ids: make(map[string]time.Time)}
+}
+
+// use records id as used until expires and reports whether it was unused.
+// Expired IDs are dropped, since their assertions would be refused anyway.
+func (c *samlAssertionCache) use(id string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for usedID, usedUntil := range c.ids {
+		if !now.Before(usedUntil) {
+			delete(c.ids, usedID)
+		}
+	}
+	if _, used := c.ids[id]; used {
+		return false
+	}
+	c.ids[id] = expires
+	return true
+}
+
+// samlAssertionExpiry returns when an assertion stops being accepted: at
+// its NotOnOrAfter condition or, without one, once its issue instant is too
+// old, in either case allowing for clock skew.
+func samlAssertionExpiry(assertion *saml.Assertion) time.Time {
+	expires := assertion.IssueInstant.Add(saml.MaxIssueDelay)
+	if assertion.Conditions != nil && !assertion.Conditions.NotOnOrAfter.IsZero() {
+		expires = assertion.Conditions.NotOnOrAfter
+	}
+	return expires.Add(saml.MaxClockSkew)
+}
+
+// samlCertificateData returns the base64 DER of a certificate given as PEM
+// or as bare base64, the way IdPs usually display it.
+func samlCertificateData(cert string) (string, error) {
+	cert = strings.TrimSpace(cert)
+	if cert == "" {
+		return "", nil
+	}
+	if block, _ := pem.Decode([]byte(cert)); block != nil {
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(block.Bytes), nil
+	}
+
+	data := strings.Join(strings.Fields(cert), "")
+	der, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("expected a PEM or base64 encoded certificate")
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+func parseSAMLKeyPair(keyPEM, certPEM string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	if keyPEM == "" || certPEM == "" {
+		return nil, nil, fmt.Errorf("both privateKey and signingCert are required")
+	}
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("privateKey is not PEM encoded")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes); err == nil {
+		key = parsed
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse privateKey: %w", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("privateKey must be an RSA key")
+		}
+		key = rsaKey
+	}
+
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("signingCert is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse signingCert: %w", err)
+	}
+
+	return key, cert, nil
+}
+
+type samlAttributeValues map[string][]string
+
+// samlAttributes collects an assertion's attribute values by name and by
+// friendly name, so either can be configured.
+func samlAttributes(assertion *saml.Assertion) samlAttributeValues {
+	values := samlAttributeValues{}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			for _, value := range attribute.Values {
+				if value.Value == "" {
+					continue
+				}
+				values[attribute.Name] = append(values[attribute.Name], value.Value)
+				if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+					values[attribute.FriendlyName] = append(values[attribute.FriendlyName], value.Value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func (v samlAttributeValues) first(name string) string {
+	if values := v[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
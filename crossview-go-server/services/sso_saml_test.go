@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"crossview-go-server/lib"
+	"crossview-go-server/models"
+
+	"github.com/beevik/etree"
+	"github.com/crewjam/saml"
+)
+
+const (
+	testSAMLCallbackURL = "http://localhost:3001/api/auth/saml/callback"
+	testSAMLIdPIssuer   = "https://idp.example.com/metadata"
+)
+
+type testSAMLKeyPair struct {
+	key     *rsa.PrivateKey
+	cert    *x509.Certificate
+	keyPEM  string
+	certPEM string
+}
+
+func newTestSAMLKeyPair(t *testing.T, commonName string) testSAMLKeyPair {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return testSAMLKeyPair{
+		key:     key,
+		cert:    cert,
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+func setupSAMLService(t *testing.T, idp, sp testSAMLKeyPair) SSOService {
+	env := setupTestEnv()
+	db := setupTestDB(t)
+	service := SSOService{
+		logger:      setupTestLogger(),
+		env:         env,
+		ssoConfig:   lib.GetSSOConfig(env),
+		userRepo:    models.NewUserRepository(db),
+		sessionRepo: models.NewSessionRepository(db),
+
+		samlAssertions: newSAMLAssertionCache(),
+	}
+	service.ssoConfig.Enabled = true
+	service.ssoConfig.SAML.Enabled = true
+	service.ssoConfig.SAML.CallbackURL = testSAMLCallbackURL
+	service.ssoConfig.SAML.EntryPoint = "https://idp.example.com/sso"
+	service.ssoConfig.SAML.Issuer = "crossview"
+	service.ssoConfig.SAML.IdPIssuer = testSAMLIdPIssuer
+	service.ssoConfig.SAML.Cert = idp.certPEM
+	service.ssoConfig.SAML.PrivateKey = sp.keyPEM
+	service.ssoConfig.SAML.SigningCert = sp.certPEM
+	return service
+}
+
+// makeTestSAMLResponse plays the IdP: it answers requestID with a signed
+// assertion for the service's SP metadata.
+func makeTestSAMLResponse(t *testing.T, service SSOService, idp testSAMLKeyPair, requestID string, now time.Time) string {
+	metadataXML, err := service.GetSAMLMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get SP metadata: %v", err)
+	}
+	var spMetadata saml.EntityDescriptor
+	if err := xml.Unmarshal(metadataXML, &spMetadata); err != nil {
+		t.Fatalf("Failed to parse SP metadata: %v", err)
+	}
+
+	metadataURL, _ := url.Parse(testSAMLIdPIssuer)
+	provider := &saml.IdentityProvider{
+		Key:         idp.key,
+		Certificate: idp.cert,
+		MetadataURL: *metadataURL,
+	}
+	req := &saml.IdpAuthnRequest{
+		IDP:                     provider,
+		HTTPRequest:             httptest.NewRequest("POST", "https://idp.example.com/sso", nil),
+		Request:                 saml.AuthnRequest{ID: requestID},
+		ServiceProviderMetadata: &spMetadata,
+		SPSSODescriptor:         &spMetadata.SPSSODescriptors[0],
+		ACSEndpoint:             &spMetadata.SPSSODescriptors[0].AssertionConsumerServices[0],
+		Now:                     now,
+	}
+	session := &saml.Session{
+		ID:       "session-1",
+		NameID:   "alice@example.com",
+		UserName: "alice",
+		CustomAttributes: []saml.Attribute{
+			{Name: service.ssoConfig.SAML.UsernameAttribute, Values: []saml.AttributeValue{{Value: "alice"}}},
+			{Name: service.ssoConfig.SAML.EmailAttribute, Values: []saml.AttributeValue{{Value: "alice@example.com"}}},
+			{Name: service.ssoConfig.SAML.FirstNameAttribute, Values: []saml.AttributeValue{{Value: "Alice"}}},
+			{Name: service.ssoConfig.SAML.LastNameAttribute, Values: []saml.AttributeValue{{Value: "Liddell"}}},
+		},
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatalf("Failed to make assertion: %v", err)
+	}
+	if err := req.MakeResponse(); err != nil {
+		t.Fatalf("Failed to make response: %v", err)
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(req.ResponseEl)
+	responseXML, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatalf("Failed to encode response: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(responseXML)
+}
+
+func TestSSOService_InitiateSAML_SignedRequest(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	sp := newTestSAMLKeyPair(t, "crossview")
+	service := setupSAMLService(t, idp, sp)
+
+	authURL, requestID, err := service.InitiateSAML(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if requestID == "" {
+		t.Error("Expected a request ID")
+	}
+	if !strings.HasPrefix(authURL, "https://idp.example.com/sso?SAMLRequest=") {
+		t.Errorf("Unexpected redirect URL '%s'", authURL)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	signed, signature, found := strings.Cut(parsed.RawQuery, "&Signature=")
+	if !found {
+		t.Fatal("Expected the request to be signed")
+	}
+	signatureValue, _ := url.QueryUnescape(signature)
+	signatureBytes, err := base64.StdEncoding.DecodeString(signatureValue)
+	if err != nil {
+		t.Fatalf("Failed to decode signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(&sp.key.PublicKey, crypto.SHA256, digest[:], signatureBytes); err != nil {
+		t.Errorf("Signature does not verify with the SP certificate: %v", err)
+	}
+}
+
+func TestSSOService_InitiateSAML_UnsignedWithoutKey(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	service := setupSAMLService(t, idp, testSAMLKeyPair{})
+
+	authURL, _, err := service.InitiateSAML(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(authURL, "Signature=") {
+		t.Errorf("Expected an unsigned request, got '%s'", authURL)
+	}
+}
+
+func TestSSOService_InitiateSAML_MissingIdPCert(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	sp := newTestSAMLKeyPair(t, "crossview")
+	service := setupSAMLService(t, idp, sp)
+	service.ssoConfig.SAML.Cert = ""
+
+	_, _, err := service.InitiateSAML(context.Background())
+	if err == nil || err.Error() != "SAML IdP certificate not configured" {
+		t.Errorf("Expected missing certificate error, got %v", err)
+	}
+}
+
+func TestSSOService_HandleSAMLCallback_Success(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	sp := newTestSAMLKeyPair(t, "crossview")
+	service := setupSAMLService(t, idp, sp)
+
+	_, requestID, err := service.InitiateSAML(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	response := makeTestSAMLResponse(t, service, idp, requestID, saml.TimeNow())
+
+	user, _, err := service.HandleSAMLCallback(context.Background(), response, requestID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("Expected username 'alice', got '%s'", user.Username)
+	}
+	if user.Email != "alice@example.com" {
+		t.Errorf("Expected email 'alice@example.com', got '%s'", user.Email)
+	}
+	if user.FirstName == nil || *user.FirstName != "Alice" || user.LastName == nil || *user.LastName != "Liddell" {
+		t.Errorf("Unexpected names: %v %v", user.FirstName, user.LastName)
+	}
+}
+
+func TestSSOService_HandleSAMLCallback_Replayed(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	sp := newTestSAMLKeyPair(t, "crossview")
+	service := setupSAMLService(t, idp, sp)
+	response := makeTestSAMLResponse(t, service, idp, "id-expected", saml.TimeNow())
+
+	if _, _, err := service.HandleSAMLCallback(context.Background(), response, "id-expected"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, err := service.HandleSAMLCallback(context.Background(), response, "id-expected")
+	if err == nil || !strings.Contains(err.Error(), "already been used") {
+		t.Errorf("Expected a replayed assertion to be rejected, got %v", err)
+	}
+}
+
+func TestSSOService_HandleSAMLCallback_Rejected(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	sp := newTestSAMLKeyPair(t, "crossview")
+	other := newTestSAMLKeyPair(t, "attacker")
+
+	tests := []struct {
+		name      string
+		signer    testSAMLKeyPair
+		requestID string
+		now       time.Time
+		configure func(*SSOService)
+		contains  string
+	}{
+		{
+			name:      "untrusted signature",
+			signer:    other,
+			requestID: "id-expected",
+			now:       saml.TimeNow(),
+			contains:  "certificate",
+		},
+		{
+			name:      "unknown request",
+			signer:    idp,
+			requestID: "id-other",
+			now:       saml.TimeNow(),
+			contains:  "InResponseTo",
+		},
+		{
+			name:      "expired",
+			signer:    idp,
+			requestID: "id-expected",
+			now:       saml.TimeNow().Add(-time.Hour),
+			contains:  "expired",
+		},
+		{
+			name:      "wrong issuer",
+			signer:    idp,
+			requestID: "id-expected",
+			now:       saml.TimeNow(),
+			configure: func(s *SSOService) { s.ssoConfig.SAML.IdPIssuer = "https://other-idp.example.com" },
+			contains:  "Issuer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := setupSAMLService(t, idp, sp)
+			response := makeTestSAMLResponse(t, service, tt.signer, tt.requestID, tt.now)
+			if tt.configure != nil {
+				tt.configure(&service)
+			}
+
+			_, _, err := service.HandleSAMLCallback(context.Background(), response, "id-expected")
+			if err == nil {
+				t.Fatal("Expected the response to be rejected")
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing '%s', got '%s'", tt.contains, err.Error())
+			}
+		})
+	}
+}
+
+func TestSSOService_HandleSAMLCallback_WrongAudience(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	sp := newTestSAMLKeyPair(t, "crossview")
+	service := setupSAMLService(t, idp, sp)
+	service.ssoConfig.SAML.Issuer = "another-sp"
+	response := makeTestSAMLResponse(t, service, idp, "id-expected", saml.TimeNow())
+
+	service.ssoConfig.SAML.Issuer = "crossview"
+	_, _, err := service.HandleSAMLCallback(context.Background(), response, "id-expected")
+	if err == nil || !strings.Contains(err.Error(), "AudienceRestriction") {
+		t.Errorf("Expected audience error, got %v", err)
+	}
+}
+
+func TestSSOService_GetSAMLMetadata(t *testing.T) {
+	idp := newTestSAMLKeyPair(t, "idp")
+	sp := newTestSAMLKeyPair(t, "crossview")
+	service := setupSAMLService(t, idp, sp)
+
+	metadataXML, err := service.GetSAMLMetadata(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var metadata saml.EntityDescriptor
+	if err := xml.Unmarshal(metadataXML, &metadata); err != nil {
+		t.Fatalf("Failed to parse metadata: %v", err)
+	}
+	if metadata.EntityID != "crossview" {
+		t.Errorf("Expected entity ID 'crossview', got '%s'", metadata.EntityID)
+	}
+	descriptor := metadata.SPSSODescriptors[0]
+	if descriptor.AuthnRequestsSigned == nil || !*descriptor.AuthnRequestsSigned {
+		t.Error("Expected metadata to declare signed requests")
+	}
+	if descriptor.AssertionConsumerServices[0].Location != testSAMLCallbackURL {
+		t.Errorf("Unexpected ACS location '%s'", descriptor.AssertionConsumerServices[0].Location)
+	}
+}
+
+func TestValidateSAMLConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		callbackURL string
+		valid       bool
+	}{
+		{"absolute https", "https://crossview.example.com/api/auth/saml/callback", true},
+		{"missing", "", false},
+		{"relative", "/api/auth/saml/callback", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := lib.SSOConfig{Enabled: true, SAML: lib.SAMLConfig{Enabled: true, CallbackURL: tt.callbackURL}}
+			if err := validateSAMLConfig(config); (err == nil) != tt.valid {
+				t.Errorf("Expected valid=%t, got %v", tt.valid, err)
+			}
+		})
+	}
+
+	if err := validateSAMLConfig(lib.SSOConfig{Enabled: true}); err != nil {
+		t.Errorf("Expected no callback URL to be needed with SAML off, got %v", err)
+	}
+}
+
+func TestSAMLAssertionCache(t *testing.T) {
+	cache := newSAMLAssertionCache()
+	now := time.Now()
+
+	if !cache.use("a", now.Add(time.Minute), now) {
+		t.Fatal("Expected a new assertion to be accepted")
+	}
+	if cache.use("a", now.Add(time.Minute), now.Add(30*time.Second)) {
+		t.Error("Expected a used assertion to be refused")
+	}
+	cache.use("b", now.Add(3*time.Minute), now.Add(2*time.Minute))
+	if _, kept := cache.ids["a"]; kept {
+		t.Error("Expected expired assertion IDs to be dropped")
+	}
+}
@@ -1,35 +1,56 @@
 package services
 
 import (
-	"context"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"net/url"
-	"strings"
 
 	"crossview-go-server/lib"
 	"crossview-go-server/models"
 )
 
+// ErrSSOLoginDenied is returned when a role mapping refuses an SSO user.
+var ErrSSOLoginDenied = errors.New("login denied by role mapping")
+
 type SSOService struct {
-	logger    lib.Logger
-	env       lib.Env
-	ssoConfig lib.SSOConfig
-	userRepo  *models.UserRepository
+	logger      lib.Logger
+	env         lib.Env
+	ssoConfig   lib.SSOConfig
+	userRepo    *models.UserRepository
+	sessionRepo *models.SessionRepository
+	oidcKeys    *oidcKeySets
+	discovery   *oidcDiscoveryCache
+	httpClient  *http.Client
+
+	samlAssertions *samlAssertionCache
 }
 
-func NewSSOService(logger lib.Logger, env lib.Env, db lib.Database) SSOServiceInterface {
+func NewSSOService(logger lib.Logger, env lib.Env, db lib.Database) (SSOServiceInterface, error) {
 	userRepo := models.NewUserRepository(db.DB)
-	return SSOService{
-		logger:    logger,
-		env:       env,
-		ssoConfig: lib.GetSSOConfig(env),
-		userRepo:  userRepo,
+	sessionRepo := models.NewSessionRepository(db.DB)
+	ssoConfig := lib.GetSSOConfig(env)
+	httpClient, err := newSSOHTTPClient(ssoConfig.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSO HTTP configuration: %w", err)
+	}
+	if err := validateOIDCProviders(ssoConfig.OIDCProviders); err != nil {
+		return nil, fmt.Errorf("invalid SSO configuration: %w", err)
 	}
+	if err := validateSAMLConfig(ssoConfig); err != nil {
+		return nil, fmt.Errorf("invalid SSO configuration: %w", err)
+	}
+	return SSOService{
+		logger:      logger,
+		env:         env,
+		ssoConfig:   ssoConfig,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		oidcKeys:    newOIDCKeySets(),
+		discovery:   newOIDCDiscoveryCache(),
+		httpClient:  httpClient,
+
+		samlAssertions: newSAMLAssertionCache(),
+	}, nil
 }
 
 func (s SSOService) GetSSOStatus() lib.SSOConfig {
@@ -39,215 +60,88 @@ func (s SSOService) GetSSOStatus() lib.SSOConfig {
 	return lib.SSOConfig{Enabled: false}
 }
 
-func (s SSOService) InitiateOIDC(ctx context.Context, callbackURL string) (string, error) {
-	if !s.ssoConfig.Enabled {
-		return "", fmt.Errorf("OIDC SSO is not enabled")
-	}
-	if !s.ssoConfig.OIDC.Enabled {
-		return "", fmt.Errorf("OIDC SSO is not enabled")
-	}
-	
-	oidcConfig := s.ssoConfig.OIDC
-	
-	// Use provided callback URL, fallback to config if not provided
-	if callbackURL == "" {
-		callbackURL = oidcConfig.CallbackURL
-	}
-	
-	var authURL string
-	var state string
-	
-	if oidcConfig.Issuer != "" {
-		discoveryURL := strings.TrimSuffix(oidcConfig.Issuer, "/") + "/.well-known/openid-configuration"
-		
-		resp, err := http.Get(discoveryURL)
-		if err == nil {
-			defer resp.Body.Close()
-			var discovery struct {
-				AuthorizationEndpoint string `json:"authorization_endpoint"`
-				TokenEndpoint         string `json:"token_endpoint"`
-				UserInfoEndpoint      string `json:"userinfo_endpoint"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&discovery); err == nil {
-				if discovery.AuthorizationEndpoint != "" {
-					authURL = discovery.AuthorizationEndpoint
-				}
-			}
+// mapRole returns the role the mapping assigns for claims. When several rules
+// match, the most privileged role wins; when none do, the default applies.
+// An empty role means the mapping does not decide, and the user keeps their
+// current role.
+func (s SSOService) mapRole(mapping lib.RoleMapping, claims map[string]interface{}, groupsAttribute string) (string, error) {
+	if !mapping.Configured() {
+		return "", nil
+	}
+	
+	best := -1
+	for _, rule := range mapping.Rules {
+		claim := rule.Claim
+		if claim == "" {
+			claim = groupsAttribute
 		}
-	}
-	
-	if authURL == "" {
-		if oidcConfig.AuthorizationURL != "" {
-			authURL = oidcConfig.AuthorizationURL
-		} else if oidcConfig.Issuer != "" {
-			authURL = strings.TrimSuffix(oidcConfig.Issuer, "/") + "/protocol/openid-connect/auth"
-		} else {
-			return "", fmt.Errorf("OIDC authorization URL not configured")
+		if !containsString(getStringSliceFromMap(claims, claim), rule.Value) {
+			continue
 		}
-	}
-	
-	stateBytes := make([]byte, 32)
-	rand.Read(stateBytes)
-	state = base64.URLEncoding.EncodeToString(stateBytes)
-	
-	params := url.Values{}
-	params.Set("client_id", oidcConfig.ClientId)
-	params.Set("redirect_uri", callbackURL)
-	params.Set("response_type", "code")
-	params.Set("scope", oidcConfig.Scope)
-	params.Set("state", state)
-	
-	authURL = authURL + "?" + params.Encode()
-	
-	return authURL, nil
-}
-
-func (s SSOService) HandleOIDCCallback(ctx context.Context, code, state string, callbackURL string) (*models.User, error) {
-	if !s.ssoConfig.Enabled || !s.ssoConfig.OIDC.Enabled {
-		return nil, fmt.Errorf("OIDC SSO is not enabled")
-	}
-	if !s.ssoConfig.Enabled || !s.ssoConfig.OIDC.Enabled {
-		return nil, fmt.Errorf("OIDC SSO is not enabled")
-	}
-	
-	oidcConfig := s.ssoConfig.OIDC
-	
-	// Use provided callback URL, fallback to config if not provided
-	if callbackURL == "" {
-		callbackURL = oidcConfig.CallbackURL
-	}
-	
-	var tokenURL string
-	var userInfoURL string
-	
-	if oidcConfig.Issuer != "" {
-		discoveryURL := strings.TrimSuffix(oidcConfig.Issuer, "/") + "/.well-known/openid-configuration"
-		
-		resp, err := http.Get(discoveryURL)
-		if err == nil {
-			defer resp.Body.Close()
-			var discovery struct {
-				TokenEndpoint    string `json:"token_endpoint"`
-				UserInfoEndpoint string `json:"userinfo_endpoint"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&discovery); err == nil {
-				if discovery.TokenEndpoint != "" {
-					tokenURL = discovery.TokenEndpoint
-				}
-				if discovery.UserInfoEndpoint != "" {
-					userInfoURL = discovery.UserInfoEndpoint
-				}
-			}
-		}
-	}
-	
-	if tokenURL == "" {
-		if oidcConfig.TokenURL != "" {
-			tokenURL = oidcConfig.TokenURL
-		} else if oidcConfig.Issuer != "" {
-			tokenURL = strings.TrimSuffix(oidcConfig.Issuer, "/") + "/protocol/openid-connect/token"
-		} else {
-			return nil, fmt.Errorf("OIDC token URL not configured")
+		rank := roleRank(rule.Role)
+		if rank < 0 {
+			s.logger.Warnf("Ignoring role mapping rule for %s=%s: invalid role %q", claim, rule.Value, rule.Role)
+			continue
 		}
-	}
-	
-	if userInfoURL == "" {
-		if oidcConfig.UserInfoURL != "" {
-			userInfoURL = oidcConfig.UserInfoURL
-		} else if oidcConfig.Issuer != "" {
-			userInfoURL = strings.TrimSuffix(oidcConfig.Issuer, "/") + "/protocol/openid-connect/userinfo"
-		} else {
-			return nil, fmt.Errorf("OIDC userinfo URL not configured")
+		if rank > best {
+			best = rank
 		}
 	}
-	
-	tokenData := url.Values{}
-	tokenData.Set("grant_type", "authorization_code")
-	tokenData.Set("code", code)
-	tokenData.Set("redirect_uri", callbackURL)
-	tokenData.Set("client_id", oidcConfig.ClientId)
-	tokenData.Set("client_secret", oidcConfig.ClientSecret)
-	
-	tokenResp, err := http.PostForm(tokenURL, tokenData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
-	}
-	defer tokenResp.Body.Close()
-	
-	if tokenResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(tokenResp.Body)
-		return nil, fmt.Errorf("token exchange failed: %s", string(body))
+	if best >= 0 {
+		return models.Roles[best], nil
 	}
 	
-	var tokenResult struct {
-		AccessToken string `json:"access_token"`
+	switch mapping.DefaultRole {
+	case "":
+		return "", nil
+	case lib.RoleMappingDeny:
+		return "", ErrSSOLoginDenied
 	}
-	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenResult); err != nil {
-		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	if !models.IsValidRole(mapping.DefaultRole) {
+		return "", fmt.Errorf("invalid default role in role mapping: %s", mapping.DefaultRole)
 	}
-	
-	req, err := http.NewRequest("GET", userInfoURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create userinfo request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+tokenResult.AccessToken)
-	
-	userInfoResp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch userinfo: %w", err)
-	}
-	defer userInfoResp.Body.Close()
-	
-	if userInfoResp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(userInfoResp.Body)
-		return nil, fmt.Errorf("userinfo request failed: %s", string(body))
-	}
-	
-	var userInfo map[string]interface{}
-	if err := json.NewDecoder(userInfoResp.Body).Decode(&userInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode userinfo: %w", err)
-	}
-	
-	username := getStringFromMap(userInfo, oidcConfig.UsernameAttribute, "preferred_username", "sub")
-	email := getStringFromMap(userInfo, oidcConfig.EmailAttribute, "email")
-	firstName := getStringFromMap(userInfo, oidcConfig.FirstNameAttribute, "given_name")
-	lastName := getStringFromMap(userInfo, oidcConfig.LastNameAttribute, "family_name")
-	providerId := getStringFromMap(userInfo, "sub", "")
-	
-	if username == "" && email == "" {
-		return nil, fmt.Errorf("OIDC userinfo missing username and email")
-	}
-	
-	user, err := s.userRepo.FindOrCreateSSOUser(username, email, firstName, lastName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to find or create user: %w", err)
-	}
-	
-	s.logger.Infof("OIDC user authenticated: userId=%d, username=%s, providerId=%s", user.ID, user.Username, providerId)
-	
-	return user, nil
+	return models.NormalizeRole(mapping.DefaultRole), nil
 }
 
-func (s SSOService) InitiateSAML(ctx context.Context, callbackURL string) (string, error) {
-	if !s.ssoConfig.Enabled || !s.ssoConfig.SAML.Enabled {
-		return "", fmt.Errorf("SAML SSO is not enabled")
+func roleRank(role string) int {
+	role = models.NormalizeRole(role)
+	for i, r := range models.Roles {
+		if r == role {
+			return i
+		}
 	}
-	
-	samlConfig := s.ssoConfig.SAML
-	
-	if samlConfig.EntryPoint == "" {
-		return "", fmt.Errorf("SAML entry point not configured")
+	return -1
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
-	
-	return samlConfig.EntryPoint, nil
+	return false
 }
 
-func (s SSOService) HandleSAMLCallback(ctx context.Context, samlResponse string, callbackURL string) (*models.User, error) {
-	if !s.ssoConfig.Enabled || !s.ssoConfig.SAML.Enabled {
-		return nil, fmt.Errorf("SAML SSO is not enabled")
+// getStringSliceFromMap reads a claim that may be a list of strings or a
+// single string.
+func getStringSliceFromMap(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				values = append(values, str)
+			}
+		}
+		return values
+	case []string:
+		return v
+	case string:
+		if v != "" {
+			return []string{v}
+		}
 	}
-	
-	return nil, fmt.Errorf("SAML callback not yet implemented - requires SAML library")
+	return nil
 }
 
 func getStringFromMap(m map[string]interface{}, keys ...string) string {
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -20,7 +21,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.User{})
+	err = db.AutoMigrate(&models.User{}, &models.UserIdentity{}, &models.UserSession{})
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
@@ -67,7 +68,7 @@ func TestSSOService_InitiateOIDC_NotEnabled(t *testing.T) {
 		ssoConfig: lib.SSOConfig{Enabled: false, OIDC: lib.OIDCConfig{Enabled: false}},
 		userRepo:  models.NewUserRepository(db),
 	}
-	_, err := service.InitiateOIDC(context.Background(), "")
+	_, _, err := service.InitiateOIDC(context.Background(), "", "")
 
 	if err == nil {
 		t.Error("Expected error when OIDC is not enabled")
@@ -81,12 +82,15 @@ func TestSSOService_InitiateOIDC_NotEnabled(t *testing.T) {
 
 func TestSSOService_InitiateOIDC_WithIssuer(t *testing.T) {
 	authEndpoint := "http://test-auth.example.com/auth"
-	discoveryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var discoveryServer *httptest.Server
+	discoveryServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/.well-known/openid-configuration" {
 			discovery := map[string]string{
+				"issuer":                  discoveryServer.URL,
 				"authorization_endpoint": authEndpoint,
 				"token_endpoint":          "http://test-auth.example.com/token",
 				"userinfo_endpoint":       "http://test-auth.example.com/userinfo",
+				"jwks_uri":                "http://test-auth.example.com/certs",
 			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(discovery)
@@ -111,7 +115,7 @@ func TestSSOService_InitiateOIDC_WithIssuer(t *testing.T) {
 	service.ssoConfig.OIDC.CallbackURL = "http://localhost:3001/api/auth/oidc/callback"
 	service.ssoConfig.OIDC.Scope = "openid profile email"
 
-	authURL, err := service.InitiateOIDC(context.Background(), "http://localhost:3001/api/auth/oidc/callback")
+	authURL, _, err := service.InitiateOIDC(context.Background(), "", "http://localhost:3001/api/auth/oidc/callback")
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -147,7 +151,7 @@ func TestSSOService_InitiateOIDC_WithAuthorizationURL(t *testing.T) {
 	service.ssoConfig.OIDC.CallbackURL = "http://localhost:3001/api/auth/oidc/callback"
 	service.ssoConfig.OIDC.Scope = "openid profile email"
 
-	authURL, err := service.InitiateOIDC(context.Background(), "http://localhost:3001/api/auth/oidc/callback")
+	authURL, _, err := service.InitiateOIDC(context.Background(), "", "http://localhost:3001/api/auth/oidc/callback")
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -176,7 +180,7 @@ func TestSSOService_InitiateOIDC_NoConfig(t *testing.T) {
 	service.ssoConfig.OIDC.Issuer = ""
 	service.ssoConfig.OIDC.AuthorizationURL = ""
 
-	_, err := service.InitiateOIDC(context.Background(), "http://localhost:3001/api/auth/oidc/callback")
+	_, _, err := service.InitiateOIDC(context.Background(), "", "http://localhost:3001/api/auth/oidc/callback")
 	if err == nil {
 		t.Error("Expected error when authorization URL is not configured")
 	}
@@ -193,7 +197,7 @@ func TestSSOService_HandleOIDCCallback_NotEnabled(t *testing.T) {
 		ssoConfig: lib.SSOConfig{Enabled: false, OIDC: lib.OIDCConfig{Enabled: false}},
 		userRepo:  models.NewUserRepository(db),
 	}
-	_, err := service.HandleOIDCCallback(context.Background(), "code", "state", "http://localhost:3001/api/auth/oidc/callback")
+	_, _, err := service.HandleOIDCCallback(context.Background(), "", "code", "state", "http://localhost:3001/api/auth/oidc/callback", nil)
 
 	if err == nil {
 		t.Error("Expected error when OIDC is not enabled")
@@ -206,78 +210,11 @@ func TestSSOService_HandleOIDCCallback_NotEnabled(t *testing.T) {
 }
 
 func TestSSOService_HandleOIDCCallback_Success(t *testing.T) {
-	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		
-		if r.Method != "POST" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			json.NewEncoder(w).Encode(map[string]string{"error": "method_not_allowed"})
-			return
-		}
-		
-		if r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
-			r.ParseMultipartForm(10 << 20)
-		} else {
-			r.ParseForm()
-		}
-		
-		grantType := r.FormValue("grant_type")
-		if grantType != "authorization_code" {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
-			return
-		}
-		
-		code := r.FormValue("code")
-		if code == "" {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request", "error_description": "code is required"})
-			return
-		}
-		
-		tokenResponse := map[string]string{
-			"access_token": "test-access-token",
-		}
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(tokenResponse)
-	}))
-	defer tokenServer.Close()
-
-	userInfoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" {
-			userInfo := map[string]interface{}{
-				"sub":                "user-123",
-				"preferred_username": "testuser",
-				"email":              "test@example.com",
-				"given_name":         "Test",
-				"family_name":        "User",
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(userInfo)
-		}
-	}))
-	defer userInfoServer.Close()
-
-	db := setupTestDB(t)
-	logger := setupTestLogger()
-	env := setupTestEnv()
+	provider := newTestOIDCProvider(t)
+	service := setupOIDCService(t, provider)
+	login, _ := startTestOIDCLogin(t, service, provider)
 
-	service := SSOService{
-		logger:    logger,
-		env:       env,
-		ssoConfig: lib.GetSSOConfig(env),
-		userRepo:  models.NewUserRepository(db),
-	}
-	service.ssoConfig.Enabled = true
-	service.ssoConfig.OIDC.Enabled = true
-	service.ssoConfig.OIDC.Issuer = ""
-	service.ssoConfig.OIDC.TokenURL = tokenServer.URL
-	service.ssoConfig.OIDC.UserInfoURL = userInfoServer.URL
-	service.ssoConfig.OIDC.ClientId = "test-client"
-	service.ssoConfig.OIDC.ClientSecret = "test-secret"
-	service.ssoConfig.OIDC.CallbackURL = "http://localhost:3001/api/auth/oidc/callback"
-
-	user, err := service.HandleOIDCCallback(context.Background(), "test-code", "test-state", "")
+	user, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
@@ -296,113 +233,54 @@ func TestSSOService_HandleOIDCCallback_Success(t *testing.T) {
 }
 
 func TestSSOService_HandleOIDCCallback_TokenExchangeFailure(t *testing.T) {
-	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid_grant"))
-	}))
-	defer tokenServer.Close()
-
-	db := setupTestDB(t)
-	logger := setupTestLogger()
-	env := setupTestEnv()
+	provider := newTestOIDCProvider(t)
+	provider.tokenStatus = http.StatusBadRequest
+	service := setupOIDCService(t, provider)
+	login, _ := startTestOIDCLogin(t, service, provider)
 
-	service := SSOService{
-		logger:    logger,
-		env:       env,
-		ssoConfig: lib.GetSSOConfig(env),
-		userRepo:  models.NewUserRepository(db),
-	}
-	service.ssoConfig.Enabled = true
-	service.ssoConfig.OIDC.Enabled = true
-	service.ssoConfig.OIDC.ClientId = "test-client"
-	service.ssoConfig.OIDC.ClientSecret = "test-secret"
-	service.ssoConfig.OIDC.CallbackURL = "http://localhost:3001/api/auth/oidc/callback"
-	service.ssoConfig.OIDC.TokenURL = tokenServer.URL
-
-	_, err := service.HandleOIDCCallback(context.Background(), "test-code", "test-state", "http://localhost:3001/api/auth/oidc/callback")
+	_, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login)
 	if err == nil {
 		t.Error("Expected error when token exchange fails")
 	}
 }
 
 func TestSSOService_HandleOIDCCallback_UserInfoFailure(t *testing.T) {
-	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenResponse := map[string]string{
-			"access_token": "test-access-token",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(tokenResponse)
-	}))
-	defer tokenServer.Close()
-
-	userInfoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("unauthorized"))
-	}))
-	defer userInfoServer.Close()
-
-	db := setupTestDB(t)
-	logger := setupTestLogger()
-	env := setupTestEnv()
-
-	service := SSOService{
-		logger:    logger,
-		env:       env,
-		ssoConfig: lib.GetSSOConfig(env),
-		userRepo:  models.NewUserRepository(db),
-	}
-	service.ssoConfig.Enabled = true
-	service.ssoConfig.OIDC.Enabled = true
-	service.ssoConfig.OIDC.ClientId = "test-client"
-	service.ssoConfig.OIDC.ClientSecret = "test-secret"
-	service.ssoConfig.OIDC.CallbackURL = "http://localhost:3001/api/auth/oidc/callback"
-	service.ssoConfig.OIDC.TokenURL = tokenServer.URL
-	service.ssoConfig.OIDC.UserInfoURL = userInfoServer.URL
+	provider := newTestOIDCProvider(t)
+	provider.userInfo = nil
+	service := setupOIDCService(t, provider)
+	login, _ := startTestOIDCLogin(t, service, provider)
 
-	_, err := service.HandleOIDCCallback(context.Background(), "test-code", "test-state", "http://localhost:3001/api/auth/oidc/callback")
+	_, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login)
 	if err == nil {
 		t.Error("Expected error when userinfo request fails")
 	}
 }
 
 func TestSSOService_HandleOIDCCallback_MissingUserInfo(t *testing.T) {
-	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenResponse := map[string]string{
-			"access_token": "test-access-token",
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(tokenResponse)
-	}))
-	defer tokenServer.Close()
-
-	userInfoServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userInfo := map[string]interface{}{}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(userInfo)
-	}))
-	defer userInfoServer.Close()
-
-	db := setupTestDB(t)
-	logger := setupTestLogger()
-	env := setupTestEnv()
+	provider := newTestOIDCProvider(t)
+	provider.userInfo = map[string]interface{}{"sub": "user-123"}
+	service := setupOIDCService(t, provider)
+	service.ssoConfig.OIDC.UsernameAttribute = "preferred_username"
+	login, _ := startTestOIDCLogin(t, service, provider)
 
-	service := SSOService{
-		logger:    logger,
-		env:       env,
-		ssoConfig: lib.GetSSOConfig(env),
-		userRepo:  models.NewUserRepository(db),
+	user, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
 	}
-	service.ssoConfig.Enabled = true
-	service.ssoConfig.OIDC.Enabled = true
-	service.ssoConfig.OIDC.ClientId = "test-client"
-	service.ssoConfig.OIDC.ClientSecret = "test-secret"
-	service.ssoConfig.OIDC.CallbackURL = "http://localhost:3001/api/auth/oidc/callback"
-	service.ssoConfig.OIDC.TokenURL = tokenServer.URL
-	service.ssoConfig.OIDC.UserInfoURL = userInfoServer.URL
+	if user.Username != "user-123" {
+		t.Errorf("Expected username to fall back to the subject, got '%s'", user.Username)
+	}
+}
 
-	_, err := service.HandleOIDCCallback(context.Background(), "test-code", "test-state", "http://localhost:3001/api/auth/oidc/callback")
+func TestSSOService_HandleOIDCCallback_SubjectMismatch(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	provider.userInfo["sub"] = "someone-else"
+	service := setupOIDCService(t, provider)
+	login, _ := startTestOIDCLogin(t, service, provider)
+
+	_, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", login.State, "", login)
 	if err == nil {
-		t.Error("Expected error when userinfo is missing username and email")
+		t.Error("Expected error when userinfo belongs to another subject")
 	}
 }
 
@@ -417,7 +295,7 @@ func TestSSOService_InitiateSAML_NotEnabled(t *testing.T) {
 		ssoConfig: lib.SSOConfig{Enabled: false, SAML: lib.SAMLConfig{Enabled: false}},
 		userRepo:  models.NewUserRepository(db),
 	}
-	_, err := service.InitiateSAML(context.Background(), "")
+	_, _, err := service.InitiateSAML(context.Background())
 
 	if err == nil {
 		t.Error("Expected error when SAML is not enabled")
@@ -443,14 +321,19 @@ func TestSSOService_InitiateSAML_Success(t *testing.T) {
 	service.ssoConfig.Enabled = true
 	service.ssoConfig.SAML.Enabled = true
 	service.ssoConfig.SAML.EntryPoint = "http://example.com/saml/login"
+	service.ssoConfig.SAML.CallbackURL = "http://localhost:3001/api/auth/saml/callback"
+	service.ssoConfig.SAML.Cert = newTestSAMLKeyPair(t, "idp").certPEM
 
-	entryPoint, err := service.InitiateSAML(context.Background(), "")
+	authURL, requestID, err := service.InitiateSAML(context.Background())
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	if entryPoint != "http://example.com/saml/login" {
-		t.Errorf("Expected entry point 'http://example.com/saml/login', got '%s'", entryPoint)
+	if !strings.HasPrefix(authURL, "http://example.com/saml/login?SAMLRequest=") {
+		t.Errorf("Expected redirect to 'http://example.com/saml/login' with a SAMLRequest, got '%s'", authURL)
+	}
+	if requestID == "" {
+		t.Error("Expected a request ID")
 	}
 }
 
@@ -469,9 +352,9 @@ func TestSSOService_InitiateSAML_NoEntryPoint(t *testing.T) {
 	service.ssoConfig.SAML.Enabled = true
 	service.ssoConfig.SAML.EntryPoint = ""
 
-	_, err := service.InitiateSAML(context.Background(), "")
+	_, _, err := service.InitiateSAML(context.Background())
 	if err == nil {
-		t.Error("Expected error when entry point is not configured")
+		t.Fatal("Expected error when entry point is not configured")
 	}
 	
 	if err.Error() != "SAML entry point not configured" {
@@ -490,7 +373,7 @@ func TestSSOService_HandleSAMLCallback_NotEnabled(t *testing.T) {
 		ssoConfig: lib.SSOConfig{Enabled: false, SAML: lib.SAMLConfig{Enabled: false}},
 		userRepo:  models.NewUserRepository(db),
 	}
-	_, err := service.HandleSAMLCallback(context.Background(), "saml-response", "http://localhost:3001/api/auth/saml/callback")
+	_, _, err := service.HandleSAMLCallback(context.Background(), "saml-response", "")
 
 	if err == nil {
 		t.Error("Expected error when SAML is not enabled")
@@ -503,7 +386,7 @@ func TestSSOService_HandleSAMLCallback_NotEnabled(t *testing.T) {
 }
 
 
-func TestSSOService_HandleSAMLCallback_NotImplemented(t *testing.T) {
+func TestSSOService_HandleSAMLCallback_InvalidResponse(t *testing.T) {
 	db := setupTestDB(t)
 	logger := setupTestLogger()
 	env := setupTestEnv()
@@ -516,10 +399,141 @@ func TestSSOService_HandleSAMLCallback_NotImplemented(t *testing.T) {
 	}
 	service.ssoConfig.Enabled = true
 	service.ssoConfig.SAML.Enabled = true
+	service.ssoConfig.SAML.CallbackURL = "http://localhost:3001/api/auth/saml/callback"
+	service.ssoConfig.SAML.Cert = newTestSAMLKeyPair(t, "idp").certPEM
 
-	_, err := service.HandleSAMLCallback(context.Background(), "saml-response", "")
+	_, _, err := service.HandleSAMLCallback(context.Background(), "saml-response", "id-123")
 	if err == nil {
-		t.Error("Expected error for not implemented SAML callback")
+		t.Error("Expected error for an invalid SAML response")
+	}
+}
+
+
+func TestSSOService_MapRole(t *testing.T) {
+	service := SSOService{logger: setupTestLogger()}
+	mapping := lib.RoleMapping{
+		Rules: []lib.RoleMappingRule{
+			{Value: "devs", Role: "editor"},
+			{Value: "platform-admins", Role: "admin"},
+			{Claim: "department", Value: "support", Role: "viewer"},
+			{Value: "broken", Role: "owner"},
+		},
+		DefaultRole: "viewer",
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   string
+	}{
+		{"single group", map[string]interface{}{"groups": []interface{}{"devs"}}, "editor"},
+		{"most privileged wins", map[string]interface{}{"groups": []interface{}{"devs", "platform-admins"}}, "admin"},
+		{"custom claim", map[string]interface{}{"department": "support"}, "viewer"},
+		{"invalid role ignored", map[string]interface{}{"groups": []interface{}{"broken"}}, "viewer"},
+		{"default", map[string]interface{}{"groups": []interface{}{"others"}}, "viewer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := service.mapRole(mapping, tt.claims, "groups")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if role != tt.want {
+				t.Errorf("Expected role '%s', got '%s'", tt.want, role)
+			}
+		})
+	}
+
+	mapping.DefaultRole = lib.RoleMappingDeny
+	if _, err := service.mapRole(mapping, map[string]interface{}{}, "groups"); !errors.Is(err, ErrSSOLoginDenied) {
+		t.Errorf("Expected ErrSSOLoginDenied, got %v", err)
+	}
+
+	role, err := service.mapRole(lib.RoleMapping{}, map[string]interface{}{"groups": "devs"}, "groups")
+	if err != nil || role != "" {
+		t.Errorf("Expected no role without a mapping, got '%s', %v", role, err)
+	}
+}
+
+func TestSSOService_HandleOIDCCallback_RoleMapping(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	provider.userInfo["groups"] = []string{"platform-admins"}
+	service := setupOIDCService(t, provider)
+	service.ssoConfig.OIDC.RoleMapping = lib.RoleMapping{
+		Rules: []lib.RoleMappingRule{
+			{Value: "platform-admins", Role: "admin"},
+			{Value: "devs", Role: "editor"},
+		},
+		DefaultRole: lib.RoleMappingDeny,
+	}
+	login := func() (*models.User, error) {
+		l, _ := startTestOIDCLogin(t, service, provider)
+		user, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", l.State, "", l)
+		return user, err
+	}
+
+	user, err := login()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.Role != models.RoleAdmin {
+		t.Errorf("Expected role '%s', got '%s'", models.RoleAdmin, user.Role)
+	}
+
+	provider.userInfo["groups"] = []string{"devs"}
+	user, err = login()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.Role != models.RoleEditor {
+		t.Errorf("Expected role to be re-evaluated to '%s', got '%s'", models.RoleEditor, user.Role)
+	}
+	stored, _ := service.userRepo.FindByUsername("testuser")
+	if stored == nil || stored.Role != models.RoleEditor {
+		t.Errorf("Expected stored role '%s', got %+v", models.RoleEditor, stored)
+	}
+
+	provider.userInfo["groups"] = []string{}
+	if _, err := login(); !errors.Is(err, ErrSSOLoginDenied) {
+		t.Errorf("Expected ErrSSOLoginDenied, got %v", err)
 	}
 }
 
+func TestSSOService_HandleOIDCCallback_IDTokenGroups(t *testing.T) {
+	provider := newTestOIDCProvider(t)
+	provider.claims = map[string]interface{}{"groups": []string{"platform-admins"}}
+	service := setupOIDCService(t, provider)
+	service.ssoConfig.OIDC.GroupsAttribute = "groups"
+	service.ssoConfig.OIDC.RoleMapping = lib.RoleMapping{
+		Rules: []lib.RoleMappingRule{
+			{Value: "platform-admins", Role: "admin"},
+			{Value: "devs", Role: "editor"},
+		},
+		DefaultRole: lib.RoleMappingDeny,
+	}
+	login := func() (*models.User, error) {
+		l, _ := startTestOIDCLogin(t, service, provider)
+		user, _, err := service.HandleOIDCCallback(context.Background(), "", "test-code", l.State, "", l)
+		return user, err
+	}
+
+	user, err := login()
+	if err != nil {
+		t.Fatalf("Expected groups in the ID token to be mapped, got %v", err)
+	}
+	if user.Role != models.RoleAdmin {
+		t.Errorf("Expected role '%s', got '%s'", models.RoleAdmin, user.Role)
+	}
+	if len(user.Groups) != 1 || user.Groups[0] != "platform-admins" {
+		t.Errorf("Expected the ID token's groups, got %v", user.Groups)
+	}
+
+	provider.userInfo["groups"] = []string{"devs"}
+	user, err = login()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if user.Role != models.RoleEditor {
+		t.Errorf("Expected userinfo's groups to win, got role '%s'", user.Role)
+	}
+}
@@ -101,7 +101,10 @@ export class AuthService {
     }
   }
 
-  getOIDCLoginURL() {
+  getOIDCLoginURL(provider) {
+    if (provider) {
+      return `${this.apiBaseUrl}/auth/oidc/${encodeURIComponent(provider)}`;
+    }
     return `${this.apiBaseUrl}/auth/oidc`;
   }
 
@@ -443,10 +443,11 @@ export const Login = () => {
                 <Box h="1px" flex={1} bg={getBorderColor(colorMode, 'gray')} />
               </HStack>
               <VStack spacing={3} align="stretch" w="100%">
-                {ssoStatus.oidc.enabled && (
+                {ssoStatus.oidc.enabled && (ssoStatus.oidc.providers?.length ? ssoStatus.oidc.providers : [{ name: '', displayName: 'OIDC' }]).map((provider) => (
                   <Button
+                    key={provider.name || 'oidc'}
                     as="a"
-                    href={authService.getOIDCLoginURL()}
+                    href={authService.getOIDCLoginURL(provider.name)}
                     w="100%"
                     py={6}
                     bg={getBackgroundColor(colorMode, 'primary')}
@@ -481,9 +482,9 @@ export const Login = () => {
                     >
                       <Text color="white" fontSize="xs" fontWeight="bold">O</Text>
                     </Box>
-                    Sign in with OIDC
+                    Sign in with {provider.displayName || provider.name}
                   </Button>
-                )}
+                ))}
                 {ssoStatus.saml.enabled && (
                   <Button
                     as="a"
@@ -332,8 +332,11 @@ export const AppProvider = ({ children }) => {
   };
 
   const handleLogout = async () => {
-    await authService.logout();
+    const result = await authService.logout();
     setUser(null);
+    if (result?.logoutUrl) {
+      window.location.assign(result.logoutUrl);
+    }
   };
 
   const handleColorModeChange = (mode) => {